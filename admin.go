@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+// loggerOptionsRequest 修改日志对象最低级别和输出格式的请求，为空的字段表示恢复默认值
+type loggerOptionsRequest struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+// initAdminHttpServer 注册管理接口
+//   - group: 管理接口的路由组
+//   - token: 管理接口的令牌，为空时所有的管理接口都返回 403
+//
+// 接口列表：
+//   - GET /loggers: 查看所有日志对象的最低级别、输出格式和丢弃的日志条数
+//   - PUT /loggers/<日志输出目录>: 修改日志对象的最低级别和输出格式，例如 /loggers/logs/restoration
+func initAdminHttpServer(group *gin.RouterGroup, token string) {
+	group.Use(adminAuthMiddleware(token))
+	group.GET("/loggers", listLoggers)
+	group.PUT("/loggers/*dir", updateLogger)
+}
+
+// adminAuthMiddleware 管理接口的认证中间件，没有配置令牌时拒绝所有请求，避免默认配置下暴露管理接口
+//   - token: 管理接口的令牌
+func adminAuthMiddleware(token string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if token == "" {
+			ctx.AbortWithStatusJSON(403, gin.H{
+				"message": "forbidden",
+				"error":   "admin token is not configured",
+			})
+			return
+		}
+
+		provided := ""
+		if authorization := ctx.GetHeader("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+			provided = strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			ctx.AbortWithStatusJSON(401, gin.H{
+				"message": "unauthorized",
+				"error":   "invalid admin token",
+			})
+		} else {
+			ctx.Next()
+		}
+	}
+}
+
+func listLoggers(ctx *gin.Context) {
+	loggers := log.GetLoggerOptions()
+	data := make([]gin.H, len(loggers))
+	for i, l := range loggers {
+		data[i] = gin.H{"dir": l.Dir, "level": l.Options.MinLevel, "format": l.Options.Format, "dropped": l.Dropped}
+	}
+	ctx.JSON(200, gin.H{
+		"message": "success",
+		"data":    data,
+	})
+}
+
+func updateLogger(ctx *gin.Context) {
+	dir := strings.TrimPrefix(ctx.Param("dir"), "/")
+	request := loggerOptionsRequest{}
+	if bindErr := ctx.ShouldBindJSON(&request); bindErr != nil {
+		ctx.JSON(400, gin.H{
+			"message": "invalid request",
+			"error":   bindErr.Error(),
+		})
+		return
+	}
+
+	options := log.Options{}
+	if request.Level != "" {
+		if level, parseErr := log.ParseLevel(request.Level); parseErr != nil {
+			ctx.JSON(400, gin.H{"message": "invalid request", "error": parseErr.Error()})
+			return
+		} else {
+			options.MinLevel = level
+		}
+	}
+	if request.Format != "" {
+		if format, parseErr := log.ParseFormat(request.Format); parseErr != nil {
+			ctx.JSON(400, gin.H{"message": "invalid request", "error": parseErr.Error()})
+			return
+		} else {
+			options.Format = format
+		}
+	}
+
+	if setErr := log.SetLoggerOptions(dir, options); setErr != nil {
+		ctx.JSON(404, gin.H{
+			"message": "logger not found",
+			"error":   setErr.Error(),
+		})
+	} else {
+		log.DefaultLogger().Log(log.DefaultField().WithCaller(log.Internal).WithLevel(log.Info).
+			WithMessage("logger options updated").WithExtra(gin.H{"dir": dir, "level": options.MinLevel, "format": options.Format}))
+		ctx.JSON(200, gin.H{
+			"message": "success",
+			"data":    gin.H{"dir": dir, "level": options.MinLevel, "format": options.Format},
+		})
+	}
+}
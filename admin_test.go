@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+// newAdminTestEngine 创建只注册了管理接口的路由
+//   - token: 管理接口的令牌
+func newAdminTestEngine(token string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	initAdminHttpServer(engine.Group("/admin"), token)
+	return engine
+}
+
+func serveAdmin(engine *gin.Engine, method, path, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminAuth(t *testing.T) {
+	cases := []struct {
+		name       string
+		configured string
+		token      string
+		status     int
+	}{
+		{name: "no admin token configured", token: "secret", status: 403},
+		{name: "missing token", configured: "secret", status: 401},
+		{name: "invalid token", configured: "secret", token: "guess", status: 401},
+		{name: "valid token", configured: "secret", token: "secret", status: 200},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if recorder := serveAdmin(newAdminTestEngine(c.configured), "GET", "/admin/loggers", c.token, ""); recorder.Code != c.status {
+				t.Errorf("GET /admin/loggers responded %d, want %d: %s", recorder.Code, c.status, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminLoggers(t *testing.T) {
+	dir := t.TempDir()
+	l := log.NewLogger(dir)
+	t.Cleanup(func() { _ = l.Close(context.Background()) })
+	engine := newAdminTestEngine("secret")
+
+	// 日志输出目录是绝对路径，路径参数去掉第一个斜杠后得到完整的目录
+	path := "/admin/loggers/" + dir
+	updated := log.Options{MinLevel: log.Warn, Format: log.Text}
+	cases := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+		want   log.Options
+	}{
+		{name: "panic level and logfmt", path: path, body: `{"level":"PANIC","format":"logfmt"}`, status: 200, want: log.Options{MinLevel: log.Panic, Format: log.Logfmt}},
+		{name: "warning alias and text", path: path, body: `{"level":"warning","format":"text"}`, status: 200, want: updated},
+		{name: "invalid level", path: path, body: `{"level":"fatal"}`, status: 400, want: updated},
+		{name: "invalid format", path: path, body: `{"format":"xml"}`, status: 400, want: updated},
+		{name: "invalid body", path: path, body: `{"level":`, status: 400, want: updated},
+		{name: "unknown logger", path: path + "/unknown", body: `{"level":"error"}`, status: 404, want: updated},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if recorder := serveAdmin(engine, "PUT", c.path, "secret", c.body); recorder.Code != c.status {
+				t.Fatalf("PUT %s responded %d, want %d: %s", c.path, recorder.Code, c.status, recorder.Body.String())
+			}
+			if options := l.Options(); options != c.want {
+				t.Errorf("logger options %+v, want %+v", options, c.want)
+			}
+		})
+	}
+
+	// 查看日志对象时返回修改后的配置，panic 级别不会被当作 info
+	if recorder := serveAdmin(engine, "PUT", path, "secret", `{"level":"panic"}`); recorder.Code != 200 {
+		t.Fatalf("PUT %s responded %d: %s", path, recorder.Code, recorder.Body.String())
+	}
+	var response struct {
+		Data []struct {
+			Dir    string `json:"dir"`
+			Level  string `json:"level"`
+			Format string `json:"format"`
+		} `json:"data"`
+	}
+	recorder := serveAdmin(engine, "GET", "/admin/loggers", "secret", "")
+	if decodeErr := json.Unmarshal(recorder.Body.Bytes(), &response); decodeErr != nil {
+		t.Fatalf("decode %s: %v", recorder.Body.String(), decodeErr)
+	}
+	found := false
+	for _, logger := range response.Data {
+		if logger.Dir == dir {
+			found = true
+			if logger.Level != "panic" || logger.Format != "" {
+				t.Errorf("listed level %q and format %q, want panic and the sink format", logger.Level, logger.Format)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("GET /admin/loggers did not list %s: %s", dir, recorder.Body.String())
+	}
+}
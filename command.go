@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"studio.sunist.work/platform/alioth-center/core/stellar"
+	"studio.sunist.work/platform/alioth-center/infrastructure/database"
+)
+
+// runCommand 执行子命令，如果参数不是子命令则返回 false，继续启动服务器
+//   - stellar migrate --from postgres --to redis [--overwrite]
+//   - stellar export --from postgres --output snapshot.json
+//   - stellar import --to redis --input snapshot.json [--overwrite]
+func runCommand(args []string) (handled bool) {
+	if len(args) < 2 || args[0] != "stellar" {
+		return false
+	}
+
+	var commandErr error
+	switch args[1] {
+	case "migrate":
+		commandErr = stellarMigrateCommand(args[2:])
+	case "export":
+		commandErr = stellarExportCommand(args[2:])
+	case "import":
+		commandErr = stellarImportCommand(args[2:])
+	default:
+		return false
+	}
+
+	if commandErr != nil {
+		_, _ = fmt.Fprintln(os.Stderr, commandErr)
+		os.Exit(1)
+	}
+	return true
+}
+
+func stellarMigrateCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("stellar migrate", flag.ContinueOnError)
+	from := flags.String("from", "postgres", "source stellar storage, postgres or redis")
+	to := flags.String("to", "redis", "target stellar storage, postgres or redis")
+	overwrite := flags.Bool("overwrite", false, "overwrite instances with the same name in target storage")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return parseErr
+	}
+
+	if prepareErr := stellar.PrepareStorage(*from, *to); prepareErr != nil {
+		return prepareErr
+	}
+	database.SyncDatabase()
+
+	result, migrateErr := stellar.Migrate(context.Background(), *from, *to, *overwrite)
+	if migrateErr != nil {
+		return migrateErr
+	}
+
+	fmt.Printf("migrated stellar registry from %s to %s: total %d, imported %d, skipped %d\n",
+		*from, *to, result.GetTotal(), result.GetImported(), result.GetSkipped())
+	return nil
+}
+
+func stellarExportCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("stellar export", flag.ContinueOnError)
+	from := flags.String("from", "postgres", "source stellar storage, postgres or redis")
+	output := flags.String("output", "", "snapshot file, print to stdout if empty")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return parseErr
+	}
+
+	if prepareErr := stellar.PrepareStorage(*from); prepareErr != nil {
+		return prepareErr
+	}
+	database.SyncDatabase()
+
+	snapshot, exportErr := stellar.Export(context.Background(), *from)
+	if exportErr != nil {
+		return exportErr
+	}
+
+	if *output == "" {
+		_, writeErr := os.Stdout.Write(snapshot)
+		return writeErr
+	} else if writeErr := os.WriteFile(*output, snapshot, 0o644); writeErr != nil {
+		return fmt.Errorf("failed to write snapshot file: %w", writeErr)
+	}
+	return nil
+}
+
+func stellarImportCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("stellar import", flag.ContinueOnError)
+	to := flags.String("to", "postgres", "target stellar storage, postgres or redis")
+	input := flags.String("input", "", "snapshot file")
+	overwrite := flags.Bool("overwrite", false, "overwrite instances with the same name in target storage")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return parseErr
+	}
+
+	snapshot, readErr := os.ReadFile(*input)
+	if readErr != nil {
+		return fmt.Errorf("failed to read snapshot file: %w", readErr)
+	}
+
+	if prepareErr := stellar.PrepareStorage(*to); prepareErr != nil {
+		return prepareErr
+	}
+	database.SyncDatabase()
+
+	result, importErr := stellar.Import(context.Background(), *to, snapshot, *overwrite)
+	if importErr != nil {
+		return importErr
+	}
+
+	fmt.Printf("imported stellar registry to %s: total %d, imported %d, skipped %d\n",
+		*to, result.GetTotal(), result.GetImported(), result.GetSkipped())
+	return nil
+}
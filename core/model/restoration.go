@@ -0,0 +1,93 @@
+package model
+
+import "time"
+
+type RestorationRecord struct {
+	ID             uint64    `gorm:"column:id;primaryKey;autoIncrement;not null"`
+	RecordID       string    `gorm:"column:record_id;type:varchar(64);index:idx_record_id"`
+	Service        string    `gorm:"column:service;type:varchar(255);not null;index:idx_service_called_at"`
+	Level          string    `gorm:"column:level;type:varchar(16);not null;index:idx_level"`
+	TraceID        string    `gorm:"column:trace_id;type:varchar(64);index:idx_trace_id"`
+	Message        string    `gorm:"column:message;type:text"`
+	CallerIP       string    `gorm:"column:caller_ip;type:varchar(64)"`
+	CallerType     string    `gorm:"column:caller_type;type:varchar(16)"`
+	CodePath       string    `gorm:"column:code_path;type:varchar(1024)"`
+	CalledFunction string    `gorm:"column:called_function;type:varchar(1024)"`
+	CalledAt       time.Time `gorm:"column:called_at;type:timestamptz;not null;index:idx_service_called_at;index:idx_called_at"`
+	InputFields    string    `gorm:"column:input_fields;type:text"`
+	PayloadFields  string    `gorm:"column:payload_fields;type:text"`
+	ExtraFields    string    `gorm:"column:extra_fields;type:text"`
+	Fields         string    `gorm:"column:fields;type:text"`
+	Error          string    `gorm:"column:error;type:text"`
+	DurationNs     int64     `gorm:"column:duration_ns;type:bigint"`
+	User           string    `gorm:"column:user_name;type:varchar(255);index:idx_user_name"`
+	Fingerprint    string    `gorm:"column:fingerprint;type:varchar(64);index:idx_fingerprint"`
+	CreatedAt      time.Time `gorm:"column:created_at;type:timestamptz;not null;autoCreateTime"`
+}
+
+func (RestorationRecord) TableName() string {
+	return "alioth_restoration_records"
+}
+
+type RestorationRecordDTO struct {
+	ID             uint64    `gorm:"column:id" json:"id"`
+	RecordID       string    `gorm:"column:record_id" json:"record_id"`
+	Service        string    `gorm:"column:service" json:"service"`
+	Level          string    `gorm:"column:level" json:"level"`
+	TraceID        string    `gorm:"column:trace_id" json:"trace_id"`
+	Message        string    `gorm:"column:message" json:"message"`
+	CallerIP       string    `gorm:"column:caller_ip" json:"caller_ip"`
+	CallerType     string    `gorm:"column:caller_type" json:"caller_type"`
+	CodePath       string    `gorm:"column:code_path" json:"code_path"`
+	CalledFunction string    `gorm:"column:called_function" json:"called_function"`
+	CalledAt       time.Time `gorm:"column:called_at" json:"called_at"`
+	InputFields    string    `gorm:"column:input_fields" json:"input_fields"`
+	PayloadFields  string    `gorm:"column:payload_fields" json:"payload_fields"`
+	ExtraFields    string    `gorm:"column:extra_fields" json:"extra_fields"`
+	Fields         string    `gorm:"column:fields" json:"fields"`
+	Error          string    `gorm:"column:error" json:"error"`
+	DurationNs     int64     `gorm:"column:duration_ns" json:"duration_ns"`
+	User           string    `gorm:"column:user_name" json:"user"`
+	Fingerprint    string    `gorm:"column:fingerprint" json:"fingerprint"`
+	CreatedAt      time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+type RestorationIssue struct {
+	ID             uint64     `gorm:"column:id;primaryKey;autoIncrement;not null"`
+	Fingerprint    string     `gorm:"column:fingerprint;type:varchar(64);not null;uniqueIndex:idx_issue_fingerprint"`
+	Service        string     `gorm:"column:service;type:varchar(255);not null;index:idx_issue_service"`
+	Level          string     `gorm:"column:level;type:varchar(16);not null"`
+	CodePath       string     `gorm:"column:code_path;type:varchar(1024)"`
+	CalledFunction string     `gorm:"column:called_function;type:varchar(1024)"`
+	Message        string     `gorm:"column:message;type:text"`
+	SampleMessage  string     `gorm:"column:sample_message;type:text"`
+	SampleTraceID  string     `gorm:"column:sample_trace_id;type:varchar(64)"`
+	Count          int64      `gorm:"column:count;type:bigint;not null"`
+	FirstSeen      time.Time  `gorm:"column:first_seen;type:timestamptz;not null"`
+	LastSeen       time.Time  `gorm:"column:last_seen;type:timestamptz;not null;index:idx_issue_last_seen"`
+	Status         string     `gorm:"column:status;type:varchar(16);not null;index:idx_issue_status"`
+	ResolvedAt     *time.Time `gorm:"column:resolved_at;type:timestamptz"`
+	CreatedAt      time.Time  `gorm:"column:created_at;type:timestamptz;not null;autoCreateTime"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at;type:timestamptz;not null;autoUpdateTime"`
+}
+
+func (RestorationIssue) TableName() string {
+	return "alioth_restoration_issues"
+}
+
+type RestorationIssueDTO struct {
+	ID             uint64     `gorm:"column:id" json:"id"`
+	Fingerprint    string     `gorm:"column:fingerprint" json:"fingerprint"`
+	Service        string     `gorm:"column:service" json:"service"`
+	Level          string     `gorm:"column:level" json:"level"`
+	CodePath       string     `gorm:"column:code_path" json:"code_path"`
+	CalledFunction string     `gorm:"column:called_function" json:"called_function"`
+	Message        string     `gorm:"column:message" json:"message"`
+	SampleMessage  string     `gorm:"column:sample_message" json:"sample_message"`
+	SampleTraceID  string     `gorm:"column:sample_trace_id" json:"sample_trace_id"`
+	Count          int64      `gorm:"column:count" json:"count"`
+	FirstSeen      time.Time  `gorm:"column:first_seen" json:"first_seen"`
+	LastSeen       time.Time  `gorm:"column:last_seen" json:"last_seen"`
+	Status         string     `gorm:"column:status" json:"status"`
+	ResolvedAt     *time.Time `gorm:"column:resolved_at" json:"resolved_at"`
+}
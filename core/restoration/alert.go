@@ -0,0 +1,351 @@
+package restoration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+// levelRank 获取日志级别的高低，无法识别的级别视为 debug
+//   - level: 日志级别，不区分大小写
+func levelRank(level string) int {
+	rank, _ := log.LevelRank(level)
+	return rank
+}
+
+// alertRule 编译后的告警规则
+type alertRule struct {
+	name      string
+	service   string
+	minLevel  int
+	pattern   *regexp.Regexp
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	notifiers []string
+}
+
+// newAlertRule 校验告警规则配置并填充默认值
+//   - conf: 告警规则配置
+//   - notifiers: 已经配置的通知渠道，用于校验规则引用的通知渠道是否存在
+func newAlertRule(conf config.RestorationAlertRuleConfig, notifiers map[string]notifier) (rule *alertRule, err error) {
+	rule = &alertRule{
+		name:      conf.Name,
+		service:   conf.Service,
+		minLevel:  -1,
+		threshold: conf.Threshold,
+		window:    time.Duration(conf.WindowSeconds) * time.Second,
+		cooldown:  time.Duration(conf.CooldownSeconds) * time.Second,
+		notifiers: conf.Notifiers,
+	}
+
+	if rule.name == "" {
+		return nil, fmt.Errorf("alert rule has no name")
+	}
+	if conf.Level != "" {
+		if rank, exist := log.LevelRank(conf.Level); !exist {
+			return nil, fmt.Errorf("alert rule %s has invalid level: %s", conf.Name, conf.Level)
+		} else {
+			rule.minLevel = rank
+		}
+	}
+	if conf.MessagePattern != "" {
+		if pattern, compileErr := regexp.Compile(conf.MessagePattern); compileErr != nil {
+			return nil, fmt.Errorf("alert rule %s has invalid message pattern: %w", conf.Name, compileErr)
+		} else {
+			rule.pattern = pattern
+		}
+	}
+	for _, name := range rule.notifiers {
+		if _, exist := notifiers[name]; !exist {
+			return nil, fmt.Errorf("alert rule %s uses undefined notifier: %s", conf.Name, name)
+		}
+	}
+
+	if rule.threshold <= 0 {
+		rule.threshold = 1
+	}
+	if rule.window <= 0 {
+		rule.window = time.Minute
+	}
+	if rule.cooldown <= 0 {
+		rule.cooldown = 5 * time.Minute
+	}
+	return rule, nil
+}
+
+func (r *alertRule) match(record *Fields) bool {
+	switch {
+	case r.service != "" && r.service != record.service:
+		return false
+	case r.minLevel >= 0 && levelRank(record.level) < r.minLevel:
+		return false
+	case r.pattern != nil && !r.pattern.MatchString(record.message):
+		return false
+	default:
+		return true
+	}
+}
+
+// alertState 一个规则在一个服务上的触发状态
+type alertState struct {
+	hits       []time.Time
+	firedAt    time.Time
+	suppressed int
+}
+
+// alertEngine 在接收日志时评估告警规则，通知在单独的协程中发送，不会阻塞日志的接收
+type alertEngine struct {
+	mtx       sync.Mutex
+	conf      config.RestorationAlertConfig
+	modTime   time.Time
+	rules     []*alertRule
+	notifiers map[string]notifier
+	states    map[string]*alertState
+	alerts    chan firedAlert
+	closed    bool
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+type firedAlert struct {
+	alert     Alert
+	notifiers []notifier
+}
+
+func newAlertEngine(conf config.RestorationAlertConfig) (engine *alertEngine, err error) {
+	engine = &alertEngine{
+		conf:      conf,
+		notifiers: map[string]notifier{},
+		states:    map[string]*alertState{},
+		alerts:    make(chan firedAlert, 256),
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	if _, reloadErr := engine.reload(); reloadErr != nil {
+		return nil, reloadErr
+	}
+
+	go engine.dispatch()
+	if conf.RulesFile != "" {
+		go engine.watch()
+	}
+	return engine, nil
+}
+
+// close 停止检查规则文件，不再接收新的告警，并等待已经触发的告警发送完成
+//   - ctx: 等待发送的上下文，结束时不再等待，剩余的告警会被丢弃
+func (e *alertEngine) close(ctx context.Context) error {
+	e.closeOnce.Do(func() {
+		close(e.stop)
+		e.mtx.Lock()
+		e.closed = true
+		close(e.alerts)
+		e.mtx.Unlock()
+	})
+
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reload 重新加载告警规则，配置了规则文件时从文件中加载，加载失败时保留原有的规则
+func (e *alertEngine) reload() (rules int, err error) {
+	rulesConf := e.conf
+	var modTime time.Time
+	if e.conf.RulesFile != "" {
+		rulesConf = config.RestorationAlertConfig{}
+		if info, statErr := os.Stat(e.conf.RulesFile); statErr != nil {
+			return 0, fmt.Errorf("stat alert rules file error: %w", statErr)
+		} else if content, readErr := os.ReadFile(e.conf.RulesFile); readErr != nil {
+			return 0, fmt.Errorf("read alert rules file error: %w", readErr)
+		} else if unmarshalErr := yaml.Unmarshal(content, &rulesConf); unmarshalErr != nil {
+			return 0, fmt.Errorf("unmarshal alert rules file error: %w", unmarshalErr)
+		} else {
+			modTime = info.ModTime()
+		}
+	}
+
+	notifiers := make(map[string]notifier, len(rulesConf.Notifiers))
+	for _, notifierConf := range rulesConf.Notifiers {
+		if n, newNotifierErr := newNotifier(notifierConf); newNotifierErr != nil {
+			return 0, newNotifierErr
+		} else {
+			notifiers[notifierConf.Name] = n
+		}
+	}
+
+	compiled := make([]*alertRule, 0, len(rulesConf.Rules))
+	for _, ruleConf := range rulesConf.Rules {
+		if rule, newRuleErr := newAlertRule(ruleConf, notifiers); newRuleErr != nil {
+			return 0, newRuleErr
+		} else {
+			compiled = append(compiled, rule)
+		}
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	// 保留仍然存在的规则的状态，避免重新加载后立即重复通知
+	names := make(map[string]bool, len(compiled))
+	for _, rule := range compiled {
+		names[rule.name] = true
+	}
+	for key := range e.states {
+		if !names[strings.SplitN(key, "\x00", 2)[0]] {
+			delete(e.states, key)
+		}
+	}
+
+	e.rules, e.notifiers, e.modTime = compiled, notifiers, modTime
+	return len(compiled), nil
+}
+
+// watch 定时检查规则文件是否变化，变化时重新加载
+func (e *alertEngine) watch() {
+	interval := time.Duration(e.conf.ReloadIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, statErr := os.Stat(e.conf.RulesFile)
+		if statErr != nil {
+			continue
+		}
+
+		e.mtx.Lock()
+		changed := !info.ModTime().Equal(e.modTime)
+		e.mtx.Unlock()
+		if !changed {
+			continue
+		}
+
+		if rules, reloadErr := e.reload(); reloadErr != nil {
+			log.DefaultLogger().Log(log.DefaultField().WithLevel(log.Error).WithCaller(log.Module).
+				WithMessage("failed to reload alert rules").WithExtra(reloadErr.Error()))
+		} else {
+			log.DefaultLogger().Log(log.DefaultField().WithLevel(log.Info).WithCaller(log.Module).
+				WithMessage("alert rules reloaded").WithExtra(rules))
+		}
+	}
+}
+
+// evaluate 使用新接收到的日志评估告警规则
+//   - records: 新接收到的日志
+func (e *alertEngine) evaluate(records []*Fields) {
+	now := time.Now()
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for _, rule := range e.rules {
+		for _, record := range records {
+			if !rule.match(record) {
+				continue
+			}
+
+			key := rule.name + "\x00" + record.service
+			state, exist := e.states[key]
+			if !exist {
+				state = &alertState{}
+				e.states[key] = state
+			}
+
+			// 移除时间窗口之外的记录
+			expired := 0
+			for expired < len(state.hits) && now.Sub(state.hits[expired]) > rule.window {
+				expired++
+			}
+			state.hits = append(state.hits[expired:], now)
+			if len(state.hits) < rule.threshold {
+				continue
+			}
+
+			if !state.firedAt.IsZero() && now.Sub(state.firedAt) < rule.cooldown {
+				state.suppressed++
+				continue
+			}
+
+			fired := firedAlert{
+				alert: Alert{
+					Rule:       rule.name,
+					Service:    record.service,
+					Count:      len(state.hits),
+					Window:     rule.window.String(),
+					Suppressed: state.suppressed,
+					Level:      record.level,
+					Message:    record.message,
+					TraceID:    record.traceID,
+					FiredAt:    now,
+				},
+				notifiers: make([]notifier, 0, len(rule.notifiers)),
+			}
+			for _, name := range rule.notifiers {
+				fired.notifiers = append(fired.notifiers, e.notifiers[name])
+			}
+			state.firedAt, state.suppressed, state.hits = now, 0, state.hits[:0]
+
+			if e.closed {
+				log.DefaultLogger().Log(log.DefaultField().WithLevel(log.Warn).WithCaller(log.Module).
+					WithMessage("alert dropped because alert engine is closed").WithExtra(fired.alert))
+				continue
+			}
+			select {
+			case e.alerts <- fired:
+			default:
+				log.DefaultLogger().Log(log.DefaultField().WithLevel(log.Warn).WithCaller(log.Module).
+					WithMessage("alert dropped because notify queue is full").WithExtra(fired.alert))
+			}
+		}
+	}
+}
+
+// dispatch 发送触发的告警，告警队列关闭并且发送完剩余的告警后退出
+func (e *alertEngine) dispatch() {
+	defer close(e.stopped)
+	for fired := range e.alerts {
+		for _, n := range fired.notifiers {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if notifyErr := n.notify(ctx, fired.alert); notifyErr != nil {
+				log.DefaultLogger().Log(log.DefaultField().WithLevel(log.Error).WithCaller(log.Module).
+					WithMessage("failed to send alert").WithExtraField("rule", fired.alert.Rule).WithExtra(notifyErr.Error()))
+			}
+			cancel()
+		}
+	}
+}
+
+// isAlertNotReloadable 判断错误是否是因为没有启用告警或者没有配置规则文件而无法重新加载
+//   - err: 重新加载告警规则时返回的错误
+func isAlertNotReloadable(err error) bool {
+	switch err.(type) {
+	case *errors.RestorationAlertDisabledError, *errors.RestorationAlertNotReloadableError:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,124 @@
+package restoration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+)
+
+// countingNotifier 记录收到的告警数量，每次通知前等待 delay
+type countingNotifier struct {
+	mtx    sync.Mutex
+	delay  time.Duration
+	alerts []Alert
+}
+
+func (n *countingNotifier) notify(_ context.Context, alert Alert) error {
+	time.Sleep(n.delay)
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func (n *countingNotifier) count() int {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return len(n.alerts)
+}
+
+func TestAlertEngineCloseDrains(t *testing.T) {
+	engine, newErr := newAlertEngine(config.RestorationAlertConfig{})
+	if newErr != nil {
+		t.Fatalf("new alert engine: %v", newErr)
+	}
+	counting := &countingNotifier{delay: 10 * time.Millisecond}
+	engine.notifiers = map[string]notifier{"counting": counting}
+	engine.rules = []*alertRule{{name: "any", minLevel: -1, threshold: 1, window: time.Minute, cooldown: time.Minute, notifiers: []string{"counting"}}}
+
+	// 每个服务单独计数，5 个服务各触发一次告警
+	records := make([]*Fields, 5)
+	for i := range records {
+		records[i] = &Fields{service: "service-" + strconv.Itoa(i), level: "error", message: "failed"}
+	}
+	engine.evaluate(records)
+
+	if closeErr := engine.close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+	if count := counting.count(); count != len(records) {
+		t.Errorf("sent %d alerts before close returned, want %d", count, len(records))
+	}
+
+	// 关闭之后触发的告警被丢弃，重复关闭不会 panic
+	engine.evaluate([]*Fields{{service: "late", level: "error", message: "failed"}})
+	if closeErr := engine.close(context.Background()); closeErr != nil {
+		t.Errorf("close again: %v", closeErr)
+	}
+	if count := counting.count(); count != len(records) {
+		t.Errorf("sent %d alerts after close, want %d", count, len(records))
+	}
+}
+
+func TestAlertEngineCloseTimeout(t *testing.T) {
+	engine, _ := newAlertEngine(config.RestorationAlertConfig{})
+	engine.notifiers = map[string]notifier{"slow": &countingNotifier{delay: time.Second}}
+	engine.rules = []*alertRule{{name: "any", minLevel: -1, threshold: 1, window: time.Minute, cooldown: time.Minute, notifiers: []string{"slow"}}}
+	engine.evaluate([]*Fields{{service: "a", level: "error"}, {service: "b", level: "error"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if closeErr := engine.close(ctx); closeErr == nil {
+		t.Error("close should return when the context is done")
+	}
+}
+
+func TestReloadAlertRules(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	cases := []struct {
+		name          string
+		conf          *config.RestorationAlertConfig
+		content       string
+		rules         int
+		notReloadable bool
+		failed        bool
+	}{
+		{name: "alert disabled", notReloadable: true},
+		{name: "no rules file", conf: &config.RestorationAlertConfig{}, notReloadable: true},
+		{name: "rules file", conf: &config.RestorationAlertConfig{RulesFile: rulesFile}, content: "rules:\n  - name: errors\n    level: error\n", rules: 1},
+		{name: "invalid rules file keeps rules", conf: &config.RestorationAlertConfig{RulesFile: rulesFile}, content: "rules:\n  - level: error\n", failed: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &Service{}
+			if c.conf != nil {
+				_ = os.WriteFile(rulesFile, []byte("rules: []\n"), 0o644)
+				engine, newErr := newAlertEngine(*c.conf)
+				if newErr != nil {
+					t.Fatalf("new alert engine: %v", newErr)
+				}
+				defer func() { _ = engine.close(context.Background()) }()
+				s.alert = engine
+				_ = os.WriteFile(rulesFile, []byte(c.content), 0o644)
+			}
+
+			rules, reloadErr := s.ReloadAlertRules()
+			if notReloadable := isAlertNotReloadable(reloadErr); notReloadable != c.notReloadable {
+				t.Errorf("not reloadable %v, want %v: %v", notReloadable, c.notReloadable, reloadErr)
+			}
+			if failed := reloadErr != nil && !c.notReloadable; failed != c.failed {
+				t.Errorf("failed %v, want %v: %v", failed, c.failed, reloadErr)
+			}
+			if rules != c.rules {
+				t.Errorf("reloaded %d rules, want %d", rules, c.rules)
+			}
+		})
+	}
+}
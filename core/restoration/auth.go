@@ -0,0 +1,178 @@
+package restoration
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/database"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+const (
+	appKeyHeader         = "X-Alioth-App-Key"
+	appSecretHeader      = "X-Alioth-App-Secret"
+	identityContextKey   = "restoration_identity"
+	applicationCacheTTL  = time.Minute
+	applicationCacheSize = 10000
+)
+
+// authenticator 校验外部接收日志的凭据，支持配置文件中的静态令牌和 starward 管理的应用密钥
+type authenticator struct {
+	anonymous    bool
+	tokens       []config.RestorationTokenConfig
+	applications bool
+	db           *gorm.DB
+
+	mtx   sync.Mutex
+	cache map[string]cachedIdentity
+}
+
+type cachedIdentity struct {
+	identity  string
+	expiredAt time.Time
+}
+
+// newAuthenticator 根据配置创建认证器，令牌或者 service 为空的静态令牌会被忽略，
+// 否则持有令牌的调用方可以使用任意的 caller_service 写入日志
+//   - conf: 认证配置
+func newAuthenticator(conf config.RestorationAuthConfig) *authenticator {
+	a := &authenticator{
+		anonymous:    conf.AllowAnonymous,
+		tokens:       make([]config.RestorationTokenConfig, 0, len(conf.Tokens)),
+		applications: conf.ApplicationKeys,
+		cache:        map[string]cachedIdentity{},
+	}
+	for i, token := range conf.Tokens {
+		if token.Token == "" || token.Service == "" {
+			log.DefaultLogger().Log(log.DefaultField().WithLevel(log.Error).WithCaller(log.Module).
+				WithMessage("restoration ingestion token ignored because token or service is empty").WithExtra(i))
+			continue
+		}
+		a.tokens = append(a.tokens, token)
+	}
+	if a.applications {
+		a.db = database.GetGorm()
+	}
+	return a
+}
+
+// authenticate 校验凭据并返回调用方的身份，身份会覆盖日志中的 caller_service，允许匿名时没有凭据返回空身份
+//   - ctx: 请求的上下文
+//   - token: Authorization 请求头中的 Bearer 令牌
+//   - appKey: starward 应用的 app_key
+//   - appSecret: starward 应用的 app_secret
+func (a *authenticator) authenticate(ctx context.Context, token, appKey, appSecret string) (identity string, err error) {
+	switch {
+	case token != "":
+		for _, configured := range a.tokens {
+			if subtle.ConstantTimeCompare([]byte(configured.Token), []byte(token)) == 1 {
+				return configured.Service, nil
+			}
+		}
+		return "", errors.NewRestorationUnauthenticatedError("invalid token")
+	case appKey != "" && a.applications:
+		return a.authenticateApplication(ctx, appKey, appSecret)
+	case a.anonymous:
+		return "", nil
+	default:
+		return "", errors.NewRestorationUnauthenticatedError("missing credentials")
+	}
+}
+
+// authenticateApplication 使用 starward 的应用密钥校验凭据，校验成功的结果会缓存一段时间，身份为应用名称
+//   - appKey: 应用的 app_key
+//   - appSecret: 应用的 app_secret
+func (a *authenticator) authenticateApplication(ctx context.Context, appKey, appSecret string) (identity string, err error) {
+	digest := sha256.Sum256([]byte(appKey + "\x00" + appSecret))
+	cacheKey := hex.EncodeToString(digest[:])
+	now := time.Now()
+
+	a.mtx.Lock()
+	if cached, exist := a.cache[cacheKey]; exist && now.Before(cached.expiredAt) {
+		a.mtx.Unlock()
+		return cached.identity, nil
+	}
+	a.mtx.Unlock()
+
+	var application model.ApplicationDTO
+	if queryErr := a.db.WithContext(ctx).Model(&model.Application{}).Where("app_key = ?", appKey).
+		Limit(1).Find(&application).Error; queryErr != nil {
+		return "", errors.NewExecuteSqlError("Find", queryErr)
+	} else if application.AppKey == "" || subtle.ConstantTimeCompare([]byte(application.AppSecret), []byte(appSecret)) != 1 {
+		return "", errors.NewRestorationUnauthenticatedError("invalid application key")
+	} else if !application.Enable {
+		return "", errors.NewRestorationUnauthenticatedError("application is disabled")
+	} else if application.Name == "" {
+		return "", errors.NewRestorationUnauthenticatedError("application has no name")
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if len(a.cache) >= applicationCacheSize {
+		for key, cached := range a.cache {
+			if now.After(cached.expiredAt) {
+				delete(a.cache, key)
+			}
+		}
+		if len(a.cache) >= applicationCacheSize {
+			a.cache = map[string]cachedIdentity{}
+		}
+	}
+	a.cache[cacheKey] = cachedIdentity{identity: application.Name, expiredAt: now.Add(applicationCacheTTL)}
+	return application.Name, nil
+}
+
+// authenticateRpc 校验 grpc 请求 metadata 中的凭据，凭据的名称与 http 请求头相同
+//   - ctx: grpc 请求的上下文
+func (a *authenticator) authenticateRpc(ctx context.Context) (identity string, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	token := ""
+	if authorization := first("authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	}
+	return a.authenticate(ctx, token, first(appKeyHeader), first(appSecretHeader))
+}
+
+// middleware 外部接收日志接口的认证中间件，校验成功后将身份写入 gin 上下文
+func (a *authenticator) middleware(ctx *gin.Context) {
+	token := ""
+	if authorization := ctx.GetHeader("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	}
+
+	if identity, authErr := a.authenticate(ctx, token, ctx.GetHeader(appKeyHeader), ctx.GetHeader(appSecretHeader)); authErr != nil {
+		if _, unauthenticated := authErr.(*errors.RestorationUnauthenticatedError); unauthenticated {
+			ctx.AbortWithStatusJSON(401, gin.H{
+				"message": "unauthorized",
+				"error":   authErr.Error(),
+			})
+		} else {
+			ctx.AbortWithStatusJSON(500, gin.H{
+				"message": "internal error",
+				"error":   authErr.Error(),
+			})
+		}
+	} else {
+		ctx.Set(identityContextKey, identity)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,106 @@
+package restoration
+
+import (
+	"context"
+	"testing"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc/metadata"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+func TestAuthenticateToken(t *testing.T) {
+	conf := config.RestorationAuthConfig{
+		Tokens: []config.RestorationTokenConfig{
+			{Token: "valid", Service: "http-example"},
+			{Token: "no-service"},
+			{Service: "no-token"},
+		},
+	}
+	cases := []struct {
+		name      string
+		anonymous bool
+		token     string
+		identity  string
+		failed    bool
+	}{
+		{name: "valid token", token: "valid", identity: "http-example"},
+		{name: "token without service is ignored", token: "no-service", failed: true},
+		{name: "unknown token", token: "unknown", failed: true},
+		{name: "missing credentials", failed: true},
+		{name: "anonymous", anonymous: true},
+		{name: "invalid token with anonymous", anonymous: true, token: "no-service", failed: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conf.AllowAnonymous = c.anonymous
+			a := newAuthenticator(conf)
+			identity, authErr := a.authenticate(context.Background(), c.token, "", "")
+			if failed := authErr != nil; failed != c.failed {
+				t.Errorf("failed %v, want %v: %v", failed, c.failed, authErr)
+			}
+			if identity != c.identity {
+				t.Errorf("identity %q, want %q", identity, c.identity)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRpc(t *testing.T) {
+	a := newAuthenticator(config.RestorationAuthConfig{
+		AllowAnonymous: true,
+		Tokens:         []config.RestorationTokenConfig{{Token: "valid", Service: "otlp-example"}},
+	})
+	cases := []struct {
+		name      string
+		metadata  metadata.MD
+		identity  string
+		anonymous bool
+		failed    bool
+	}{
+		{name: "bearer token", metadata: metadata.Pairs("authorization", "Bearer valid"), identity: "otlp-example"},
+		{name: "invalid token", metadata: metadata.Pairs("authorization", "Bearer invalid"), failed: true},
+		{name: "anonymous", metadata: metadata.MD{}, anonymous: true},
+		{name: "no metadata", anonymous: true},
+	}
+
+	request := &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			{Key: "service.name", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "claimed"}}},
+		}},
+		ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{{}}}},
+	}}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			if c.metadata != nil {
+				ctx = metadata.NewIncomingContext(ctx, c.metadata)
+			}
+			identity, authErr := a.authenticateRpc(ctx)
+			if failed := authErr != nil; failed != c.failed {
+				t.Fatalf("failed %v, want %v: %v", failed, c.failed, authErr)
+			} else if c.failed {
+				return
+			} else if identity != c.identity {
+				t.Errorf("identity %q, want %q", identity, c.identity)
+			}
+
+			// 认证后的身份覆盖 service.name，匿名时保留声明的名称并标记为匿名
+			for _, record := range NewRestorationFieldsFromOtlp(ctx, log.Service, request) {
+				record.withIdentity(identity)
+				if want := map[bool]string{true: "claimed", false: c.identity}[identity == ""]; record.service != want {
+					t.Errorf("service %q, want %q", record.service, want)
+				}
+				if record.anonymous != c.anonymous {
+					t.Errorf("anonymous %v, want %v", record.anonymous, c.anonymous)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package restoration
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+// OverflowPolicy 缓冲区已满时的处理策略
+type OverflowPolicy int
+
+const (
+	// DropOldest 丢弃缓冲区中最早的日志，为新日志腾出空间
+	DropOldest OverflowPolicy = iota
+	// DropNewest 丢弃新产生的日志
+	DropNewest
+	// Block 阻塞调用方，直到缓冲区有空间
+	Block
+)
+
+// sender 批量发送日志的传输层
+type sender interface {
+	send(ctx context.Context, records []*alioth.RestorationCollectionRequest) (err error)
+}
+
+// closableSender 需要在缓冲区关闭时释放连接的传输层
+type closableSender interface {
+	sender
+	close() (err error)
+}
+
+// droppingSender 自身也会丢弃日志的传输层，例如暂存区超过大小上限时删除最早的分段
+type droppingSender interface {
+	sender
+	dropped() uint64
+}
+
+// buffer 有界的日志缓冲区，按照批次大小或者时间间隔批量发送日志
+type buffer struct {
+	sender        sender
+	size          int
+	batchSize     int
+	flushInterval time.Duration
+	overflow      OverflowPolicy
+	maxRetries    int
+
+	mtx      sync.Mutex
+	notFull  *sync.Cond
+	records  []*alioth.RestorationCollectionRequest
+	retry    []*alioth.RestorationCollectionRequest
+	retried  int
+	closed   bool
+	sendMtx  sync.Mutex
+	flushing chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+	dropped  atomic.Uint64
+}
+
+func newBuffer(sender sender, options CollectorOptions) *buffer {
+	b := &buffer{
+		sender:        sender,
+		size:          options.BufferSize,
+		batchSize:     options.BatchSize,
+		flushInterval: options.FlushInterval,
+		overflow:      options.Overflow,
+		maxRetries:    options.MaxRetries,
+		records:       make([]*alioth.RestorationCollectionRequest, 0, options.BufferSize),
+		flushing:      make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	b.notFull = sync.NewCond(&b.mtx)
+
+	go b.serve()
+	return b
+}
+
+// enqueue 将日志放入缓冲区，缓冲区已满时按照 overflow 策略处理，关闭后的日志会被丢弃
+func (b *buffer) enqueue(record *alioth.RestorationCollectionRequest) {
+	b.mtx.Lock()
+	for !b.closed && len(b.records) >= b.size {
+		switch b.overflow {
+		case DropNewest:
+			b.mtx.Unlock()
+			b.dropped.Add(1)
+			return
+		case Block:
+			b.notFull.Wait()
+		default:
+			b.discard(1)
+			b.dropped.Add(1)
+		}
+	}
+	if b.closed {
+		b.mtx.Unlock()
+		b.dropped.Add(1)
+		return
+	}
+	b.records = append(b.records, record)
+	full := len(b.records) >= b.batchSize
+	b.mtx.Unlock()
+
+	// 达到批次大小时通知发送协程
+	if full {
+		select {
+		case b.flushing <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// discard 丢弃缓冲区头部的 n 条日志，剩余的日志复制到新的切片中，
+// 避免底层数组继续引用已经丢弃的日志，也避免切片的容量越来越小，需要持有 mtx
+//   - n: 丢弃的日志数量
+func (b *buffer) discard(n int) {
+	records := make([]*alioth.RestorationCollectionRequest, len(b.records)-n, b.size)
+	copy(records, b.records[n:])
+	b.records = records
+}
+
+// take 取出需要重新发送的批次，没有时从缓冲区头部取出最多一个批次的日志
+func (b *buffer) take() (batch []*alioth.RestorationCollectionRequest, retried int) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.retry != nil {
+		batch, retried = b.retry, b.retried
+		b.retry, b.retried = nil, 0
+		return batch, retried
+	}
+
+	n := len(b.records)
+	if n > b.batchSize {
+		n = b.batchSize
+	}
+	if n == 0 {
+		return nil, 0
+	}
+
+	batch = make([]*alioth.RestorationCollectionRequest, n)
+	copy(batch, b.records[:n])
+	b.discard(n)
+	b.notFull.Broadcast()
+	return batch, 0
+}
+
+// requeue 将发送失败的批次放回缓冲区，下一次发送时最先发送，重新发送的次数达到上限时丢弃这个批次
+//   - batch: 发送失败的批次
+//   - retried: 这个批次已经重新发送的次数
+func (b *buffer) requeue(batch []*alioth.RestorationCollectionRequest, retried int) (requeued bool) {
+	if retried >= b.maxRetries {
+		b.dropped.Add(uint64(len(batch)))
+		return false
+	}
+
+	b.mtx.Lock()
+	b.retry, b.retried = batch, retried+1
+	b.mtx.Unlock()
+	return true
+}
+
+// flush 发送缓冲区中的日志，直到缓冲区为空或者 ctx 结束，批次发送失败并且放回缓冲区时停止发送，等待下一次发送时重试
+func (b *buffer) flush(ctx context.Context) (err error) {
+	b.sendMtx.Lock()
+	defer b.sendMtx.Unlock()
+
+	for batch, retried := b.take(); batch != nil; batch, retried = b.take() {
+		if sendErr := b.sender.send(ctx, batch); sendErr != nil {
+			err = sendErr
+			if b.requeue(batch, retried) {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// serve 定时或者在达到批次大小时发送日志，关闭时取消正在进行的发送，例如等待重连的发送，剩余的日志由 Close 发送
+func (b *buffer) serve() {
+	defer close(b.stopped)
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-b.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = b.flush(ctx)
+		case <-b.flushing:
+			_ = b.flush(ctx)
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Flush 立即发送缓冲区中的所有日志
+func (b *buffer) Flush(ctx context.Context) (err error) {
+	return b.flush(ctx)
+}
+
+// Close 停止接收日志，并发送缓冲区中剩余的日志，重复调用时只会发送剩余的日志
+func (b *buffer) Close(ctx context.Context) (err error) {
+	b.mtx.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.stop)
+	}
+	b.notFull.Broadcast()
+	b.mtx.Unlock()
+
+	select {
+	case <-b.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// 关闭时立即重试发送失败的批次，直到发送成功、重试次数用完或者 ctx 结束，剩余的日志计入丢弃的数量
+	err = b.flush(ctx)
+	for err != nil && ctx.Err() == nil && b.pending() {
+		err = b.flush(ctx)
+	}
+	b.mtx.Lock()
+	b.dropped.Add(uint64(len(b.retry) + len(b.records)))
+	b.retry, b.records = nil, nil
+	b.mtx.Unlock()
+
+	if closable, ok := b.sender.(closableSender); ok {
+		b.sendMtx.Lock()
+		if closeErr := closable.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		b.sendMtx.Unlock()
+	}
+	return err
+}
+
+// pending 是否有等待重新发送的批次
+func (b *buffer) pending() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.retry != nil
+}
+
+// Dropped 获取因为缓冲区已满、已关闭、重新发送的次数用完或者暂存区已满而丢弃的日志数量
+func (b *buffer) Dropped() uint64 {
+	if dropping, ok := b.sender.(droppingSender); ok {
+		return b.dropped.Load() + dropping.dropped()
+	}
+	return b.dropped.Load()
+}
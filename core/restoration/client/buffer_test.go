@@ -0,0 +1,205 @@
+package restoration
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+// recordingSender 记录发送的批次，前 failures 次发送返回错误
+type recordingSender struct {
+	mtx      sync.Mutex
+	failures int
+	attempts int
+	batches  [][]string
+}
+
+func (s *recordingSender) send(_ context.Context, records []*alioth.RestorationCollectionRequest) (err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.attempts++
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("collector unavailable")
+	}
+	messages := make([]string, len(records))
+	for i, record := range records {
+		messages[i] = record.GetMessage()
+	}
+	s.batches = append(s.batches, messages)
+	return nil
+}
+
+func (s *recordingSender) sent() (messages []string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, batch := range s.batches {
+		messages = append(messages, batch...)
+	}
+	return messages
+}
+
+// newTestBuffer 创建不会自动发送的缓冲区，只有调用 Flush 或者 Close 时才会发送
+func newTestBuffer(s sender, size, batchSize, maxRetries int, overflow OverflowPolicy) *buffer {
+	return newBuffer(s, CollectorOptions{
+		BufferSize:    size,
+		BatchSize:     batchSize,
+		FlushInterval: time.Hour,
+		Overflow:      overflow,
+		MaxRetries:    maxRetries,
+	})
+}
+
+func enqueueMessages(b *buffer, count int) {
+	for i := 0; i < count; i++ {
+		b.enqueue(&alioth.RestorationCollectionRequest{Message: strconv.Itoa(i)})
+	}
+}
+
+func equalMessages(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBufferOverflow(t *testing.T) {
+	cases := []struct {
+		name     string
+		overflow OverflowPolicy
+		enqueue  int
+		sent     []string
+		dropped  uint64
+	}{
+		{name: "not full", overflow: DropOldest, enqueue: 2, sent: []string{"0", "1"}},
+		{name: "drop oldest", overflow: DropOldest, enqueue: 5, sent: []string{"2", "3", "4"}, dropped: 2},
+		{name: "drop newest", overflow: DropNewest, enqueue: 5, sent: []string{"0", "1", "2"}, dropped: 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &recordingSender{}
+			// 批次大小大于缓冲区容量，避免入队时触发发送
+			b := newTestBuffer(s, 3, 100, 0, c.overflow)
+			enqueueMessages(b, c.enqueue)
+			if closeErr := b.Close(context.Background()); closeErr != nil {
+				t.Fatalf("close buffer: %v", closeErr)
+			}
+			if sent := s.sent(); !equalMessages(sent, c.sent) {
+				t.Errorf("sent %v, want %v", sent, c.sent)
+			}
+			if dropped := b.Dropped(); dropped != c.dropped {
+				t.Errorf("dropped %d, want %d", dropped, c.dropped)
+			}
+		})
+	}
+}
+
+func TestBufferBlockOverflow(t *testing.T) {
+	s := &recordingSender{}
+	b := newTestBuffer(s, 2, 100, 0, Block)
+	enqueueMessages(b, 2)
+
+	enqueued := make(chan struct{})
+	go func() {
+		b.enqueue(&alioth.RestorationCollectionRequest{Message: "2"})
+		close(enqueued)
+	}()
+	select {
+	case <-enqueued:
+		t.Fatal("enqueue should block when the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if flushErr := b.Flush(context.Background()); flushErr != nil {
+		t.Fatalf("flush buffer: %v", flushErr)
+	}
+	select {
+	case <-enqueued:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue should continue after flush")
+	}
+	_ = b.Close(context.Background())
+	if sent := s.sent(); !equalMessages(sent, []string{"0", "1", "2"}) {
+		t.Errorf("sent %v, want [0 1 2]", sent)
+	}
+}
+
+func TestBufferRequeue(t *testing.T) {
+	cases := []struct {
+		name       string
+		maxRetries int
+		failures   int
+		sent       []string
+		dropped    uint64
+	}{
+		{name: "no failure", maxRetries: 2, sent: []string{"0", "1", "2", "3"}},
+		{name: "retry succeeds", maxRetries: 2, failures: 2, sent: []string{"0", "1", "2", "3"}},
+		{name: "retries exhausted", maxRetries: 1, failures: 2, sent: []string{"2", "3"}, dropped: 2},
+		{name: "retry disabled", maxRetries: 0, failures: 1, sent: []string{"2", "3"}, dropped: 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &recordingSender{failures: c.failures}
+			b := newTestBuffer(s, 8, 2, c.maxRetries, DropOldest)
+			enqueueMessages(b, 4)
+			for i := 0; i <= c.failures; i++ {
+				_ = b.Flush(context.Background())
+			}
+			_ = b.Close(context.Background())
+
+			if sent := s.sent(); !equalMessages(sent, c.sent) {
+				t.Errorf("sent %v, want %v", sent, c.sent)
+			}
+			if dropped := b.Dropped(); dropped != c.dropped {
+				t.Errorf("dropped %d, want %d", dropped, c.dropped)
+			}
+		})
+	}
+}
+
+func TestBufferCloseDropsUnsent(t *testing.T) {
+	s := &recordingSender{failures: 100}
+	b := newTestBuffer(s, 8, 2, 1, DropOldest)
+	enqueueMessages(b, 4)
+
+	if closeErr := b.Close(context.Background()); closeErr == nil {
+		t.Error("close should report the send error")
+	}
+	if dropped := b.Dropped(); dropped != 4 {
+		t.Errorf("dropped %d, want 4", dropped)
+	}
+	b.enqueue(&alioth.RestorationCollectionRequest{Message: "closed"})
+	if dropped := b.Dropped(); dropped != 5 {
+		t.Errorf("dropped %d after close, want 5", dropped)
+	}
+}
+
+func TestBufferDiscardCopies(t *testing.T) {
+	b := newTestBuffer(&recordingSender{}, 4, 100, 0, DropOldest)
+	enqueueMessages(b, 4)
+
+	b.mtx.Lock()
+	old := b.records
+	b.discard(1)
+	if len(b.records) != 3 || cap(b.records) != 4 {
+		t.Errorf("len %d cap %d, want len 3 cap 4", len(b.records), cap(b.records))
+	}
+	if &old[1] == &b.records[0] {
+		t.Error("discard should copy the remaining records into a new slice")
+	}
+	b.mtx.Unlock()
+	_ = b.Close(context.Background())
+}
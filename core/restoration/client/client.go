@@ -23,23 +23,41 @@ type client struct {
 	failed     int
 	maxFailed  int
 	failedCall func(err error)
+	cc         *grpc.ClientConn
 	conn       alioth.AliothRestorationClient
 }
 
-func (c *client) execute(request *alioth.RestorationCollectionRequest) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(initialize.GlobalConfig().Grpc.TimeoutSeconds)*time.Second)
-	_, e := c.conn.RestorationCollection(ctx, request)
+func (c *client) send(ctx context.Context, records []*alioth.RestorationCollectionRequest) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(initialize.GlobalConfig().Grpc.TimeoutSeconds)*time.Second)
+	_, e := c.conn.RestorationBatchCollection(ctx, &alioth.RestorationBatchCollectionRequest{Records: records})
 	cancel()
 
 	if e != nil {
-		c.failed++
-		if c.failed >= c.maxFailed && c.failedCall != nil {
-			c.failedCall(e)
-			c.failed = 0
-		}
+		c.fail(e)
+		return fmt.Errorf("failed to send batch collection: %w", e)
+	}
+	return nil
+}
+
+// fail 记录一次发送失败，失败次数达到 maxFailed 时调用 failedCall
+func (c *client) fail(err error) {
+	c.failed++
+	if c.failed >= c.maxFailed && c.failedCall != nil {
+		c.failedCall(err)
+		c.failed = 0
 	}
 }
 
+// close 关闭 grpc 连接，缓冲区发送完剩余的日志之后调用，可以重复调用
+func (c *client) close() (err error) {
+	if c.cc == nil {
+		return nil
+	}
+	closeErr := c.cc.Close()
+	c.cc = nil
+	return closeErr
+}
+
 // newRestorationClient 创建一个使用 grpc 协议的 restoration 客户端
 //   - serverAddr: restoration 服务的地址，需要包含IP和端口，如 10.0.0.1:50051
 //
@@ -49,7 +67,7 @@ func newRestorationClient(serverAddr string) (c *client, err error) {
 		return nil, fmt.Errorf("failed to dial grpc client: %w", dialErr)
 	} else {
 		clt := alioth.NewAliothRestorationClient(conn)
-		return &client{conn: clt, maxFailed: 1 << 31, failedCall: func(error) {}}, nil
+		return &client{cc: conn, conn: clt, maxFailed: 1 << 31, failedCall: func(error) {}}, nil
 	}
 }
 
@@ -75,19 +93,52 @@ func newClientWithFailedCallback(serviceAddr string, maxFailed int, callback fun
 	}
 }
 
+// Credentials 外部接收日志使用的凭据，Token 和应用密钥二选一，服务端会使用凭据对应的身份作为 caller_service
+type Credentials struct {
+	// Token 配置文件中的静态令牌，使用 Authorization: Bearer 请求头发送
+	Token string
+	// AppKey starward 管理的应用的 app_key
+	AppKey string
+	// AppSecret starward 管理的应用的 app_secret
+	AppSecret string
+}
+
+func (c Credentials) apply(request *http.Request) {
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.AppKey != "" {
+		request.Header.Set("X-Alioth-App-Key", c.AppKey)
+		request.Header.Set("X-Alioth-App-Secret", c.AppSecret)
+	}
+}
+
 // externalClient restoration 客户端，使用 http 协议
 type externalClient struct {
-	endpoint string
+	endpoint         string
+	samplingEndpoint string
+	credentials      Credentials
+	failedCall       func(err error)
+}
+
+func (c *externalClient) send(ctx context.Context, records []*alioth.RestorationCollectionRequest) (err error) {
+	if sendErr := c.execute(ctx, &alioth.RestorationBatchCollectionRequest{Records: records}); sendErr != nil {
+		if c.failedCall != nil {
+			c.failedCall(sendErr)
+		}
+		return sendErr
+	}
+	return nil
 }
 
-func (c externalClient) execute(request *alioth.RestorationCollectionRequest) (err error) {
+func (c *externalClient) execute(ctx context.Context, request *alioth.RestorationBatchCollectionRequest) (err error) {
 	// 序列化请求
 	payload, marshalErr := json.Marshal(request)
 	if marshalErr != nil {
 		return fmt.Errorf("failed to marshal request: %w", marshalErr)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(initialize.GlobalConfig().Http.TimeoutSeconds)*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(initialize.GlobalConfig().Http.TimeoutSeconds)*time.Second)
 	defer cancel()
 
 	// 构建http请求
@@ -95,6 +146,8 @@ func (c externalClient) execute(request *alioth.RestorationCollectionRequest) (e
 	if buildHttpRequestErr != nil {
 		return fmt.Errorf("failed to build http request: %w", buildHttpRequestErr)
 	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	c.credentials.apply(httpRequest)
 
 	// 发送http请求
 	httpResponse, sendHttpRequestErr := http.DefaultClient.Do(httpRequest)
@@ -103,6 +156,7 @@ func (c externalClient) execute(request *alioth.RestorationCollectionRequest) (e
 	}
 
 	// 检查http响应
+	_ = httpResponse.Body.Close()
 	if httpResponse.StatusCode != http.StatusOK {
 		return fmt.Errorf("failed to send http request: %w", errors.NewRestorationExternalResponseError(httpResponse.StatusCode))
 	}
@@ -119,13 +173,17 @@ func newExternalClient(endpoint string) (client *externalClient, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(initialize.GlobalConfig().Http.TimeoutSeconds)*time.Second)
 	defer cancel()
 	path, joinPathErr := url.JoinPath(endpoint, "/restoration/ping")
-	collection, collectionPathErr := url.JoinPath(endpoint, "/restoration/collection")
+	collection, collectionPathErr := url.JoinPath(endpoint, "/restoration/batch_collection")
 	if joinPathErr != nil {
 		return nil, fmt.Errorf("failed to find endpoint: %w", joinPathErr)
 	}
 	if collectionPathErr != nil {
 		return nil, fmt.Errorf("failed to find endpoint: %w", collectionPathErr)
 	}
+	sampling, samplingPathErr := url.JoinPath(endpoint, "/restoration/sampling")
+	if samplingPathErr != nil {
+		return nil, fmt.Errorf("failed to find endpoint: %w", samplingPathErr)
+	}
 
 	httpRequest, buildHttpRequestErr := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
 	if buildHttpRequestErr != nil {
@@ -141,5 +199,5 @@ func newExternalClient(endpoint string) (client *externalClient, err error) {
 		return nil, fmt.Errorf("failed to send http request: %w", errors.NewRestorationExternalResponseError(httpResponse.StatusCode))
 	}
 
-	return &externalClient{endpoint: collection}, nil
+	return &externalClient{endpoint: collection, samplingEndpoint: sampling, failedCall: func(error) {}}, nil
 }
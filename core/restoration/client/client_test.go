@@ -0,0 +1,81 @@
+package restoration
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+// testServer 记录收到的日志，流式接口使用 ack 生成每个批次的确认，ack 为 nil 时按照序号确认
+type testServer struct {
+	alioth.UnimplementedAliothRestorationServer
+	mtx      sync.Mutex
+	ack      func(request *alioth.RestorationStreamRequest) *alioth.RestorationStreamResponse
+	messages []string
+	streams  int
+}
+
+func (s *testServer) RestorationBatchCollection(_ context.Context, request *alioth.RestorationBatchCollectionRequest) (*alioth.RestorationBatchCollectionResponse, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, record := range request.GetRecords() {
+		s.messages = append(s.messages, record.GetMessage())
+	}
+	return &alioth.RestorationBatchCollectionResponse{Accepted: int32(len(request.GetRecords()))}, nil
+}
+
+func (s *testServer) received() (messages []string, streams int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]string{}, s.messages...), s.streams
+}
+
+// startTestServer 在本地端口上启动 restoration 服务，测试结束时停止
+func startTestServer(t *testing.T, server *testServer) (address string) {
+	t.Helper()
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("listen: %v", listenErr)
+	}
+	grpcServer := grpc.NewServer()
+	alioth.RegisterAliothRestorationServer(grpcServer, server)
+	go func() { _ = grpcServer.Serve(listener) }()
+	t.Cleanup(grpcServer.Stop)
+	return listener.Addr().String()
+}
+
+func TestCollectorClosesConnection(t *testing.T) {
+	server := &testServer{}
+	options := DefaultCollectorOptions()
+	options.FlushInterval = time.Hour
+	options.SamplingPollInterval = -1
+	c, newErr := NewCollectorWithOptions("batch-test", startTestServer(t, server), options)
+	if newErr != nil {
+		t.Fatalf("new collector: %v", newErr)
+	}
+	cc := c.(*collector).buffer.sender.(*client).cc
+
+	c.Info(NewCollection(context.Background(), "before close"))
+	if closeErr := c.Close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+
+	// 关闭时先发送剩余的日志，再关闭 grpc 连接，重复关闭不会返回错误
+	if messages, _ := server.received(); !reflect.DeepEqual(messages, []string{"before close"}) {
+		t.Errorf("server received %v, want the buffered record", messages)
+	}
+	if state := cc.GetState(); state != connectivity.Shutdown {
+		t.Errorf("connection is %v after close, want %v", state, connectivity.Shutdown)
+	}
+	if closeErr := c.Close(context.Background()); closeErr != nil {
+		t.Errorf("closing twice returned %v", closeErr)
+	}
+}
@@ -1,10 +1,16 @@
 package restoration
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
 
 	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
 	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils/redact"
 
 	"studio.sunist.work/platform/alioth-center/proto/alioth"
 )
@@ -21,6 +27,8 @@ func SetDefaultServiceName(name string) {
 }
 
 // Collector 分布式日志收集器，向 alioth-restoration 服务发送日志
+//
+// 日志会先进入有界缓冲区，按照批次大小或者时间间隔批量发送，退出前需要调用 Close 发送剩余的日志
 type Collector interface {
 	// Debug 记录一个 debug 级别的日志
 	//   - fields: 日志字段
@@ -37,11 +45,150 @@ type Collector interface {
 	// Error 记录一个 error 级别的日志
 	//   - fields: 日志字段
 	Error(fields Fields)
+
+	// Flush 立即发送缓冲区中的所有日志，直到缓冲区为空或者 ctx 结束
+	//   - ctx: 控制发送的超时时间
+	Flush(ctx context.Context) (err error)
+
+	// Close 停止接收日志，并发送缓冲区中剩余的日志，发送完成后关闭与服务端的连接
+	//   - ctx: 控制发送的超时时间
+	Close(ctx context.Context) (err error)
+}
+
+// CollectorOptions 日志收集器的配置，为零值的字段会使用默认值
+type CollectorOptions struct {
+	// BufferSize 缓冲区容量，默认为 1024
+	BufferSize int
+	// BatchSize 每个批次最多发送的日志数量，缓冲区中的日志达到这个数量时会立即发送，默认为 100
+	BatchSize int
+	// FlushInterval 定时发送的时间间隔，默认为 1s
+	FlushInterval time.Duration
+	// Overflow 缓冲区已满时的处理策略，默认为 DropOldest
+	Overflow OverflowPolicy
+	// MaxRetries 发送失败的批次放回缓冲区重新发送的最大次数，默认为 3，小于 0 时不重新发送
+	MaxRetries int
+	// MaxFailed 最大失败次数，如果失败次数超过这个值，则会调用 FailedCallback，大于 0 时生效
+	MaxFailed int
+	// FailedCallback 发送失败时调用的回调函数，不为 nil 时生效
+	FailedCallback func(err error)
+	// SpoolDir 文件暂存区目录，不为空时启用，发送失败的日志会写入暂存区，服务端恢复后按顺序重放
+	SpoolDir string
+	// SpoolSegmentSize 暂存区单个分段文件的大小上限，默认为 8MB
+	SpoolSegmentSize int64
+	// SpoolMaxSize 暂存区所有分段文件的大小上限，超过后删除最早的分段，默认为 512MB
+	SpoolMaxSize int64
+	// SpoolReplayInterval 定时重放暂存区的时间间隔，默认为 5s
+	SpoolReplayInterval time.Duration
+	// SpoolMaxAge 日志在暂存区中最长的保存时间，超过后不再重放，默认为 1h，小于 0 时不限制，
+	// 服务端只在 1h 的时间窗口内按照 record_id 去重，超过这个时间重放部分发送成功的分段会重复接收日志
+	SpoolMaxAge time.Duration
+	// Redactor 发送前对 input_fields, payload_fields, extra_fields, fields 和错误消息脱敏使用的引擎，为 nil 时使用 redact.Default()
+	Redactor *redact.Redactor
+	// DisableRedaction 关闭客户端的脱敏
+	DisableRedaction bool
+	// Credentials 外部日志收集器使用的凭据，只在使用 http 协议时生效
+	Credentials Credentials
+	// MinLevel 发送日志的最低级别，低于该级别的日志会被直接丢弃，为空时发送所有级别
+	MinLevel string
+	// SampleRates 按照级别的采样率，取值范围为 [0, 1]，没有配置的级别全部发送
+	SampleRates map[string]float64
+	// TraceConsistentSampling 按照 trace_id 采样，同一个 trace_id 的日志全部保留或者全部丢弃
+	TraceConsistentSampling bool
+	// SamplingPollInterval 拉取服务端下发的级别和采样配置的间隔，默认为 30s，小于 0 时不拉取
+	SamplingPollInterval time.Duration
+}
+
+// DefaultCollectorOptions 获取默认的日志收集器配置
+func DefaultCollectorOptions() CollectorOptions {
+	return CollectorOptions{
+		BufferSize:           1024,
+		BatchSize:            100,
+		FlushInterval:        time.Second,
+		Overflow:             DropOldest,
+		MaxRetries:           3,
+		SpoolSegmentSize:     8 << 20,
+		SpoolMaxSize:         512 << 20,
+		SpoolReplayInterval:  time.Second * 5,
+		SpoolMaxAge:          time.Hour,
+		SamplingPollInterval: time.Second * 30,
+	}
+}
+
+func (o CollectorOptions) normalize() CollectorOptions {
+	defaults := DefaultCollectorOptions()
+	if o.BufferSize <= 0 {
+		o.BufferSize = defaults.BufferSize
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaults.BatchSize
+	}
+	if o.BatchSize > o.BufferSize {
+		o.BatchSize = o.BufferSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaults.FlushInterval
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = defaults.MaxRetries
+	} else if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.SpoolSegmentSize <= 0 {
+		o.SpoolSegmentSize = defaults.SpoolSegmentSize
+	}
+	if o.SpoolMaxSize <= 0 {
+		o.SpoolMaxSize = defaults.SpoolMaxSize
+	}
+	if o.SpoolReplayInterval <= 0 {
+		o.SpoolReplayInterval = defaults.SpoolReplayInterval
+	}
+	if o.SpoolMaxAge == 0 {
+		o.SpoolMaxAge = defaults.SpoolMaxAge
+	} else if o.SpoolMaxAge < 0 {
+		o.SpoolMaxAge = 0
+	}
+	if o.SamplingPollInterval == 0 {
+		o.SamplingPollInterval = defaults.SamplingPollInterval
+	}
+	return o
+}
+
+// redactor 获取客户端使用的脱敏引擎，关闭脱敏时返回 nil
+func (o CollectorOptions) redactor() *redact.Redactor {
+	if o.DisableRedaction {
+		return nil
+	} else if o.Redactor != nil {
+		return o.Redactor
+	}
+	return redact.Default()
 }
 
 type collector struct {
-	client      *client
+	buffer      *buffer
 	serviceName string
+	redactor    *redact.Redactor
+	sampler     *sampler
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// newCollector 创建日志收集器，source 不为 nil 时定时拉取服务端下发的级别和采样配置
+//   - serviceName: 服务名称
+//   - s: 发送日志使用的客户端
+//   - source: 拉取采样配置使用的客户端
+//   - options: 已经填充默认值的配置
+func newCollector(serviceName string, s sender, source samplingSource, options CollectorOptions) *collector {
+	c := &collector{
+		buffer:      newBuffer(s, options),
+		serviceName: serviceName,
+		redactor:    options.redactor(),
+		sampler:     newSampler(options),
+		stop:        make(chan struct{}),
+	}
+	if source != nil && options.SamplingPollInterval > 0 {
+		go c.sampler.poll(source, serviceName, options.SamplingPollInterval, c.stop)
+	}
+	return c
 }
 
 func (r *collector) logField(fields Fields) {
@@ -49,23 +196,44 @@ func (r *collector) logField(fields Fields) {
 	if exported.service == "" {
 		exported.service = r.serviceName
 	}
+	// 通过收集器发送的日志来自内部服务，适配其他日志框架时可以使用日志中声明的调用方类型
+	if exported.callerType == "" {
+		fields.withCaller(string(log.Service))
+	}
+	if !r.sampler.keep(exported.level, exported.traceID) {
+		return
+	}
 
 	var paramsBytes []byte
 	if exported.inputFields != nil {
-		paramsBytes = utils.JsonMarshal(exported.inputFields)
+		paramsBytes = r.redactor.RedactJSON(utils.JsonMarshal(exported.inputFields))
 	}
 
 	var processingBytes []byte
 	if exported.payloadFields != nil {
-		processingBytes = utils.JsonMarshal(exported.payloadFields)
+		processingBytes = r.redactor.RedactJSON(utils.JsonMarshal(exported.payloadFields))
 	}
 
 	var extraBytes []byte
 	if exported.extraFields != nil {
-		extraBytes = utils.JsonMarshal(exported.extraFields)
+		extraBytes = r.redactor.RedactJSON(utils.JsonMarshal(exported.extraFields))
+	}
+
+	var structuredBytes []byte
+	if len(exported.fields) > 0 {
+		structuredBytes = r.redactor.RedactJSON(utils.JsonMarshal(exported.fields))
 	}
 
-	r.client.execute(&alioth.RestorationCollectionRequest{
+	var errorInfo *alioth.RestorationError
+	if exported.err != nil {
+		errorInfo = &alioth.RestorationError{
+			Type:    exported.err.GetType(),
+			Message: r.redactor.RedactString(exported.err.GetMessage()),
+			Stack:   exported.err.GetStack(),
+		}
+	}
+
+	r.buffer.enqueue(&alioth.RestorationCollectionRequest{
 		CallerService:  exported.service,
 		CodePath:       exported.code,
 		Level:          exported.level,
@@ -76,23 +244,38 @@ func (r *collector) logField(fields Fields) {
 		InputFields:    paramsBytes,
 		PayloadFields:  processingBytes,
 		ExtraFields:    extraBytes,
+		RecordId:       uuid.NewString(),
+		CallerType:     exported.callerType,
+		Fields:         structuredBytes,
+		Error:          errorInfo,
+		DurationNs:     int64(exported.duration),
+		User:           exported.user,
 	})
 }
 
 func (r *collector) Debug(fields Fields) {
-	go r.logField(fields.withLevel("debug").withService(r.serviceName))
+	r.logField(fields.withLevel("debug").withService(r.serviceName))
 }
 
 func (r *collector) Info(fields Fields) {
-	go r.logField(fields.withLevel("info").withService(r.serviceName))
+	r.logField(fields.withLevel("info").withService(r.serviceName))
 }
 
 func (r *collector) Warn(fields Fields) {
-	go r.logField(fields.withLevel("warn").withService(r.serviceName))
+	r.logField(fields.withLevel("warn").withService(r.serviceName))
 }
 
 func (r *collector) Error(fields Fields) {
-	go r.logField(fields.withLevel("error").withService(r.serviceName))
+	r.logField(fields.withLevel("error").withService(r.serviceName))
+}
+
+func (r *collector) Flush(ctx context.Context) (err error) {
+	return r.buffer.Flush(ctx)
+}
+
+func (r *collector) Close(ctx context.Context) (err error) {
+	r.stopOnce.Do(func() { close(r.stop) })
+	return r.buffer.Close(ctx)
 }
 
 // NewCollector 创建一个新的日志收集器
@@ -101,14 +284,7 @@ func (r *collector) Error(fields Fields) {
 //
 // 不会验证 serverAddr 的有效性，失败了也不会有任何提示，哪怕是失败日志也不会有
 func NewCollector(serviceName string, restorationAddr string) (c Collector, err error) {
-	if rpcClient, initClientErr := newRestorationClient(restorationAddr); initClientErr != nil {
-		return nilCollector, fmt.Errorf("init restoration client error: %w", initClientErr)
-	} else {
-		return &collector{
-			client:      rpcClient,
-			serviceName: serviceName,
-		}, nil
-	}
+	return NewCollectorWithOptions(serviceName, restorationAddr, DefaultCollectorOptions())
 }
 
 // NewCollectorWithFailedCallback 创建一个新的日志收集器，当日志收集器无法连接到日志服务时，会调用回调函数
@@ -119,89 +295,89 @@ func NewCollector(serviceName string, restorationAddr string) (c Collector, err
 //
 // 不会验证 serverAddr 的有效性，失败了也不会有任何提示，哪怕是失败日志也不会有，在超过最大失败次数后会调用 callback
 func NewCollectorWithFailedCallback(serviceName string, restorationAddr string, maxFailed int, callback func(err error)) (c Collector, err error) {
-	if rpcClient, initClientErr := newClientWithFailedCallback(restorationAddr, maxFailed, callback); initClientErr != nil {
+	options := DefaultCollectorOptions()
+	options.MaxFailed = maxFailed
+	options.FailedCallback = callback
+	return NewCollectorWithOptions(serviceName, restorationAddr, options)
+}
+
+// NewCollectorWithOptions 使用自定义配置创建一个新的日志收集器
+//   - serviceName: 服务名称，用于标识日志来源
+//   - restorationAddr: 日志服务地址，需要包含IP和端口，如 10.0.0.1:50051
+//   - options: 日志收集器的配置，为零值的字段会使用默认值
+//
+// 不会验证 serverAddr 的有效性，失败了也不会有任何提示，在超过最大失败次数后会调用 options.FailedCallback
+func NewCollectorWithOptions(serviceName string, restorationAddr string, options CollectorOptions) (c Collector, err error) {
+	options = options.normalize()
+	if rpcClient, initClientErr := newClientWithFailedCallback(restorationAddr, options.MaxFailed, options.FailedCallback); initClientErr != nil {
 		return nilCollector, fmt.Errorf("init restoration client error: %w", initClientErr)
+	} else if spooled, initSpoolErr := withSpool(rpcClient, options); initSpoolErr != nil {
+		return nilCollector, fmt.Errorf("init restoration spool error: %w", initSpoolErr)
 	} else {
-		return &collector{
-			client:      rpcClient,
-			serviceName: serviceName,
-		}, nil
+		return newCollector(serviceName, spooled, rpcClient, options), nil
 	}
 }
 
-type externalCollector struct {
-	client      *externalClient
-	serviceName string
+// NewExternalCollector 创建一个新的日志收集器
+//   - serviceName: 服务名称，用于标识日志来源
+//   - restorationAddr: 日志服务地址，需要包含协议和端口，如 https://api.sunist.work:8080
+//
+// 会请求 ${endpoint}/restoration/ping 接口，如果返回 200 则认为 endpoint 有效，否则返回 error
+func NewExternalCollector(serviceName string, restorationAddr string) (collector Collector, err error) {
+	return NewExternalCollectorWithOptions(serviceName, restorationAddr, DefaultCollectorOptions())
 }
 
-func (r *externalCollector) logField(fields Fields) {
-	exported := fields.export()
-	if exported.service == "" {
-		exported.service = r.serviceName
-	}
-
-	var paramsBytes []byte
-	if exported.inputFields != nil {
-		paramsBytes = utils.JsonMarshal(exported.inputFields)
-	}
-
-	var processingBytes []byte
-	if exported.payloadFields != nil {
-		processingBytes = utils.JsonMarshal(exported.payloadFields)
-	}
-
-	var extraBytes []byte
-	if exported.extraFields != nil {
-		extraBytes = utils.JsonMarshal(exported.extraFields)
+// NewExternalCollectorWithOptions 使用自定义配置创建一个新的日志收集器
+//   - serviceName: 服务名称，用于标识日志来源
+//   - restorationAddr: 日志服务地址，需要包含协议和端口，如 https://api.sunist.work:8080
+//   - options: 日志收集器的配置，为零值的字段会使用默认值
+//
+// 会请求 ${endpoint}/restoration/ping 接口，如果返回 200 则认为 endpoint 有效，否则返回 error，
+// 发送失败时会记录错误日志，并调用 options.FailedCallback
+func NewExternalCollectorWithOptions(serviceName string, restorationAddr string, options CollectorOptions) (c Collector, err error) {
+	options = options.normalize()
+	httpClient, initClientErr := newExternalClient(restorationAddr)
+	if initClientErr != nil {
+		return nilCollector, fmt.Errorf("init restoration client error: %w", initClientErr)
 	}
 
-	logExternalErr := r.client.execute(&alioth.RestorationCollectionRequest{
-		CallerService:  exported.service,
-		CodePath:       exported.code,
-		Level:          exported.level,
-		Message:        exported.message,
-		CalledAt:       exported.calledAt,
-		CalledFunction: exported.calledFunction,
-		TraceId:        exported.traceID,
-		InputFields:    paramsBytes,
-		PayloadFields:  processingBytes,
-		ExtraFields:    extraBytes,
-	})
-
-	if logExternalErr != nil {
+	httpClient.credentials = options.Credentials
+	httpClient.failedCall = func(logExternalErr error) {
 		logger.Log(log.DefaultField().WithMessage("log external error").WithLevel(log.Error).WithCaller(log.Module).
-			WithExtra(map[string]any{"error": logExternalErr, "fields": fields}))
+			WithExtra(logExternalErr.Error()))
+		if options.FailedCallback != nil {
+			options.FailedCallback(logExternalErr)
+		}
 	}
+	spooled, initSpoolErr := withSpool(httpClient, options)
+	if initSpoolErr != nil {
+		return nilCollector, fmt.Errorf("init restoration spool error: %w", initSpoolErr)
+	}
+	return newCollector(serviceName, spooled, httpClient, options), nil
 }
 
-func (r *externalCollector) Debug(fields Fields) {
-	go r.logField(fields.withLevel("debug").withService(r.serviceName))
-}
-
-func (r *externalCollector) Info(fields Fields) {
-	go r.logField(fields.withLevel("info").withService(r.serviceName))
-}
-
-func (r *externalCollector) Warn(fields Fields) {
-	go r.logField(fields.withLevel("warn").withService(r.serviceName))
-}
-
-func (r *externalCollector) Error(fields Fields) {
-	go r.logField(fields.withLevel("error").withService(r.serviceName))
+// NewStreamCollector 创建一个使用 grpc 双向流的日志收集器，适用于日志量较大的服务
+//   - serviceName: 服务名称，用于标识日志来源
+//   - restorationAddr: 日志服务地址，需要包含IP和端口，如 10.0.0.1:50051
+//
+// 收集器会保持一个长连接，每个批次都需要等待服务端确认，连接断开后会自动重连
+func NewStreamCollector(serviceName string, restorationAddr string) (c Collector, err error) {
+	return NewStreamCollectorWithOptions(serviceName, restorationAddr, DefaultCollectorOptions())
 }
 
-// NewExternalCollector 创建一个新的日志收集器
+// NewStreamCollectorWithOptions 使用自定义配置创建一个使用 grpc 双向流的日志收集器
 //   - serviceName: 服务名称，用于标识日志来源
-//   - restorationAddr: 日志服务地址，需要包含协议和端口，如 https://api.sunist.work:8080
+//   - restorationAddr: 日志服务地址，需要包含IP和端口，如 10.0.0.1:50051
+//   - options: 日志收集器的配置，为零值的字段会使用默认值
 //
-// 会请求 ${endpoint}/restoration/ping 接口，如果返回 200 则认为 endpoint 有效，否则返回 error
-func NewExternalCollector(serviceName string, restorationAddr string) (collector Collector, err error) {
-	if httpClient, initClientErr := newExternalClient(restorationAddr); initClientErr != nil {
+// 收集器会保持一个长连接，每个批次都需要等待服务端确认，连接断开后会自动重连，在超过最大失败次数后会调用 options.FailedCallback
+func NewStreamCollectorWithOptions(serviceName string, restorationAddr string, options CollectorOptions) (c Collector, err error) {
+	options = options.normalize()
+	if streamClient, initClientErr := newStreamClient(restorationAddr, options.MaxFailed, options.FailedCallback); initClientErr != nil {
 		return nilCollector, fmt.Errorf("init restoration client error: %w", initClientErr)
+	} else if spooled, initSpoolErr := withSpool(streamClient, options); initSpoolErr != nil {
+		return nilCollector, fmt.Errorf("init restoration spool error: %w", initSpoolErr)
 	} else {
-		return &externalCollector{
-			client:      httpClient,
-			serviceName: serviceName,
-		}, nil
+		return newCollector(serviceName, spooled, streamClient, options), nil
 	}
 }
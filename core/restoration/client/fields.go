@@ -2,14 +2,21 @@ package restoration
 
 import (
 	"context"
+	"fmt"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"studio.sunist.work/platform/alioth-center/infrastructure/global"
 	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
 )
 
+// maxStackDepth WithError 记录的调用栈的最大深度
+const maxStackDepth = 32
+
 type Fields interface {
 	withBasic(ctx context.Context, message string) Fields
 	withLevel(level string) Fields
@@ -18,6 +25,28 @@ type Fields interface {
 	WithParams(params any) Fields
 	WithProcessing(processing any) Fields
 	WithExtra(extra any) Fields
+
+	// WithField 添加一个结构化的键值对字段，相同的键会覆盖之前的值
+	//   - key: 字段名
+	//   - value: 字段值，需要可以序列化为 json
+	WithField(key string, value any) Fields
+
+	// WithError 记录错误的类型、消息和调用 WithError 时的调用栈，err 为 nil 时忽略
+	//   - err: 日志关联的错误
+	WithError(err error) Fields
+
+	// WithTraceID 使用指定的 trace_id 覆盖从 ctx 中获取的 trace_id
+	//   - traceID: 链路追踪的 ID
+	WithTraceID(traceID string) Fields
+
+	// WithDuration 记录操作的耗时
+	//   - duration: 操作的耗时
+	WithDuration(duration time.Duration) Fields
+
+	// WithUser 记录操作的用户
+	//   - user: 用户的标识，如用户 ID 或者用户名
+	WithUser(user string) Fields
+
 	export() *fields
 }
 
@@ -33,6 +62,10 @@ type fields struct {
 	inputFields    any
 	payloadFields  any
 	extraFields    any
+	fields         map[string]any
+	err            *alioth.RestorationError
+	duration       time.Duration
+	user           string
 }
 
 func (f *fields) withBasic(ctx context.Context, message string) Fields {
@@ -79,7 +112,7 @@ func (f *fields) withCaller(caller string) Fields {
 }
 
 func (f *fields) WithParams(params any) Fields {
-	f.extraFields = params
+	f.inputFields = params
 	return f
 }
 
@@ -93,10 +126,123 @@ func (f *fields) WithExtra(extra any) Fields {
 	return f
 }
 
+func (f *fields) WithField(key string, value any) Fields {
+	if f.fields == nil {
+		f.fields = map[string]any{}
+	}
+	f.fields[key] = value
+	return f
+}
+
+func (f *fields) WithError(err error) Fields {
+	if err != nil {
+		f.err = newRestorationError(err, callerStack(1, ""))
+	}
+	return f
+}
+
+func (f *fields) WithTraceID(traceID string) Fields {
+	f.traceID = traceID
+	return f
+}
+
+func (f *fields) WithDuration(duration time.Duration) Fields {
+	f.duration = duration
+	return f
+}
+
+func (f *fields) WithUser(user string) Fields {
+	f.user = user
+	return f
+}
+
 func (f *fields) export() *fields {
 	return f
 }
 
+// newCollectionAt 使用日志框架提供的调用位置和时间创建日志字段，用于适配其他日志框架
+//   - ctx: 用于获取 trace_id，可以为 nil
+//   - message: 日志消息
+//   - calledAt: 日志框架记录的时间
+//   - frame: 日志框架记录的调用位置
+func newCollectionAt(ctx context.Context, message string, calledAt time.Time, frame runtime.Frame) *fields {
+	f := &fields{
+		service:        serviceName,
+		message:        message,
+		calledAt:       calledAt.Format(global.AliothTimeFormat),
+		code:           "unknown:0",
+		calledFunction: "unknown",
+	}
+	if frame.File != "" {
+		f.code = frame.File + ":" + strconv.Itoa(frame.Line)
+	}
+	if frame.Function != "" {
+		f.calledFunction = frame.Function
+	}
+	if traceID, getTraceErr := utils.GetTraceID(ctx); getTraceErr == nil {
+		f.traceID = traceID
+	}
+	return f
+}
+
+// logAt 按照级别调用日志收集器，无法识别的级别视为 info
+func logAt(collector Collector, level string, f Fields) {
+	switch level {
+	case "debug":
+		collector.Debug(f)
+	case "warn":
+		collector.Warn(f)
+	case "error":
+		collector.Error(f)
+	default:
+		collector.Info(f)
+	}
+}
+
 func NewCollection(ctx context.Context, message string) Fields {
 	return (&fields{}).withBasic(ctx, message)
 }
+
+func newRestorationError(err error, stack string) *alioth.RestorationError {
+	return &alioth.RestorationError{
+		Type:    fmt.Sprintf("%T", err),
+		Message: err.Error(),
+		Stack:   stack,
+	}
+}
+
+// callerStack 获取调用栈，每一帧包含函数名和文件位置
+//   - skip: 跳过的栈帧数量，0 为 callerStack 的调用方
+//   - from: 不为空时从这个函数所在的栈帧开始，用于去掉适配其他日志框架时的内部栈帧，找不到时保留完整的调用栈
+func callerStack(skip int, from string) string {
+	pcs := make([]uintptr, maxStackDepth*2)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var collected []runtime.Frame
+	for {
+		frame, more := frames.Next()
+		if from != "" && frame.Function == from {
+			collected = collected[:0]
+			from = ""
+		}
+		collected = append(collected, frame)
+		if !more {
+			break
+		}
+	}
+	if len(collected) > maxStackDepth {
+		collected = collected[:maxStackDepth]
+	}
+
+	var stack strings.Builder
+	for _, frame := range collected {
+		stack.WriteString(frame.Function)
+		stack.WriteString("\n\t")
+		stack.WriteString(frame.File)
+		stack.WriteString(":")
+		stack.WriteString(strconv.Itoa(frame.Line))
+		stack.WriteString("\n")
+	}
+	return stack.String()
+}
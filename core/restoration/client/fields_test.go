@@ -0,0 +1,99 @@
+package restoration
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+// requestSender 记录发送的完整日志请求
+type requestSender struct {
+	mtx     sync.Mutex
+	records []*alioth.RestorationCollectionRequest
+}
+
+func (s *requestSender) send(_ context.Context, records []*alioth.RestorationCollectionRequest) (err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func TestFieldsBuilders(t *testing.T) {
+	params, processing, extra := map[string]any{"id": 1}, map[string]any{"step": "pay"}, map[string]any{"region": "cn"}
+	f := NewCollection(context.Background(), "message").
+		WithParams(params).
+		WithProcessing(processing).
+		WithExtra(extra).
+		WithField("order", "o1").
+		WithField("amount", 10).
+		WithField("order", "o2").
+		WithTraceID("trace").
+		WithDuration(time.Second).
+		WithUser("u1").
+		export()
+
+	// WithParams 写入请求参数，不会覆盖额外字段
+	if !reflect.DeepEqual(f.inputFields, params) || !reflect.DeepEqual(f.payloadFields, processing) || !reflect.DeepEqual(f.extraFields, extra) {
+		t.Errorf("params %v, processing %v and extra %v, want %v, %v and %v", f.inputFields, f.payloadFields, f.extraFields, params, processing, extra)
+	}
+	if want := map[string]any{"order": "o2", "amount": 10}; !reflect.DeepEqual(f.fields, want) {
+		t.Errorf("fields %v, want %v", f.fields, want)
+	}
+	if f.traceID != "trace" || f.duration != time.Second || f.user != "u1" {
+		t.Errorf("trace id %q, duration %v and user %q", f.traceID, f.duration, f.user)
+	}
+	if f.err != nil {
+		t.Errorf("error %v without WithError", f.err)
+	}
+}
+
+func TestFieldsWithError(t *testing.T) {
+	if f := NewCollection(context.Background(), "message").WithError(nil).export(); f.err != nil {
+		t.Errorf("nil error recorded as %v", f.err)
+	}
+
+	err := &fs.PathError{Op: "open", Path: "config.yaml", Err: errors.New("not found")}
+	f := NewCollection(context.Background(), "message").WithError(err).export()
+	if f.err.GetType() != "*fs.PathError" || f.err.GetMessage() != err.Error() {
+		t.Errorf("error type %q and message %q, want *fs.PathError and %q", f.err.GetType(), f.err.GetMessage(), err.Error())
+	}
+	// 调用栈从调用 WithError 的函数开始
+	if first, _, _ := strings.Cut(f.err.GetStack(), "\n"); !strings.HasSuffix(first, "TestFieldsWithError") {
+		t.Errorf("stack starts with %q, want the caller of WithError", first)
+	}
+}
+
+func TestCollectorCallerType(t *testing.T) {
+	s := &requestSender{}
+	options := DefaultCollectorOptions()
+	options.FlushInterval = time.Hour
+	c := newCollector("caller-test", s, nil, options)
+
+	c.Info(NewCollection(context.Background(), "default").WithParams(map[string]any{"id": 1}))
+	c.Info(NewCollection(context.Background(), "declared").withCaller("module"))
+	if closeErr := c.Close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+
+	// 没有声明调用方类型时作为内部服务发送，声明时使用声明的类型
+	want := map[string]string{"default": "service", "declared": "module"}
+	if len(s.records) != len(want) {
+		t.Fatalf("sent %d records, want %d", len(s.records), len(want))
+	}
+	for _, record := range s.records {
+		if record.GetCallerType() != want[record.GetMessage()] {
+			t.Errorf("%s sent with caller type %q, want %q", record.GetMessage(), record.GetCallerType(), want[record.GetMessage()])
+		}
+		if record.GetMessage() == "default" && string(record.GetInputFields()) != `{"id":1}` {
+			t.Errorf("input fields %s, want the params", record.GetInputFields())
+		}
+	}
+}
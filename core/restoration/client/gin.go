@@ -0,0 +1,205 @@
+package restoration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
+)
+
+// NewGinMiddleware 创建记录 http 请求的 gin 中间件
+//   - collector: 日志收集器
+//   - options: 中间件配置
+//
+// 从 TraceIDHeader 请求头中获取上游的 trace_id，没有或者不合法时生成新的 trace_id，写入请求的上下文和响应头，
+// 处理函数可以通过 utils.GetTraceID(ctx) 或者 utils.GetTraceID(ctx.Request.Context()) 获取，
+// 查询参数和请求内容作为 input_fields，响应内容作为 payload_fields，内容超过 MaxPayloadSize 时不记录，
+// 表单格式的请求内容会解析为键值对记录，使脱敏引擎可以按照键名脱敏
+func NewGinMiddleware(collector Collector, options InterceptorOptions) gin.HandlerFunc {
+	options = options.normalize()
+	return func(ctx *gin.Context) {
+		requestCtx := ctx.Request.Context()
+		if traceID := ctx.GetHeader(TraceIDHeader); validTraceID(traceID) {
+			requestCtx = utils.SetTraceID(requestCtx, traceID)
+		}
+		requestCtx = utils.AddTraceID(requestCtx)
+		traceID, _ := utils.GetTraceID(requestCtx)
+		ctx.Request = ctx.Request.WithContext(requestCtx)
+		ctx.Set("trace_id", traceID)
+		ctx.Header(TraceIDHeader, traceID)
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = ctx.Request.URL.Path
+		}
+		if options.skip(route) {
+			ctx.Next()
+			return
+		}
+
+		var requestBody []byte
+		var writer *payloadWriter
+		if !options.DisablePayloads {
+			requestBody = readRequestBody(ctx, options.MaxPayloadSize)
+			writer = &payloadWriter{ResponseWriter: ctx.Writer, limit: options.MaxPayloadSize}
+			ctx.Writer = writer
+		}
+
+		startedAt := time.Now()
+		ctx.Next()
+
+		statusCode := ctx.Writer.Status()
+		f := newCollectionAt(requestCtx, "http request", startedAt, runtime.Frame{Function: ctx.HandlerName()})
+		f.WithField("method", ctx.Request.Method).WithField("route", route).WithField("status", statusCode).
+			WithField("peer", ctx.ClientIP()).WithDuration(time.Since(startedAt))
+		if len(ctx.Errors) > 0 {
+			f.err = newRestorationError(ctx.Errors.Last().Err, "")
+		}
+		if !options.DisablePayloads {
+			params := map[string]any{}
+			if query := ctx.Request.URL.Query(); len(query) > 0 {
+				params["query"] = query
+			}
+			if len(requestBody) > 0 {
+				params["body"] = requestPayload(ctx.GetHeader("Content-Type"), requestBody)
+			}
+			if len(params) > 0 {
+				f.WithParams(params)
+			}
+			if response := writer.payload(); len(response) > 0 {
+				f.WithProcessing(httpPayload(response))
+			}
+		}
+
+		level := "info"
+		if statusCode >= 500 {
+			level = "error"
+		} else if statusCode >= 400 {
+			level = "warn"
+		}
+		logAt(collector, level, f)
+	}
+}
+
+// readRequestBody 读取请求内容并放回请求中，内容超过 limit 时返回 nil
+func readRequestBody(ctx *gin.Context, limit int) []byte {
+	if ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+		return nil
+	}
+
+	head, readErr := io.ReadAll(io.LimitReader(ctx.Request.Body, int64(limit)+1))
+	ctx.Request.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(head), ctx.Request.Body), Closer: ctx.Request.Body}
+	if readErr != nil || len(head) > limit {
+		return nil
+	}
+	return head
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// requestPayload 将表单格式的请求内容解析为键值对，使脱敏引擎可以按照键名脱敏，
+// multipart 中的文件只记录文件名，无法解析的表单和其他内容按照 httpPayload 记录
+//   - contentType: 请求的 Content-Type 请求头
+//   - content: 请求内容
+func requestPayload(contentType string, content []byte) any {
+	mediaType, params, parseErr := mime.ParseMediaType(contentType)
+	if parseErr != nil {
+		return httpPayload(content)
+	}
+
+	switch mediaType {
+	case binding.MIMEPOSTForm:
+		if values, parseErr := url.ParseQuery(string(content)); parseErr == nil {
+			return values
+		}
+	case binding.MIMEMultipartPOSTForm:
+		if values, parseErr := parseMultipart(content, params["boundary"]); parseErr == nil {
+			return values
+		}
+	}
+	return httpPayload(content)
+}
+
+// parseMultipart 解析 multipart 表单，文件字段的值为 file:文件名
+func parseMultipart(content []byte, boundary string) (url.Values, error) {
+	if boundary == "" {
+		return nil, errors.New("missing multipart boundary")
+	}
+
+	values := url.Values{}
+	reader := multipart.NewReader(bytes.NewReader(content), boundary)
+	for {
+		part, partErr := reader.NextPart()
+		if partErr == io.EOF {
+			return values, nil
+		} else if partErr != nil {
+			return nil, partErr
+		}
+
+		if filename := part.FileName(); filename != "" {
+			values.Add(part.FormName(), "file:"+filename)
+		} else if value, readErr := io.ReadAll(part); readErr != nil {
+			return nil, readErr
+		} else {
+			values.Add(part.FormName(), string(value))
+		}
+	}
+}
+
+// httpPayload 将 json 格式的内容作为 json 记录，其他内容作为字符串记录
+func httpPayload(content []byte) any {
+	if json.Valid(content) {
+		return json.RawMessage(content)
+	}
+	return string(content)
+}
+
+// payloadWriter 在写入响应的同时保存响应内容，超过 limit 时丢弃保存的内容
+type payloadWriter struct {
+	gin.ResponseWriter
+	limit    int
+	buffer   bytes.Buffer
+	overflow bool
+}
+
+func (w *payloadWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *payloadWriter) WriteString(data string) (int, error) {
+	w.capture([]byte(data))
+	return w.ResponseWriter.WriteString(data)
+}
+
+func (w *payloadWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	} else if w.buffer.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buffer.Reset()
+		return
+	}
+	w.buffer.Write(data)
+}
+
+func (w *payloadWriter) payload() []byte {
+	if w == nil || w.overflow {
+		return nil
+	}
+	return w.buffer.Bytes()
+}
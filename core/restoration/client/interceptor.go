@@ -0,0 +1,323 @@
+package restoration
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
+)
+
+const (
+	// TraceIDMetadataKey 在 grpc metadata 中传递 trace_id 使用的键
+	TraceIDMetadataKey = "x-alioth-trace-id"
+	// TraceIDHeader 在 http 请求头和响应头中传递 trace_id 使用的键
+	TraceIDHeader = "X-Alioth-Trace-Id"
+	// maxTraceIDLength 上游传递的 trace_id 的最大长度
+	maxTraceIDLength = 128
+)
+
+// InterceptorOptions grpc 拦截器和 gin 中间件的配置，为零值的字段会使用默认值
+type InterceptorOptions struct {
+	// DisablePayloads 不记录请求和响应的内容，记录的内容会使用日志收集器的脱敏引擎脱敏
+	DisablePayloads bool
+	// MaxPayloadSize http 请求和响应内容的最大记录字节数，超过时不记录内容，默认为 64KB
+	MaxPayloadSize int
+	// SkipMethods 不记录日志的 grpc 方法或者 http 路由，如 /grpc.health.v1.Health/Check，仍然会传递 trace_id
+	SkipMethods []string
+}
+
+func (o InterceptorOptions) normalize() InterceptorOptions {
+	if o.MaxPayloadSize <= 0 {
+		o.MaxPayloadSize = 64 << 10
+	}
+	return o
+}
+
+func (o InterceptorOptions) skip(method string) bool {
+	for _, skipped := range o.SkipMethods {
+		if skipped == method {
+			return true
+		}
+	}
+	return false
+}
+
+// grpcLevel 根据 grpc 状态码获取日志级别，调用方的错误视为 warn，服务端的错误视为 error
+func grpcLevel(code codes.Code) string {
+	switch code {
+	case codes.OK:
+		return "info"
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.Unauthenticated, codes.ResourceExhausted, codes.FailedPrecondition, codes.Aborted, codes.OutOfRange:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// protoPayload 将 grpc 的消息转换为可以序列化为 json 的值，proto 消息使用 protojson 序列化
+func protoPayload(message any) any {
+	if m, isProto := message.(proto.Message); isProto {
+		if encoded, marshalErr := (protojson.MarshalOptions{UseProtoNames: true}).Marshal(m); marshalErr == nil {
+			return json.RawMessage(encoded)
+		}
+	}
+	return message
+}
+
+// validTraceID 检查上游传递的 trace_id，只接受不超过 maxTraceIDLength 个字符的字母、数字和 - _ .，
+// 避免调用方通过 trace_id 写入超长或者包含控制字符的内容
+func validTraceID(traceID string) bool {
+	if traceID == "" || len(traceID) > maxTraceIDLength {
+		return false
+	}
+	for i := 0; i < len(traceID); i++ {
+		switch c := traceID[i]; {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// incomingTraceContext 从 grpc metadata 中获取上游的 trace_id，没有或者不合法时生成新的 trace_id
+func incomingTraceContext(ctx context.Context) (context.Context, string) {
+	if md, exist := metadata.FromIncomingContext(ctx); exist {
+		if values := md.Get(TraceIDMetadataKey); len(values) > 0 && validTraceID(values[0]) {
+			ctx = utils.SetTraceID(ctx, values[0])
+		}
+	}
+	ctx = utils.AddTraceID(ctx)
+	traceID, _ := utils.GetTraceID(ctx)
+	return ctx, traceID
+}
+
+// outgoingTraceContext 获取或者生成 trace_id，并写入发送给下游的 grpc metadata
+func outgoingTraceContext(ctx context.Context) context.Context {
+	ctx = utils.AddTraceID(ctx)
+	traceID, _ := utils.GetTraceID(ctx)
+	return metadata.AppendToOutgoingContext(ctx, TraceIDMetadataKey, traceID)
+}
+
+func peerAddress(ctx context.Context) string {
+	if p, exist := peer.FromContext(ctx); exist && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// logGrpcCall 创建一次 grpc 调用的日志，并根据状态码获取日志级别
+//   - ctx: 包含 trace_id 的上下文
+//   - message: 日志消息
+//   - method: 完整的方法名
+//   - remote: 对端地址
+//   - startedAt: 调用开始的时间
+//   - err: 调用返回的错误
+func logGrpcCall(ctx context.Context, message, method, remote string, startedAt time.Time, err error) (f *fields, level string) {
+	code := status.Code(err)
+	f = newCollectionAt(ctx, message, startedAt, runtime.Frame{Function: method})
+	f.WithField("method", method).WithField("status", code.String()).WithField("peer", remote).
+		WithDuration(time.Since(startedAt))
+	if err != nil {
+		f.err = newRestorationError(err, "")
+	}
+	return f, grpcLevel(code)
+}
+
+// NewUnaryServerInterceptor 创建记录 grpc 一元调用的服务端拦截器
+//   - collector: 日志收集器
+//   - options: 拦截器配置
+//
+// 从 metadata 中获取上游的 trace_id，没有时生成新的 trace_id，并通过 utils.GetTraceID 提供给处理函数，
+// 请求作为 input_fields，响应作为 payload_fields
+func NewUnaryServerInterceptor(collector Collector, options InterceptorOptions) grpc.UnaryServerInterceptor {
+	options = options.normalize()
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		ctx, traceID := incomingTraceContext(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(TraceIDMetadataKey, traceID))
+		if options.skip(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		startedAt := time.Now()
+		resp, err = handler(ctx, req)
+
+		f, level := logGrpcCall(ctx, "grpc server call", info.FullMethod, peerAddress(ctx), startedAt, err)
+		if !options.DisablePayloads {
+			f.WithParams(protoPayload(req))
+			if err == nil {
+				f.WithProcessing(protoPayload(resp))
+			}
+		}
+		logAt(collector, level, f)
+		return resp, err
+	}
+}
+
+// NewStreamServerInterceptor 创建记录 grpc 流式调用的服务端拦截器，流结束时记录一条日志，包含收发的消息数量，不记录消息内容
+//   - collector: 日志收集器
+//   - options: 拦截器配置
+func NewStreamServerInterceptor(collector Collector, options InterceptorOptions) grpc.StreamServerInterceptor {
+	options = options.normalize()
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx, traceID := incomingTraceContext(ss.Context())
+		_ = ss.SetHeader(metadata.Pairs(TraceIDMetadataKey, traceID))
+		wrapped := &serverStream{ServerStream: ss, ctx: ctx}
+		if options.skip(info.FullMethod) {
+			return handler(srv, wrapped)
+		}
+
+		startedAt := time.Now()
+		err = handler(srv, wrapped)
+
+		f, level := logGrpcCall(ctx, "grpc server stream", info.FullMethod, peerAddress(ctx), startedAt, err)
+		f.WithField("received", wrapped.received).WithField("sent", wrapped.sent)
+		logAt(collector, level, f)
+		return err
+	}
+}
+
+// serverStream 使用包含 trace_id 的上下文，并统计收发的消息数量
+type serverStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	received int
+	sent     int
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received++
+	}
+	return err
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+	}
+	return err
+}
+
+// NewUnaryClientInterceptor 创建记录 grpc 一元调用的客户端拦截器，trace_id 会通过 metadata 传递给服务端
+//   - collector: 日志收集器
+//   - options: 拦截器配置
+//
+// 不要在连接 alioth-restoration 的客户端上使用，否则发送日志的调用也会产生日志
+func NewUnaryClientInterceptor(collector Collector, options InterceptorOptions) grpc.UnaryClientInterceptor {
+	options = options.normalize()
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		ctx = outgoingTraceContext(ctx)
+		if options.skip(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		startedAt := time.Now()
+		err = invoker(ctx, method, req, reply, cc, opts...)
+
+		f, level := logGrpcCall(ctx, "grpc client call", method, cc.Target(), startedAt, err)
+		if !options.DisablePayloads {
+			f.WithParams(protoPayload(req))
+			if err == nil {
+				f.WithProcessing(protoPayload(reply))
+			}
+		}
+		logAt(collector, level, f)
+		return err
+	}
+}
+
+// NewStreamClientInterceptor 创建记录 grpc 流式调用的客户端拦截器，流结束时记录一条日志，包含收发的消息数量，不记录消息内容
+//   - collector: 日志收集器
+//   - options: 拦截器配置
+//
+// 只有在读取到流的结束或者错误时才会记录日志，不要在连接 alioth-restoration 的客户端上使用
+func NewStreamClientInterceptor(collector Collector, options InterceptorOptions) grpc.StreamClientInterceptor {
+	options = options.normalize()
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = outgoingTraceContext(ctx)
+		if options.skip(method) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		startedAt := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			f, level := logGrpcCall(ctx, "grpc client stream", method, cc.Target(), startedAt, err)
+			logAt(collector, level, f)
+			return nil, err
+		}
+
+		return &clientStream{
+			ClientStream:  stream,
+			serverStreams: desc.ServerStreams,
+			finish: func(received, sent int, finishErr error) {
+				f, level := logGrpcCall(ctx, "grpc client stream", method, cc.Target(), startedAt, finishErr)
+				f.WithField("received", received).WithField("sent", sent)
+				logAt(collector, level, f)
+			},
+		}, nil
+	}
+}
+
+// clientStream 统计收发的消息数量，读取到流的结束或者错误时记录一次日志，
+// 服务端只返回一条消息的流在读取到这条消息后就记录日志，调用方不会再读取到流的结束
+type clientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	finish        func(received, sent int, err error)
+	once          sync.Once
+	mtx           sync.Mutex
+	received      int
+	sent          int
+}
+
+func (s *clientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.mtx.Lock()
+		s.sent++
+		s.mtx.Unlock()
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	s.mtx.Lock()
+	if err == nil {
+		s.received++
+	}
+	received, sent := s.received, s.sent
+	s.mtx.Unlock()
+
+	if err != nil {
+		finishErr := err
+		if err == io.EOF {
+			finishErr = nil
+		}
+		s.once.Do(func() { s.finish(received, sent, finishErr) })
+	} else if !s.serverStreams {
+		s.once.Do(func() { s.finish(received, sent, nil) })
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package restoration
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestValidTraceID(t *testing.T) {
+	cases := []struct {
+		traceID string
+		valid   bool
+	}{
+		{traceID: "6f1c2a0e-5b7d-4c1a-9e8f-0a1b2c3d4e5f", valid: true},
+		{traceID: "trace_id.1", valid: true},
+		{traceID: strings.Repeat("a", maxTraceIDLength), valid: true},
+		{traceID: "", valid: false},
+		{traceID: strings.Repeat("a", maxTraceIDLength+1), valid: false},
+		{traceID: "trace\nid", valid: false},
+		{traceID: "trace id", valid: false},
+		{traceID: "<script>", valid: false},
+	}
+
+	for _, c := range cases {
+		if valid := validTraceID(c.traceID); valid != c.valid {
+			t.Errorf("validTraceID(%q) = %v, want %v", c.traceID, valid, c.valid)
+		}
+	}
+}
+
+func TestRequestPayload(t *testing.T) {
+	var multipartBody bytes.Buffer
+	writer := multipart.NewWriter(&multipartBody)
+	_ = writer.WriteField("username", "alice")
+	_ = writer.WriteField("password", "123")
+	file, _ := writer.CreateFormFile("avatar", "avatar.png")
+	_, _ = file.Write([]byte("binary"))
+	_ = writer.Close()
+
+	cases := []struct {
+		name        string
+		contentType string
+		content     []byte
+		want        any
+	}{
+		{
+			name:        "url encoded form",
+			contentType: "application/x-www-form-urlencoded; charset=utf-8",
+			content:     []byte("username=alice&password=123"),
+			want:        url.Values{"username": {"alice"}, "password": {"123"}},
+		},
+		{
+			name:        "multipart form",
+			contentType: writer.FormDataContentType(),
+			content:     multipartBody.Bytes(),
+			want:        url.Values{"username": {"alice"}, "password": {"123"}, "avatar": {"file:avatar.png"}},
+		},
+		{
+			name:        "multipart without boundary",
+			contentType: "multipart/form-data",
+			content:     []byte("raw"),
+			want:        "raw",
+		},
+		{
+			name:        "plain text",
+			contentType: "text/plain",
+			content:     []byte("password=123"),
+			want:        "password=123",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if payload := requestPayload(c.contentType, c.content); !reflect.DeepEqual(payload, c.want) {
+				t.Errorf("requestPayload = %#v, want %#v", payload, c.want)
+			}
+		})
+	}
+}
+
+// scriptedClientStream 依次返回预设的 RecvMsg 结果
+type scriptedClientStream struct {
+	grpc.ClientStream
+	results []error
+}
+
+func (s *scriptedClientStream) RecvMsg(any) error {
+	err := s.results[0]
+	s.results = s.results[1:]
+	return err
+}
+
+func TestClientStreamFinish(t *testing.T) {
+	cases := []struct {
+		name          string
+		serverStreams bool
+		results       []error
+		finishedAfter int
+	}{
+		{name: "client streaming finishes after the response", results: []error{nil}, finishedAfter: 1},
+		{name: "server streaming finishes at eof", serverStreams: true, results: []error{nil, nil, io.EOF}, finishedAfter: 3},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			finished := 0
+			stream := &clientStream{
+				ClientStream:  &scriptedClientStream{results: c.results},
+				serverStreams: c.serverStreams,
+				finish:        func(received, sent int, err error) { finished++ },
+			}
+			for i := range c.results {
+				_ = stream.RecvMsg(nil)
+				if want := map[bool]int{true: 1, false: 0}[i+1 >= c.finishedAfter]; finished != want {
+					t.Fatalf("finished %d times after %d messages, want %d", finished, i+1, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package restoration
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logrusPackage = "github.com/sirupsen/logrus."
+
+	// logrusFlushTimeout fatal 和 panic 级别的日志在程序退出前发送缓冲区的最长时间
+	logrusFlushTimeout = 5 * time.Second
+)
+
+// logrusHook 将 logrus 的日志转发到日志收集器的 logrus.Hook
+type logrusHook struct {
+	collector Collector
+	levels    []logrus.Level
+}
+
+// NewLogrusHook 创建一个将日志转发到日志收集器的 logrus.Hook
+//   - collector: 日志收集器
+//   - levels: 转发的级别，为空时转发所有级别
+//
+// 键为 ParamsKey 和 ProcessingKey 的字段分别作为 input_fields 和 payload_fields，其他字段作为 extra_fields，
+// logrus.ErrorKey 对应的 error 会作为日志关联的错误，trace_id 从 entry.Context 中获取，
+// 调用位置优先使用开启 ReportCaller 后 logrus 记录的位置，否则从调用栈中查找 logrus 的调用方，
+// fatal 和 panic 级别的日志在 logrus 调用 os.Exit 或者 panic 之前立即发送缓冲区，最多等待 5 秒
+func NewLogrusHook(collector Collector, levels ...logrus.Level) logrus.Hook {
+	if len(levels) == 0 {
+		levels = logrus.AllLevels
+	}
+	return &logrusHook{collector: collector, levels: levels}
+}
+
+func (h *logrusHook) Levels() []logrus.Level {
+	return h.levels
+}
+
+func (h *logrusHook) Fire(entry *logrus.Entry) error {
+	frame := logrusCaller()
+	if entry.Caller != nil {
+		frame = *entry.Caller
+	}
+	f := newCollectionAt(entry.Context, entry.Message, entry.Time, frame)
+
+	attributes := make(map[string]any, len(entry.Data))
+	for key, value := range entry.Data {
+		if err, isError := value.(error); isError {
+			if key == logrus.ErrorKey || f.err == nil {
+				f.err = newRestorationError(err, callerStack(1, frame.Function))
+			}
+			attributes[key] = err.Error()
+		} else {
+			attributes[key] = value
+		}
+	}
+	applyAttributes(f, attributes)
+
+	logAt(h.collector, logrusLevel(entry.Level), f)
+	if entry.Level <= logrus.FatalLevel {
+		h.flush()
+	}
+	return nil
+}
+
+// flush 在程序退出前发送缓冲区中的日志，超时后放弃发送，避免日志服务不可用时阻塞程序退出
+func (h *logrusHook) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), logrusFlushTimeout)
+	defer cancel()
+	_ = h.collector.Flush(ctx)
+}
+
+// logrusLevel 将 logrus 的级别转换为日志收集器的级别，trace 视为 debug，fatal 和 panic 视为 error
+func logrusLevel(level logrus.Level) string {
+	switch level {
+	case logrus.TraceLevel, logrus.DebugLevel:
+		return "debug"
+	case logrus.InfoLevel:
+		return "info"
+	case logrus.WarnLevel:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// logrusCaller 在没有开启 ReportCaller 时从调用栈中查找 logrus 的调用方，即 logrus 栈帧之后的第一个栈帧
+func logrusCaller() runtime.Frame {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	inLogrus := false
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, logrusPackage) {
+			inLogrus = true
+		} else if inLogrus {
+			return frame
+		}
+		if !more {
+			return runtime.Frame{}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package restoration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// flushCountingCollector 记录收到的日志级别和 Flush 的调用次数
+type flushCountingCollector struct {
+	mtx     sync.Mutex
+	levels  []string
+	flushes int
+}
+
+func (c *flushCountingCollector) record(level string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.levels = append(c.levels, level)
+}
+
+func (c *flushCountingCollector) Debug(Fields) { c.record("debug") }
+func (c *flushCountingCollector) Info(Fields)  { c.record("info") }
+func (c *flushCountingCollector) Warn(Fields)  { c.record("warn") }
+func (c *flushCountingCollector) Error(Fields) { c.record("error") }
+
+func (c *flushCountingCollector) Flush(ctx context.Context) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if _, hasDeadline := ctx.Deadline(); hasDeadline {
+		c.flushes++
+	}
+	return nil
+}
+
+func (c *flushCountingCollector) Close(context.Context) error { return nil }
+
+func TestLogrusHookFlushesBeforeExit(t *testing.T) {
+	cases := []struct {
+		level   logrus.Level
+		want    string
+		flushes int
+	}{
+		{level: logrus.InfoLevel, want: "info"},
+		{level: logrus.ErrorLevel, want: "error"},
+		{level: logrus.FatalLevel, want: "error", flushes: 1},
+		{level: logrus.PanicLevel, want: "error", flushes: 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.level.String(), func(t *testing.T) {
+			collector := &flushCountingCollector{}
+			entry := &logrus.Entry{Logger: logrus.New(), Level: c.level, Time: time.Now(), Message: "message", Data: logrus.Fields{}}
+			if fireErr := NewLogrusHook(collector).Fire(entry); fireErr != nil {
+				t.Fatalf("fire: %v", fireErr)
+			}
+			if len(collector.levels) != 1 || collector.levels[0] != c.want {
+				t.Errorf("collected %v, want [%s]", collector.levels, c.want)
+			}
+			if collector.flushes != c.flushes {
+				t.Errorf("flushed %d times with a deadline, want %d", collector.flushes, c.flushes)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package restoration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+// samplingSource 可以拉取服务端下发的级别和采样配置的客户端
+type samplingSource interface {
+	sampling(ctx context.Context, service string) (*alioth.RestorationSamplingResponse, error)
+}
+
+func (c *client) sampling(ctx context.Context, service string) (*alioth.RestorationSamplingResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(initialize.GlobalConfig().Grpc.TimeoutSeconds)*time.Second)
+	defer cancel()
+	return c.conn.RestorationSampling(ctx, &alioth.RestorationSamplingRequest{CallerService: service})
+}
+
+func (c *externalClient) sampling(ctx context.Context, service string) (*alioth.RestorationSamplingResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(initialize.GlobalConfig().Http.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	httpRequest, buildHttpRequestErr := http.NewRequestWithContext(ctx, http.MethodGet, c.samplingEndpoint+"?service="+url.QueryEscape(service), nil)
+	if buildHttpRequestErr != nil {
+		return nil, fmt.Errorf("failed to build http request: %w", buildHttpRequestErr)
+	}
+	c.credentials.apply(httpRequest)
+
+	httpResponse, sendHttpRequestErr := http.DefaultClient.Do(httpRequest)
+	if sendHttpRequestErr != nil {
+		return nil, fmt.Errorf("failed to send http request: %w", sendHttpRequestErr)
+	}
+	defer func() { _ = httpResponse.Body.Close() }()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to send http request: %w", errors.NewRestorationExternalResponseError(httpResponse.StatusCode))
+	}
+
+	response := struct {
+		Data *alioth.RestorationSamplingResponse `json:"data"`
+	}{}
+	if decodeErr := json.NewDecoder(httpResponse.Body).Decode(&response); decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode sampling response: %w", decodeErr)
+	} else if response.Data == nil {
+		return &alioth.RestorationSamplingResponse{}, nil
+	}
+	return response.Data, nil
+}
+
+// samplingPolicy 日志收集器的级别和采样策略
+type samplingPolicy struct {
+	minLevel        string
+	rates           map[string]float64
+	traceConsistent bool
+}
+
+// sampler 在发送前过滤日志，服务端下发的配置会覆盖本地配置，服务端移除配置后恢复使用本地配置
+type sampler struct {
+	mtx     sync.RWMutex
+	local   samplingPolicy
+	current samplingPolicy
+}
+
+func newSampler(options CollectorOptions) *sampler {
+	local := samplingPolicy{
+		minLevel:        strings.ToLower(options.MinLevel),
+		rates:           options.SampleRates,
+		traceConsistent: options.TraceConsistentSampling,
+	}
+	return &sampler{local: local, current: local}
+}
+
+// keep 判断是否保留日志，开启 trace 一致采样时同一个 trace_id 的日志在采样率相同的级别上会全部保留或者全部丢弃
+//   - level: 日志级别
+//   - traceID: 日志的 trace_id，为空时随机采样
+func (s *sampler) keep(level, traceID string) bool {
+	s.mtx.RLock()
+	policy := s.current
+	s.mtx.RUnlock()
+
+	if policy.minLevel != "" {
+		// 使用和服务端校验配置相同的级别顺序，无法识别的级别视为 debug
+		rank, _ := log.LevelRank(level)
+		if minRank, _ := log.LevelRank(policy.minLevel); rank < minRank {
+			return false
+		}
+	}
+
+	rate, exist := policy.rates[level]
+	switch {
+	case !exist || rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	case policy.traceConsistent && traceID != "":
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(traceID))
+		return float64(hash.Sum64())/math.MaxUint64 < rate
+	default:
+		return rand.Float64() < rate
+	}
+}
+
+// apply 应用服务端下发的配置，没有下发配置时恢复使用本地配置
+//   - response: 服务端下发的配置
+func (s *sampler) apply(response *alioth.RestorationSamplingResponse) {
+	policy := s.local
+	if response.GetFound() {
+		if response.GetMinLevel() != "" {
+			policy.minLevel = strings.ToLower(response.GetMinLevel())
+		}
+		rates := make(map[string]float64, len(s.local.rates)+len(response.GetRates()))
+		for level, rate := range s.local.rates {
+			rates[level] = rate
+		}
+		for level, rate := range response.GetRates() {
+			rates[strings.ToLower(level)] = rate
+		}
+		policy.rates = rates
+		policy.traceConsistent = policy.traceConsistent || response.GetTraceConsistent()
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.current = policy
+}
+
+// poll 定时拉取服务端下发的配置，直到 stop 被关闭，拉取失败时保留当前的配置
+//   - source: 拉取配置使用的客户端
+//   - service: 日志收集器的服务名称
+//   - interval: 拉取间隔
+//   - stop: 停止拉取的信号
+func (s *sampler) poll(source samplingSource, service string, interval time.Duration, stop <-chan struct{}) {
+	refresh := func() {
+		if response, pollErr := source.sampling(context.Background(), service); pollErr != nil {
+			logger.Log(log.DefaultField().WithLevel(log.Debug).WithCaller(log.Module).
+				WithMessage("failed to poll restoration sampling").WithExtra(pollErr.Error()))
+		} else {
+			s.apply(response)
+		}
+	}
+
+	refresh()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package restoration
+
+import (
+	"strconv"
+	"testing"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+func TestSamplerKeep(t *testing.T) {
+	cases := []struct {
+		name    string
+		options CollectorOptions
+		level   string
+		traceID string
+		keep    bool
+	}{
+		{name: "no policy", level: "debug", keep: true},
+		{name: "below min level", options: CollectorOptions{MinLevel: "warn"}, level: "info", keep: false},
+		{name: "at min level", options: CollectorOptions{MinLevel: "warn"}, level: "warn", keep: true},
+		{name: "panic above error", options: CollectorOptions{MinLevel: "error"}, level: "panic", keep: true},
+		{name: "min level case insensitive", options: CollectorOptions{MinLevel: "ERROR"}, level: "warn", keep: false},
+		{name: "rate zero", options: CollectorOptions{SampleRates: map[string]float64{"info": 0}}, level: "info", keep: false},
+		{name: "rate one", options: CollectorOptions{SampleRates: map[string]float64{"info": 1}}, level: "info", keep: true},
+		{name: "rate of other level", options: CollectorOptions{SampleRates: map[string]float64{"info": 0}}, level: "error", keep: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if keep := newSampler(c.options).keep(c.level, c.traceID); keep != c.keep {
+				t.Errorf("keep(%s) = %v, want %v", c.level, keep, c.keep)
+			}
+		})
+	}
+}
+
+func TestSamplerTraceConsistent(t *testing.T) {
+	s := newSampler(CollectorOptions{SampleRates: map[string]float64{"info": 0.5, "warn": 0.5}, TraceConsistentSampling: true})
+
+	// 同一个 trace_id 在采样率相同的级别上的结果一致，不同的 trace_id 大约保留一半
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		traceID := "trace-" + strconv.Itoa(i)
+		keep := s.keep("info", traceID)
+		if s.keep("warn", traceID) != keep || s.keep("info", traceID) != keep {
+			t.Fatalf("trace %s sampled inconsistently", traceID)
+		}
+		if keep {
+			kept++
+		}
+	}
+	if kept < 400 || kept > 600 {
+		t.Errorf("kept %d of 1000 traces, want about 500", kept)
+	}
+}
+
+func TestSamplerApply(t *testing.T) {
+	s := newSampler(CollectorOptions{MinLevel: "info", SampleRates: map[string]float64{"info": 1, "debug": 0}})
+
+	cases := []struct {
+		name     string
+		response *alioth.RestorationSamplingResponse
+		level    string
+		keep     bool
+	}{
+		{name: "local policy", response: &alioth.RestorationSamplingResponse{}, level: "warn", keep: true},
+		{name: "server min level", response: &alioth.RestorationSamplingResponse{Found: true, MinLevel: "ERROR"}, level: "warn", keep: false},
+		{name: "server min level allows panic", response: &alioth.RestorationSamplingResponse{Found: true, MinLevel: "error"}, level: "panic", keep: true},
+		{name: "server rates merged with local rates", response: &alioth.RestorationSamplingResponse{Found: true, Rates: map[string]float64{"INFO": 0}}, level: "info", keep: false},
+		{name: "local min level kept without server min level", response: &alioth.RestorationSamplingResponse{Found: true, Rates: map[string]float64{"debug": 1}}, level: "debug", keep: false},
+		{name: "restore local policy", response: &alioth.RestorationSamplingResponse{Found: false, MinLevel: "panic"}, level: "info", keep: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s.apply(c.response)
+			if keep := s.keep(c.level, ""); keep != c.keep {
+				t.Errorf("keep(%s) = %v, want %v", c.level, keep, c.keep)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package restoration
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/lifecycle"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+// clientPackage 日志收集器所在的包，这个包内产生的日志不会被转发，避免发送失败的日志再次被转发
+var clientPackage = reflect.TypeOf(collector{}).PkgPath() + "."
+
+// collectorSink 将 log.Logger 的日志转发到日志收集器的输出目标
+type collectorSink struct {
+	collector Collector
+}
+
+// NewCollectorSink 创建将 log.Logger 的日志转发到日志收集器的输出目标，通过 Logger.AddSink 添加
+//   - collector: 日志收集器，由调用方负责关闭
+//
+// function 和 filepath 作为调用位置，trace_id 作为日志的 trace_id，extra 作为 extra_fields，其他字段作为结构化字段，
+// panic 级别视为 error，日志收集器自身产生的日志不会被转发
+func NewCollectorSink(collector Collector) log.Sink {
+	return &collectorSink{collector: collector}
+}
+
+func (s *collectorSink) Write(entry log.Entry) error {
+	function, _ := entry.Fields["function"].(string)
+	if strings.HasPrefix(function, clientPackage) {
+		return nil
+	}
+
+	frame := runtime.Frame{Function: function}
+	if location, isString := entry.Fields["filepath"].(string); isString {
+		if separator := strings.LastIndexByte(location, ':'); separator > 0 {
+			frame.File = location[:separator]
+			frame.Line, _ = strconv.Atoi(location[separator+1:])
+		}
+	}
+	f := newCollectionAt(context.Background(), entry.Message, entry.Time, frame)
+
+	for key, value := range entry.Fields {
+		if err, isError := value.(error); isError {
+			value = err.Error()
+		}
+		switch key {
+		case "function", "filepath":
+		case "caller_type":
+			f.withCaller(strings.ToLower(fmtString(value)))
+		case "trace_id":
+			f.traceID = fmtString(value)
+		case "extra":
+			f.extraFields = value
+		default:
+			f.WithField(key, value)
+		}
+	}
+
+	level := string(entry.Level)
+	if entry.Level == log.Panic {
+		level = "error"
+	}
+	logAt(s.collector, level, f)
+	return nil
+}
+
+// Close 日志收集器由调用方关闭，这里不做任何操作
+func (s *collectorSink) Close() error {
+	return nil
+}
+
+// CollectorHook 创建停止时关闭日志收集器的生命周期钩子，关闭时会发送缓冲区中剩余的日志，
+// 需要在通过 NewCollectorSink 转发到这个日志收集器的日志对象的钩子之前添加，保证日志对象先写入剩余的日志
+//   - collector: 日志收集器
+func CollectorHook(collector Collector) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name:   "restoration collector",
+		OnStop: collector.Close,
+	}
+}
+
+// fmtString 将字符串或者字符串类型的值转换为字符串，如 log.LoggerCaller
+func fmtString(value any) string {
+	if reflected := reflect.ValueOf(value); reflected.Kind() == reflect.String {
+		return reflected.String()
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package restoration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+func TestCollectorSink(t *testing.T) {
+	s := &requestSender{}
+	options := DefaultCollectorOptions()
+	options.FlushInterval = time.Hour
+	c := newCollector("sink-test", s, nil, options)
+	sink := NewCollectorSink(c)
+
+	calledAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := log.Entry{
+		Time:    calledAt,
+		Level:   log.Panic,
+		Message: "payment failed",
+		Fields: map[string]any{
+			"function":    "main.handle",
+			"filepath":    "/app/main.go:12",
+			"caller_type": log.Module,
+			"trace_id":    "trace",
+			"extra":       map[string]any{"region": "cn"},
+			"order":       "o1",
+			"err":         errors.New("timeout"),
+		},
+	}
+	if writeErr := sink.Write(entry); writeErr != nil {
+		t.Fatalf("write: %v", writeErr)
+	}
+	if closeErr := c.Close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+
+	if len(s.records) != 1 {
+		t.Fatalf("forwarded %d records, want 1", len(s.records))
+	}
+	record := s.records[0]
+	if record.GetMessage() != "payment failed" || record.GetLevel() != "error" || record.GetCallerService() != "sink-test" {
+		t.Errorf("forwarded %q at %s from %s, want the message at error from sink-test", record.GetMessage(), record.GetLevel(), record.GetCallerService())
+	}
+	if record.GetCodePath() != "/app/main.go:12" || record.GetCalledFunction() != "main.handle" || record.GetCalledAt() != calledAt.Format(global.AliothTimeFormat) {
+		t.Errorf("forwarded from %s in %s at %s, want the logger's caller and time", record.GetCodePath(), record.GetCalledFunction(), record.GetCalledAt())
+	}
+	if record.GetTraceId() != "trace" || record.GetCallerType() != "module" {
+		t.Errorf("trace id %q and caller type %q, want trace and module", record.GetTraceId(), record.GetCallerType())
+	}
+	if string(record.GetExtraFields()) != `{"region":"cn"}` || string(record.GetFields()) != `{"err":"timeout","order":"o1"}` {
+		t.Errorf("extra fields %s and fields %s", record.GetExtraFields(), record.GetFields())
+	}
+}
+
+func TestCollectorSinkSkipsClientPackage(t *testing.T) {
+	s := &requestSender{}
+	options := DefaultCollectorOptions()
+	options.FlushInterval = time.Hour
+	c := newCollector("sink-test", s, nil, options)
+	sink := NewCollectorSink(c)
+
+	// 只跳过日志收集器自身产生的日志，同名前缀的服务端包和子包的日志仍然转发
+	functions := map[string]bool{
+		clientPackage + "(*collector).logField":                                       false,
+		clientPackage + "(*buffer).send.func1":                                        false,
+		"studio.sunist.work/platform/alioth-center/core/restoration.(*Service).Collect": true,
+		"studio.sunist.work/platform/alioth-center/core/restoration/clientutil.Send":    true,
+		"main.handle": true,
+	}
+	for function := range functions {
+		if writeErr := sink.Write(log.Entry{Level: log.Info, Message: function, Fields: map[string]any{"function": function}}); writeErr != nil {
+			t.Fatalf("write %s: %v", function, writeErr)
+		}
+	}
+	if closeErr := c.Close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+
+	forwarded := map[string]bool{}
+	for _, record := range s.records {
+		forwarded[record.GetMessage()] = true
+	}
+	for function, want := range functions {
+		if forwarded[function] != want {
+			t.Errorf("%s forwarded %v, want %v", function, forwarded[function], want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package restoration
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+const (
+	// ParamsKey 适配其他日志框架时，这个键对应的属性会作为 input_fields 发送
+	ParamsKey = "params"
+	// ProcessingKey 适配其他日志框架时，这个键对应的属性会作为 payload_fields 发送
+	ProcessingKey = "processing"
+)
+
+// slogHandler 将 slog 的日志转发到日志收集器的 slog.Handler
+type slogHandler struct {
+	collector Collector
+	level     slog.Leveler
+	attrs     []groupedAttr
+	groups    []string
+}
+
+// groupedAttr 通过 WithAttrs 添加的属性，以及添加时所在的分组
+type groupedAttr struct {
+	groups []string
+	attr   slog.Attr
+}
+
+// NewSlogHandler 创建一个将日志转发到日志收集器的 slog.Handler
+//   - collector: 日志收集器
+//   - level: 最低级别，为 nil 时使用 slog.LevelInfo
+//
+// 键为 ParamsKey 和 ProcessingKey 的属性分别作为 input_fields 和 payload_fields，其他属性作为 extra_fields，
+// 值为 error 的属性会同时作为日志关联的错误，trace_id 从 ctx 中获取，调用位置使用 slog 记录的位置
+func NewSlogHandler(collector Collector, level slog.Leveler) slog.Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &slogHandler{collector: collector, level: level}
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *slogHandler) Handle(ctx context.Context, record slog.Record) error {
+	var frame runtime.Frame
+	if record.PC != 0 {
+		frame, _ = runtime.CallersFrames([]uintptr{record.PC}).Next()
+	}
+	calledAt := record.Time
+	if calledAt.IsZero() {
+		calledAt = time.Now()
+	}
+	f := newCollectionAt(ctx, record.Message, calledAt, frame)
+
+	root := map[string]any{}
+	for _, preset := range h.attrs {
+		addSlogAttr(f, root, preset.groups, preset.attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		addSlogAttr(f, root, h.groups, attr)
+		return true
+	})
+	applyAttributes(f, root)
+
+	logAt(h.collector, slogLevel(record.Level), f)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	next := *h
+	next.attrs = make([]groupedAttr, len(h.attrs), len(h.attrs)+len(attrs))
+	copy(next.attrs, h.attrs)
+	for _, attr := range attrs {
+		next.attrs = append(next.attrs, groupedAttr{groups: h.groups, attr: attr})
+	}
+	return &next
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := *h
+	next.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &next
+}
+
+// slogLevel 将 slog 的级别转换为日志收集器的级别，低于 info 视为 debug，高于 error 视为 error
+func slogLevel(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "debug"
+	case level < slog.LevelWarn:
+		return "info"
+	case level < slog.LevelError:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// addSlogAttr 将属性写入分组对应的 map，值为 error 时同时记录为日志关联的错误
+//   - f: 日志字段
+//   - root: 所有属性组成的 map
+//   - groups: 属性所在的分组
+//   - attr: 属性
+func addSlogAttr(f *fields, root map[string]any, groups []string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	target := root
+	for _, group := range groups {
+		next, isMap := target[group].(map[string]any)
+		if !isMap {
+			next = map[string]any{}
+			target[group] = next
+		}
+		target = next
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		// 没有键的分组属于当前分组
+		if attr.Key == "" {
+			for _, member := range attr.Value.Group() {
+				addSlogAttr(f, target, nil, member)
+			}
+			return
+		}
+		for _, member := range attr.Value.Group() {
+			addSlogAttr(f, target, []string{attr.Key}, member)
+		}
+		return
+	}
+
+	target[attr.Key] = slogValue(f, attr.Value)
+}
+
+// slogValue 将属性值转换为可以序列化为 json 的值
+func slogValue(f *fields, value slog.Value) any {
+	switch value.Kind() {
+	case slog.KindTime:
+		return value.Time().Format(time.RFC3339Nano)
+	case slog.KindDuration:
+		return value.Duration().String()
+	case slog.KindAny:
+		if err, isError := value.Any().(error); isError {
+			if f.err == nil {
+				f.err = newRestorationError(err, callerStack(1, f.calledFunction))
+			}
+			return err.Error()
+		}
+		return value.Any()
+	default:
+		return value.Any()
+	}
+}
+
+// applyAttributes 将 ParamsKey 和 ProcessingKey 对应的属性作为 input_fields 和 payload_fields，其他属性作为 extra_fields
+//   - f: 日志字段
+//   - attributes: 所有属性组成的 map，会被修改
+func applyAttributes(f *fields, attributes map[string]any) {
+	if params, exist := attributes[ParamsKey]; exist {
+		f.inputFields = params
+		delete(attributes, ParamsKey)
+	}
+	if processing, exist := attributes[ProcessingKey]; exist {
+		f.payloadFields = processing
+		delete(attributes, ProcessingKey)
+	}
+	if len(attributes) > 0 {
+		f.extraFields = attributes
+	}
+}
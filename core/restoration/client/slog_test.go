@@ -0,0 +1,76 @@
+package restoration
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
+)
+
+func TestSlogHandler(t *testing.T) {
+	s := &requestSender{}
+	options := DefaultCollectorOptions()
+	options.FlushInterval = time.Hour
+	c := newCollector("slog-test", s, nil, options)
+	logger := slog.New(NewSlogHandler(c, nil)).With("service", "order")
+
+	ctx := utils.AddTraceID(context.Background())
+	traceID, _ := utils.GetTraceID(ctx)
+	logger.InfoContext(ctx, "created", ParamsKey, map[string]int{"id": 1}, ProcessingKey, "paid", slog.Group("user", "id", "u1"), "err", errors.New("timeout"))
+	logger.WithGroup("request").With("path", "/pay").Warn("grouped", "status", 500, slog.Group("", "inline", true))
+	logger.Debug("below the level")
+	if closeErr := c.Close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+
+	if len(s.records) != 2 {
+		t.Fatalf("forwarded %d records, want 2", len(s.records))
+	}
+
+	// 属性按照键拆分为 input_fields、payload_fields 和 extra_fields，error 同时作为日志关联的错误
+	created := s.records[0]
+	if created.GetLevel() != "info" || created.GetTraceId() != traceID || !strings.HasSuffix(created.GetCalledFunction(), "TestSlogHandler") {
+		t.Errorf("forwarded at %s with trace id %q from %s, want info with %q from the test", created.GetLevel(), created.GetTraceId(), created.GetCalledFunction(), traceID)
+	}
+	if string(created.GetInputFields()) != `{"id":1}` || string(created.GetPayloadFields()) != `"paid"` {
+		t.Errorf("input fields %s and payload fields %s", created.GetInputFields(), created.GetPayloadFields())
+	}
+	if want := `{"err":"timeout","service":"order","user":{"id":"u1"}}`; string(created.GetExtraFields()) != want {
+		t.Errorf("extra fields %s, want %s", created.GetExtraFields(), want)
+	}
+	if created.GetError().GetType() != "*errors.errorString" || created.GetError().GetMessage() != "timeout" || created.GetError().GetStack() == "" {
+		t.Errorf("error %v, want the timeout error with a stack", created.GetError())
+	}
+
+	// WithGroup 之后添加的属性写入分组，之前添加的属性保留在根上
+	grouped := s.records[1]
+	if want := `{"request":{"inline":true,"path":"/pay","status":500},"service":"order"}`; grouped.GetLevel() != "warn" || string(grouped.GetExtraFields()) != want {
+		t.Errorf("forwarded %s at %s, want %s at warn", grouped.GetExtraFields(), grouped.GetLevel(), want)
+	}
+}
+
+func TestSlogLevel(t *testing.T) {
+	cases := map[slog.Level]string{
+		slog.LevelDebug - 4: "debug",
+		slog.LevelDebug:     "debug",
+		slog.LevelInfo:      "info",
+		slog.LevelInfo + 2:  "info",
+		slog.LevelWarn:      "warn",
+		slog.LevelError:     "error",
+		slog.LevelError + 4: "error",
+	}
+	for level, want := range cases {
+		if got := slogLevel(level); got != want {
+			t.Errorf("slogLevel(%v) = %s, want %s", level, got, want)
+		}
+	}
+
+	handler := NewSlogHandler(&flushCountingCollector{}, slog.LevelWarn)
+	if handler.Enabled(context.Background(), slog.LevelInfo) || !handler.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("handler should only enable levels from warn")
+	}
+}
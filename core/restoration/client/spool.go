@@ -0,0 +1,427 @@
+package restoration
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+const (
+	spoolSegmentSuffix = ".spool"
+	// spoolSegmentMaxAge 单个分段最长的写入时间，超过后切换到新的分段，使分段的最后写入时间可以限制其中所有日志的暂存时间
+	spoolSegmentMaxAge = time.Minute
+)
+
+// spoolSegment 暂存区中的一个分段文件
+type spoolSegment struct {
+	sequence  uint64
+	size      int64
+	records   int
+	writtenAt time.Time // 最后一次写入的时间，恢复的分段使用文件的修改时间
+}
+
+// spool 基于文件的日志暂存区，服务端不可用时按顺序保存日志，进程重启后仍然可以读取
+//
+// 日志按照 [4 字节长度][protobuf 编码的日志] 的格式追加到分段文件中，单个分段超过 segmentSize 时切换到新的分段，
+// 所有分段超过 maxSize 时删除最早的分段，暂存超过 maxAge 的分段在重放前删除，删除的日志条数计入 dropped
+//
+// 服务端只在去重的时间窗口内按照 record_id 去重，maxAge 需要不超过这个窗口，否则部分发送成功的分段在很久之后重放时会被重复接收，
+// 单个分段最多写入 segmentAge，分段最后写入的时间超过 maxAge - segmentAge 时删除，保证其中最早的日志也没有超过 maxAge
+type spool struct {
+	mtx         sync.Mutex
+	dir         string
+	segmentSize int64
+	maxSize     int64
+	maxAge      time.Duration
+	segmentAge  time.Duration
+	segments    []spoolSegment
+	current     *os.File
+	currentAt   time.Time
+	dropped     uint64
+}
+
+// newSpool 创建暂存区，并恢复目录中上次进程遗留的分段
+//   - dir: 暂存区目录
+//   - segmentSize: 单个分段文件的大小上限
+//   - maxSize: 所有分段文件的大小上限
+//   - maxAge: 日志最长的暂存时间，为 0 时不按照时间删除
+func newSpool(dir string, segmentSize, maxSize int64, maxAge time.Duration) (s *spool, err error) {
+	if mkdirErr := os.MkdirAll(dir, 0o755); mkdirErr != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", mkdirErr)
+	}
+
+	entries, readDirErr := os.ReadDir(dir)
+	if readDirErr != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", readDirErr)
+	}
+
+	// 恢复上次进程遗留的分段
+	s = &spool{dir: dir, segmentSize: segmentSize, maxSize: maxSize, maxAge: maxAge, segmentAge: spoolSegmentMaxAge}
+	if maxAge > 0 && maxAge/2 < s.segmentAge {
+		s.segmentAge = maxAge / 2
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), spoolSegmentSuffix) {
+			continue
+		}
+		sequence, parseErr := strconv.ParseUint(strings.TrimSuffix(entry.Name(), spoolSegmentSuffix), 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		if info, infoErr := entry.Info(); infoErr == nil {
+			s.segments = append(s.segments, spoolSegment{
+				sequence:  sequence,
+				size:      info.Size(),
+				records:   countSpoolRecords(filepath.Join(dir, entry.Name())),
+				writtenAt: info.ModTime(),
+			})
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].sequence < s.segments[j].sequence })
+
+	return s, nil
+}
+
+// countSpoolRecords 统计分段文件中完整的日志条数，只读取长度不解析日志
+//   - path: 分段文件路径
+func countSpoolRecords(path string) (records int) {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return 0
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, 4)
+	for {
+		if _, readErr := io.ReadFull(reader, header); readErr != nil {
+			return records
+		}
+		length := int64(binary.BigEndian.Uint32(header))
+		if discarded, discardErr := reader.Discard(int(length)); discardErr != nil || int64(discarded) != length {
+			return records
+		}
+		records++
+	}
+}
+
+func (s *spool) segmentPath(sequence uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", sequence, spoolSegmentSuffix))
+}
+
+// empty 检查暂存区中是否有未重放的日志
+func (s *spool) empty() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.segments) == 0
+}
+
+// write 将日志追加到当前分段中，需要时切换分段并删除最早的分段
+//   - records: 需要暂存的日志
+func (s *spool) write(records []*alioth.RestorationCollectionRequest) (err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// 序列化日志
+	var payload []byte
+	for _, record := range records {
+		encoded, marshalErr := proto.Marshal(record)
+		if marshalErr != nil {
+			return fmt.Errorf("failed to marshal spool record: %w", marshalErr)
+		}
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(encoded)))
+		payload = append(payload, encoded...)
+	}
+
+	// 当前分段已满或者写入的时间过长时切换到新的分段
+	if s.current == nil || s.segments[len(s.segments)-1].size >= s.segmentSize || time.Since(s.currentAt) >= s.segmentAge {
+		if rotateErr := s.rotate(); rotateErr != nil {
+			return rotateErr
+		}
+	}
+
+	if _, writeErr := s.current.Write(payload); writeErr != nil {
+		return fmt.Errorf("failed to write spool segment: %w", writeErr)
+	} else if syncErr := s.current.Sync(); syncErr != nil {
+		return fmt.Errorf("failed to sync spool segment: %w", syncErr)
+	}
+	s.segments[len(s.segments)-1].size += int64(len(payload))
+	s.segments[len(s.segments)-1].records += len(records)
+	s.segments[len(s.segments)-1].writtenAt = time.Now()
+
+	s.truncate()
+	return nil
+}
+
+// rotate 关闭当前分段，并创建一个新的分段
+func (s *spool) rotate() (err error) {
+	if s.current != nil {
+		_ = s.current.Close()
+		s.current = nil
+	}
+
+	sequence := uint64(1)
+	if len(s.segments) > 0 {
+		sequence = s.segments[len(s.segments)-1].sequence + 1
+	}
+
+	file, openErr := os.OpenFile(s.segmentPath(sequence), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if openErr != nil {
+		return fmt.Errorf("failed to open spool segment: %w", openErr)
+	}
+	s.current, s.currentAt = file, time.Now()
+	s.segments = append(s.segments, spoolSegment{sequence: sequence, writtenAt: s.currentAt})
+	return nil
+}
+
+// truncate 所有分段超过 maxSize 时删除最早的分段，不会删除正在写入的分段
+func (s *spool) truncate() {
+	total := int64(0)
+	for _, segment := range s.segments {
+		total += segment.size
+	}
+
+	for total > s.maxSize && len(s.segments) > 1 {
+		if removeErr := os.Remove(s.segmentPath(s.segments[0].sequence)); removeErr != nil && !os.IsNotExist(removeErr) {
+			return
+		}
+		total -= s.segments[0].size
+		s.dropped += uint64(s.segments[0].records)
+		s.segments = s.segments[1:]
+	}
+}
+
+// expire 删除暂存时间可能超过 maxAge 的分段，如果删除的是正在写入的分段，会先关闭它
+func (s *spool) expire() {
+	if s.maxAge <= 0 {
+		return
+	}
+
+	for len(s.segments) > 0 && time.Since(s.segments[0].writtenAt) > s.maxAge-s.segmentAge {
+		if len(s.segments) == 1 && s.current != nil {
+			_ = s.current.Close()
+			s.current = nil
+		}
+		if removeErr := os.Remove(s.segmentPath(s.segments[0].sequence)); removeErr != nil && !os.IsNotExist(removeErr) {
+			return
+		}
+		s.dropped += uint64(s.segments[0].records)
+		s.segments = s.segments[1:]
+	}
+}
+
+// oldest 读取最早的分段中的所有日志，如果读取的是正在写入的分段，会先关闭它，后续的日志写入新的分段，
+// 读取前会删除暂存时间超过 maxAge 的分段，这些日志即使重放也可能已经无法被服务端去重
+func (s *spool) oldest() (sequence uint64, records []*alioth.RestorationCollectionRequest, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.expire()
+	if len(s.segments) == 0 {
+		return 0, nil, nil
+	}
+	sequence = s.segments[0].sequence
+	if len(s.segments) == 1 && s.current != nil {
+		_ = s.current.Close()
+		s.current = nil
+	}
+
+	file, openErr := os.Open(s.segmentPath(sequence))
+	if openErr != nil {
+		return sequence, nil, fmt.Errorf("failed to open spool segment: %w", openErr)
+	}
+	defer func() { _ = file.Close() }()
+
+	// 逐条读取日志，末尾不完整的日志说明写入时进程退出，直接忽略
+	reader := bufio.NewReader(file)
+	header := make([]byte, 4)
+	for {
+		if _, readErr := io.ReadFull(reader, header); readErr != nil {
+			break
+		}
+		encoded := make([]byte, binary.BigEndian.Uint32(header))
+		if _, readErr := io.ReadFull(reader, encoded); readErr != nil {
+			break
+		}
+		record := &alioth.RestorationCollectionRequest{}
+		if unmarshalErr := proto.Unmarshal(encoded, record); unmarshalErr != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return sequence, records, nil
+}
+
+// remove 删除已经重放成功的分段
+//   - sequence: 分段序号
+func (s *spool) remove(sequence uint64) (err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if len(s.segments) == 0 || s.segments[0].sequence != sequence {
+		return nil
+	}
+	if len(s.segments) == 1 && s.current != nil {
+		_ = s.current.Close()
+		s.current = nil
+	}
+	if removeErr := os.Remove(s.segmentPath(sequence)); removeErr != nil && !os.IsNotExist(removeErr) {
+		return fmt.Errorf("failed to remove spool segment: %w", removeErr)
+	}
+	s.segments = s.segments[1:]
+	return nil
+}
+
+// droppedRecords 获取因为超过 maxSize 而删除的日志条数
+func (s *spool) droppedRecords() uint64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.dropped
+}
+
+func (s *spool) close() (err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.current != nil {
+		err = s.current.Close()
+		s.current = nil
+	}
+	return err
+}
+
+// spoolSender 带有文件暂存区的传输层，发送失败的日志会写入暂存区，恢复后按照顺序先重放暂存区中的日志
+//
+// 重放时整个分段会重新发送，部分发送成功的日志由服务端按照 record_id 去重
+type spoolSender struct {
+	mtx       sync.Mutex
+	next      sender
+	spool     *spool
+	batchSize int
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newSpoolSender(next sender, options CollectorOptions) (s *spoolSender, err error) {
+	sp, newSpoolErr := newSpool(options.SpoolDir, options.SpoolSegmentSize, options.SpoolMaxSize, options.SpoolMaxAge)
+	if newSpoolErr != nil {
+		return nil, newSpoolErr
+	}
+
+	s = &spoolSender{
+		next:      next,
+		spool:     sp,
+		batchSize: options.BatchSize,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go s.serve(options.SpoolReplayInterval)
+	return s, nil
+}
+
+// replay 按照顺序重放暂存区中的所有分段，遇到失败时停止
+func (s *spoolSender) replay(ctx context.Context) (err error) {
+	for !s.spool.empty() {
+		sequence, records, readErr := s.spool.oldest()
+		if readErr != nil {
+			return readErr
+		}
+
+		for start := 0; start < len(records); start += s.batchSize {
+			end := start + s.batchSize
+			if end > len(records) {
+				end = len(records)
+			}
+			if sendErr := s.next.send(ctx, records[start:end]); sendErr != nil {
+				return sendErr
+			}
+		}
+
+		if removeErr := s.spool.remove(sequence); removeErr != nil {
+			return removeErr
+		}
+	}
+	return nil
+}
+
+func (s *spoolSender) send(ctx context.Context, records []*alioth.RestorationCollectionRequest) (err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// 暂存区中还有日志时，需要先重放，保证日志的顺序
+	if replayErr := s.replay(ctx); replayErr != nil {
+		return s.spool.write(records)
+	}
+
+	if sendErr := s.next.send(ctx, records); sendErr != nil {
+		if writeErr := s.spool.write(records); writeErr != nil {
+			return fmt.Errorf("failed to spool records: %w, send error: %w", writeErr, sendErr)
+		}
+	}
+	return nil
+}
+
+// serve 定时重放暂存区中的日志，保证没有新日志时也能恢复
+func (s *spoolSender) serve(interval time.Duration) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mtx.Lock()
+			_ = s.replay(context.Background())
+			s.mtx.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// close 停止定时重放并关闭暂存区和下一层传输层，重复调用时返回第一次关闭的结果
+func (s *spoolSender) close() (err error) {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.stopped
+
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		s.closeErr = s.spool.close()
+		if closable, ok := s.next.(closableSender); ok {
+			if closeErr := closable.close(); closeErr != nil && s.closeErr == nil {
+				s.closeErr = closeErr
+			}
+		}
+	})
+	return s.closeErr
+}
+
+// dropped 获取暂存区超过大小上限时删除的日志条数
+func (s *spoolSender) dropped() uint64 {
+	return s.spool.droppedRecords()
+}
+
+// withSpool 如果配置了暂存区目录，为传输层添加文件暂存区
+func withSpool(next sender, options CollectorOptions) (s sender, err error) {
+	if options.SpoolDir == "" {
+		return next, nil
+	}
+	return newSpoolSender(next, options)
+}
@@ -0,0 +1,236 @@
+package restoration
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+func spoolBatch(from, count int) []*alioth.RestorationCollectionRequest {
+	records := make([]*alioth.RestorationCollectionRequest, count)
+	for i := range records {
+		records[i] = &alioth.RestorationCollectionRequest{Message: strconv.Itoa(from + i)}
+	}
+	return records
+}
+
+func spoolMessages(records []*alioth.RestorationCollectionRequest) []string {
+	messages := make([]string, len(records))
+	for i, record := range records {
+		messages[i] = record.GetMessage()
+	}
+	return messages
+}
+
+func TestSpoolSegments(t *testing.T) {
+	// 每条日志编码后为 4 字节长度加上 3 字节的 protobuf，一个批次 2 条日志为 14 字节
+	cases := []struct {
+		name        string
+		segmentSize int64
+		maxSize     int64
+		batches     int
+		segments    int
+		oldest      []string
+		dropped     uint64
+	}{
+		{name: "single segment", segmentSize: 1 << 20, maxSize: 1 << 20, batches: 3, segments: 1, oldest: []string{"0", "1", "2", "3", "4", "5"}},
+		{name: "rotate per batch", segmentSize: 10, maxSize: 1 << 20, batches: 3, segments: 3, oldest: []string{"0", "1"}},
+		{name: "rotate every two batches", segmentSize: 20, maxSize: 1 << 20, batches: 3, segments: 2, oldest: []string{"0", "1", "2", "3"}},
+		{name: "truncate oldest segments", segmentSize: 10, maxSize: 30, batches: 4, segments: 2, oldest: []string{"4", "5"}, dropped: 4},
+		{name: "never truncate the current segment", segmentSize: 1 << 20, maxSize: 10, batches: 3, segments: 1, oldest: []string{"0", "1", "2", "3", "4", "5"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, newSpoolErr := newSpool(t.TempDir(), c.segmentSize, c.maxSize, 0)
+			if newSpoolErr != nil {
+				t.Fatalf("new spool: %v", newSpoolErr)
+			}
+			defer func() { _ = s.close() }()
+
+			for i := 0; i < c.batches; i++ {
+				if writeErr := s.write(spoolBatch(i*2, 2)); writeErr != nil {
+					t.Fatalf("write batch %d: %v", i, writeErr)
+				}
+			}
+			if len(s.segments) != c.segments {
+				t.Errorf("segments %d, want %d", len(s.segments), c.segments)
+			}
+			if dropped := s.droppedRecords(); dropped != c.dropped {
+				t.Errorf("dropped %d, want %d", dropped, c.dropped)
+			}
+			if _, records, readErr := s.oldest(); readErr != nil {
+				t.Fatalf("read oldest: %v", readErr)
+			} else if messages := spoolMessages(records); !equalMessages(messages, c.oldest) {
+				t.Errorf("oldest %v, want %v", messages, c.oldest)
+			}
+		})
+	}
+}
+
+func TestSpoolRecover(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := newSpool(dir, 10, 1<<20, 0)
+	for i := 0; i < 3; i++ {
+		_ = s.write(spoolBatch(i*2, 2))
+	}
+	_ = s.close()
+
+	// 重新打开后恢复分段和每个分段的日志条数，继续写入新的分段
+	recovered, newSpoolErr := newSpool(dir, 10, 45, 0)
+	if newSpoolErr != nil {
+		t.Fatalf("recover spool: %v", newSpoolErr)
+	}
+	defer func() { _ = recovered.close() }()
+	if len(recovered.segments) != 3 {
+		t.Fatalf("recovered %d segments, want 3", len(recovered.segments))
+	}
+	for i, segment := range recovered.segments {
+		if segment.records != 2 {
+			t.Errorf("segment %d has %d records, want 2", i, segment.records)
+		}
+	}
+
+	_ = recovered.write(spoolBatch(6, 2))
+	if dropped := recovered.droppedRecords(); dropped != 2 {
+		t.Errorf("dropped %d, want 2", dropped)
+	}
+
+	// 按照顺序读取并删除所有分段
+	var replayed []string
+	for !recovered.empty() {
+		sequence, records, readErr := recovered.oldest()
+		if readErr != nil {
+			t.Fatalf("read oldest: %v", readErr)
+		}
+		replayed = append(replayed, spoolMessages(records)...)
+		if removeErr := recovered.remove(sequence); removeErr != nil {
+			t.Fatalf("remove segment: %v", removeErr)
+		}
+	}
+	if want := []string{"2", "3", "4", "5", "6", "7"}; !equalMessages(replayed, want) {
+		t.Errorf("replayed %v, want %v", replayed, want)
+	}
+}
+
+func TestSpoolExpire(t *testing.T) {
+	s, newSpoolErr := newSpool(t.TempDir(), 1<<20, 1<<20, 200*time.Millisecond)
+	if newSpoolErr != nil {
+		t.Fatalf("new spool: %v", newSpoolErr)
+	}
+	defer func() { _ = s.close() }()
+
+	// 分段最多写入 maxAge 的一半，之后的日志写入新的分段，过期时只删除旧的分段
+	_ = s.write(spoolBatch(0, 2))
+	time.Sleep(150 * time.Millisecond)
+	_ = s.write(spoolBatch(2, 2))
+	if len(s.segments) != 2 {
+		t.Fatalf("segments %d, want the old segment rotated", len(s.segments))
+	}
+
+	if _, records, readErr := s.oldest(); readErr != nil {
+		t.Fatalf("read oldest: %v", readErr)
+	} else if messages := spoolMessages(records); !equalMessages(messages, []string{"2", "3"}) {
+		t.Errorf("oldest %v, want the expired segment skipped", messages)
+	}
+	if dropped := s.droppedRecords(); dropped != 2 {
+		t.Errorf("dropped %d, want 2", dropped)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, records, _ := s.oldest(); len(records) != 0 || !s.empty() {
+		t.Errorf("read %v after every segment expired, want an empty spool", spoolMessages(records))
+	}
+}
+
+func TestSpoolExpireRecovered(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := newSpool(dir, 10, 1<<20, 0)
+	for i := 0; i < 2; i++ {
+		_ = s.write(spoolBatch(i*2, 2))
+	}
+	_ = s.close()
+
+	// 恢复的分段使用文件的修改时间，超过两个小时的分段不会再重放
+	old := time.Now().Add(-2 * time.Hour)
+	if chtimesErr := os.Chtimes(s.segmentPath(s.segments[0].sequence), old, old); chtimesErr != nil {
+		t.Fatalf("chtimes: %v", chtimesErr)
+	}
+	recovered, newSpoolErr := newSpool(dir, 10, 1<<20, time.Hour)
+	if newSpoolErr != nil {
+		t.Fatalf("recover spool: %v", newSpoolErr)
+	}
+	defer func() { _ = recovered.close() }()
+
+	if _, records, readErr := recovered.oldest(); readErr != nil {
+		t.Fatalf("read oldest: %v", readErr)
+	} else if messages := spoolMessages(records); !equalMessages(messages, []string{"2", "3"}) {
+		t.Errorf("oldest %v, want the expired segment skipped", messages)
+	}
+	if dropped := recovered.droppedRecords(); dropped != 2 {
+		t.Errorf("dropped %d, want 2", dropped)
+	}
+}
+
+func TestSpoolSender(t *testing.T) {
+	next := &recordingSender{failures: 1}
+	s, newSenderErr := newSpoolSender(next, CollectorOptions{
+		SpoolDir:            t.TempDir(),
+		SpoolSegmentSize:    1 << 20,
+		SpoolMaxSize:        1 << 20,
+		SpoolReplayInterval: time.Hour,
+		BatchSize:           10,
+	})
+	if newSenderErr != nil {
+		t.Fatalf("new spool sender: %v", newSenderErr)
+	}
+
+	// 第一次发送失败时写入暂存区，下一次发送时先重放暂存区，保证顺序
+	if sendErr := s.send(context.Background(), spoolBatch(0, 2)); sendErr != nil {
+		t.Fatalf("send should spool the failed batch: %v", sendErr)
+	}
+	if s.spool.empty() {
+		t.Fatal("failed batch should be spooled")
+	}
+	if sendErr := s.send(context.Background(), spoolBatch(2, 2)); sendErr != nil {
+		t.Fatalf("send: %v", sendErr)
+	}
+	if sent := next.sent(); !equalMessages(sent, []string{"0", "1", "2", "3"}) {
+		t.Errorf("sent %v, want [0 1 2 3]", sent)
+	}
+
+	// 重复关闭不会 panic
+	if closeErr := s.close(); closeErr != nil {
+		t.Errorf("close: %v", closeErr)
+	}
+	if closeErr := s.close(); closeErr != nil {
+		t.Errorf("close again: %v", closeErr)
+	}
+}
+
+func TestBufferDroppedIncludesSpool(t *testing.T) {
+	s, newSenderErr := newSpoolSender(&recordingSender{failures: 100}, CollectorOptions{
+		SpoolDir:            t.TempDir(),
+		SpoolSegmentSize:    10,
+		SpoolMaxSize:        30,
+		SpoolReplayInterval: time.Hour,
+		BatchSize:           2,
+	})
+	if newSenderErr != nil {
+		t.Fatalf("new spool sender: %v", newSenderErr)
+	}
+
+	b := newTestBuffer(s, 16, 2, 0, DropOldest)
+	enqueueMessages(b, 8)
+	_ = b.Flush(context.Background())
+	// 4 个批次写入 4 个分段，超过大小上限时删除了最早的 2 个分段
+	if dropped := b.Dropped(); dropped != 4 {
+		t.Errorf("dropped %d, want 4", dropped)
+	}
+	_ = b.Close(context.Background())
+	_ = b.Close(context.Background())
+}
@@ -0,0 +1,151 @@
+package restoration
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+const (
+	minReconnectInterval = time.Millisecond * 100
+	maxReconnectInterval = time.Second * 30
+)
+
+// streamClient restoration 客户端，使用 grpc 双向流保持长连接，每个批次都需要等待服务端确认
+//
+// 发送或者确认失败时会关闭当前的流，下一次发送时等待指数退避的时间后重新建立连接，
+// 服务端因为限流拒绝批次时保持当前的流，下一次发送时同样等待指数退避的时间，
+// 发送失败和被拒绝的批次由缓冲区保留，在退避之后再次发送
+type streamClient struct {
+	*client
+	stream            alioth.AliothRestoration_RestorationStreamClient
+	cancel            context.CancelFunc
+	sequence          int64
+	reconnectAt       time.Time
+	reconnectInterval time.Duration
+}
+
+func (c *streamClient) connect() (err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if stream, openStreamErr := c.conn.RestorationStream(ctx); openStreamErr != nil {
+		cancel()
+		c.backoff()
+		return fmt.Errorf("failed to open restoration stream: %w", openStreamErr)
+	} else {
+		c.stream, c.cancel = stream, cancel
+		return nil
+	}
+}
+
+// backoff 关闭当前的流，并推迟下一次重连的时间
+func (c *streamClient) backoff() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.stream, c.cancel = nil, nil
+	c.delay()
+}
+
+// delay 按照指数退避推迟下一次发送的时间，不关闭当前的流
+func (c *streamClient) delay() {
+	if c.reconnectInterval < minReconnectInterval {
+		c.reconnectInterval = minReconnectInterval
+	} else if c.reconnectInterval *= 2; c.reconnectInterval > maxReconnectInterval {
+		c.reconnectInterval = maxReconnectInterval
+	}
+	c.reconnectAt = time.Now().Add(c.reconnectInterval)
+}
+
+func (c *streamClient) send(ctx context.Context, records []*alioth.RestorationCollectionRequest) (err error) {
+	// 等待到可以重连或者重新发送的时间，而不是直接返回错误，避免批次在退避期间用完重新发送的次数
+	if wait := time.Until(c.reconnectAt); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if c.stream == nil {
+		if connectErr := c.connect(); connectErr != nil {
+			c.fail(connectErr)
+			return connectErr
+		}
+	}
+
+	c.sequence++
+	if sendErr := c.stream.Send(&alioth.RestorationStreamRequest{Sequence: c.sequence, Records: records}); sendErr != nil {
+		c.backoff()
+		c.fail(sendErr)
+		return fmt.Errorf("failed to send restoration stream: %w", sendErr)
+	}
+
+	// 等待服务端确认，超时后关闭当前的流
+	ackChan, errChan := make(chan *alioth.RestorationStreamResponse, 1), make(chan error, 1)
+	go func(stream alioth.AliothRestoration_RestorationStreamClient) {
+		if ack, receiveErr := stream.Recv(); receiveErr != nil {
+			errChan <- receiveErr
+		} else {
+			ackChan <- ack
+		}
+	}(c.stream)
+
+	timer := time.NewTimer(time.Duration(initialize.GlobalConfig().Grpc.TimeoutSeconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case ack := <-ackChan:
+		if ack.GetSequence() != c.sequence {
+			err = fmt.Errorf("unexpected restoration stream ack: want %d, got %d", c.sequence, ack.GetSequence())
+		} else if ack.GetThrottled() {
+			// 限流不是连接的问题，不关闭流，也不计入失败次数
+			c.delay()
+			return fmt.Errorf("restoration stream batch %d throttled", c.sequence)
+		}
+	case receiveErr := <-errChan:
+		err = fmt.Errorf("failed to receive restoration stream ack: %w", receiveErr)
+	case <-timer.C:
+		err = fmt.Errorf("restoration stream ack timeout")
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		c.backoff()
+		c.fail(err)
+		return err
+	}
+	c.reconnectInterval = 0
+	return nil
+}
+
+// close 关闭当前的流和 grpc 连接，缓冲区发送完剩余的日志之后调用
+func (c *streamClient) close() (err error) {
+	if c.stream != nil {
+		err = c.stream.CloseSend()
+		c.cancel()
+		c.stream, c.cancel = nil, nil
+	}
+	if closeErr := c.client.close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// newStreamClient 创建一个使用 grpc 双向流的 restoration 客户端
+//   - serverAddr: restoration 服务的地址，需要包含IP和端口，如 10.0.0.1:50051
+//   - maxFailed: 最大失败次数，如果失败次数超过这个值，则会调用 callback，大于 0 时生效
+//   - callback: 调用的回调函数，不为 nil 时生效
+//
+// 不会立即建立连接，第一次发送日志时才会打开流
+func newStreamClient(serverAddr string, maxFailed int, callback func(err error)) (c *streamClient, err error) {
+	if rpcClient, initClientErr := newClientWithFailedCallback(serverAddr, maxFailed, callback); initClientErr != nil {
+		return nil, initClientErr
+	} else {
+		return &streamClient{client: rpcClient}, nil
+	}
+}
@@ -0,0 +1,144 @@
+package restoration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+func (s *testServer) RestorationStream(stream alioth.AliothRestoration_RestorationStreamServer) error {
+	s.mtx.Lock()
+	s.streams++
+	s.mtx.Unlock()
+
+	for {
+		request, receiveErr := stream.Recv()
+		if errors.Is(receiveErr, io.EOF) {
+			return nil
+		} else if receiveErr != nil {
+			return receiveErr
+		}
+
+		s.mtx.Lock()
+		for _, record := range request.GetRecords() {
+			s.messages = append(s.messages, record.GetMessage())
+		}
+		response := &alioth.RestorationStreamResponse{Sequence: request.GetSequence(), Accepted: int32(len(request.GetRecords()))}
+		if s.ack != nil {
+			response = s.ack(request)
+		}
+		s.mtx.Unlock()
+
+		if sendErr := stream.Send(response); sendErr != nil {
+			return sendErr
+		}
+	}
+}
+
+func newStreamRecords(messages ...string) []*alioth.RestorationCollectionRequest {
+	records := make([]*alioth.RestorationCollectionRequest, len(messages))
+	for i, message := range messages {
+		records[i] = &alioth.RestorationCollectionRequest{Message: message}
+	}
+	return records
+}
+
+func TestStreamClientAck(t *testing.T) {
+	server := &testServer{}
+	c, newErr := newStreamClient(startTestServer(t, server), 0, nil)
+	if newErr != nil {
+		t.Fatalf("new stream client: %v", newErr)
+	}
+	defer func() { _ = c.close() }()
+
+	for _, batch := range [][]string{{"a", "b"}, {"c"}} {
+		if sendErr := c.send(context.Background(), newStreamRecords(batch...)); sendErr != nil {
+			t.Fatalf("send %v: %v", batch, sendErr)
+		}
+	}
+
+	// 所有的批次都使用同一个流发送，序号依次递增
+	if messages, streams := server.received(); !reflect.DeepEqual(messages, []string{"a", "b", "c"}) || streams != 1 {
+		t.Errorf("server received %v on %d streams, want [a b c] on 1 stream", messages, streams)
+	}
+	if c.sequence != 2 || c.failed != 0 || c.reconnectInterval != 0 {
+		t.Errorf("client has sequence %d, %d failures and interval %v", c.sequence, c.failed, c.reconnectInterval)
+	}
+}
+
+func TestStreamClientThrottled(t *testing.T) {
+	server := &testServer{ack: func(request *alioth.RestorationStreamRequest) *alioth.RestorationStreamResponse {
+		return &alioth.RestorationStreamResponse{Sequence: request.GetSequence(), Throttled: request.GetSequence() == 1}
+	}}
+	c, _ := newStreamClient(startTestServer(t, server), 0, nil)
+	defer func() { _ = c.close() }()
+
+	if sendErr := c.send(context.Background(), newStreamRecords("a")); sendErr == nil {
+		t.Fatal("a throttled batch should return an error")
+	}
+
+	// 限流时保留当前的流并推迟下一次发送，不计入失败次数
+	if c.stream == nil || c.failed != 0 || time.Until(c.reconnectAt) <= 0 {
+		t.Errorf("throttled client has stream %v, %d failures and retries at %v", c.stream != nil, c.failed, c.reconnectAt)
+	}
+	startAt := time.Now()
+	if sendErr := c.send(context.Background(), newStreamRecords("a")); sendErr != nil {
+		t.Fatalf("resend: %v", sendErr)
+	}
+	if elapsed := time.Since(startAt); elapsed < minReconnectInterval/2 {
+		t.Errorf("resent after %v, want to wait for the backoff", elapsed)
+	}
+	if _, streams := server.received(); streams != 1 {
+		t.Errorf("server accepted %d streams, want the throttled stream kept", streams)
+	}
+}
+
+func TestStreamClientUnexpectedAck(t *testing.T) {
+	server := &testServer{ack: func(request *alioth.RestorationStreamRequest) *alioth.RestorationStreamResponse {
+		return &alioth.RestorationStreamResponse{Sequence: request.GetSequence() + 100}
+	}}
+	failures := 0
+	c, _ := newStreamClient(startTestServer(t, server), 1, func(error) { failures++ })
+	defer func() { _ = c.close() }()
+
+	if sendErr := c.send(context.Background(), newStreamRecords("a")); sendErr == nil {
+		t.Fatal("an ack with another sequence should return an error")
+	}
+
+	// 确认的序号不一致时关闭当前的流，并计入失败次数
+	if c.stream != nil || failures != 1 || time.Until(c.reconnectAt) <= 0 {
+		t.Errorf("client has stream %v and %d failures after an unexpected ack", c.stream != nil, failures)
+	}
+}
+
+func TestStreamCollectorClosesConnection(t *testing.T) {
+	server := &testServer{}
+	options := DefaultCollectorOptions()
+	options.FlushInterval = time.Hour
+	options.SamplingPollInterval = -1
+	c, newErr := NewStreamCollectorWithOptions("stream-test", startTestServer(t, server), options)
+	if newErr != nil {
+		t.Fatalf("new collector: %v", newErr)
+	}
+	cc := c.(*collector).buffer.sender.(*streamClient).cc
+
+	c.Info(NewCollection(context.Background(), "before close"))
+	if closeErr := c.Close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+
+	// 关闭时先发送剩余的日志，再关闭 grpc 连接
+	if messages, _ := server.received(); !reflect.DeepEqual(messages, []string{"before close"}) {
+		t.Errorf("server received %v, want the buffered record", messages)
+	}
+	if state := cc.GetState(); state != connectivity.Shutdown {
+		t.Errorf("connection is %v after close, want %v", state, connectivity.Shutdown)
+	}
+}
@@ -0,0 +1,215 @@
+package restoration
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/database"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+// dao 使用 postgres 存储日志，按照主键和条件的读写使用 GormAccessor，
+// 游标分页、关键字匹配和 upsert 等 GormAccessor 无法表达的语句与 starward 一样直接使用 gorm
+type dao struct {
+	db     *gorm.DB
+	issues *database.GormAccessor[uint64, model.RestorationIssueDTO, model.RestorationIssue]
+	logger *log.Logger
+}
+
+func newDao() *dao {
+	d := &dao{
+		db:     database.GetGorm(),
+		issues: database.GetGormAccessor(uint64(0), model.RestorationIssueDTO{}, model.RestorationIssue{}),
+		logger: log.DefaultLogger(),
+	}
+
+	if err := database.RegisterSyncModels(model.RestorationRecord{}, model.RestorationIssue{}); err != nil {
+		d.logger.Log(log.DefaultField().WithLevel(log.Panic).WithCaller(log.Module).
+			WithMessage("failed to register sync models").WithExtra(err.Error()))
+	}
+
+	return d
+}
+
+// Store 批量保存日志
+func (d *dao) Store(ctx context.Context, records []*Fields) (err error) {
+	pos := make([]model.RestorationRecord, len(records))
+	for i, record := range records {
+		dto := record.record()
+		pos[i] = model.RestorationRecord{
+			RecordID:       dto.RecordID,
+			Service:        dto.Service,
+			Level:          dto.Level,
+			TraceID:        dto.TraceID,
+			Message:        dto.Message,
+			CallerIP:       dto.CallerIP,
+			CallerType:     dto.CallerType,
+			CodePath:       dto.CodePath,
+			CalledFunction: dto.CalledFunction,
+			CalledAt:       dto.CalledAt,
+			InputFields:    dto.InputFields,
+			PayloadFields:  dto.PayloadFields,
+			ExtraFields:    dto.ExtraFields,
+			Fields:         dto.Fields,
+			Error:          dto.Error,
+			DurationNs:     dto.DurationNs,
+			User:           dto.User,
+			Fingerprint:    dto.Fingerprint,
+		}
+	}
+
+	if createErr := d.db.WithContext(ctx).CreateInBatches(&pos, 100).Error; createErr != nil {
+		return errors.NewExecuteSqlError("CreateInBatches", createErr)
+	}
+	return nil
+}
+
+// Query 按照过滤条件查询日志，关键字使用 ILIKE 匹配
+func (d *dao) Query(ctx context.Context, filter QueryFilter) (records []model.RestorationRecordDTO, nextCursor string, err error) {
+	query := d.db.WithContext(ctx).Model(&model.RestorationRecord{})
+	if filter.Service != "" {
+		query = query.Where("service = ?", filter.Service)
+	}
+	if filter.Level != "" {
+		query = query.Where("level = ?", filter.Level)
+	}
+	if filter.TraceID != "" {
+		query = query.Where("trace_id = ?", filter.TraceID)
+	}
+	if filter.Fingerprint != "" {
+		query = query.Where("fingerprint = ?", filter.Fingerprint)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("called_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("called_at < ?", filter.Until)
+	}
+	if filter.Keyword != "" {
+		query = query.Where("message ILIKE ?", "%"+escapeLike(filter.Keyword)+"%")
+	}
+	if filter.Cursor != 0 {
+		query = query.Where("id < ?", filter.Cursor)
+	}
+
+	records = []model.RestorationRecordDTO{}
+	if queryErr := query.Order("id desc").Limit(filter.Limit).Find(&records).Error; queryErr != nil {
+		return nil, "", errors.NewExecuteSqlError("Find", queryErr)
+	}
+	return records, filter.nextCursor(records), nil
+}
+
+// Trace 查询一个 trace_id 下的所有日志，多查询一条用于判断是否超过了 maxTraceRecords 条
+func (d *dao) Trace(ctx context.Context, traceID string) (records []model.RestorationRecordDTO, truncated bool, err error) {
+	records = []model.RestorationRecordDTO{}
+	if queryErr := d.db.WithContext(ctx).Model(&model.RestorationRecord{}).Where("trace_id = ?", traceID).
+		Order("called_at asc, id asc").Limit(maxTraceRecords + 1).Find(&records).Error; queryErr != nil {
+		return nil, false, errors.NewExecuteSqlError("Find", queryErr)
+	}
+	if len(records) > maxTraceRecords {
+		return records[:maxTraceRecords], true, nil
+	}
+	return records, false, nil
+}
+
+// StoreIssues 使用 upsert 合并问题，已解决的问题再次出现时会重新打开
+func (d *dao) StoreIssues(ctx context.Context, occurrences []issueOccurrence) (err error) {
+	if len(occurrences) == 0 {
+		return nil
+	}
+
+	pos := make([]model.RestorationIssue, len(occurrences))
+	for i, occurrence := range occurrences {
+		issue := mergeOccurrence(nil, occurrence)
+		pos[i] = model.RestorationIssue{
+			Fingerprint:    issue.Fingerprint,
+			Service:        issue.Service,
+			Level:          issue.Level,
+			CodePath:       issue.CodePath,
+			CalledFunction: issue.CalledFunction,
+			Message:        issue.Message,
+			SampleMessage:  issue.SampleMessage,
+			SampleTraceID:  issue.SampleTraceID,
+			Count:          issue.Count,
+			FirstSeen:      issue.FirstSeen,
+			LastSeen:       issue.LastSeen,
+			Status:         issue.Status,
+		}
+	}
+
+	const table = "alioth_restoration_issues"
+	upsert := clause.OnConflict{
+		Columns: []clause.Column{{Name: "fingerprint"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"count":           gorm.Expr(table + ".count + excluded.count"),
+			"first_seen":      gorm.Expr("LEAST(" + table + ".first_seen, excluded.first_seen)"),
+			"last_seen":       gorm.Expr("GREATEST(" + table + ".last_seen, excluded.last_seen)"),
+			"level":           gorm.Expr("CASE WHEN excluded.level = 'panic' THEN excluded.level ELSE " + table + ".level END"),
+			"sample_message":  gorm.Expr("excluded.sample_message"),
+			"sample_trace_id": gorm.Expr("COALESCE(NULLIF(excluded.sample_trace_id, ''), " + table + ".sample_trace_id)"),
+			"status":          issueUnresolved,
+			"resolved_at":     nil,
+			"updated_at":      time.Now(),
+		}),
+	}
+	if createErr := d.db.WithContext(ctx).Clauses(upsert).CreateInBatches(&pos, 100).Error; createErr != nil {
+		return errors.NewExecuteSqlError("CreateInBatches", createErr)
+	}
+	return nil
+}
+
+// Issues 按照过滤条件查询问题，按照最后出现的时间从新到旧排列
+func (d *dao) Issues(ctx context.Context, filter IssueFilter) (issues []model.RestorationIssueDTO, nextCursor string, err error) {
+	query := d.db.WithContext(ctx).Model(&model.RestorationIssue{})
+	if filter.Service != "" {
+		query = query.Where("service = ?", filter.Service)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	issues = []model.RestorationIssueDTO{}
+	if queryErr := query.Order("last_seen desc, id desc").Offset(filter.Offset).Limit(filter.Limit).Find(&issues).Error; queryErr != nil {
+		return nil, "", errors.NewExecuteSqlError("Find", queryErr)
+	}
+	return issues, filter.nextCursor(issues), nil
+}
+
+// Issue 查询指纹对应的问题
+func (d *dao) Issue(_ context.Context, fingerprint string) (issue model.RestorationIssueDTO, err error) {
+	if issue, queryErr := d.issues.CustomQueryOne("fingerprint = ?", fingerprint); queryErr != nil {
+		if queryErr.Derive(gorm.ErrRecordNotFound) {
+			return model.RestorationIssueDTO{}, errors.NewRestorationIssueNotFoundError(fingerprint)
+		}
+		return model.RestorationIssueDTO{}, queryErr
+	} else {
+		return issue, nil
+	}
+}
+
+// ResolveIssue 更新问题的状态，解决时记录解决的时间
+func (d *dao) ResolveIssue(ctx context.Context, fingerprint string, resolved bool) (issue model.RestorationIssueDTO, err error) {
+	updates := map[string]any{"status": issueUnresolved, "resolved_at": nil}
+	if resolved {
+		updates = map[string]any{"status": issueResolved, "resolved_at": time.Now()}
+	}
+
+	result := d.db.WithContext(ctx).Model(&model.RestorationIssue{}).Where("fingerprint = ?", fingerprint).Updates(updates)
+	if result.Error != nil {
+		return issue, errors.NewExecuteSqlError("Updates", result.Error)
+	} else if result.RowsAffected == 0 {
+		return issue, errors.NewRestorationIssueNotFoundError(fingerprint)
+	}
+	return d.Issue(ctx, fingerprint)
+}
+
+// escapeLike 转义 LIKE 语句中的通配符
+func escapeLike(keyword string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(keyword)
+}
@@ -0,0 +1,150 @@
+package restoration
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deduplicator 记录最近接收过的日志 ID，用于过滤客户端重放时重复发送的日志
+//
+// 最多保存 capacity 个 ID，超过 ttl 或者容量时淘汰最早的 ID，停止时可以保存到文件中，启动时读取，避免重启后重复接收重放的日志
+// 超过 ttl 之后重放的日志无法去重，客户端暂存区通过 SpoolMaxAge 删除暂存时间超过 ttl 的日志
+type deduplicator struct {
+	mtx      sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List
+	records  map[string]*list.Element
+}
+
+type dedupRecord struct {
+	id         string
+	receivedAt time.Time
+}
+
+func newDeduplicator(capacity int, ttl time.Duration) *deduplicator {
+	return &deduplicator{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		records:  map[string]*list.Element{},
+	}
+}
+
+// seen 检查日志 ID 是否已经接收过，没有接收过时会记录这个 ID，空 ID 不参与去重
+//   - id: 日志 ID
+func (d *deduplicator) seen(id string) (duplicated bool) {
+	if id == "" {
+		return false
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	// 淘汰过期的记录
+	now := time.Now()
+	for front := d.order.Front(); front != nil; front = d.order.Front() {
+		if record := front.Value.(*dedupRecord); now.Sub(record.receivedAt) <= d.ttl && d.order.Len() < d.capacity {
+			break
+		} else {
+			delete(d.records, record.id)
+			d.order.Remove(front)
+		}
+	}
+
+	if _, exist := d.records[id]; exist {
+		return true
+	}
+	d.records[id] = d.order.PushBack(&dedupRecord{id: id, receivedAt: now})
+	return false
+}
+
+// save 将没有过期的日志 ID 按照接收顺序保存到文件中，先写入临时文件再替换，避免写入一半时进程退出导致文件损坏
+//   - path: 保存的文件路径
+func (d *deduplicator) save(path string) (err error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if mkdirErr := os.MkdirAll(filepath.Dir(path), 0o755); mkdirErr != nil {
+		return fmt.Errorf("failed to create dedup directory: %w", mkdirErr)
+	}
+	file, createErr := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if createErr != nil {
+		return fmt.Errorf("failed to create dedup file: %w", createErr)
+	}
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
+
+	// 每行为 <接收时间的纳秒时间戳> <日志 ID>
+	now := time.Now()
+	writer := bufio.NewWriter(file)
+	for element := d.order.Front(); element != nil; element = element.Next() {
+		if record := element.Value.(*dedupRecord); now.Sub(record.receivedAt) <= d.ttl {
+			_, _ = fmt.Fprintf(writer, "%d %s\n", record.receivedAt.UnixNano(), record.id)
+		}
+	}
+	if flushErr := writer.Flush(); flushErr != nil {
+		return fmt.Errorf("failed to write dedup file: %w", flushErr)
+	} else if closeErr := file.Close(); closeErr != nil {
+		return fmt.Errorf("failed to write dedup file: %w", closeErr)
+	} else if renameErr := os.Rename(file.Name(), path); renameErr != nil {
+		return fmt.Errorf("failed to replace dedup file: %w", renameErr)
+	}
+	return nil
+}
+
+// load 从文件中读取日志 ID，跳过已经过期和格式错误的行，超过容量时保留最新的 ID，文件不存在时不做任何事
+//   - path: 保存的文件路径
+func (d *deduplicator) load(path string) (err error) {
+	file, openErr := os.Open(path)
+	if os.IsNotExist(openErr) {
+		return nil
+	} else if openErr != nil {
+		return fmt.Errorf("failed to open dedup file: %w", openErr)
+	}
+	defer func() { _ = file.Close() }()
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		timestamp, id, found := strings.Cut(scanner.Text(), " ")
+		if !found || id == "" {
+			continue
+		}
+		nanos, parseErr := strconv.ParseInt(timestamp, 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		receivedAt := time.Unix(0, nanos)
+		if now.Sub(receivedAt) > d.ttl {
+			continue
+		}
+		if _, exist := d.records[id]; exist {
+			continue
+		}
+		d.records[id] = d.order.PushBack(&dedupRecord{id: id, receivedAt: receivedAt})
+		if d.order.Len() > d.capacity {
+			front := d.order.Front()
+			delete(d.records, front.Value.(*dedupRecord).id)
+			d.order.Remove(front)
+		}
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return fmt.Errorf("failed to read dedup file: %w", scanErr)
+	}
+	return nil
+}
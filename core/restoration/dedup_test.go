@@ -0,0 +1,93 @@
+package restoration
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeduplicatorSeen(t *testing.T) {
+	cases := []struct {
+		name     string
+		capacity int
+		ttl      time.Duration
+		ids      []string
+		want     []bool
+	}{
+		{name: "empty id is never duplicated", capacity: 8, ttl: time.Hour, ids: []string{"", ""}, want: []bool{false, false}},
+		{name: "repeated id", capacity: 8, ttl: time.Hour, ids: []string{"a", "b", "a"}, want: []bool{false, false, true}},
+		{name: "evicted by capacity", capacity: 2, ttl: time.Hour, ids: []string{"a", "b", "c", "a"}, want: []bool{false, false, false, false}},
+		{name: "recent id kept by capacity", capacity: 2, ttl: time.Hour, ids: []string{"a", "b", "c", "c"}, want: []bool{false, false, false, true}},
+		{name: "expired by ttl", capacity: 8, ttl: -time.Second, ids: []string{"a", "a"}, want: []bool{false, false}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := newDeduplicator(c.capacity, c.ttl)
+			for i, id := range c.ids {
+				if duplicated := d.seen(id); duplicated != c.want[i] {
+					t.Errorf("seen(%q) at %d = %v, want %v", id, i, duplicated, c.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDeduplicatorPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "restoration", "dedup")
+
+	d := newDeduplicator(8, time.Hour)
+	for _, id := range []string{"a", "b", "c"} {
+		d.seen(id)
+	}
+	if saveErr := d.save(path); saveErr != nil {
+		t.Fatalf("save: %v", saveErr)
+	}
+
+	cases := []struct {
+		name     string
+		capacity int
+		ttl      time.Duration
+		id       string
+		want     bool
+	}{
+		{name: "restored id", capacity: 8, ttl: time.Hour, id: "b", want: true},
+		{name: "unknown id", capacity: 8, ttl: time.Hour, id: "d", want: false},
+		{name: "oldest id over capacity", capacity: 2, ttl: time.Hour, id: "a", want: false},
+		{name: "newest id within capacity", capacity: 2, ttl: time.Hour, id: "c", want: true},
+		{name: "expired id", capacity: 8, ttl: -time.Second, id: "b", want: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			restored := newDeduplicator(c.capacity, c.ttl)
+			if loadErr := restored.load(path); loadErr != nil {
+				t.Fatalf("load: %v", loadErr)
+			}
+			if duplicated := restored.seen(c.id); duplicated != c.want {
+				t.Errorf("seen(%q) = %v, want %v", c.id, duplicated, c.want)
+			}
+		})
+	}
+}
+
+func TestDeduplicatorLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	d := newDeduplicator(8, time.Hour)
+	if loadErr := d.load(filepath.Join(dir, "missing")); loadErr != nil {
+		t.Errorf("loading a missing file should succeed: %v", loadErr)
+	}
+
+	path := filepath.Join(dir, "dedup")
+	content := "not-a-timestamp a\n" + "1\n" + "\n" + strconv.FormatInt(time.Now().UnixNano(), 10) + " \n"
+	if writeErr := os.WriteFile(path, []byte(content), 0o644); writeErr != nil {
+		t.Fatalf("write: %v", writeErr)
+	}
+	if loadErr := d.load(path); loadErr != nil {
+		t.Fatalf("load: %v", loadErr)
+	}
+	if d.order.Len() != 0 {
+		t.Errorf("loaded %d invalid records, want 0", d.order.Len())
+	}
+}
@@ -2,14 +2,24 @@ package restoration
 
 import (
 	"context"
+	"time"
 
+	"github.com/gin-gonic/gin"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
 	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
 	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils/redact"
 
 	"studio.sunist.work/platform/alioth-center/proto/alioth"
 )
 
+// redactor 服务端的脱敏引擎，在输出和存储日志前对 input_fields, payload_fields, extra_fields, fields 和 error 脱敏，为 nil 时不脱敏
+var redactor = redact.Default()
+
 type Fields struct {
+	recordID       string
 	callerIP       string
 	service        string
 	code           string
@@ -22,6 +32,12 @@ type Fields struct {
 	inputFields    []byte
 	payloadFields  []byte
 	extraFields    []byte
+	fields         []byte
+	err            *alioth.RestorationError
+	duration       time.Duration
+	user           string
+	fingerprint    string
+	anonymous      bool // 调用方没有通过认证，caller_service 只是调用方声明的名称
 }
 
 func (f *Fields) EncodePayload() map[string]any {
@@ -37,6 +53,10 @@ func (f *Fields) EncodePayload() map[string]any {
 		payload["trace_id"] = f.traceID
 	}
 
+	if f.recordID != "" {
+		payload["record_id"] = f.recordID
+	}
+
 	if f.callerIP != "" {
 		payload["caller_ip"] = f.callerIP
 	}
@@ -44,24 +64,54 @@ func (f *Fields) EncodePayload() map[string]any {
 	if f.inputFields != nil && len(f.inputFields) > 0 {
 		var inputFields any
 		utils.JsonUnmarshal(f.inputFields, &inputFields)
-		payload["caller_arguments"] = inputFields
+		payload["caller_arguments"] = redactor.Redact(inputFields)
 	}
 
 	if f.payloadFields != nil && len(f.payloadFields) > 0 {
 		var payloadFields any
 		utils.JsonUnmarshal(f.payloadFields, &payloadFields)
-		payload["caller_processing"] = payloadFields
+		payload["caller_processing"] = redactor.Redact(payloadFields)
 	}
 
 	if f.extraFields != nil && len(f.extraFields) > 0 {
 		var extraFields any
 		utils.JsonUnmarshal(f.extraFields, &extraFields)
-		payload["extra_data"] = extraFields
+		payload["extra_data"] = redactor.Redact(extraFields)
+	}
+
+	if len(f.fields) > 0 {
+		var fields any
+		utils.JsonUnmarshal(f.fields, &fields)
+		payload["fields"] = redactor.Redact(fields)
+	}
+
+	if f.err != nil {
+		payload["error"] = redactor.Redact(f.errorFields())
+	}
+
+	if f.duration > 0 {
+		payload["duration_ms"] = float64(f.duration) / float64(time.Millisecond)
+	}
+
+	if f.user != "" {
+		payload["user"] = f.user
 	}
 
 	return payload
 }
 
+// errorFields 将错误转换为 json 对象，没有错误时返回 nil
+func (f *Fields) errorFields() map[string]any {
+	if f.err == nil {
+		return nil
+	}
+	return map[string]any{
+		"type":    f.err.GetType(),
+		"message": f.err.GetMessage(),
+		"stack":   f.err.GetStack(),
+	}
+}
+
 func (f *Fields) Level() log.LoggerLevel {
 	return log.NewLevelFromString(f.level)
 }
@@ -70,12 +120,66 @@ func (f *Fields) Message() string {
 	return f.message
 }
 
-func NewRestorationFieldsFromRequest(ctx context.Context, request *alioth.RestorationCollectionRequest) log.LoggerField {
-	ip, getIPErr := utils.GetContextClientIP(ctx)
-	if getIPErr != nil {
-		ip = ""
+// record 将日志字段转换为存储使用的日志记录，无法解析调用时间时使用接收时间
+func (f *Fields) record() model.RestorationRecordDTO {
+	calledAt := f.calledTime()
+
+	errorJson := ""
+	if f.err != nil {
+		errorJson = string(redactor.RedactJSON(utils.JsonMarshal(f.errorFields())))
+	}
+
+	return model.RestorationRecordDTO{
+		RecordID:       f.recordID,
+		Service:        f.service,
+		Level:          string(f.Level()),
+		TraceID:        f.traceID,
+		Message:        f.message,
+		CallerIP:       f.callerIP,
+		CallerType:     f.caller,
+		CodePath:       f.code,
+		CalledFunction: f.calledFunction,
+		CalledAt:       calledAt,
+		InputFields:    string(redactor.RedactJSON(f.inputFields)),
+		PayloadFields:  string(redactor.RedactJSON(f.payloadFields)),
+		ExtraFields:    string(redactor.RedactJSON(f.extraFields)),
+		Fields:         string(redactor.RedactJSON(f.fields)),
+		Error:          errorJson,
+		DurationNs:     int64(f.duration),
+		User:           f.user,
+		Fingerprint:    f.fingerprint,
+		CreatedAt:      time.Now(),
+	}
+}
+
+// calledTime 解析日志的调用时间，无法解析时使用当前时间
+func (f *Fields) calledTime() time.Time {
+	if calledAt, parseTimeErr := time.Parse(global.AliothTimeFormat, f.calledAt); parseTimeErr == nil {
+		return calledAt
+	}
+	return time.Now()
+}
+
+// withIdentity 使用认证后的身份覆盖客户端声明的 caller_service
+//   - identity: 认证后的调用方身份，为空时表示匿名调用方，不覆盖 caller_service
+func (f *Fields) withIdentity(identity string) *Fields {
+	if identity != "" {
+		f.service = identity
+	}
+	f.anonymous = identity == ""
+	return f
+}
+
+// NewRestorationFieldsFromRequest 转换内部服务发送的日志，使用客户端声明的调用方类型，没有声明或者无法识别时视为 service
+func NewRestorationFieldsFromRequest(ctx context.Context, request *alioth.RestorationCollectionRequest) *Fields {
+	ip := clientIP(ctx)
+	caller := string(log.Service)
+	switch log.LoggerCaller(request.GetCallerType()) {
+	case log.Internal, log.Module, log.Service, log.External:
+		caller = request.GetCallerType()
 	}
 	return &Fields{
+		recordID:       request.GetRecordId(),
 		callerIP:       ip,
 		service:        request.GetCallerService(),
 		code:           request.GetCodePath(),
@@ -87,16 +191,19 @@ func NewRestorationFieldsFromRequest(ctx context.Context, request *alioth.Restor
 		inputFields:    request.GetInputFields(),
 		payloadFields:  request.GetPayloadFields(),
 		extraFields:    request.GetExtraFields(),
-		caller:         string(log.Service),
+		fields:         request.GetFields(),
+		err:            request.GetError(),
+		duration:       time.Duration(request.GetDurationNs()),
+		user:           request.GetUser(),
+		caller:         caller,
 	}
 }
 
-func NewExternalRestorationFieldsFromRequest(ctx context.Context, request *alioth.RestorationCollectionRequest) log.LoggerField {
-	ip, getIPErr := utils.GetContextClientIP(ctx)
-	if getIPErr != nil {
-		ip = ""
-	}
+// NewExternalRestorationFieldsFromRequest 转换外部发送的日志，外部日志的调用方类型固定为 external，忽略客户端声明的类型
+func NewExternalRestorationFieldsFromRequest(ctx context.Context, request *alioth.RestorationCollectionRequest) *Fields {
+	ip := clientIP(ctx)
 	return &Fields{
+		recordID:       request.GetRecordId(),
 		callerIP:       ip,
 		service:        request.GetCallerService(),
 		code:           request.GetCodePath(),
@@ -108,6 +215,21 @@ func NewExternalRestorationFieldsFromRequest(ctx context.Context, request *aliot
 		inputFields:    request.GetInputFields(),
 		payloadFields:  request.GetPayloadFields(),
 		extraFields:    request.GetExtraFields(),
+		fields:         request.GetFields(),
+		err:            request.GetError(),
+		duration:       time.Duration(request.GetDurationNs()),
+		user:           request.GetUser(),
 		caller:         string(log.External),
 	}
 }
+
+// clientIP 获取调用方的 IP，http 请求使用 gin 解析的地址，只有来自 http.trusted_proxies 的请求才会使用 X-Forwarded-For，
+// rpc 请求使用连接的对端地址，获取失败时返回空字符串
+func clientIP(ctx context.Context) string {
+	if ginCtx, isGinCtx := ctx.(*gin.Context); isGinCtx {
+		return ginCtx.ClientIP()
+	} else if ip, getIPErr := utils.GetContextClientIP(ctx); getIPErr == nil {
+		return ip
+	}
+	return ""
+}
@@ -0,0 +1,572 @@
+package restoration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	aliothErrors "studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+)
+
+const (
+	fileStorePrefix         = "records_"
+	fileStoreSuffix         = ".jsonl"
+	fileStoreIssues         = "issues.jsonl"
+	minIssueJournals        = 1024
+	defaultFileStoreIndexed = 1000000
+)
+
+// fileIndexEntry 日志在文件中的位置和用于过滤的字段
+type fileIndexEntry struct {
+	id          uint64
+	file        string
+	offset      int64
+	length      int
+	service     string
+	level       string
+	traceID     string
+	fingerprint string
+	calledAt    time.Time
+}
+
+// fileStore 使用本地文件存储日志，按天写入 json lines 文件
+//
+// 启动时扫描所有文件，在内存中建立按照服务、级别、trace_id 和指纹的索引，查询时只读取候选日志所在的行，
+// 索引最多保存 maxIndexed 条日志，超过时移除最早的日志的索引，这些日志仍然保留在文件中，但是不再能被查询
+//
+// 问题保存在内存中，每次变更追加到 issues.jsonl，启动时以最后一行为准，追加的行数过多时重写文件
+type fileStore struct {
+	mtx           sync.RWMutex
+	dir           string
+	maxIndexed    int
+	evicted       int
+	entries       []fileIndexEntry
+	byService     map[string][]int
+	byLevel       map[string][]int
+	byTrace       map[string][]int
+	byFingerprint map[string][]int
+	nextID        uint64
+	current       *os.File
+	date          string
+	offset        int64
+
+	issueMtx    sync.RWMutex
+	issues      map[string]*model.RestorationIssueDTO
+	journal     *os.File
+	journals    int
+	nextIssueID uint64
+}
+
+// newFileStore 创建文件存储后端，并扫描目录中已有的日志和问题
+//   - dir: 存储目录
+//   - maxIndexed: 内存中索引的最大日志条数，不大于 0 时为 defaultFileStoreIndexed
+func newFileStore(dir string, maxIndexed int) (s *fileStore, err error) {
+	if maxIndexed <= 0 {
+		maxIndexed = defaultFileStoreIndexed
+	}
+	if mkdirErr := os.MkdirAll(dir, 0o755); mkdirErr != nil {
+		return nil, fmt.Errorf("failed to create restoration storage directory: %w", mkdirErr)
+	}
+
+	s = &fileStore{
+		dir:           dir,
+		maxIndexed:    maxIndexed,
+		byService:     map[string][]int{},
+		byLevel:       map[string][]int{},
+		byTrace:       map[string][]int{},
+		byFingerprint: map[string][]int{},
+		nextID:        1,
+		issues:        map[string]*model.RestorationIssueDTO{},
+		nextIssueID:   1,
+	}
+	if rebuildErr := s.rebuild(); rebuildErr != nil {
+		return nil, rebuildErr
+	}
+	if loadErr := s.loadIssues(); loadErr != nil {
+		return nil, loadErr
+	}
+	return s, nil
+}
+
+// rebuild 扫描目录中的所有日志文件，重建内存索引
+func (s *fileStore) rebuild() (err error) {
+	files, globErr := filepath.Glob(filepath.Join(s.dir, fileStorePrefix+"*"+fileStoreSuffix))
+	if globErr != nil {
+		return fmt.Errorf("failed to list restoration storage files: %w", globErr)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		if indexErr := s.indexFile(file); indexErr != nil {
+			return indexErr
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) indexFile(path string) (err error) {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return fmt.Errorf("failed to open restoration storage file: %w", openErr)
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var record model.RestorationRecordDTO
+			if unmarshalErr := json.Unmarshal(line, &record); unmarshalErr == nil {
+				s.index(record, filepath.Base(path), offset, len(line))
+			}
+		}
+		offset += int64(len(line))
+		if readErr != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// index 将日志加入内存索引，超过索引的最大条数时移除最早的十分之一，调用方需要持有写锁
+//
+// 索引中的位置从第一条日志开始计数，移除的日志也会计入，因此移除时不需要修改其他日志的位置
+func (s *fileStore) index(record model.RestorationRecordDTO, file string, offset int64, length int) {
+	position := s.evicted + len(s.entries)
+	s.entries = append(s.entries, fileIndexEntry{
+		id:          record.ID,
+		file:        file,
+		offset:      offset,
+		length:      length,
+		service:     record.Service,
+		level:       record.Level,
+		traceID:     record.TraceID,
+		fingerprint: record.Fingerprint,
+		calledAt:    record.CalledAt,
+	})
+	s.byService[record.Service] = append(s.byService[record.Service], position)
+	s.byLevel[record.Level] = append(s.byLevel[record.Level], position)
+	if record.TraceID != "" {
+		s.byTrace[record.TraceID] = append(s.byTrace[record.TraceID], position)
+	}
+	if record.Fingerprint != "" {
+		s.byFingerprint[record.Fingerprint] = append(s.byFingerprint[record.Fingerprint], position)
+	}
+	if record.ID >= s.nextID {
+		s.nextID = record.ID + 1
+	}
+
+	if len(s.entries) > s.maxIndexed {
+		s.evict(len(s.entries) - s.maxIndexed + s.maxIndexed/10)
+	}
+}
+
+// evict 移除最早的 n 条日志的索引，剩余的索引复制到新的切片中，调用方需要持有写锁
+//   - n: 移除的日志条数
+func (s *fileStore) evict(n int) {
+	if n > len(s.entries) {
+		n = len(s.entries)
+	}
+	entries := make([]fileIndexEntry, len(s.entries)-n, s.maxIndexed+1)
+	copy(entries, s.entries[n:])
+	s.entries = entries
+	s.evicted += n
+
+	for _, positions := range []map[string][]int{s.byService, s.byLevel, s.byTrace, s.byFingerprint} {
+		for key, list := range positions {
+			if start := sort.SearchInts(list, s.evicted); start == len(list) {
+				delete(positions, key)
+			} else if start > 0 {
+				positions[key] = append([]int(nil), list[start:]...)
+			}
+		}
+	}
+}
+
+// Close 关闭正在写入的日志文件和问题的变更记录，需要在存储写入队列停止之后调用
+func (s *fileStore) Close() error {
+	s.mtx.Lock()
+	var closeErr error
+	if s.current != nil {
+		closeErr = s.current.Close()
+		s.current, s.date = nil, ""
+	}
+	s.mtx.Unlock()
+
+	s.issueMtx.Lock()
+	defer s.issueMtx.Unlock()
+	if s.journal != nil {
+		closeErr = errors.Join(closeErr, s.journal.Close())
+		s.journal = nil
+	}
+	return closeErr
+}
+
+// entry 获取索引位置上的日志，调用方需要持有读锁
+//   - position: 索引中的位置
+func (s *fileStore) entry(position int) fileIndexEntry {
+	return s.entries[position-s.evicted]
+}
+
+// open 打开当天的日志文件，日期变化时切换文件，调用方需要持有写锁
+func (s *fileStore) open(now time.Time) (err error) {
+	date := now.Format("2006-01-02")
+	if s.current != nil && s.date == date {
+		return nil
+	}
+	if s.current != nil {
+		_ = s.current.Close()
+	}
+
+	path := filepath.Join(s.dir, fileStorePrefix+date+fileStoreSuffix)
+	file, openErr := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if openErr != nil {
+		return fmt.Errorf("failed to open restoration storage file: %w", openErr)
+	}
+	info, statErr := file.Stat()
+	if statErr != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat restoration storage file: %w", statErr)
+	}
+
+	s.current, s.date, s.offset = file, date, info.Size()
+	return nil
+}
+
+func (s *fileStore) Store(_ context.Context, records []*Fields) (err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if openErr := s.open(time.Now()); openErr != nil {
+		return openErr
+	}
+
+	for _, fields := range records {
+		record := fields.record()
+		record.ID = s.nextID
+		line, marshalErr := json.Marshal(record)
+		if marshalErr != nil {
+			return fmt.Errorf("failed to marshal restoration record: %w", marshalErr)
+		}
+		line = append(line, '\n')
+
+		if _, writeErr := s.current.Write(line); writeErr != nil {
+			return fmt.Errorf("failed to write restoration storage file: %w", writeErr)
+		}
+		s.index(record, filepath.Base(s.current.Name()), s.offset, len(line))
+		s.offset += int64(len(line))
+	}
+	return nil
+}
+
+// candidates 根据索引选出最小的候选集合，返回按照写入顺序排列的位置
+func (s *fileStore) candidates(filter QueryFilter) (positions []int, all bool) {
+	var lists [][]int
+	if filter.Service != "" {
+		lists = append(lists, s.byService[filter.Service])
+	}
+	if filter.Level != "" {
+		lists = append(lists, s.byLevel[filter.Level])
+	}
+	if filter.TraceID != "" {
+		lists = append(lists, s.byTrace[filter.TraceID])
+	}
+	if filter.Fingerprint != "" {
+		lists = append(lists, s.byFingerprint[filter.Fingerprint])
+	}
+	if len(lists) == 0 {
+		return nil, true
+	}
+
+	positions = lists[0]
+	for _, list := range lists[1:] {
+		if len(list) < len(positions) {
+			positions = list
+		}
+	}
+	return positions, false
+}
+
+// read 读取索引位置上的完整日志
+func (s *fileStore) read(files map[string]*os.File, entry fileIndexEntry) (record model.RestorationRecordDTO, err error) {
+	file, opened := files[entry.file]
+	if !opened {
+		if file, err = os.Open(filepath.Join(s.dir, entry.file)); err != nil {
+			return record, fmt.Errorf("failed to open restoration storage file: %w", err)
+		}
+		files[entry.file] = file
+	}
+
+	line := make([]byte, entry.length)
+	if _, readErr := file.ReadAt(line, entry.offset); readErr != nil && readErr != io.EOF {
+		return record, fmt.Errorf("failed to read restoration storage file: %w", readErr)
+	}
+	if unmarshalErr := json.Unmarshal(line, &record); unmarshalErr != nil {
+		return record, fmt.Errorf("failed to unmarshal restoration record: %w", unmarshalErr)
+	}
+	return record, nil
+}
+
+func (s *fileStore) Query(ctx context.Context, filter QueryFilter) (records []model.RestorationRecordDTO, nextCursor string, err error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	files := map[string]*os.File{}
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+
+	positions, all := s.candidates(filter)
+	total := len(positions)
+	if all {
+		total = len(s.entries)
+	}
+
+	// 从最新的日志开始倒序查找
+	records = []model.RestorationRecordDTO{}
+	for i := total - 1; i >= 0 && len(records) < filter.Limit; i-- {
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+
+		var entry fileIndexEntry
+		if all {
+			entry = s.entries[i]
+		} else {
+			entry = s.entry(positions[i])
+		}
+		if filter.Cursor != 0 && entry.id >= filter.Cursor {
+			continue
+		} else if !filter.match(entry.service, entry.level, entry.traceID, entry.fingerprint, entry.calledAt) {
+			continue
+		}
+
+		record, readErr := s.read(files, entry)
+		if readErr != nil {
+			if errors.Is(readErr, os.ErrNotExist) {
+				// 文件已经被清理，跳过
+				continue
+			}
+			return nil, "", readErr
+		}
+		if filter.matchKeyword(record.Message) {
+			records = append(records, record)
+		}
+	}
+
+	return records, filter.nextCursor(records), nil
+}
+
+func (s *fileStore) Trace(ctx context.Context, traceID string) (records []model.RestorationRecordDTO, truncated bool, err error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	files := map[string]*os.File{}
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+
+	// 超过上限时只读取最早写入的日志
+	positions := s.byTrace[traceID]
+	if len(positions) > maxTraceRecords {
+		positions, truncated = positions[:maxTraceRecords], true
+	}
+
+	records = make([]model.RestorationRecordDTO, 0, len(positions))
+	for _, position := range positions {
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+
+		record, readErr := s.read(files, s.entry(position))
+		if errors.Is(readErr, os.ErrNotExist) {
+			continue
+		} else if readErr != nil {
+			return nil, false, readErr
+		}
+		records = append(records, record)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].CalledAt.Before(records[j].CalledAt) })
+	return records, truncated, nil
+}
+
+// loadIssues 读取问题的变更记录，同一个指纹以最后一行为准，然后重写文件
+func (s *fileStore) loadIssues() (err error) {
+	if file, openErr := os.Open(filepath.Join(s.dir, fileStoreIssues)); openErr != nil && !errors.Is(openErr, os.ErrNotExist) {
+		return fmt.Errorf("failed to open restoration issue file: %w", openErr)
+	} else if openErr == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64<<10), 16<<20)
+		for scanner.Scan() {
+			var issue model.RestorationIssueDTO
+			if unmarshalErr := json.Unmarshal(scanner.Bytes(), &issue); unmarshalErr == nil && issue.Fingerprint != "" {
+				s.issues[issue.Fingerprint] = &issue
+				if issue.ID >= s.nextIssueID {
+					s.nextIssueID = issue.ID + 1
+				}
+			}
+		}
+		_ = file.Close()
+	}
+
+	return s.compactIssues()
+}
+
+// compactIssues 将内存中的问题重写到新文件并替换变更记录，调用方需要持有问题的写锁
+func (s *fileStore) compactIssues() (err error) {
+	path := filepath.Join(s.dir, fileStoreIssues)
+	temp, createErr := os.Create(path + ".tmp")
+	if createErr != nil {
+		return fmt.Errorf("failed to create restoration issue file: %w", createErr)
+	}
+
+	writer := bufio.NewWriter(temp)
+	for _, issue := range s.issues {
+		line, marshalErr := json.Marshal(issue)
+		if marshalErr != nil {
+			_ = temp.Close()
+			return fmt.Errorf("failed to marshal restoration issue: %w", marshalErr)
+		}
+		_, _ = writer.Write(append(line, '\n'))
+	}
+	if flushErr := writer.Flush(); flushErr != nil {
+		_ = temp.Close()
+		return fmt.Errorf("failed to write restoration issue file: %w", flushErr)
+	}
+	if closeErr := temp.Close(); closeErr != nil {
+		return fmt.Errorf("failed to write restoration issue file: %w", closeErr)
+	}
+	if renameErr := os.Rename(path+".tmp", path); renameErr != nil {
+		return fmt.Errorf("failed to replace restoration issue file: %w", renameErr)
+	}
+
+	if s.journal != nil {
+		_ = s.journal.Close()
+	}
+	journal, openErr := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if openErr != nil {
+		return fmt.Errorf("failed to open restoration issue file: %w", openErr)
+	}
+	s.journal, s.journals = journal, len(s.issues)
+	return nil
+}
+
+// appendIssues 将变更后的问题追加到变更记录，行数超过问题数量的两倍时重写文件，调用方需要持有问题的写锁
+func (s *fileStore) appendIssues(issues ...*model.RestorationIssueDTO) (err error) {
+	var lines []byte
+	for _, issue := range issues {
+		line, marshalErr := json.Marshal(issue)
+		if marshalErr != nil {
+			return fmt.Errorf("failed to marshal restoration issue: %w", marshalErr)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	if s.journal == nil {
+		return fmt.Errorf("failed to write restoration issue file: %w", os.ErrClosed)
+	} else if _, writeErr := s.journal.Write(lines); writeErr != nil {
+		return fmt.Errorf("failed to write restoration issue file: %w", writeErr)
+	}
+
+	s.journals += len(issues)
+	if s.journals > minIssueJournals && s.journals > 2*len(s.issues) {
+		return s.compactIssues()
+	}
+	return nil
+}
+
+func (s *fileStore) StoreIssues(_ context.Context, occurrences []issueOccurrence) (err error) {
+	if len(occurrences) == 0 {
+		return nil
+	}
+
+	s.issueMtx.Lock()
+	defer s.issueMtx.Unlock()
+
+	changed := make([]*model.RestorationIssueDTO, len(occurrences))
+	for i, occurrence := range occurrences {
+		issue := mergeOccurrence(s.issues[occurrence.fingerprint], occurrence)
+		if issue.ID == 0 {
+			issue.ID = s.nextIssueID
+			s.nextIssueID++
+			s.issues[issue.Fingerprint] = issue
+		}
+		changed[i] = issue
+	}
+	return s.appendIssues(changed...)
+}
+
+func (s *fileStore) Issues(ctx context.Context, filter IssueFilter) (issues []model.RestorationIssueDTO, nextCursor string, err error) {
+	s.issueMtx.RLock()
+	matched := make([]model.RestorationIssueDTO, 0, len(s.issues))
+	for _, issue := range s.issues {
+		if filter.match(issue) {
+			matched = append(matched, *issue)
+		}
+	}
+	s.issueMtx.RUnlock()
+
+	if ctx.Err() != nil {
+		return nil, "", ctx.Err()
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].LastSeen.Equal(matched[j].LastSeen) {
+			return matched[i].LastSeen.After(matched[j].LastSeen)
+		}
+		return matched[i].ID > matched[j].ID
+	})
+	if filter.Offset >= len(matched) {
+		return []model.RestorationIssueDTO{}, "", nil
+	}
+	issues = matched[filter.Offset:]
+	if len(issues) > filter.Limit {
+		issues = issues[:filter.Limit]
+	}
+	return issues, filter.nextCursor(issues), nil
+}
+
+func (s *fileStore) Issue(_ context.Context, fingerprint string) (issue model.RestorationIssueDTO, err error) {
+	s.issueMtx.RLock()
+	defer s.issueMtx.RUnlock()
+
+	if stored, exist := s.issues[fingerprint]; exist {
+		return *stored, nil
+	}
+	return issue, aliothErrors.NewRestorationIssueNotFoundError(fingerprint)
+}
+
+func (s *fileStore) ResolveIssue(_ context.Context, fingerprint string, resolved bool) (issue model.RestorationIssueDTO, err error) {
+	s.issueMtx.Lock()
+	defer s.issueMtx.Unlock()
+
+	stored, exist := s.issues[fingerprint]
+	if !exist {
+		return issue, aliothErrors.NewRestorationIssueNotFoundError(fingerprint)
+	}
+
+	if resolved {
+		resolvedAt := time.Now()
+		stored.Status, stored.ResolvedAt = issueResolved, &resolvedAt
+	} else {
+		stored.Status, stored.ResolvedAt = issueUnresolved, nil
+	}
+	if appendErr := s.appendIssues(stored); appendErr != nil {
+		return issue, appendErr
+	}
+	return *stored, nil
+}
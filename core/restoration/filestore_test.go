@@ -0,0 +1,103 @@
+package restoration
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestFileStoreIndexEviction(t *testing.T) {
+	cases := []struct {
+		name       string
+		maxIndexed int
+		stored     int
+		indexed    int
+		services   []string
+	}{
+		{name: "below limit", maxIndexed: 10, stored: 10, indexed: 10, services: []string{"a", "b"}},
+		{name: "evict oldest tenth", maxIndexed: 10, stored: 11, indexed: 9, services: []string{"a", "b"}},
+		{name: "evict repeatedly", maxIndexed: 10, stored: 25, indexed: 9, services: []string{"a", "b"}},
+		{name: "drop empty keys", maxIndexed: 4, stored: 5, indexed: 4, services: []string{"b"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, newErr := newFileStore(t.TempDir(), c.maxIndexed)
+			if newErr != nil {
+				t.Fatalf("new file store: %v", newErr)
+			}
+
+			// 第一条日志属于服务 a，其余属于服务 b，每条日志使用不同的 trace_id
+			for i := 0; i < c.stored; i++ {
+				service := "b"
+				if i == 0 || (c.maxIndexed > 4 && i%2 == 0) {
+					service = "a"
+				}
+				fields := &Fields{service: service, level: "info", message: strconv.Itoa(i), traceID: strconv.Itoa(i)}
+				if storeErr := s.Store(context.Background(), []*Fields{fields}); storeErr != nil {
+					t.Fatalf("store record %d: %v", i, storeErr)
+				}
+			}
+
+			if len(s.entries) != c.indexed {
+				t.Errorf("indexed %d, want %d", len(s.entries), c.indexed)
+			}
+			if len(s.byService) != len(c.services) {
+				t.Errorf("indexed services %d, want %v", len(s.byService), c.services)
+			}
+			if len(s.byTrace) != c.indexed {
+				t.Errorf("indexed traces %d, want %d", len(s.byTrace), c.indexed)
+			}
+
+			// 被移除的日志不能被查询，保留的日志可以按照索引读取
+			records, _, queryErr := s.Query(context.Background(), QueryFilter{Limit: c.stored})
+			if queryErr != nil {
+				t.Fatalf("query: %v", queryErr)
+			}
+			if len(records) != c.indexed {
+				t.Fatalf("queried %d records, want %d", len(records), c.indexed)
+			}
+			if oldest, want := records[len(records)-1].Message, strconv.Itoa(c.stored-c.indexed); oldest != want {
+				t.Errorf("oldest indexed %s, want %s", oldest, want)
+			}
+			for _, service := range c.services {
+				if records, _, queryErr = s.Query(context.Background(), QueryFilter{Service: service, Limit: c.stored}); queryErr != nil {
+					t.Fatalf("query service %s: %v", service, queryErr)
+				}
+				for _, record := range records {
+					if record.Service != service {
+						t.Errorf("query service %s returned %s", service, record.Service)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFileStoreClose(t *testing.T) {
+	s, newErr := newFileStore(t.TempDir(), 0)
+	if newErr != nil {
+		t.Fatalf("new file store: %v", newErr)
+	}
+	records := []*Fields{{service: "a", level: "error", message: "failed"}}
+	occurrences := fingerprintRecords(records)
+	if storeErr := s.Store(context.Background(), records); storeErr != nil {
+		t.Fatalf("store: %v", storeErr)
+	}
+	if storeErr := s.StoreIssues(context.Background(), occurrences); storeErr != nil {
+		t.Fatalf("store issues: %v", storeErr)
+	}
+
+	if closeErr := s.Close(); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+	if closeErr := s.Close(); closeErr != nil {
+		t.Errorf("close again: %v", closeErr)
+	}
+	if s.current != nil || s.journal != nil {
+		t.Error("close should release the record file and the issue journal")
+	}
+	if storeErr := s.StoreIssues(context.Background(), occurrences); storeErr == nil {
+		t.Error("storing issues after close should fail")
+	}
+}
@@ -1,10 +1,23 @@
 package restoration
 
 import (
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
 	"studio.sunist.work/platform/alioth-center/proto/alioth"
 )
 
+const maxOtlpBodySize = 16 << 20
+
 type HttpServer struct{}
 
 func (h HttpServer) Ping(ctx *gin.Context) {
@@ -20,10 +33,385 @@ func (h HttpServer) Collection(ctx *gin.Context) {
 			"message": "invalid request",
 			"error":   bindJsonErr.Error(),
 		})
+	} else if collectErr := defaultService.CollectLogExternal(ctx, ctx.GetString(identityContextKey), &request); collectErr != nil {
+		collectionFailed(ctx, collectErr)
+	} else {
+		ctx.JSON(200, gin.H{
+			"message": "success",
+		})
+	}
+}
+
+func (h HttpServer) BatchCollection(ctx *gin.Context) {
+	var request alioth.RestorationBatchCollectionRequest
+	if bindJsonErr := ctx.ShouldBindJSON(&request); bindJsonErr != nil {
+		ctx.JSON(400, gin.H{
+			"message": "invalid request",
+			"error":   bindJsonErr.Error(),
+		})
+	} else if accepted, collectErr := defaultService.CollectLogExternalBatch(ctx, ctx.GetString(identityContextKey), &request); collectErr != nil {
+		collectionFailed(ctx, collectErr)
+	} else {
+		ctx.JSON(200, gin.H{
+			"message": "success",
+			"data":    &alioth.RestorationBatchCollectionResponse{Accepted: int32(accepted)},
+		})
+	}
+}
+
+func (h HttpServer) Query(ctx *gin.Context) {
+	request := alioth.RestorationQueryRequest{
+		Service:     ctx.Query("service"),
+		Level:       ctx.Query("level"),
+		TraceId:     ctx.Query("trace_id"),
+		Fingerprint: ctx.Query("fingerprint"),
+		Keyword:     ctx.Query("keyword"),
+		Since:       ctx.Query("since"),
+		Until:       ctx.Query("until"),
+		Cursor:      ctx.Query("cursor"),
+	}
+	if limit := ctx.Query("limit"); limit != "" {
+		if parsedLimit, parseErr := strconv.Atoi(limit); parseErr != nil {
+			ctx.JSON(400, gin.H{
+				"message": "invalid request",
+				"error":   "invalid limit",
+			})
+			return
+		} else {
+			request.Limit = int32(parsedLimit)
+		}
+	}
+
+	if response, queryErr := defaultService.QueryLog(ctx, &request); queryErr != nil {
+		queryFailed(ctx, queryErr)
+	} else {
+		ctx.JSON(200, gin.H{
+			"message": "success",
+			"data":    response,
+		})
+	}
+}
+
+func (h HttpServer) Trace(ctx *gin.Context) {
+	request := alioth.RestorationTraceRequest{TraceId: ctx.Param("trace_id")}
+	if request.TraceId == "" {
+		ctx.JSON(400, gin.H{
+			"message": "invalid request",
+			"error":   "invalid trace id",
+		})
+	} else if response, traceErr := defaultService.TraceLog(ctx, &request); traceErr != nil {
+		queryFailed(ctx, traceErr)
+	} else {
+		ctx.JSON(200, gin.H{
+			"message": "success",
+			"data":    response,
+		})
+	}
+}
+
+func (h HttpServer) Tail(ctx *gin.Context) {
+	request := alioth.RestorationTailRequest{
+		Service: ctx.Query("service"),
+		Level:   ctx.Query("level"),
+		TraceId: ctx.Query("trace_id"),
+		Keyword: ctx.Query("keyword"),
+	}
+	if bufferSize := ctx.Query("buffer_size"); bufferSize != "" {
+		if parsedBufferSize, parseErr := strconv.Atoi(bufferSize); parseErr != nil {
+			ctx.JSON(400, gin.H{
+				"message": "invalid request",
+				"error":   "invalid buffer size",
+			})
+			return
+		} else {
+			request.BufferSize = int32(parsedBufferSize)
+		}
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(200)
+	ctx.Writer.Flush()
+
+	_ = defaultService.TailLog(ctx.Request.Context(), &request, func(response *alioth.RestorationTailResponse) error {
+		ctx.SSEvent("record", response)
+		ctx.Writer.Flush()
+		return ctx.Request.Context().Err()
+	})
+}
+
+func (h HttpServer) ReloadAlertRules(ctx *gin.Context) {
+	if rules, reloadErr := defaultService.ReloadAlertRules(); isAlertNotReloadable(reloadErr) {
+		ctx.JSON(409, gin.H{
+			"message": "alert rules not reloadable",
+			"error":   reloadErr.Error(),
+		})
+	} else if reloadErr != nil {
+		ctx.JSON(500, gin.H{
+			"message": "internal error",
+			"error":   reloadErr.Error(),
+		})
+	} else {
+		ctx.JSON(200, gin.H{
+			"message": "success",
+			"data":    gin.H{"rules": rules},
+		})
+	}
+}
+
+// collectionFailed 返回接收日志失败的响应，超出限流额度时返回 429，便于客户端退避
+//   - err: 接收日志时返回的错误
+func collectionFailed(ctx *gin.Context, err error) {
+	if isRateLimited(err) {
+		ctx.Header("Retry-After", "1")
+		ctx.JSON(429, gin.H{
+			"message": "too many requests",
+			"error":   err.Error(),
+		})
+	} else {
+		ctx.JSON(500, gin.H{
+			"message": "internal error",
+			"error":   err.Error(),
+		})
+	}
+}
+
+func (h HttpServer) Sampling(ctx *gin.Context) {
+	service := ctx.GetString(identityContextKey)
+	if service == "" {
+		service = ctx.Query("service")
+	}
+
+	ctx.JSON(200, gin.H{
+		"message": "success",
+		"data":    defaultService.Sampling(service),
+	})
+}
+
+type samplingUpdateRequest struct {
+	MinLevel        string             `json:"min_level"`
+	Rates           map[string]float64 `json:"rates"`
+	TraceConsistent bool               `json:"trace_consistent"`
+	TTLSeconds      int                `json:"ttl_seconds"`
+}
+
+func (h HttpServer) UpdateSampling(ctx *gin.Context) {
+	var request samplingUpdateRequest
+	if bindJsonErr := ctx.ShouldBindJSON(&request); bindJsonErr != nil {
+		ctx.JSON(400, gin.H{
+			"message": "invalid request",
+			"error":   bindJsonErr.Error(),
+		})
+	} else if setErr := defaultService.SetSampling(ctx.Param("service"), request.MinLevel, request.Rates,
+		request.TraceConsistent, time.Duration(request.TTLSeconds)*time.Second); setErr != nil {
+		ctx.JSON(400, gin.H{
+			"message": "invalid request",
+			"error":   setErr.Error(),
+		})
+	} else {
+		ctx.JSON(200, gin.H{
+			"message": "success",
+			"data":    defaultService.Sampling(ctx.Param("service")),
+		})
+	}
+}
+
+func (h HttpServer) RemoveSampling(ctx *gin.Context) {
+	defaultService.RemoveSampling(ctx.Param("service"))
+	ctx.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+// OtlpLogs OTLP/HTTP 日志接收器，支持 protobuf 和 json 编码，以及 gzip 压缩的请求体
+func (h HttpServer) OtlpLogs(ctx *gin.Context) {
+	body := io.Reader(ctx.Request.Body)
+	if ctx.GetHeader("Content-Encoding") == "gzip" {
+		if gzipReader, newReaderErr := gzip.NewReader(body); newReaderErr != nil {
+			ctx.JSON(400, gin.H{
+				"message": "invalid request",
+				"error":   newReaderErr.Error(),
+			})
+			return
+		} else {
+			defer func() { _ = gzipReader.Close() }()
+			body = gzipReader
+		}
+	}
+
+	// 多读取一个字节用于判断请求体是否超过限制，超过限制时拒绝请求而不是截断后解析
+	payload, readErr := io.ReadAll(io.LimitReader(body, maxOtlpBodySize+1))
+	if readErr != nil {
+		ctx.JSON(400, gin.H{
+			"message": "invalid request",
+			"error":   readErr.Error(),
+		})
+		return
+	} else if len(payload) > maxOtlpBodySize {
+		ctx.JSON(413, gin.H{
+			"message": "request entity too large",
+			"error":   "request body exceeds " + strconv.Itoa(maxOtlpBodySize) + " bytes",
+		})
+		return
+	}
+
+	request := &collogspb.ExportLogsServiceRequest{}
+	isJson := strings.HasPrefix(ctx.ContentType(), "application/json")
+	if isJson {
+		readErr = unmarshalOtlpJson(payload, request)
+	} else {
+		readErr = proto.Unmarshal(payload, request)
+	}
+	if readErr != nil {
+		ctx.JSON(400, gin.H{
+			"message": "invalid request",
+			"error":   readErr.Error(),
+		})
+		return
+	}
+
+	if _, collectErr := defaultService.CollectLogOtlp(ctx, ctx.GetString(identityContextKey), log.External, request); collectErr != nil {
+		collectionFailed(ctx, collectErr)
+	} else if isJson {
+		response, _ := protojson.Marshal(&collogspb.ExportLogsServiceResponse{})
+		ctx.Data(200, "application/json", response)
+	} else {
+		response, _ := proto.Marshal(&collogspb.ExportLogsServiceResponse{})
+		ctx.Data(200, "application/x-protobuf", response)
+	}
+}
+
+// queryFailed 返回查询日志、问题和统计结果失败的响应，问题不存在时返回 404，查询条件不合法或者没有启用日志存储时返回 400
+//   - err: 查询时返回的错误
+func queryFailed(ctx *gin.Context, err error) {
+	if isIssueNotFound(err) {
+		ctx.JSON(404, gin.H{
+			"message": "not found",
+			"error":   err.Error(),
+		})
+	} else if isStorageDisabled(err) {
+		ctx.JSON(400, gin.H{
+			"message": "storage disabled",
+			"error":   err.Error(),
+		})
+	} else if isInvalidQuery(err) {
+		ctx.JSON(400, gin.H{
+			"message": "invalid request",
+			"error":   err.Error(),
+		})
+	} else {
+		ctx.JSON(500, gin.H{
+			"message": "internal error",
+			"error":   err.Error(),
+		})
+	}
+}
+
+// parseLimit 解析查询参数中的 limit，没有时返回 0，不合法时返回 400 响应并且 valid 为 false
+func parseLimit(ctx *gin.Context) (limit int32, valid bool) {
+	if value := ctx.Query("limit"); value != "" {
+		parsedLimit, parseErr := strconv.Atoi(value)
+		if parseErr != nil {
+			ctx.JSON(400, gin.H{
+				"message": "invalid request",
+				"error":   "invalid limit",
+			})
+			return 0, false
+		}
+		return int32(parsedLimit), true
+	}
+	return 0, true
+}
+
+func (h HttpServer) Issues(ctx *gin.Context) {
+	request := alioth.RestorationIssuesRequest{
+		Service: ctx.Query("service"),
+		Status:  ctx.Query("status"),
+		Cursor:  ctx.Query("cursor"),
+	}
+	limit, valid := parseLimit(ctx)
+	if !valid {
+		return
+	}
+	request.Limit = limit
+
+	if response, queryErr := defaultService.ListIssues(ctx, &request); queryErr != nil {
+		queryFailed(ctx, queryErr)
+	} else {
+		ctx.JSON(200, gin.H{
+			"message": "success",
+			"data":    response,
+		})
+	}
+}
+
+func (h HttpServer) Issue(ctx *gin.Context) {
+	request := alioth.RestorationIssueRequest{Fingerprint: ctx.Param("fingerprint")}
+	limit, valid := parseLimit(ctx)
+	if !valid {
+		return
+	}
+	request.Limit = limit
+
+	if response, queryErr := defaultService.GetIssue(ctx, &request); queryErr != nil {
+		queryFailed(ctx, queryErr)
+	} else {
+		ctx.JSON(200, gin.H{
+			"message": "success",
+			"data":    response,
+		})
+	}
+}
+
+func (h HttpServer) ResolveIssue(ctx *gin.Context) {
+	h.updateIssue(ctx, false)
+}
+
+func (h HttpServer) ReopenIssue(ctx *gin.Context) {
+	h.updateIssue(ctx, true)
+}
+
+func (h HttpServer) updateIssue(ctx *gin.Context, reopen bool) {
+	request := alioth.RestorationResolveIssueRequest{Fingerprint: ctx.Param("fingerprint"), Reopen: reopen}
+	if response, resolveErr := defaultService.ResolveIssue(ctx, &request); resolveErr != nil {
+		queryFailed(ctx, resolveErr)
+	} else {
+		ctx.JSON(200, gin.H{
+			"message": "success",
+			"data":    response,
+		})
+	}
+}
+
+func (h HttpServer) Stats(ctx *gin.Context) {
+	request := alioth.RestorationStatsRequest{
+		Metric:          ctx.Query("metric"),
+		Service:         ctx.Query("service"),
+		CalledFunction:  ctx.Query("called_function"),
+		Since:           ctx.Query("since"),
+		Until:           ctx.Query("until"),
+		GroupByFunction: ctx.Query("group_by_function") == "true",
+	}
+	if bucketSeconds := ctx.Query("bucket_seconds"); bucketSeconds != "" {
+		if parsedBucketSeconds, parseErr := strconv.Atoi(bucketSeconds); parseErr != nil {
+			ctx.JSON(400, gin.H{
+				"message": "invalid request",
+				"error":   "invalid bucket seconds",
+			})
+			return
+		} else {
+			request.BucketSeconds = int32(parsedBucketSeconds)
+		}
+	}
+
+	if response, statsErr := defaultService.Stats(ctx, &request); statsErr != nil {
+		queryFailed(ctx, statsErr)
 	} else {
-		defaultService.CollectLogExternal(ctx, &request)
 		ctx.JSON(200, gin.H{
 			"message": "success",
+			"data":    response,
 		})
 	}
 }
@@ -0,0 +1,23 @@
+package restoration
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQueryInvalidRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/query", HttpServer{}.Query)
+
+	// 查询条件不合法时返回 400，而不是服务端错误
+	for _, query := range []string{"since=yesterday", "until=tomorrow", "cursor=invalid", "limit=ten"} {
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, httptest.NewRequest("GET", "/query?"+query, nil))
+		if recorder.Code != 400 {
+			t.Errorf("GET /query?%s responded %d, want 400: %s", query, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -1,44 +1,96 @@
 package restoration
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"studio.sunist.work/platform/alioth-center/infrastructure/utils/exit"
 
 	"github.com/gin-gonic/gin"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
 	"google.golang.org/grpc"
 	stellar "studio.sunist.work/platform/alioth-center/core/stellar/client"
 	"studio.sunist.work/platform/alioth-center/infrastructure/initialize"
+	"studio.sunist.work/platform/alioth-center/infrastructure/lifecycle"
 	"studio.sunist.work/platform/alioth-center/infrastructure/utils/version"
 	"studio.sunist.work/platform/alioth-center/proto/alioth"
 )
 
-func RegisterToStellar() {
-	grpcConf := initialize.GlobalConfig().Grpc
-	client, err := stellar.NewClient(fmt.Sprintf("%s:%d", grpcConf.ListenIP, grpcConf.ListenPort))
-	if err != nil {
-		panic(err)
-	}
+// StellarRegistrationHook 创建注册到 stellar 的生命周期钩子，启动时注册服务，注册失败时关闭客户端，停止时卸载服务并关闭客户端，
+// 需要在 grpc 服务器之后添加，保证卸载时 grpc 服务器仍然可用
+func StellarRegistrationHook() lifecycle.Hook {
+	var client stellar.Client
+	handlerName := ""
 
-	_, handlerName, registerErr := client.Register("alioth-restoration", version.NewVersion(1, 0, 0, 0), grpcConf.ListenPort)
-	if registerErr != nil {
-		panic(registerErr)
+	return lifecycle.Hook{
+		Name: "restoration stellar registration",
+		OnStart: func(ctx context.Context) (err error) {
+			grpcConf := initialize.GlobalConfig().Grpc
+			if client, err = stellar.NewClient(fmt.Sprintf("%s:%d", grpcConf.ListenIP, grpcConf.ListenPort)); err != nil {
+				return err
+			}
+			if _, handlerName, err = client.Register("alioth-restoration", version.NewVersion(1, 0, 0, 0), grpcConf.ListenPort); err != nil {
+				return errors.Join(err, client.Close())
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return errors.Join(client.Unmount("alioth-restoration", handlerName), client.Close())
+		},
 	}
-
-	exit.AddExitFunctions(func() error {
-		err := client.Unmount("alioth-restoration", handlerName)
-		if err != nil {
-			return err
-		}
-		return nil
-	})
 }
 
 func InitRestorationRpcServer(server *grpc.Server) {
 	alioth.RegisterAliothRestorationServer(server, &RpcServer{})
+	collogspb.RegisterLogsServiceServer(server, &OtlpLogsServer{auth: newAuthenticator(initialize.GlobalConfig().Restoration.Auth)})
 }
 
 func InitRestorationHttpServer(group *gin.RouterGroup) {
 	server := HttpServer{}
+	auth := newAuthenticator(initialize.GlobalConfig().Restoration.Auth)
 	group.GET("/restoration/ping", server.Ping)
-	group.POST("/restoration/collection", server.Collection)
+	group.POST("/restoration/collection", auth.middleware, server.Collection)
+	group.POST("/restoration/batch_collection", auth.middleware, server.BatchCollection)
+	group.POST("/v1/logs", auth.middleware, server.OtlpLogs)
+	group.GET("/restoration/sampling", auth.middleware, server.Sampling)
+}
+
+// InitRestorationAdminHttpServer 注册查询和管理日志的接口，这些接口可以读取所有服务的日志，只能注册在管理接口的路由组上
+//   - group: 管理接口的路由组，需要已经使用了管理接口的认证中间件
+func InitRestorationAdminHttpServer(group *gin.RouterGroup) {
+	server := HttpServer{}
+	group.GET("/restoration/query", server.Query)
+	group.GET("/restoration/trace/:trace_id", server.Trace)
+	group.GET("/restoration/tail", server.Tail)
+	group.GET("/restoration/issues", server.Issues)
+	group.GET("/restoration/issues/:fingerprint", server.Issue)
+	group.POST("/restoration/issues/:fingerprint/resolve", server.ResolveIssue)
+	group.POST("/restoration/issues/:fingerprint/reopen", server.ReopenIssue)
+	group.GET("/restoration/stats", server.Stats)
+	group.POST("/restoration/alert/reload", server.ReloadAlertRules)
+	group.PUT("/restoration/sampling/:service", server.UpdateSampling)
+	group.DELETE("/restoration/sampling/:service", server.RemoveSampling)
+}
+
+// InitRestorationSyslogServer 根据配置注册 syslog 监听器，没有配置监听地址时不注册，
+// 生命周期启动时开始监听，监听失败时启动失败，停止时在 grpc 和 http 服务器之后关闭监听器
+func InitRestorationSyslogServer() {
+	conf := initialize.GlobalConfig().Restoration.Syslog
+	if conf.UDP == "" && conf.TCP == "" {
+		return
+	}
+
+	var server *SyslogServer
+	lifecycle.Append(lifecycle.Hook{
+		Name: "restoration syslog server",
+		OnStart: func(ctx context.Context) (err error) {
+			server, err = ListenSyslog(conf)
+			return err
+		},
+		OnStop: func(ctx context.Context) error {
+			if server == nil {
+				return nil
+			}
+			return server.Close()
+		},
+	})
 }
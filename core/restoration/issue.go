@@ -0,0 +1,325 @@
+package restoration
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+const (
+	issueUnresolved     = "unresolved"
+	issueResolved       = "resolved"
+	defaultIssueLimit   = 50
+	maxIssueLimit       = 500
+	defaultIssueRecords = 20
+	maxNormalizedLength = 2048
+)
+
+var (
+	uuidPattern       = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	ipPattern         = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`)
+	quotedPattern     = regexp.MustCompile(`'[^']*'|"[^"]*"`)
+	hexPattern        = regexp.MustCompile(`(?i)\b(?:0x[0-9a-f]+|[0-9a-f]{6,})\b`)
+	numberPattern     = regexp.MustCompile(`[-+]?\b\d+(?:\.\d+)?\b`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// normalizeMessage 将日志消息中的 uuid、ip、引号中的字符串、十六进制和数字替换为占位符，使只有参数不同的日志得到相同的指纹
+//   - message: 原始的日志消息，超过 maxNormalizedLength 的部分会被忽略
+func normalizeMessage(message string) string {
+	if len(message) > maxNormalizedLength {
+		message = message[:maxNormalizedLength]
+	}
+	message = uuidPattern.ReplaceAllString(message, "<uuid>")
+	message = ipPattern.ReplaceAllString(message, "<ip>")
+	message = quotedPattern.ReplaceAllString(message, "<str>")
+	// 只替换以 0x 开头或者同时包含数字和字母的十六进制，避免替换 decade 这样的单词
+	message = hexPattern.ReplaceAllStringFunc(message, func(value string) string {
+		if strings.HasPrefix(strings.ToLower(value), "0x") ||
+			(strings.ContainsAny(value, "0123456789") && strings.ContainsAny(strings.ToLower(value), "abcdef")) {
+			return "<hex>"
+		}
+		return value
+	})
+	message = numberPattern.ReplaceAllString(message, "<num>")
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(message, " "))
+}
+
+// isIssueLevel 判断日志是否需要聚合为问题，只有 error 和 panic 级别的日志会聚合
+func isIssueLevel(level string) bool {
+	return levelRank(level) >= levelRank(string(log.Error))
+}
+
+// issueOccurrence 同一批日志中指纹相同的日志聚合的结果
+type issueOccurrence struct {
+	fingerprint    string
+	service        string
+	level          string
+	codePath       string
+	calledFunction string
+	message        string
+	sampleMessage  string
+	sampleTraceID  string
+	count          int64
+	firstSeen      time.Time
+	lastSeen       time.Time
+}
+
+// fingerprintRecords 为 error 和 panic 级别的日志计算指纹，并按照指纹聚合
+//
+// 指纹由 caller_service, code_path, called_function 和归一化后的日志消息计算得到，会写入日志并随日志保存，
+// 问题中保存的归一化消息和示例消息使用服务端的脱敏引擎脱敏
+//   - records: 已经通过去重的日志
+func fingerprintRecords(records []*Fields) (occurrences []issueOccurrence) {
+	positions := map[string]int{}
+	for _, record := range records {
+		if !isIssueLevel(record.level) {
+			continue
+		}
+
+		normalized := normalizeMessage(record.message)
+		digest := sha1.Sum([]byte(record.service + "\x00" + record.code + "\x00" + record.calledFunction + "\x00" + normalized))
+		record.fingerprint = hex.EncodeToString(digest[:])
+		calledAt := record.calledTime()
+
+		if position, exist := positions[record.fingerprint]; exist {
+			occurrence := &occurrences[position]
+			occurrence.count++
+			if levelRank(record.level) > levelRank(occurrence.level) {
+				occurrence.level = strings.ToLower(record.level)
+			}
+			if calledAt.Before(occurrence.firstSeen) {
+				occurrence.firstSeen = calledAt
+			}
+			if !calledAt.Before(occurrence.lastSeen) {
+				occurrence.lastSeen, occurrence.sampleMessage = calledAt, redactor.RedactString(record.message)
+			}
+			if record.traceID != "" {
+				occurrence.sampleTraceID = record.traceID
+			}
+			continue
+		}
+
+		positions[record.fingerprint] = len(occurrences)
+		occurrences = append(occurrences, issueOccurrence{
+			fingerprint:    record.fingerprint,
+			service:        record.service,
+			level:          strings.ToLower(record.level),
+			codePath:       record.code,
+			calledFunction: record.calledFunction,
+			message:        redactor.RedactString(normalized),
+			sampleMessage:  redactor.RedactString(record.message),
+			sampleTraceID:  record.traceID,
+			count:          1,
+			firstSeen:      calledAt,
+			lastSeen:       calledAt,
+		})
+	}
+	return occurrences
+}
+
+// mergeOccurrence 将聚合结果合并到已有的问题中，已解决的问题会重新打开
+//   - issue: 已有的问题，为 nil 时创建新的问题
+//   - occurrence: 同一批日志的聚合结果
+func mergeOccurrence(issue *model.RestorationIssueDTO, occurrence issueOccurrence) *model.RestorationIssueDTO {
+	if issue == nil {
+		return &model.RestorationIssueDTO{
+			Fingerprint:    occurrence.fingerprint,
+			Service:        occurrence.service,
+			Level:          occurrence.level,
+			CodePath:       occurrence.codePath,
+			CalledFunction: occurrence.calledFunction,
+			Message:        occurrence.message,
+			SampleMessage:  occurrence.sampleMessage,
+			SampleTraceID:  occurrence.sampleTraceID,
+			Count:          occurrence.count,
+			FirstSeen:      occurrence.firstSeen,
+			LastSeen:       occurrence.lastSeen,
+			Status:         issueUnresolved,
+		}
+	}
+
+	issue.Count += occurrence.count
+	if levelRank(occurrence.level) > levelRank(issue.Level) {
+		issue.Level = occurrence.level
+	}
+	if occurrence.firstSeen.Before(issue.FirstSeen) {
+		issue.FirstSeen = occurrence.firstSeen
+	}
+	if occurrence.lastSeen.After(issue.LastSeen) {
+		issue.LastSeen = occurrence.lastSeen
+	}
+	issue.SampleMessage = occurrence.sampleMessage
+	if occurrence.sampleTraceID != "" {
+		issue.SampleTraceID = occurrence.sampleTraceID
+	}
+	issue.Status, issue.ResolvedAt = issueUnresolved, nil
+	return issue
+}
+
+// IssueFilter 问题查询的过滤条件，为零值的字段不参与过滤
+type IssueFilter struct {
+	Service string
+	Status  string
+	Limit   int
+	Offset  int
+}
+
+func (f IssueFilter) match(issue *model.RestorationIssueDTO) bool {
+	return (f.Service == "" || f.Service == issue.Service) && (f.Status == "" || f.Status == issue.Status)
+}
+
+// nextCursor 根据当前页的问题生成下一页的游标，不满一页时说明没有更多的问题
+func (f IssueFilter) nextCursor(issues []model.RestorationIssueDTO) string {
+	if len(issues) < f.Limit || len(issues) == 0 {
+		return ""
+	}
+	return strconv.Itoa(f.Offset + len(issues))
+}
+
+func newIssueFilter(request *alioth.RestorationIssuesRequest) (filter IssueFilter, err error) {
+	filter = IssueFilter{
+		Service: request.GetService(),
+		Status:  request.GetStatus(),
+		Limit:   int(request.GetLimit()),
+	}
+
+	if filter.Status != "" && filter.Status != issueUnresolved && filter.Status != issueResolved {
+		return IssueFilter{}, errors.NewInvalidRestorationQueryError("status", filter.Status)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultIssueLimit
+	} else if filter.Limit > maxIssueLimit {
+		filter.Limit = maxIssueLimit
+	}
+	if request.GetCursor() != "" {
+		if filter.Offset, err = strconv.Atoi(request.GetCursor()); err != nil || filter.Offset < 0 {
+			return IssueFilter{}, errors.NewInvalidRestorationQueryError("cursor", request.GetCursor())
+		}
+	}
+	return filter, nil
+}
+
+func exportIssue(issue model.RestorationIssueDTO) *alioth.RestorationIssue {
+	exported := &alioth.RestorationIssue{
+		Fingerprint:    issue.Fingerprint,
+		CallerService:  issue.Service,
+		Level:          issue.Level,
+		CodePath:       issue.CodePath,
+		CalledFunction: issue.CalledFunction,
+		Message:        issue.Message,
+		SampleMessage:  issue.SampleMessage,
+		SampleTraceId:  issue.SampleTraceID,
+		Count:          issue.Count,
+		FirstSeen:      issue.FirstSeen.Format(global.AliothTimeFormat),
+		LastSeen:       issue.LastSeen.Format(global.AliothTimeFormat),
+		Status:         issue.Status,
+	}
+	if issue.ResolvedAt != nil {
+		exported.ResolvedAt = issue.ResolvedAt.Format(global.AliothTimeFormat)
+	}
+	return exported
+}
+
+// isIssueNotFound 判断错误是否是因为问题不存在
+//   - err: 查询问题时返回的错误
+func isIssueNotFound(err error) bool {
+	_, notFound := err.(*errors.RestorationIssueNotFoundError)
+	return notFound
+}
+
+// isInvalidQuery 判断错误是否是因为查询条件不合法
+//   - err: 查询时返回的错误
+func isInvalidQuery(err error) bool {
+	_, invalid := err.(*errors.InvalidRestorationQueryError)
+	return invalid
+}
+
+// isStorageDisabled 判断错误是否是因为没有启用日志存储
+//   - err: 查询时返回的错误
+func isStorageDisabled(err error) bool {
+	_, disabled := err.(*errors.RestorationStorageDisabledError)
+	return disabled
+}
+
+// ListIssues 按照过滤条件查询问题
+func (s *Service) ListIssues(ctx context.Context, request *alioth.RestorationIssuesRequest) (*alioth.RestorationIssuesResponse, error) {
+	if s.storage == nil {
+		return nil, errors.NewRestorationStorageDisabledError()
+	}
+
+	filter, parseFilterErr := newIssueFilter(request)
+	if parseFilterErr != nil {
+		return nil, parseFilterErr
+	}
+
+	issues, nextCursor, queryErr := s.storage.Issues(ctx, filter)
+	if queryErr != nil {
+		return nil, queryErr
+	}
+
+	response := &alioth.RestorationIssuesResponse{
+		Issues:     make([]*alioth.RestorationIssue, len(issues)),
+		NextCursor: nextCursor,
+	}
+	for i, issue := range issues {
+		response.Issues[i] = exportIssue(issue)
+	}
+	return response, nil
+}
+
+// GetIssue 查询问题和最近的日志
+func (s *Service) GetIssue(ctx context.Context, request *alioth.RestorationIssueRequest) (*alioth.RestorationIssueResponse, error) {
+	if s.storage == nil {
+		return nil, errors.NewRestorationStorageDisabledError()
+	}
+
+	issue, queryErr := s.storage.Issue(ctx, request.GetFingerprint())
+	if queryErr != nil {
+		return nil, queryErr
+	}
+
+	limit := int(request.GetLimit())
+	if limit <= 0 {
+		limit = defaultIssueRecords
+	} else if limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+	records, _, queryRecordsErr := s.storage.Query(ctx, QueryFilter{Service: issue.Service, Fingerprint: issue.Fingerprint, Limit: limit})
+	if queryRecordsErr != nil {
+		return nil, queryRecordsErr
+	}
+
+	response := &alioth.RestorationIssueResponse{
+		Issue:   exportIssue(issue),
+		Records: make([]*alioth.RestorationRecord, len(records)),
+	}
+	for i, record := range records {
+		response.Records[i] = exportRecord(record)
+	}
+	return response, nil
+}
+
+// ResolveIssue 将问题标记为已解决，reopen 为 true 时重新打开问题
+func (s *Service) ResolveIssue(ctx context.Context, request *alioth.RestorationResolveIssueRequest) (*alioth.RestorationResolveIssueResponse, error) {
+	if s.storage == nil {
+		return nil, errors.NewRestorationStorageDisabledError()
+	}
+
+	issue, resolveErr := s.storage.ResolveIssue(ctx, request.GetFingerprint(), !request.GetReopen())
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+	return &alioth.RestorationResolveIssueResponse{Issue: exportIssue(issue)}, nil
+}
@@ -0,0 +1,66 @@
+package restoration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMessage(t *testing.T) {
+	cases := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{name: "numbers", message: "order 12345 failed after 3 retries", want: "order <num> failed after <num> retries"},
+		{name: "uuid", message: "user 6f1c2a0e-5b7d-4c1a-9e8f-0a1b2c3d4e5f not found", want: "user <uuid> not found"},
+		{name: "ip and port", message: "dial tcp 10.0.0.1:3306: connection refused", want: "dial tcp <ip>: connection refused"},
+		{name: "quoted strings", message: `key "user:1" and 'session' expired`, want: "key <str> and <str> expired"},
+		{name: "hex with prefix", message: "segfault at 0xdeadbeef", want: "segfault at <hex>"},
+		{name: "hex digest", message: "object 3f2a9c missing", want: "object <hex> missing"},
+		{name: "words made of hex letters", message: "decade facade added", want: "decade facade added"},
+		{name: "whitespace", message: "  too   many\n\tspaces  ", want: "too many spaces"},
+		{name: "plain message", message: "connection reset by peer", want: "connection reset by peer"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if normalized := normalizeMessage(c.message); normalized != c.want {
+				t.Errorf("normalizeMessage(%q) = %q, want %q", c.message, normalized, c.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeMessageTruncated(t *testing.T) {
+	message := strings.Repeat("a ", maxNormalizedLength)
+	if normalized := normalizeMessage(message + "tail"); strings.Contains(normalized, "tail") {
+		t.Errorf("normalized message should ignore the part after %d bytes", maxNormalizedLength)
+	}
+}
+
+func TestFingerprintRecords(t *testing.T) {
+	records := []*Fields{
+		{service: "a", level: "error", code: "main.go:10", message: "order 1 failed for bob@example.com", calledAt: "2024-01-02 03:04:05"},
+		{service: "a", level: "panic", code: "main.go:10", message: "order 2 failed for bob@example.com", calledAt: "2024-01-02 03:04:06"},
+		{service: "a", level: "error", code: "main.go:20", message: "order 3 failed for bob@example.com", calledAt: "2024-01-02 03:04:07"},
+		{service: "a", level: "info", code: "main.go:10", message: "order 4 failed"},
+	}
+
+	occurrences := fingerprintRecords(records)
+	if len(occurrences) != 2 {
+		t.Fatalf("got %d occurrences, want 2", len(occurrences))
+	}
+	if records[0].fingerprint != records[1].fingerprint || records[0].fingerprint == records[2].fingerprint || records[3].fingerprint != "" {
+		t.Errorf("unexpected fingerprints %q %q %q %q", records[0].fingerprint, records[1].fingerprint, records[2].fingerprint, records[3].fingerprint)
+	}
+
+	grouped := occurrences[0]
+	if grouped.count != 2 || grouped.level != "panic" {
+		t.Errorf("grouped %d records at level %s, want 2 at panic", grouped.count, grouped.level)
+	}
+	for _, occurrence := range occurrences {
+		if strings.Contains(occurrence.sampleMessage, "@example.com") || strings.Contains(occurrence.message, "@example.com") {
+			t.Errorf("occurrence %q with sample %q should be redacted", occurrence.message, occurrence.sampleMessage)
+		}
+	}
+}
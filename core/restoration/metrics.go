@@ -0,0 +1,488 @@
+package restoration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+	"studio.sunist.work/platform/alioth-center/infrastructure/metrics"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+const (
+	statsRecords           = "records"
+	defaultStatsResolution = time.Minute
+	defaultStatsRetention  = 24 * time.Hour
+	defaultStatsRange      = time.Hour
+	maxStatsBuckets        = 1440
+)
+
+var (
+	recordCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "alioth",
+		Subsystem: "restoration",
+		Name:      "records_total",
+		Help:      "Total number of accepted records by caller service and level.",
+	}, []string{"service", "level"})
+
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	// metricLabels 指标规则可以使用的标签，called_function 由调用方决定，作为标签会导致 prometheus 的序列数量不受控制
+	metricLabels = map[string]bool{"service": true, "level": true}
+)
+
+func init() {
+	metrics.MustRegister(recordCounter)
+}
+
+// metricRule 编译后的指标规则，counter 统计匹配的日志数量，histogram 统计 payload_fields 中的数值
+type metricRule struct {
+	name      string
+	service   string
+	minLevel  int
+	pattern   *regexp.Regexp
+	field     []string
+	labels    []string
+	counter   *prometheus.CounterVec
+	histogram *prometheus.HistogramVec
+}
+
+// newMetricRule 校验指标规则配置并创建对应的 prometheus 指标，指标需要调用方注册
+//   - conf: 指标规则配置
+func newMetricRule(conf config.RestorationMetricRuleConfig) (rule *metricRule, err error) {
+	rule = &metricRule{
+		name:     conf.Name,
+		service:  conf.Service,
+		minLevel: -1,
+		labels:   conf.Labels,
+	}
+
+	if !metricNamePattern.MatchString(conf.Name) {
+		return nil, fmt.Errorf("metric rule has invalid name: %s", conf.Name)
+	} else if conf.Name == statsRecords {
+		return nil, fmt.Errorf("metric rule name %s is reserved", conf.Name)
+	}
+	if conf.Level != "" {
+		if rank, exist := log.LevelRank(conf.Level); !exist {
+			return nil, fmt.Errorf("metric rule %s has invalid level: %s", conf.Name, conf.Level)
+		} else {
+			rule.minLevel = rank
+		}
+	}
+	if conf.MessagePattern != "" {
+		if pattern, compileErr := regexp.Compile(conf.MessagePattern); compileErr != nil {
+			return nil, fmt.Errorf("metric rule %s has invalid message pattern: %w", conf.Name, compileErr)
+		} else {
+			rule.pattern = pattern
+		}
+	}
+	if len(rule.labels) == 0 {
+		rule.labels = []string{"service"}
+	}
+	for _, label := range rule.labels {
+		if !metricLabels[label] {
+			return nil, fmt.Errorf("metric rule %s has invalid label: %s", conf.Name, label)
+		}
+	}
+
+	help := conf.Help
+	if help == "" {
+		help = fmt.Sprintf("Metric %s derived from restoration records.", conf.Name)
+	}
+	switch strings.ToLower(conf.Type) {
+	case "", "counter":
+		rule.counter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alioth",
+			Subsystem: "restoration",
+			Name:      strings.TrimSuffix(conf.Name, "_total") + "_total",
+			Help:      help,
+		}, rule.labels)
+	case "histogram":
+		if conf.Field == "" {
+			return nil, fmt.Errorf("metric rule %s has no field", conf.Name)
+		}
+		buckets := conf.Buckets
+		if len(buckets) == 0 {
+			buckets = prometheus.DefBuckets
+		}
+		rule.field = strings.Split(conf.Field, ".")
+		rule.histogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "alioth",
+			Subsystem: "restoration",
+			Name:      conf.Name,
+			Help:      help,
+			Buckets:   buckets,
+		}, rule.labels)
+	default:
+		return nil, fmt.Errorf("metric rule %s has invalid type: %s", conf.Name, conf.Type)
+	}
+	return rule, nil
+}
+
+func (r *metricRule) collector() prometheus.Collector {
+	if r.histogram != nil {
+		return r.histogram
+	}
+	return r.counter
+}
+
+func (r *metricRule) match(record *Fields) bool {
+	switch {
+	case r.service != "" && r.service != record.service:
+		return false
+	case r.minLevel >= 0 && levelRank(record.level) < r.minLevel:
+		return false
+	case r.pattern != nil && !r.pattern.MatchString(record.message):
+		return false
+	default:
+		return true
+	}
+}
+
+func (r *metricRule) labelValues(record *Fields) []string {
+	values := make([]string, len(r.labels))
+	for i, label := range r.labels {
+		switch label {
+		case "service":
+			values[i] = record.service
+		case "level":
+			values[i] = strings.ToLower(record.level)
+		}
+	}
+	return values
+}
+
+// payloadNumber 从 payload_fields 中取出路径对应的数值，支持数字和可以解析为数字的字符串
+//   - payload: 已经解析的 payload_fields
+//   - path: 使用 . 分隔的字段路径
+func payloadNumber(payload any, path []string) (value float64, exist bool) {
+	for _, key := range path {
+		object, isObject := payload.(map[string]any)
+		if !isObject {
+			return 0, false
+		}
+		if payload, exist = object[key]; !exist {
+			return 0, false
+		}
+	}
+
+	switch typed := payload.(type) {
+	case float64:
+		return typed, true
+	case string:
+		if parsed, parseErr := strconv.ParseFloat(typed, 64); parseErr == nil {
+			return parsed, true
+		}
+	}
+	return 0, false
+}
+
+// statsSeries 统计结果的维度
+type statsSeries struct {
+	metric         string
+	service        string
+	calledFunction string
+}
+
+// statsValue 一个维度在一个时间段内的统计结果
+type statsValue struct {
+	count  int64
+	errors int64
+	sum    float64
+	min    float64
+	max    float64
+}
+
+func (v *statsValue) add(other statsValue) {
+	if v.count == 0 || other.min < v.min {
+		v.min = other.min
+	}
+	if v.count == 0 || other.max > v.max {
+		v.max = other.max
+	}
+	v.count += other.count
+	v.errors += other.errors
+	v.sum += other.sum
+}
+
+// metricsEngine 在接收日志时统计指标，同时导出到 prometheus 和按照时间段保存在内存中
+//
+// 内存中的统计结果按照 resolution 分段，只保留 retention 内的时间段，
+// 使用服务端接收日志的时间分段，调用方提供的 called_at 不会影响统计的时间段
+type metricsEngine struct {
+	mtx        sync.Mutex
+	rules      []*metricRule
+	names      map[string]bool
+	resolution time.Duration
+	retention  time.Duration
+	buckets    map[int64]map[statsSeries]*statsValue
+	oldest     int64
+}
+
+func newMetricsEngine(conf config.RestorationMetricsConfig) (engine *metricsEngine, err error) {
+	engine = &metricsEngine{
+		names:      map[string]bool{statsRecords: true},
+		resolution: time.Duration(conf.ResolutionSeconds) * time.Second,
+		retention:  time.Duration(conf.RetentionHours) * time.Hour,
+		buckets:    map[int64]map[statsSeries]*statsValue{},
+	}
+	if engine.resolution <= 0 {
+		engine.resolution = defaultStatsResolution
+	}
+	if engine.retention <= 0 {
+		engine.retention = defaultStatsRetention
+	}
+
+	for _, ruleConf := range conf.Rules {
+		rule, newRuleErr := newMetricRule(ruleConf)
+		if newRuleErr != nil {
+			return nil, newRuleErr
+		} else if engine.names[rule.name] {
+			return nil, fmt.Errorf("metric rule %s is duplicated", rule.name)
+		}
+		engine.rules = append(engine.rules, rule)
+		engine.names[rule.name] = true
+	}
+
+	for _, rule := range engine.rules {
+		if registerErr := metrics.Registry().Register(rule.collector()); registerErr != nil {
+			return nil, fmt.Errorf("failed to register metric rule %s: %w", rule.name, registerErr)
+		}
+	}
+	return engine, nil
+}
+
+// observe 统计一批已经接收的日志
+//   - records: 通过去重的日志
+func (e *metricsEngine) observe(records []*Fields) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	now := time.Now()
+	receivedAt := now.Unix()
+	for _, record := range records {
+		level := strings.ToLower(record.level)
+		recordCounter.WithLabelValues(record.service, level).Inc()
+
+		value := statsValue{count: 1}
+		if isIssueLevel(level) {
+			value.errors = 1
+		}
+		e.record(receivedAt, statsSeries{metric: statsRecords, service: record.service, calledFunction: record.calledFunction}, value)
+
+		var payload any
+		decoded := false
+		for _, rule := range e.rules {
+			if !rule.match(record) {
+				continue
+			}
+			if rule.counter != nil {
+				rule.counter.WithLabelValues(rule.labelValues(record)...).Inc()
+				e.record(receivedAt, statsSeries{metric: rule.name, service: record.service, calledFunction: record.calledFunction}, value)
+				continue
+			}
+
+			// 多个 histogram 规则共用同一次解析的结果
+			if !decoded {
+				decoded = true
+				if len(record.payloadFields) > 0 {
+					_ = json.Unmarshal(record.payloadFields, &payload)
+				}
+			}
+			if number, exist := payloadNumber(payload, rule.field); exist {
+				rule.histogram.WithLabelValues(rule.labelValues(record)...).Observe(number)
+				observed := value
+				observed.sum, observed.min, observed.max = number, number, number
+				e.record(receivedAt, statsSeries{metric: rule.name, service: record.service, calledFunction: record.calledFunction}, observed)
+			}
+		}
+	}
+	e.prune(now.Add(-e.retention).Unix())
+}
+
+// record 将统计结果加入接收时间所在的时间段，调用方需要持有锁
+func (e *metricsEngine) record(receivedAt int64, series statsSeries, value statsValue) {
+	resolution := int64(e.resolution / time.Second)
+	start := receivedAt - receivedAt%resolution
+	bucket, exist := e.buckets[start]
+	if !exist {
+		bucket = map[statsSeries]*statsValue{}
+		e.buckets[start] = bucket
+		if e.oldest == 0 || start < e.oldest {
+			e.oldest = start
+		}
+	}
+	if stored, exist := bucket[series]; exist {
+		stored.add(value)
+	} else {
+		bucket[series] = &value
+	}
+}
+
+// prune 清理超出保留时长的时间段，调用方需要持有锁
+func (e *metricsEngine) prune(cutoff int64) {
+	resolution := int64(e.resolution / time.Second)
+	if e.oldest == 0 || e.oldest+resolution > cutoff {
+		return
+	}
+
+	e.oldest = 0
+	for start := range e.buckets {
+		if start+resolution <= cutoff {
+			delete(e.buckets, start)
+		} else if e.oldest == 0 || start < e.oldest {
+			e.oldest = start
+		}
+	}
+}
+
+// statsFilter RestorationStats 的查询条件
+type statsFilter struct {
+	metric          string
+	service         string
+	calledFunction  string
+	since           time.Time
+	until           time.Time
+	bucket          time.Duration
+	groupByFunction bool
+}
+
+func (e *metricsEngine) newStatsFilter(request *alioth.RestorationStatsRequest) (filter statsFilter, err error) {
+	filter = statsFilter{
+		metric:          request.GetMetric(),
+		service:         request.GetService(),
+		calledFunction:  request.GetCalledFunction(),
+		until:           time.Now(),
+		bucket:          time.Duration(request.GetBucketSeconds()) * time.Second,
+		groupByFunction: request.GetGroupByFunction(),
+	}
+
+	if filter.metric == "" {
+		filter.metric = statsRecords
+	} else if !e.names[filter.metric] {
+		return statsFilter{}, errors.NewInvalidRestorationQueryError("metric", filter.metric)
+	}
+	if request.GetUntil() != "" {
+		if filter.until, err = parseQueryTime(request.GetUntil()); err != nil {
+			return statsFilter{}, errors.NewInvalidRestorationQueryError("until", request.GetUntil())
+		}
+	}
+	filter.since = filter.until.Add(-defaultStatsRange)
+	if request.GetSince() != "" {
+		if filter.since, err = parseQueryTime(request.GetSince()); err != nil {
+			return statsFilter{}, errors.NewInvalidRestorationQueryError("since", request.GetSince())
+		}
+	}
+	if !filter.since.Before(filter.until) {
+		return statsFilter{}, errors.NewInvalidRestorationQueryError("since", request.GetSince())
+	}
+
+	// 时间段的长度向上取整为统计粒度的整数倍
+	if filter.bucket < 0 {
+		return statsFilter{}, errors.NewInvalidRestorationQueryError("bucket_seconds", strconv.Itoa(int(request.GetBucketSeconds())))
+	} else if remainder := filter.bucket % e.resolution; filter.bucket == 0 || remainder != 0 {
+		filter.bucket += e.resolution - remainder
+	}
+	if filter.until.Sub(filter.since)/filter.bucket > maxStatsBuckets {
+		return statsFilter{}, errors.NewInvalidRestorationQueryError("bucket_seconds", strconv.Itoa(int(request.GetBucketSeconds())))
+	}
+	return filter, nil
+}
+
+// stats 按照查询条件合并时间段内的统计结果
+func (e *metricsEngine) stats(request *alioth.RestorationStatsRequest) (*alioth.RestorationStatsResponse, error) {
+	filter, parseFilterErr := e.newStatsFilter(request)
+	if parseFilterErr != nil {
+		return nil, parseFilterErr
+	}
+
+	bucketSeconds := int64(filter.bucket / time.Second)
+	merged := map[statsSeries]map[int64]*statsValue{}
+	e.mtx.Lock()
+	for start, bucket := range e.buckets {
+		if start < filter.since.Unix() || start >= filter.until.Unix() {
+			continue
+		}
+		for series, value := range bucket {
+			if series.metric != filter.metric || (filter.service != "" && series.service != filter.service) ||
+				(filter.calledFunction != "" && series.calledFunction != filter.calledFunction) {
+				continue
+			}
+
+			key := statsSeries{metric: series.metric, service: series.service}
+			if filter.groupByFunction {
+				key.calledFunction = series.calledFunction
+			}
+			if merged[key] == nil {
+				merged[key] = map[int64]*statsValue{}
+			}
+			aligned := start - start%bucketSeconds
+			if stored, exist := merged[key][aligned]; exist {
+				stored.add(*value)
+			} else {
+				copied := *value
+				merged[key][aligned] = &copied
+			}
+		}
+	}
+	e.mtx.Unlock()
+
+	response := &alioth.RestorationStatsResponse{
+		Metric:        filter.metric,
+		BucketSeconds: int32(bucketSeconds),
+		Series:        make([]*alioth.RestorationStatsSeries, 0, len(merged)),
+	}
+	for key, values := range merged {
+		starts := make([]int64, 0, len(values))
+		for start := range values {
+			starts = append(starts, start)
+		}
+		sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+		series := &alioth.RestorationStatsSeries{
+			CallerService:  key.service,
+			CalledFunction: key.calledFunction,
+			Buckets:        make([]*alioth.RestorationStatsBucket, len(starts)),
+		}
+		for i, start := range starts {
+			value := values[start]
+			series.Buckets[i] = &alioth.RestorationStatsBucket{
+				Start:     time.Unix(start, 0).Format(global.AliothTimeFormat),
+				Count:     value.count,
+				Errors:    value.errors,
+				ErrorRate: float64(value.errors) / float64(value.count),
+				Sum:       value.sum,
+				Min:       value.min,
+				Max:       value.max,
+			}
+		}
+		response.Series = append(response.Series, series)
+	}
+	sort.Slice(response.Series, func(i, j int) bool {
+		if response.Series[i].CallerService != response.Series[j].CallerService {
+			return response.Series[i].CallerService < response.Series[j].CallerService
+		}
+		return response.Series[i].CalledFunction < response.Series[j].CalledFunction
+	})
+	return response, nil
+}
+
+// Stats 查询从日志中统计的指标，按照时间段返回
+func (s *Service) Stats(_ context.Context, request *alioth.RestorationStatsRequest) (*alioth.RestorationStatsResponse, error) {
+	if s.metrics == nil {
+		return nil, errors.NewRestorationMetricsDisabledError()
+	}
+	return s.metrics.stats(request)
+}
@@ -0,0 +1,126 @@
+package restoration
+
+import (
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+func TestMetricsObserveUsesReceiveTime(t *testing.T) {
+	engine, newErr := newMetricsEngine(config.RestorationMetricsConfig{ResolutionSeconds: 60, RetentionHours: 1})
+	if newErr != nil {
+		t.Fatalf("new metrics engine: %v", newErr)
+	}
+
+	// 调用方提供的 called_at 在很久以前、很久以后或者无法解析，都统计在接收时间所在的时间段
+	engine.observe([]*Fields{
+		{service: "a", level: "info", calledAt: "2000-01-01 00:00:00"},
+		{service: "a", level: "error", calledAt: "2999-01-01 00:00:00"},
+		{service: "a", level: "info", calledAt: "invalid"},
+		{service: "a", level: "info"},
+	})
+
+	response, statsErr := engine.stats(&alioth.RestorationStatsRequest{Until: time.Now().Add(time.Minute).Format(time.RFC3339)})
+	if statsErr != nil {
+		t.Fatalf("stats: %v", statsErr)
+	}
+	if len(response.Series) != 1 || len(response.Series[0].Buckets) != 1 {
+		t.Fatalf("got %v, want a single series with a single bucket", response.Series)
+	}
+	if bucket := response.Series[0].Buckets[0]; bucket.Count != 4 || bucket.Errors != 1 {
+		t.Errorf("bucket counted %d records and %d errors, want 4 and 1", bucket.Count, bucket.Errors)
+	}
+	if len(engine.buckets) != 1 {
+		t.Errorf("engine kept %d buckets, want 1", len(engine.buckets))
+	}
+}
+
+func TestMetricsStatsBuckets(t *testing.T) {
+	engine, _ := newMetricsEngine(config.RestorationMetricsConfig{ResolutionSeconds: 60, RetentionHours: 1})
+	since := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	for i, minute := range []int{0, 1, 2, 5} {
+		series := statsSeries{metric: statsRecords, service: "a", calledFunction: []string{"f", "g"}[i%2]}
+		engine.record(since.Add(time.Duration(minute)*time.Minute+30*time.Second).Unix(), series, statsValue{count: 1})
+	}
+	engine.record(since.Add(time.Minute).Unix(), statsSeries{metric: statsRecords, service: "b", calledFunction: "f"}, statsValue{count: 1, errors: 1})
+
+	cases := []struct {
+		name    string
+		request *alioth.RestorationStatsRequest
+		counts  map[string][]int64
+	}{
+		{
+			name:    "merged into two minute buckets",
+			request: &alioth.RestorationStatsRequest{BucketSeconds: 120},
+			counts:  map[string][]int64{"a/": {2, 1, 1}, "b/": {1}},
+		},
+		{
+			name:    "bucket rounded up to the resolution",
+			request: &alioth.RestorationStatsRequest{Service: "a", BucketSeconds: 90},
+			counts:  map[string][]int64{"a/": {2, 1, 1}},
+		},
+		{
+			name:    "grouped by function",
+			request: &alioth.RestorationStatsRequest{Service: "a", GroupByFunction: true, BucketSeconds: 3600},
+			counts:  map[string][]int64{"a/f": {2}, "a/g": {2}},
+		},
+		{
+			name:    "filtered by function",
+			request: &alioth.RestorationStatsRequest{CalledFunction: "f", BucketSeconds: 3600},
+			counts:  map[string][]int64{"a/": {2}, "b/": {1}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.request.Since = since.Format(time.RFC3339)
+			c.request.Until = since.Add(time.Hour).Format(time.RFC3339)
+			response, statsErr := engine.stats(c.request)
+			if statsErr != nil {
+				t.Fatalf("stats: %v", statsErr)
+			}
+
+			counts := map[string][]int64{}
+			for _, series := range response.Series {
+				key := series.CallerService + "/" + series.CalledFunction
+				for _, bucket := range series.Buckets {
+					counts[key] = append(counts[key], bucket.Count)
+				}
+			}
+			if len(counts) != len(c.counts) {
+				t.Fatalf("got series %v, want %v", counts, c.counts)
+			}
+			for key, want := range c.counts {
+				if got := counts[key]; len(got) != len(want) {
+					t.Errorf("series %s has buckets %v, want %v", key, got, want)
+				} else {
+					for i := range want {
+						if got[i] != want[i] {
+							t.Errorf("series %s has buckets %v, want %v", key, got, want)
+							break
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsPrune(t *testing.T) {
+	engine, _ := newMetricsEngine(config.RestorationMetricsConfig{ResolutionSeconds: 60, RetentionHours: 1})
+	now := time.Now()
+	engine.record(now.Add(-2*time.Hour).Unix(), statsSeries{metric: statsRecords, service: "old"}, statsValue{count: 1})
+	engine.record(now.Unix(), statsSeries{metric: statsRecords, service: "new"}, statsValue{count: 1})
+	engine.prune(now.Add(-engine.retention).Unix())
+
+	if len(engine.buckets) != 1 {
+		t.Fatalf("engine kept %d buckets after prune, want 1", len(engine.buckets))
+	}
+	for _, bucket := range engine.buckets {
+		if _, exist := bucket[statsSeries{metric: statsRecords, service: "new"}]; !exist {
+			t.Error("the bucket within retention should be kept")
+		}
+	}
+}
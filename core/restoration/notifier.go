@@ -0,0 +1,151 @@
+package restoration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+	"studio.sunist.work/platform/alioth-center/infrastructure/mail"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+// Alert 告警规则触发时发送给通知渠道的内容
+type Alert struct {
+	Rule       string    `json:"rule"`
+	Service    string    `json:"service"`
+	Count      int       `json:"count"`      // 时间窗口内匹配的日志数量
+	Window     string    `json:"window"`     // 统计的时间窗口
+	Suppressed int       `json:"suppressed"` // 上一次通知后因为冷却而没有通知的触发次数
+	Level      string    `json:"level"`      // 最后一条匹配日志的级别
+	Message    string    `json:"message"`    // 最后一条匹配日志的消息
+	TraceID    string    `json:"trace_id"`   // 最后一条匹配日志的 trace_id
+	FiredAt    time.Time `json:"fired_at"`
+}
+
+func (a Alert) subject() string {
+	return fmt.Sprintf("[alioth alert] %s: %d records from %s in %s", a.Rule, a.Count, a.Service, a.Window)
+}
+
+func (a Alert) text() string {
+	lines := []string{
+		"rule: " + a.Rule,
+		"service: " + a.Service,
+		fmt.Sprintf("count: %d in %s", a.Count, a.Window),
+		"fired at: " + a.FiredAt.Format(global.AliothTimeFormat),
+		"level: " + a.Level,
+		"message: " + a.Message,
+	}
+	if a.TraceID != "" {
+		lines = append(lines, "trace id: "+a.TraceID)
+	}
+	if a.Suppressed > 0 {
+		lines = append(lines, fmt.Sprintf("suppressed during cooldown: %d", a.Suppressed))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// notifier 告警的通知渠道
+type notifier interface {
+	notify(ctx context.Context, alert Alert) error
+}
+
+// newNotifier 根据配置创建通知渠道
+//   - conf: 通知渠道配置
+func newNotifier(conf config.RestorationAlertNotifierConfig) (n notifier, err error) {
+	switch conf.Type {
+	case "webhook":
+		if conf.URL == "" {
+			return nil, fmt.Errorf("webhook notifier %s has no url", conf.Name)
+		}
+		return &webhookNotifier{url: conf.URL, headers: conf.Headers, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "smtp":
+		sender := mail.DefaultSender()
+		if !sender.Configured() {
+			return nil, fmt.Errorf("smtp notifier %s requires smtp config", conf.Name)
+		} else if len(conf.To) == 0 {
+			return nil, fmt.Errorf("smtp notifier %s has no recipient", conf.Name)
+		}
+		return &smtpNotifier{sender: sender, to: conf.To}, nil
+	case "log":
+		if conf.Logger == "" {
+			conf.Logger = "logs/alert"
+		}
+		return &logNotifier{logger: alertLogger(conf.Logger)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported alert notifier type: %s", conf.Type)
+	}
+}
+
+// webhookNotifier 将告警以 json 格式 POST 到指定的地址
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, alert Alert) error {
+	request, newRequestErr := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(utils.JsonMarshal(alert)))
+	if newRequestErr != nil {
+		return newRequestErr
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range n.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, doErr := n.client.Do(request)
+	if doErr != nil {
+		return doErr
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook response status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// smtpNotifier 使用全局的 smtp 配置发送告警邮件
+type smtpNotifier struct {
+	sender *mail.Sender
+	to     []string
+}
+
+func (n *smtpNotifier) notify(_ context.Context, alert Alert) error {
+	return n.sender.Send(n.to, alert.subject(), "text/plain", alert.text())
+}
+
+var (
+	alertLoggersMtx sync.Mutex
+	alertLoggers    = map[string]*log.Logger{}
+)
+
+// alertLogger 获取告警使用的日志对象，同一个目录只创建一次，避免重新加载规则时重复创建
+//   - dir: 日志输出目录
+func alertLogger(dir string) *log.Logger {
+	alertLoggersMtx.Lock()
+	defer alertLoggersMtx.Unlock()
+
+	if logger, exist := alertLoggers[dir]; exist {
+		return logger
+	}
+	alertLoggers[dir] = log.NewLogger(dir)
+	return alertLoggers[dir]
+}
+
+// logNotifier 将告警写入日志文件
+type logNotifier struct {
+	logger *log.Logger
+}
+
+func (n *logNotifier) notify(ctx context.Context, alert Alert) error {
+	n.logger.Log(log.DefaultField().WithFields(log.Warn, log.Module, alert.subject(), ctx).WithExtra(alert))
+	return nil
+}
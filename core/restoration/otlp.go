@@ -0,0 +1,254 @@
+package restoration
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+// OtlpLogsServer OTLP/gRPC 日志接收器，将 OpenTelemetry 的日志转换为 restoration 的日志，
+// 使用与外部接收日志相同的认证，认证后的身份覆盖资源属性中的 service.name
+type OtlpLogsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	auth *authenticator
+}
+
+func (s OtlpLogsServer) Export(ctx context.Context, request *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	identity, authErr := s.auth.authenticateRpc(ctx)
+	if _, unauthenticated := authErr.(*errors.RestorationUnauthenticatedError); unauthenticated {
+		return nil, status.Error(codes.Unauthenticated, authErr.Error())
+	} else if authErr != nil {
+		return nil, authErr
+	}
+
+	if _, collectErr := defaultService.CollectLogOtlp(ctx, identity, log.Service, request); collectErr != nil {
+		return nil, collectionError(collectErr)
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+// unmarshalOtlpJson 解析 json 编码的 OTLP 日志，规范要求 traceId 和 spanId 使用十六进制字符串，
+// 而 protojson 将 bytes 字段作为 base64 解码，因此先将日志中的十六进制 id 转换为 base64 再解析
+//   - payload: json 编码的请求体
+//   - request: 解析结果
+func unmarshalOtlpJson(payload []byte, request *collogspb.ExportLogsServiceRequest) error {
+	var document map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if decodeErr := decoder.Decode(&document); decodeErr != nil {
+		return decodeErr
+	}
+
+	for _, resourceLogs := range otlpJsonList(document, "resourceLogs", "resource_logs") {
+		for _, scopeLogs := range otlpJsonList(resourceLogs, "scopeLogs", "scope_logs") {
+			for _, record := range otlpJsonList(scopeLogs, "logRecords", "log_records") {
+				for _, key := range []string{"traceId", "trace_id", "spanId", "span_id"} {
+					if id, isString := record[key].(string); isString {
+						if decoded, decodeErr := hex.DecodeString(id); decodeErr == nil {
+							record[key] = base64.StdEncoding.EncodeToString(decoded)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if converted, marshalErr := json.Marshal(document); marshalErr != nil {
+		return marshalErr
+	} else {
+		return protojson.Unmarshal(converted, request)
+	}
+}
+
+// otlpJsonList 获取 json 对象中的对象数组，protojson 同时接受驼峰和下划线两种字段名
+//   - object: json 对象
+//   - keys: 字段名
+func otlpJsonList(object map[string]any, keys ...string) []map[string]any {
+	var list []map[string]any
+	for _, key := range keys {
+		if items, isList := object[key].([]any); isList {
+			for _, item := range items {
+				if value, isObject := item.(map[string]any); isObject {
+					list = append(list, value)
+				}
+			}
+		}
+	}
+	return list
+}
+
+// NewRestorationFieldsFromOtlp 将 OTLP 日志转换为 restoration 的日志
+//   - ctx: 请求的上下文，用于获取调用方 IP
+//   - caller: 调用方类型
+//   - request: OTLP 日志导出请求
+func NewRestorationFieldsFromOtlp(ctx context.Context, caller log.LoggerCaller, request *collogspb.ExportLogsServiceRequest) []*Fields {
+	ip := clientIP(ctx)
+
+	var records []*Fields
+	for _, resourceLogs := range request.GetResourceLogs() {
+		resource := otlpAttributes(resourceLogs.GetResource().GetAttributes())
+		service, _ := resource["service.name"].(string)
+
+		for _, scopeLogs := range resourceLogs.GetScopeLogs() {
+			for _, record := range scopeLogs.GetLogRecords() {
+				records = append(records, newFieldsFromOtlpRecord(record, resource, scopeLogs.GetScope(), service, ip, caller))
+			}
+		}
+	}
+	return records
+}
+
+// newFieldsFromOtlpRecord 转换一条 OTLP 日志，日志属性作为 payload_fields，资源、范围和 span 信息作为 extra_fields
+func newFieldsFromOtlpRecord(record *logspb.LogRecord, resource map[string]any, scope *commonpb.InstrumentationScope,
+	service, ip string, caller log.LoggerCaller,
+) *Fields {
+	attributes := otlpAttributes(record.GetAttributes())
+
+	code := ""
+	if file, isString := attributes["code.filepath"].(string); isString {
+		code = file
+		if line, exist := attributes["code.lineno"]; exist {
+			code += ":" + otlpString(line)
+		}
+	}
+	function, _ := attributes["code.function"].(string)
+	if namespace, isString := attributes["code.namespace"].(string); isString && function != "" {
+		function = namespace + "." + function
+	}
+	for _, key := range []string{"code.filepath", "code.lineno", "code.function", "code.namespace"} {
+		delete(attributes, key)
+	}
+
+	calledAt := time.Now()
+	if record.GetTimeUnixNano() != 0 {
+		calledAt = time.Unix(0, int64(record.GetTimeUnixNano()))
+	} else if record.GetObservedTimeUnixNano() != 0 {
+		calledAt = time.Unix(0, int64(record.GetObservedTimeUnixNano()))
+	}
+
+	extra := map[string]any{"resource": resource}
+	if scope != nil {
+		extra["scope"] = map[string]any{"name": scope.GetName(), "version": scope.GetVersion()}
+	}
+	if len(record.GetSpanId()) > 0 {
+		extra["span_id"] = hex.EncodeToString(record.GetSpanId())
+	}
+	if record.GetSeverityText() != "" {
+		extra["severity_text"] = record.GetSeverityText()
+	}
+
+	f := &Fields{
+		callerIP:       ip,
+		service:        service,
+		code:           code,
+		level:          otlpLevel(record.GetSeverityNumber(), record.GetSeverityText()),
+		caller:         string(caller),
+		message:        otlpString(otlpValue(record.GetBody())),
+		calledAt:       calledAt.Format(global.AliothTimeFormat),
+		calledFunction: function,
+		extraFields:    utils.JsonMarshal(extra),
+	}
+	if len(record.GetTraceId()) > 0 {
+		f.traceID = hex.EncodeToString(record.GetTraceId())
+	}
+	if len(attributes) > 0 {
+		f.payloadFields = utils.JsonMarshal(attributes)
+	}
+	return f
+}
+
+// otlpLevel 将 OTLP 的日志级别转换为 restoration 的日志级别，TRACE 视为 debug，FATAL 视为 panic
+//   - number: SeverityNumber，未设置时使用 SeverityText
+//   - text: SeverityText
+func otlpLevel(number logspb.SeverityNumber, text string) string {
+	switch {
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_FATAL:
+		return string(log.Panic)
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR:
+		return string(log.Error)
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_WARN:
+		return string(log.Warn)
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_INFO:
+		return string(log.Info)
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_TRACE:
+		return string(log.Debug)
+	}
+
+	switch strings.ToLower(text) {
+	case "trace", "debug":
+		return string(log.Debug)
+	case "warn", "warning":
+		return string(log.Warn)
+	case "error":
+		return string(log.Error)
+	case "fatal", "panic", "critical":
+		return string(log.Panic)
+	default:
+		return string(log.Info)
+	}
+}
+
+func otlpAttributes(attributes []*commonpb.KeyValue) map[string]any {
+	values := make(map[string]any, len(attributes))
+	for _, attribute := range attributes {
+		values[attribute.GetKey()] = otlpValue(attribute.GetValue())
+	}
+	return values
+}
+
+// otlpValue 将 OTLP 的 AnyValue 转换为可以序列化为 json 的值
+func otlpValue(value *commonpb.AnyValue) any {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return v.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]any, len(v.ArrayValue.GetValues()))
+		for i, item := range v.ArrayValue.GetValues() {
+			values[i] = otlpValue(item)
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		return otlpAttributes(v.KvlistValue.GetValues())
+	default:
+		return nil
+	}
+}
+
+// otlpString 将转换后的值作为日志消息，字符串直接使用，其他类型序列化为 json
+func otlpString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return string(utils.JsonMarshal(v))
+	}
+}
@@ -0,0 +1,154 @@
+package restoration
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+const (
+	otlpTestTraceID  = "5b8efff798038103d269b633813fc60c"
+	otlpTestSpanID   = "eee19b7ec3c1b174"
+	otlpTestUnixNano = 1704164645000000000
+)
+
+// otlpTestJson 与 newOtlpTestRequest 内容相同的 json 编码请求，traceId 和 spanId 按照规范使用十六进制字符串
+const otlpTestJson = `{"resourceLogs":[{
+	"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"order"}}]},
+	"scopeLogs":[{
+		"scope":{"name":"otel","version":"1.0"},
+		"logRecords":[{
+			"timeUnixNano":"1704164645000000000",
+			"severityNumber":17,
+			"severityText":"ERROR",
+			"body":{"stringValue":"payment failed"},
+			"traceId":"5b8efff798038103d269b633813fc60c",
+			"spanId":"eee19b7ec3c1b174",
+			"attributes":[
+				{"key":"code.filepath","value":{"stringValue":"pay.go"}},
+				{"key":"code.lineno","value":{"intValue":"42"}},
+				{"key":"code.function","value":{"stringValue":"Pay"}},
+				{"key":"code.namespace","value":{"stringValue":"order"}},
+				{"key":"user.id","value":{"stringValue":"u1"}}
+			]
+		}]
+	}]
+}]}`
+
+func newOtlpTestRequest() *collogspb.ExportLogsServiceRequest {
+	traceID, _ := hex.DecodeString(otlpTestTraceID)
+	spanID, _ := hex.DecodeString(otlpTestSpanID)
+	stringValue := func(key, value string) *commonpb.KeyValue {
+		return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+	}
+
+	return &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringValue("service.name", "order")}},
+		ScopeLogs: []*logspb.ScopeLogs{{
+			Scope: &commonpb.InstrumentationScope{Name: "otel", Version: "1.0"},
+			LogRecords: []*logspb.LogRecord{{
+				TimeUnixNano:   otlpTestUnixNano,
+				SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+				SeverityText:   "ERROR",
+				Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "payment failed"}},
+				TraceId:        traceID,
+				SpanId:         spanID,
+				Attributes: []*commonpb.KeyValue{
+					stringValue("code.filepath", "pay.go"),
+					{Key: "code.lineno", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 42}}},
+					stringValue("code.function", "Pay"),
+					stringValue("code.namespace", "order"),
+					stringValue("user.id", "u1"),
+				},
+			}},
+		}},
+	}}}
+}
+
+func TestNewRestorationFieldsFromOtlp(t *testing.T) {
+	want := &Fields{
+		service:        "order",
+		code:           "pay.go:42",
+		level:          string(log.Error),
+		caller:         string(log.External),
+		message:        "payment failed",
+		calledAt:       time.Unix(0, otlpTestUnixNano).Format(global.AliothTimeFormat),
+		calledFunction: "order.Pay",
+		traceID:        otlpTestTraceID,
+		payloadFields:  utils.JsonMarshal(map[string]any{"user.id": "u1"}),
+		extraFields: utils.JsonMarshal(map[string]any{
+			"resource":      map[string]any{"service.name": "order"},
+			"scope":         map[string]any{"name": "otel", "version": "1.0"},
+			"severity_text": "ERROR",
+			"span_id":       otlpTestSpanID,
+		}),
+	}
+
+	encoded, _ := proto.Marshal(newOtlpTestRequest())
+	cases := []struct {
+		name      string
+		unmarshal func(request *collogspb.ExportLogsServiceRequest) error
+	}{
+		{name: "protobuf", unmarshal: func(request *collogspb.ExportLogsServiceRequest) error {
+			return proto.Unmarshal(encoded, request)
+		}},
+		{name: "json", unmarshal: func(request *collogspb.ExportLogsServiceRequest) error {
+			return unmarshalOtlpJson([]byte(otlpTestJson), request)
+		}},
+	}
+
+	// 两种编码解析后得到相同的日志，十六进制的 id 不会被当作 base64 解码
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := &collogspb.ExportLogsServiceRequest{}
+			if unmarshalErr := c.unmarshal(request); unmarshalErr != nil {
+				t.Fatalf("unmarshal: %v", unmarshalErr)
+			}
+			records := NewRestorationFieldsFromOtlp(context.Background(), log.External, request)
+			if len(records) != 1 {
+				t.Fatalf("converted %d records, want 1", len(records))
+			}
+			if !reflect.DeepEqual(records[0], want) {
+				t.Errorf("converted %+v, want %+v", records[0], want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalOtlpJsonInvalid(t *testing.T) {
+	for _, payload := range []string{`{"resourceLogs":`, `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"traceId":"not an id"}]}]}]}`} {
+		if unmarshalErr := unmarshalOtlpJson([]byte(payload), &collogspb.ExportLogsServiceRequest{}); unmarshalErr == nil {
+			t.Errorf("unmarshal %s should fail", payload)
+		}
+	}
+}
+
+func TestOtlpLogsBodyTooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/v1/logs", HttpServer{}.OtlpLogs)
+
+	// 超过限制的请求体返回 413，而不是截断后作为不完整的日志解析
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/v1/logs", bytes.NewReader(make([]byte, maxOtlpBodySize+1)))
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != 413 {
+		t.Errorf("POST /v1/logs responded %d, want 413: %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,203 @@
+package restoration
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+	"studio.sunist.work/platform/alioth-center/infrastructure/metrics"
+)
+
+const bucketIdleTimeout = 10 * time.Minute
+
+var throttledCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "alioth",
+	Subsystem: "restoration",
+	Name:      "throttled_records_total",
+	Help:      "Total number of records rejected by the ingestion rate limit, by caller service and limit.",
+}, []string{"service", "limit"})
+
+func init() {
+	metrics.MustRegister(throttledCounter)
+}
+
+// tokenBucket 令牌桶，按照 rate 的速度补充令牌，最多保存 burst 个令牌
+type tokenBucket struct {
+	rate     float64
+	burst    float64
+	tokens   float64
+	lastSeen time.Time
+}
+
+func newTokenBucket(quota config.RestorationQuotaConfig, now time.Time) *tokenBucket {
+	burst := float64(quota.Burst)
+	if burst <= 0 {
+		burst = quota.Rate
+	}
+	return &tokenBucket{rate: quota.Rate, burst: burst, tokens: burst, lastSeen: now}
+}
+
+// enough 判断令牌是否足够，超过 burst 的批次只要求令牌桶已满，之后令牌会变为负数，保证平均速度不超过限额
+//   - n: 需要消耗的令牌数量
+func (b *tokenBucket) enough(n float64) bool {
+	if n > b.burst {
+		n = b.burst
+	}
+	return b.tokens >= n
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.lastSeen).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.lastSeen = now
+}
+
+// rateLimiter 按照 caller_service 和调用方 IP 限制日志的接收速度，单位为每秒的日志条数
+//
+// 匿名调用方声明的 caller_service 不可信，按照调用方 IP 使用默认的服务限额，避免通过更换名称绕过限额或者占用其他服务的限额
+type rateLimiter struct {
+	mtx       sync.Mutex
+	service   config.RestorationQuotaConfig
+	ip        config.RestorationQuotaConfig
+	overrides map[string]config.RestorationQuotaConfig
+	buckets   map[string]*tokenBucket
+	sweptAt   time.Time
+}
+
+// newRateLimiter 根据配置创建限流器，没有配置任何限额时返回 nil
+//   - conf: 限流配置
+func newRateLimiter(conf config.RestorationRateLimitConfig) *rateLimiter {
+	if conf.Service.Rate <= 0 && conf.IP.Rate <= 0 && len(conf.Services) == 0 {
+		return nil
+	}
+	return &rateLimiter{
+		service:   conf.Service,
+		ip:        conf.IP,
+		overrides: conf.Services,
+		buckets:   map[string]*tokenBucket{},
+		sweptAt:   time.Now(),
+	}
+}
+
+// bucket 获取限流使用的令牌桶，限额为 0 时不限制，返回 nil
+//   - key: 令牌桶的标识
+//   - quota: 令牌桶的限额
+func (l *rateLimiter) bucket(key string, quota config.RestorationQuotaConfig, now time.Time) *tokenBucket {
+	if quota.Rate <= 0 {
+		return nil
+	}
+
+	current, exist := l.buckets[key]
+	if !exist {
+		current = newTokenBucket(quota, now)
+		l.buckets[key] = current
+	}
+	current.refill(now)
+	return current
+}
+
+// allow 判断是否允许接收 caller_service 和 ip 的日志，超出任意一个限额时拒绝全部日志并且不消耗令牌
+//   - records: 同一次请求中的日志
+func (l *rateLimiter) allow(records []*Fields) error {
+	now := time.Now()
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.sweep(now)
+
+	counts := map[string]int{}
+	anonymous := map[string]int{}
+	ips := map[string]int{}
+	for _, record := range records {
+		if record.anonymous {
+			anonymous[record.callerIP]++
+		} else {
+			counts[record.service]++
+		}
+		if record.callerIP != "" {
+			ips[record.callerIP]++
+		}
+	}
+
+	type take struct {
+		bucket *tokenBucket
+		n      float64
+	}
+	takes := make([]take, 0, len(counts)+len(anonymous)+len(ips))
+	for service, n := range counts {
+		quota := l.service
+		if override, exist := l.overrides[service]; exist {
+			quota = override
+		}
+		if current := l.bucket("service\x00"+service, quota, now); current == nil {
+			continue
+		} else if !current.enough(float64(n)) {
+			l.reject(counts, anonymous, "service")
+			return errors.NewRestorationRateLimitedError("caller_service", service)
+		} else {
+			takes = append(takes, take{bucket: current, n: float64(n)})
+		}
+	}
+	for ip, n := range anonymous {
+		if current := l.bucket("anonymous\x00"+ip, l.service, now); current == nil {
+			continue
+		} else if !current.enough(float64(n)) {
+			l.reject(counts, anonymous, "service")
+			return errors.NewRestorationRateLimitedError("anonymous caller_ip", ip)
+		} else {
+			takes = append(takes, take{bucket: current, n: float64(n)})
+		}
+	}
+	for ip, n := range ips {
+		if current := l.bucket("ip\x00"+ip, l.ip, now); current == nil {
+			continue
+		} else if !current.enough(float64(n)) {
+			l.reject(counts, anonymous, "ip")
+			return errors.NewRestorationRateLimitedError("caller_ip", ip)
+		} else {
+			takes = append(takes, take{bucket: current, n: float64(n)})
+		}
+	}
+
+	for _, t := range takes {
+		t.bucket.tokens -= t.n
+	}
+	return nil
+}
+
+// reject 记录被拒绝的日志数量，匿名调用方声明的 caller_service 不作为指标的标签，统一记录为 anonymous
+func (l *rateLimiter) reject(counts, anonymous map[string]int, limit string) {
+	for service, n := range counts {
+		throttledCounter.WithLabelValues(service, limit).Add(float64(n))
+	}
+	for _, n := range anonymous {
+		throttledCounter.WithLabelValues("anonymous", limit).Add(float64(n))
+	}
+}
+
+// sweep 定期清理长时间没有使用的令牌桶，避免调用方 IP 过多时占用内存
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < time.Minute {
+		return
+	}
+
+	for key, current := range l.buckets {
+		if now.Sub(current.lastSeen) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.sweptAt = now
+}
+
+// isRateLimited 判断错误是否是因为超出限流额度
+//   - err: 接收日志时返回的错误
+func isRateLimited(err error) bool {
+	_, limited := err.(*errors.RestorationRateLimitedError)
+	return limited
+}
@@ -0,0 +1,122 @@
+package restoration
+
+import (
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	cases := []struct {
+		name    string
+		quota   config.RestorationQuotaConfig
+		taken   float64
+		elapsed time.Duration
+		request float64
+		enough  bool
+	}{
+		{name: "full bucket", quota: config.RestorationQuotaConfig{Rate: 10, Burst: 20}, request: 20, enough: true},
+		{name: "burst defaults to rate", quota: config.RestorationQuotaConfig{Rate: 10}, taken: 5, request: 6, enough: false},
+		{name: "not enough tokens", quota: config.RestorationQuotaConfig{Rate: 10, Burst: 20}, taken: 15, request: 6, enough: false},
+		{name: "refilled by rate", quota: config.RestorationQuotaConfig{Rate: 10, Burst: 20}, taken: 15, elapsed: time.Second, request: 15, enough: true},
+		{name: "refill capped by burst", quota: config.RestorationQuotaConfig{Rate: 10, Burst: 20}, elapsed: time.Hour, request: 21, enough: true},
+		{name: "batch over burst needs full bucket", quota: config.RestorationQuotaConfig{Rate: 10, Burst: 20}, taken: 1, request: 100, enough: false},
+		{name: "negative tokens after large batch", quota: config.RestorationQuotaConfig{Rate: 10, Burst: 20}, taken: 100, elapsed: 5 * time.Second, request: 1, enough: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bucket := newTokenBucket(c.quota, start)
+			bucket.tokens -= c.taken
+			bucket.refill(start.Add(c.elapsed))
+			if enough := bucket.enough(c.request); enough != c.enough {
+				t.Errorf("enough(%v) with %v tokens = %v, want %v", c.request, bucket.tokens, enough, c.enough)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	conf := config.RestorationRateLimitConfig{
+		Service:  config.RestorationQuotaConfig{Rate: 0.001, Burst: 3},
+		IP:       config.RestorationQuotaConfig{Rate: 0.001, Burst: 5},
+		Services: map[string]config.RestorationQuotaConfig{"trusted": {Rate: 0.001, Burst: 10}},
+	}
+	record := func(service, ip string, anonymous bool) *Fields {
+		return &Fields{service: service, callerIP: ip, anonymous: anonymous}
+	}
+	repeat := func(n int, f *Fields) []*Fields {
+		records := make([]*Fields, n)
+		for i := range records {
+			copied := *f
+			records[i] = &copied
+		}
+		return records
+	}
+
+	cases := []struct {
+		name    string
+		batches [][]*Fields
+		allowed []bool
+	}{
+		{
+			name:    "per service quota",
+			batches: [][]*Fields{repeat(3, record("a", "", false)), repeat(1, record("a", "", false)), repeat(1, record("b", "", false))},
+			allowed: []bool{true, false, true},
+		},
+		{
+			name:    "service override",
+			batches: [][]*Fields{repeat(4, record("trusted", "", false)), repeat(4, record("trusted", "", false))},
+			allowed: []bool{true, true},
+		},
+		{
+			name:    "per ip quota",
+			batches: [][]*Fields{repeat(3, record("a", "10.0.0.1", false)), repeat(3, record("b", "10.0.0.1", false)), repeat(2, record("b", "10.0.0.1", false))},
+			allowed: []bool{true, false, true},
+		},
+		{
+			name: "anonymous callers cannot switch service names",
+			batches: [][]*Fields{
+				repeat(3, record("a", "10.0.0.1", true)), repeat(1, record("b", "10.0.0.1", true)), repeat(1, record("c", "10.0.0.2", true)),
+			},
+			allowed: []bool{true, false, true},
+		},
+		{
+			name:    "anonymous callers do not use service quota",
+			batches: [][]*Fields{repeat(3, record("a", "10.0.0.1", true)), repeat(3, record("a", "10.0.0.2", false))},
+			allowed: []bool{true, true},
+		},
+		{
+			name:    "anonymous callers do not use overrides",
+			batches: [][]*Fields{repeat(3, record("trusted", "10.0.0.1", true)), repeat(1, record("trusted", "10.0.0.1", true))},
+			allowed: []bool{true, false},
+		},
+		{
+			name:    "rejected batch does not take tokens",
+			batches: [][]*Fields{repeat(2, record("a", "", false)), repeat(2, record("a", "", false)), repeat(1, record("a", "", false))},
+			allowed: []bool{true, false, true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			limiter := newRateLimiter(conf)
+			for i, batch := range c.batches {
+				limitErr := limiter.allow(batch)
+				if allowed := limitErr == nil; allowed != c.allowed[i] {
+					t.Errorf("batch %d allowed %v, want %v: %v", i, allowed, c.allowed[i], limitErr)
+				} else if limitErr != nil && !isRateLimited(limitErr) {
+					t.Errorf("batch %d returned %v, want a rate limited error", i, limitErr)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRateLimiterDisabled(t *testing.T) {
+	if limiter := newRateLimiter(config.RestorationRateLimitConfig{}); limiter != nil {
+		t.Error("limiter without quotas should be nil")
+	}
+}
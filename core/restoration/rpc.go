@@ -2,7 +2,14 @@ package restoration
 
 import (
 	"context"
+	"errors"
+	"io"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
 	"studio.sunist.work/platform/alioth-center/proto/alioth"
 )
 
@@ -10,7 +17,147 @@ type RpcServer struct {
 	alioth.UnimplementedAliothRestorationServer
 }
 
+// collectionError 将接收日志的错误转换为 gRPC 错误，超出限流额度时返回 ResourceExhausted，便于客户端退避
+//   - err: 接收日志时返回的错误
+func collectionError(err error) error {
+	if isRateLimited(err) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return err
+}
+
 func (a RpcServer) RestorationCollection(ctx context.Context, request *alioth.RestorationCollectionRequest) (*alioth.RestorationCollectionResponse, error) {
-	defaultService.CollectLog(ctx, request)
+	if collectErr := defaultService.CollectLog(ctx, request); collectErr != nil {
+		return nil, collectionError(collectErr)
+	}
 	return &alioth.RestorationCollectionResponse{}, nil
 }
+
+func (a RpcServer) RestorationBatchCollection(ctx context.Context, request *alioth.RestorationBatchCollectionRequest) (*alioth.RestorationBatchCollectionResponse, error) {
+	accepted, collectErr := defaultService.CollectLogBatch(ctx, request)
+	if collectErr != nil {
+		return nil, collectionError(collectErr)
+	}
+	return &alioth.RestorationBatchCollectionResponse{Accepted: int32(accepted)}, nil
+}
+
+func (a RpcServer) RestorationStream(stream alioth.AliothRestoration_RestorationStreamServer) error {
+	for {
+		request, receiveErr := stream.Recv()
+		if errors.Is(receiveErr, io.EOF) {
+			return nil
+		} else if receiveErr != nil {
+			return receiveErr
+		}
+
+		// 超出限流额度时只拒绝这个批次，不关闭整个流，其他错误仍然结束流
+		accepted, collectErr := defaultService.CollectLogStream(stream.Context(), request)
+		if collectErr != nil && !isRateLimited(collectErr) {
+			return collectionError(collectErr)
+		}
+		if sendErr := stream.Send(&alioth.RestorationStreamResponse{
+			Sequence:  request.GetSequence(),
+			Accepted:  int32(accepted),
+			Throttled: collectErr != nil,
+		}); sendErr != nil {
+			return sendErr
+		}
+	}
+}
+
+// authenticateAdmin 校验管理接口的令牌，查询日志、问题和统计结果的接口可以读取所有服务的日志，与对应的 http 接口一样只注册在管理接口上
+//   - ctx: grpc 请求的上下文
+func authenticateAdmin(ctx context.Context) error {
+	return utils.CheckAdminToken(ctx, initialize.GlobalConfig().Http.AdminToken)
+}
+
+// queryError 将查询日志、问题和统计结果的错误转换为 gRPC 错误，问题不存在时返回 NotFound，查询条件不合法时返回 InvalidArgument，
+// 没有启用日志存储时返回 FailedPrecondition
+//   - err: 查询时返回的错误
+func queryError(err error) error {
+	if isIssueNotFound(err) {
+		return status.Error(codes.NotFound, err.Error())
+	} else if isInvalidQuery(err) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	} else if isStorageDisabled(err) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return err
+}
+
+func (a RpcServer) RestorationQuery(ctx context.Context, request *alioth.RestorationQueryRequest) (*alioth.RestorationQueryResponse, error) {
+	if authErr := authenticateAdmin(ctx); authErr != nil {
+		return nil, authErr
+	}
+	response, err := defaultService.QueryLog(ctx, request)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return response, nil
+}
+
+func (a RpcServer) RestorationTrace(ctx context.Context, request *alioth.RestorationTraceRequest) (*alioth.RestorationTraceResponse, error) {
+	if authErr := authenticateAdmin(ctx); authErr != nil {
+		return nil, authErr
+	}
+	response, err := defaultService.TraceLog(ctx, request)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return response, nil
+}
+
+func (a RpcServer) RestorationTail(request *alioth.RestorationTailRequest, stream alioth.AliothRestoration_RestorationTailServer) error {
+	if authErr := authenticateAdmin(stream.Context()); authErr != nil {
+		return authErr
+	}
+	return defaultService.TailLog(stream.Context(), request, stream.Send)
+}
+
+func (a RpcServer) RestorationSampling(_ context.Context, request *alioth.RestorationSamplingRequest) (*alioth.RestorationSamplingResponse, error) {
+	return defaultService.Sampling(request.GetCallerService()), nil
+}
+
+func (a RpcServer) RestorationIssues(ctx context.Context, request *alioth.RestorationIssuesRequest) (*alioth.RestorationIssuesResponse, error) {
+	if authErr := authenticateAdmin(ctx); authErr != nil {
+		return nil, authErr
+	}
+	response, err := defaultService.ListIssues(ctx, request)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return response, nil
+}
+
+func (a RpcServer) RestorationIssue(ctx context.Context, request *alioth.RestorationIssueRequest) (*alioth.RestorationIssueResponse, error) {
+	if authErr := authenticateAdmin(ctx); authErr != nil {
+		return nil, authErr
+	}
+	response, err := defaultService.GetIssue(ctx, request)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return response, nil
+}
+
+func (a RpcServer) RestorationResolveIssue(ctx context.Context, request *alioth.RestorationResolveIssueRequest) (*alioth.RestorationResolveIssueResponse, error) {
+	if authErr := authenticateAdmin(ctx); authErr != nil {
+		return nil, authErr
+	}
+	response, err := defaultService.ResolveIssue(ctx, request)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return response, nil
+}
+
+func (a RpcServer) RestorationStats(ctx context.Context, request *alioth.RestorationStatsRequest) (*alioth.RestorationStatsResponse, error) {
+	if authErr := authenticateAdmin(ctx); authErr != nil {
+		return nil, authErr
+	}
+	response, err := defaultService.Stats(ctx, request)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return response, nil
+}
@@ -0,0 +1,102 @@
+package restoration
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+func TestQueryErrorMapping(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		code   codes.Code
+		status int
+	}{
+		{name: "invalid query", err: errors.NewInvalidRestorationQueryError("since", "yesterday"), code: codes.InvalidArgument, status: 400},
+		{name: "storage disabled", err: errors.NewRestorationStorageDisabledError(), code: codes.FailedPrecondition, status: 400},
+		{name: "issue not found", err: errors.NewRestorationIssueNotFoundError("fingerprint"), code: codes.NotFound, status: 404},
+		{name: "other error", err: io.ErrUnexpectedEOF, code: codes.Unknown, status: 500},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if code := status.Code(queryError(c.err)); code != c.code {
+				t.Errorf("queryError returned %v, want %v", code, c.code)
+			}
+
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			queryFailed(ctx, c.err)
+			if recorder.Code != c.status {
+				t.Errorf("queryFailed responded %d, want %d", recorder.Code, c.status)
+			}
+		})
+	}
+}
+
+// tailStream 只提供上下文的实时日志流，Send 总是返回错误
+type tailStream struct {
+	alioth.AliothRestoration_RestorationTailServer
+	ctx context.Context
+}
+
+func (s *tailStream) Context() context.Context { return s.ctx }
+
+func (s *tailStream) Send(*alioth.RestorationTailResponse) error {
+	return io.ErrClosedPipe
+}
+
+func TestAdminRpcRequiresToken(t *testing.T) {
+	server := RpcServer{}
+	cases := []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{name: "query", call: func(ctx context.Context) error {
+			_, err := server.RestorationQuery(ctx, &alioth.RestorationQueryRequest{})
+			return err
+		}},
+		{name: "trace", call: func(ctx context.Context) error {
+			_, err := server.RestorationTrace(ctx, &alioth.RestorationTraceRequest{TraceId: "trace"})
+			return err
+		}},
+		{name: "tail", call: func(ctx context.Context) error {
+			return server.RestorationTail(&alioth.RestorationTailRequest{}, &tailStream{ctx: ctx})
+		}},
+		{name: "issues", call: func(ctx context.Context) error {
+			_, err := server.RestorationIssues(ctx, &alioth.RestorationIssuesRequest{})
+			return err
+		}},
+		{name: "issue", call: func(ctx context.Context) error {
+			_, err := server.RestorationIssue(ctx, &alioth.RestorationIssueRequest{Fingerprint: "fingerprint"})
+			return err
+		}},
+		{name: "resolve issue", call: func(ctx context.Context) error {
+			_, err := server.RestorationResolveIssue(ctx, &alioth.RestorationResolveIssueRequest{Fingerprint: "fingerprint"})
+			return err
+		}},
+		{name: "stats", call: func(ctx context.Context) error {
+			_, err := server.RestorationStats(ctx, &alioth.RestorationStatsRequest{})
+			return err
+		}},
+	}
+
+	// 测试配置中没有管理接口令牌，所有的管理接口都拒绝请求
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if code := status.Code(c.call(context.Background())); code != codes.PermissionDenied {
+				t.Errorf("%s returned %v without an admin token, want %v", c.name, code, codes.PermissionDenied)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package restoration
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+// samplingOverride 下发给一个服务的日志收集器的级别和采样配置
+type samplingOverride struct {
+	minLevel        string
+	rates           map[string]float64
+	traceConsistent bool
+	expiredAt       time.Time
+}
+
+// samplingRegistry 保存按照 caller_service 下发的采样配置，配置文件中的配置不会过期，运行时设置的配置可以指定过期时间
+type samplingRegistry struct {
+	mtx       sync.RWMutex
+	overrides map[string]samplingOverride
+}
+
+func newSamplingRegistry(conf map[string]config.RestorationSamplingConfig) *samplingRegistry {
+	registry := &samplingRegistry{overrides: map[string]samplingOverride{}}
+	for service, sampling := range conf {
+		if override, validateErr := newSamplingOverride(sampling.MinLevel, sampling.Rates, sampling.TraceConsistent, 0); validateErr == nil {
+			registry.overrides[service] = override
+		}
+	}
+	return registry
+}
+
+// newSamplingOverride 校验采样配置
+//   - minLevel: 最低级别，为空时使用客户端本地配置
+//   - rates: 按照级别的采样率
+//   - traceConsistent: 是否按照 trace_id 采样
+//   - ttl: 配置的有效时间，为 0 时不过期
+//
+// 级别转换为标准的小写名称，例如 WARNING 转换为 warn，客户端按照相同的级别顺序过滤日志
+func newSamplingOverride(minLevel string, rates map[string]float64, traceConsistent bool, ttl time.Duration) (override samplingOverride, err error) {
+	override = samplingOverride{rates: make(map[string]float64, len(rates)), traceConsistent: traceConsistent}
+	if minLevel != "" {
+		if level, parseErr := log.ParseLevel(minLevel); parseErr != nil {
+			return samplingOverride{}, errors.NewInvalidRestorationSamplingError("min_level", minLevel)
+		} else {
+			override.minLevel = string(level)
+		}
+	}
+	for level, rate := range rates {
+		if parsed, parseErr := log.ParseLevel(level); parseErr != nil {
+			return samplingOverride{}, errors.NewInvalidRestorationSamplingError("rates", level)
+		} else if rate < 0 || rate > 1 {
+			return samplingOverride{}, errors.NewInvalidRestorationSamplingError("rates", strconv.FormatFloat(rate, 'f', -1, 64))
+		} else {
+			override.rates[string(parsed)] = rate
+		}
+	}
+
+	if ttl > 0 {
+		override.expiredAt = time.Now().Add(ttl)
+	}
+	return override, nil
+}
+
+func (r *samplingRegistry) set(service string, override samplingOverride) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.overrides[service] = override
+}
+
+func (r *samplingRegistry) remove(service string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.overrides, service)
+}
+
+// get 获取服务的采样配置，没有配置或者配置已经过期时 Found 为 false
+//   - service: caller_service
+func (r *samplingRegistry) get(service string) *alioth.RestorationSamplingResponse {
+	r.mtx.RLock()
+	override, exist := r.overrides[service]
+	r.mtx.RUnlock()
+
+	if !exist || (!override.expiredAt.IsZero() && time.Now().After(override.expiredAt)) {
+		return &alioth.RestorationSamplingResponse{Found: false}
+	}
+
+	response := &alioth.RestorationSamplingResponse{
+		Found:           true,
+		MinLevel:        override.minLevel,
+		Rates:           override.rates,
+		TraceConsistent: override.traceConsistent,
+	}
+	if !override.expiredAt.IsZero() {
+		response.ExpiredAt = override.expiredAt.Format(global.AliothTimeFormat)
+	}
+	return response
+}
@@ -0,0 +1,66 @@
+package restoration
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewSamplingOverride(t *testing.T) {
+	cases := []struct {
+		name     string
+		minLevel string
+		rates    map[string]float64
+		want     samplingOverride
+		invalid  bool
+	}{
+		{name: "empty", want: samplingOverride{rates: map[string]float64{}}},
+		{name: "panic level", minLevel: "panic", want: samplingOverride{minLevel: "panic", rates: map[string]float64{}}},
+		{name: "normalize levels", minLevel: "WARNING", rates: map[string]float64{"Info": 0.5}, want: samplingOverride{minLevel: "warn", rates: map[string]float64{"info": 0.5}}},
+		{name: "unknown min level", minLevel: "fatal", invalid: true},
+		{name: "unknown rate level", rates: map[string]float64{"trace": 0.5}, invalid: true},
+		{name: "rate out of range", rates: map[string]float64{"info": 1.5}, invalid: true},
+		{name: "negative rate", rates: map[string]float64{"info": -0.1}, invalid: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			override, validateErr := newSamplingOverride(c.minLevel, c.rates, false, 0)
+			if invalid := validateErr != nil; invalid != c.invalid {
+				t.Fatalf("invalid %v, want %v: %v", invalid, c.invalid, validateErr)
+			} else if c.invalid {
+				return
+			}
+			if override.minLevel != c.want.minLevel {
+				t.Errorf("min level %q, want %q", override.minLevel, c.want.minLevel)
+			}
+			if len(override.rates) != len(c.want.rates) {
+				t.Errorf("rates %v, want %v", override.rates, c.want.rates)
+			}
+			for level, rate := range c.want.rates {
+				if override.rates[level] != rate {
+					t.Errorf("rate of %s %v, want %v", level, override.rates[level], rate)
+				}
+			}
+		})
+	}
+}
+
+func TestSamplingRegistryExpire(t *testing.T) {
+	registry := newSamplingRegistry(nil)
+	expired, _ := newSamplingOverride("error", nil, false, time.Nanosecond)
+	registry.set("expired", expired)
+	permanent, _ := newSamplingOverride("error", nil, false, 0)
+	registry.set("permanent", permanent)
+	time.Sleep(time.Millisecond)
+
+	if response := registry.get("expired"); response.GetFound() {
+		t.Error("expired override should not be found")
+	}
+	if response := registry.get("permanent"); !response.GetFound() || response.GetMinLevel() != "error" {
+		t.Errorf("permanent override %v, want min level error", response)
+	}
+	registry.remove("permanent")
+	if response := registry.get("permanent"); response.GetFound() {
+		t.Error("removed override should not be found")
+	}
+}
@@ -2,28 +2,298 @@ package restoration
 
 import (
 	"context"
+	"io"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize"
+	"studio.sunist.work/platform/alioth-center/infrastructure/lifecycle"
+	"studio.sunist.work/platform/alioth-center/infrastructure/metrics"
 	"studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils/redact"
 
 	"studio.sunist.work/platform/alioth-center/proto/alioth"
 )
 
+const (
+	// dedupCapacity 去重时最多记录的日志 ID 数量
+	dedupCapacity = 100000
+	// dedupWindow 按照 record_id 去重的时间窗口，客户端暂存区默认的 SpoolMaxAge 与这个窗口相同，修改时需要同时修改
+	dedupWindow = time.Hour
+)
+
 var defaultService *Service
 
 func init() {
+	conf := initialize.GlobalConfig().Restoration
+	loggerPath := "logs/restoration"
+	if conf.Logger != "" {
+		loggerPath = conf.Logger
+	}
+
 	defaultService = &Service{
-		logger: log.NewLogger("logs/restoration"),
+		logger: log.NewLogger(loggerPath),
+		dedup:  newDeduplicator(dedupCapacity, dedupWindow),
+		tail:   newTailHub(),
+	}
+	if conf.DedupFile != "" {
+		if loadErr := defaultService.dedup.load(conf.DedupFile); loadErr != nil {
+			defaultService.logger.Log(log.DefaultField().WithLevel(log.Warn).WithCaller(log.Module).
+				WithMessage("failed to load restoration dedup records").WithExtra(loadErr.Error()))
+		}
+		lifecycle.Append(lifecycle.Hook{Name: "restoration dedup records", OnStop: func(_ context.Context) error {
+			return defaultService.dedup.save(conf.DedupFile)
+		}})
+	}
+	defaultService.sampling = newSamplingRegistry(conf.Sampling)
+	defaultService.syslogServiceFrom = conf.Syslog.ServiceFrom
+
+	if conf.Redaction.Disable {
+		redactor = nil
+	} else if configured, newRedactorErr := redact.New(redact.DefaultRule().Merge(redact.Rule{
+		Keys:     conf.Redaction.Keys,
+		Paths:    conf.Redaction.Paths,
+		Patterns: conf.Redaction.Patterns,
+		Mask:     conf.Redaction.Mask,
+	})); newRedactorErr != nil {
+		defaultService.logger.Log(log.DefaultField().WithLevel(log.Panic).WithCaller(log.Module).
+			WithMessage("failed to init restoration redaction").WithExtra(newRedactorErr.Error()))
+	} else {
+		redactor = configured
+	}
+
+	defaultService.limiter = newRateLimiter(conf.RateLimit)
+
+	if engine, newAlertEngineErr := newAlertEngine(conf.Alert); newAlertEngineErr != nil {
+		defaultService.logger.Log(log.DefaultField().WithLevel(log.Panic).WithCaller(log.Module).
+			WithMessage("failed to init restoration alert rules").WithExtra(newAlertEngineErr.Error()))
+	} else {
+		// 停止时在服务器之后等待已经触发的告警发送完成
+		defaultService.alert = engine
+		lifecycle.Append(lifecycle.Hook{Name: "restoration alert dispatcher", OnStop: engine.close})
+	}
+
+	if !conf.Metrics.Disable {
+		if engine, newMetricsEngineErr := newMetricsEngine(conf.Metrics); newMetricsEngineErr != nil {
+			defaultService.logger.Log(log.DefaultField().WithLevel(log.Panic).WithCaller(log.Module).
+				WithMessage("failed to init restoration metrics").WithExtra(newMetricsEngineErr.Error()))
+		} else {
+			defaultService.metrics = engine
+		}
+	}
+
+	if storage, newStorageErr := newStorage(conf.Storage, conf.StorageDir, conf.MaxIndexed); newStorageErr != nil {
+		defaultService.logger.Log(log.DefaultField().WithLevel(log.Panic).WithCaller(log.Module).
+			WithMessage("failed to init restoration storage").WithExtra(newStorageErr.Error()))
+	} else if storage != nil {
+		// 存储后端在接收日志的协程之外写入，停止时在服务器之后等待队列中的日志写入完成，最后关闭存储后端打开的文件
+		defaultService.storage = storage
+		defaultService.writer = newStorageWriter(storage, storageQueueSize)
+		if closer, isCloser := storage.(io.Closer); isCloser {
+			lifecycle.Append(lifecycle.Hook{Name: "restoration storage", OnStop: func(ctx context.Context) error { return closer.Close() }})
+		}
+		lifecycle.Append(lifecycle.Hook{Name: "restoration storage writer", OnStop: defaultService.writer.close})
+		metrics.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "alioth",
+			Subsystem: "restoration",
+			Name:      "storage_dropped_total",
+			Help:      "Number of accepted records not stored because the storage queue was full or closed.",
+		}, func() float64 { return float64(defaultService.writer.dropped.Load()) }))
 	}
 }
 
 type Service struct {
-	logger *log.Logger
+	logger   *log.Logger
+	dedup    *deduplicator
+	storage  Storage
+	writer   *storageWriter
+	tail     *tailHub
+	alert    *alertEngine
+	limiter  *rateLimiter
+	sampling *samplingRegistry
+	metrics  *metricsEngine
+
+	syslogServiceFrom string
 }
 
-func (s *Service) CollectLog(ctx context.Context, request *alioth.RestorationCollectionRequest) {
-	s.logger.Log(NewRestorationFieldsFromRequest(ctx, request))
+// collect 处理接收到的日志，所有的接收方式最终都会经过这里，超出限流额度时拒绝全部日志
+//   - records: 接收到的日志，重复的日志会被过滤
+func (s *Service) collect(ctx context.Context, records ...*Fields) error {
+	if s.limiter != nil {
+		if limitErr := s.limiter.allow(records); limitErr != nil {
+			return limitErr
+		}
+	}
+
+	accepted := make([]*Fields, 0, len(records))
+	for _, record := range records {
+		if s.dedup.seen(record.recordID) {
+			continue
+		}
+		s.logger.Log(record)
+		accepted = append(accepted, record)
+	}
+	// 先计算指纹，使订阅、存储的日志都带有指纹
+	occurrences := fingerprintRecords(accepted)
+	s.tail.publish(accepted)
+	if s.alert != nil {
+		s.alert.evaluate(accepted)
+	}
+	if s.metrics != nil {
+		s.metrics.observe(accepted)
+	}
+
+	if s.writer != nil && len(accepted) > 0 {
+		s.writer.write(accepted, occurrences)
+	}
+	return nil
+}
+
+func (s *Service) CollectLog(ctx context.Context, request *alioth.RestorationCollectionRequest) error {
+	return s.collect(ctx, NewRestorationFieldsFromRequest(ctx, request))
+}
+
+// CollectLogExternal 接收外部日志
+//   - identity: 认证后的调用方身份，不为空时覆盖日志中的 caller_service
+func (s *Service) CollectLogExternal(ctx context.Context, identity string, request *alioth.RestorationCollectionRequest) error {
+	return s.collect(ctx, NewExternalRestorationFieldsFromRequest(ctx, request).withIdentity(identity))
+}
+
+func (s *Service) CollectLogBatch(ctx context.Context, request *alioth.RestorationBatchCollectionRequest) (accepted int, err error) {
+	records := make([]*Fields, len(request.GetRecords()))
+	for i, record := range request.GetRecords() {
+		records[i] = NewRestorationFieldsFromRequest(ctx, record)
+	}
+	if collectErr := s.collect(ctx, records...); collectErr != nil {
+		return 0, collectErr
+	}
+	return len(records), nil
+}
+
+// CollectLogExternalBatch 批量接收外部日志
+//   - identity: 认证后的调用方身份，不为空时覆盖日志中的 caller_service
+func (s *Service) CollectLogExternalBatch(ctx context.Context, identity string, request *alioth.RestorationBatchCollectionRequest) (accepted int, err error) {
+	records := make([]*Fields, len(request.GetRecords()))
+	for i, record := range request.GetRecords() {
+		records[i] = NewExternalRestorationFieldsFromRequest(ctx, record).withIdentity(identity)
+	}
+	if collectErr := s.collect(ctx, records...); collectErr != nil {
+		return 0, collectErr
+	}
+	return len(records), nil
+}
+
+func (s *Service) CollectLogStream(ctx context.Context, request *alioth.RestorationStreamRequest) (accepted int, err error) {
+	records := make([]*Fields, len(request.GetRecords()))
+	for i, record := range request.GetRecords() {
+		records[i] = NewRestorationFieldsFromRequest(ctx, record)
+	}
+	if collectErr := s.collect(ctx, records...); collectErr != nil {
+		return 0, collectErr
+	}
+	return len(records), nil
+}
+
+// CollectLogOtlp 接收 OpenTelemetry 的日志，转换后与原生日志使用相同的处理流程
+//   - identity: 认证后的调用方身份，不为空时覆盖 service.name
+//   - caller: 调用方类型
+func (s *Service) CollectLogOtlp(ctx context.Context, identity string, caller log.LoggerCaller, request *collogspb.ExportLogsServiceRequest) (accepted int, err error) {
+	records := NewRestorationFieldsFromOtlp(ctx, caller, request)
+	for _, record := range records {
+		record.withIdentity(identity)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	} else if collectErr := s.collect(ctx, records...); collectErr != nil {
+		return 0, collectErr
+	}
+	return len(records), nil
+}
+
+func (s *Service) QueryLog(ctx context.Context, request *alioth.RestorationQueryRequest) (*alioth.RestorationQueryResponse, error) {
+	if s.storage == nil {
+		return nil, errors.NewRestorationStorageDisabledError()
+	}
+
+	filter, parseFilterErr := newQueryFilter(request)
+	if parseFilterErr != nil {
+		return nil, parseFilterErr
+	}
+
+	records, nextCursor, queryErr := s.storage.Query(ctx, filter)
+	if queryErr != nil {
+		return nil, queryErr
+	}
+
+	response := &alioth.RestorationQueryResponse{
+		Records:    make([]*alioth.RestorationRecord, len(records)),
+		NextCursor: nextCursor,
+	}
+	for i, record := range records {
+		response.Records[i] = exportRecord(record)
+	}
+	return response, nil
+}
+
+func (s *Service) TraceLog(ctx context.Context, request *alioth.RestorationTraceRequest) (*alioth.RestorationTraceResponse, error) {
+	if s.storage == nil {
+		return nil, errors.NewRestorationStorageDisabledError()
+	} else if request.GetTraceId() == "" {
+		return nil, errors.NewInvalidRestorationQueryError("trace_id", request.GetTraceId())
+	}
+
+	records, truncated, traceErr := s.storage.Trace(ctx, request.GetTraceId())
+	if traceErr != nil {
+		return nil, traceErr
+	}
+
+	response := &alioth.RestorationTraceResponse{
+		TraceId:   request.GetTraceId(),
+		Records:   make([]*alioth.RestorationRecord, len(records)),
+		Timeline:  buildTraceTimeline(records),
+		Truncated: truncated,
+	}
+	for i, record := range records {
+		response.Records[i] = exportRecord(record)
+	}
+	return response, nil
+}
+
+// ReloadAlertRules 从规则文件重新加载告警规则，加载失败时保留原有的规则，没有配置规则文件时返回错误
+func (s *Service) ReloadAlertRules() (rules int, err error) {
+	if s.alert == nil {
+		return 0, errors.NewRestorationAlertDisabledError()
+	} else if s.alert.conf.RulesFile == "" {
+		return 0, errors.NewRestorationAlertNotReloadableError()
+	}
+	return s.alert.reload()
+}
+
+// Sampling 获取下发给服务的日志收集器的级别和采样配置
+//   - service: caller_service
+func (s *Service) Sampling(service string) *alioth.RestorationSamplingResponse {
+	return s.sampling.get(service)
+}
+
+// SetSampling 设置下发给服务的日志收集器的级别和采样配置
+//   - service: caller_service
+//   - ttl: 配置的有效时间，为 0 时不过期
+func (s *Service) SetSampling(service, minLevel string, rates map[string]float64, traceConsistent bool, ttl time.Duration) error {
+	if service == "" {
+		return errors.NewInvalidRestorationSamplingError("service", service)
+	} else if override, validateErr := newSamplingOverride(minLevel, rates, traceConsistent, ttl); validateErr != nil {
+		return validateErr
+	} else {
+		s.sampling.set(service, override)
+		return nil
+	}
 }
 
-func (s *Service) CollectLogExternal(ctx context.Context, request *alioth.RestorationCollectionRequest) {
-	s.logger.Log(NewExternalRestorationFieldsFromRequest(ctx, request))
+// RemoveSampling 移除下发给服务的日志收集器的配置，收集器会恢复使用本地配置
+//   - service: caller_service
+func (s *Service) RemoveSampling(service string) {
+	s.sampling.remove(service)
 }
@@ -0,0 +1,268 @@
+package restoration
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+	maxTraceRecords   = 10000
+	storageQueueSize  = 1024
+)
+
+// Storage 日志存储后端，保存接收到的日志并提供查询
+type Storage interface {
+	// Store 保存日志
+	//   - records: 需要保存的日志
+	Store(ctx context.Context, records []*Fields) (err error)
+
+	// Query 按照过滤条件查询日志，按照日志 ID 从新到旧返回
+	//   - filter: 过滤条件
+	Query(ctx context.Context, filter QueryFilter) (records []model.RestorationRecordDTO, nextCursor string, err error)
+
+	// Trace 查询一个 trace_id 下的所有日志，按照调用时间从早到晚返回，最多返回 maxTraceRecords 条，超过时 truncated 为 true
+	//   - traceID: 需要查询的 trace_id
+	Trace(ctx context.Context, traceID string) (records []model.RestorationRecordDTO, truncated bool, err error)
+
+	// StoreIssues 合并同一批日志按照指纹聚合的结果，已解决的问题再次出现时会重新打开
+	//   - occurrences: 按照指纹聚合的结果，每个指纹只出现一次
+	StoreIssues(ctx context.Context, occurrences []issueOccurrence) (err error)
+
+	// Issues 按照过滤条件查询问题，按照最后出现的时间从新到旧返回
+	//   - filter: 过滤条件
+	Issues(ctx context.Context, filter IssueFilter) (issues []model.RestorationIssueDTO, nextCursor string, err error)
+
+	// Issue 查询指纹对应的问题，不存在时返回 RestorationIssueNotFoundError
+	//   - fingerprint: 问题的指纹
+	Issue(ctx context.Context, fingerprint string) (issue model.RestorationIssueDTO, err error)
+
+	// ResolveIssue 将问题标记为已解决或者重新打开，不存在时返回 RestorationIssueNotFoundError
+	//   - fingerprint: 问题的指纹
+	//   - resolved: 为 true 时标记为已解决，为 false 时重新打开
+	ResolveIssue(ctx context.Context, fingerprint string, resolved bool) (issue model.RestorationIssueDTO, err error)
+}
+
+// newStorage 根据配置创建日志存储后端
+//   - storage: 存储后端，支持 file 和 postgres，为空时不存储日志
+//   - dir: file 存储后端的目录
+//   - maxIndexed: file 存储后端在内存中索引的最大日志条数
+func newStorage(storage, dir string, maxIndexed int) (s Storage, err error) {
+	switch storage {
+	case "":
+		return nil, nil
+	case "postgres":
+		return newDao(), nil
+	case "file":
+		if dir == "" {
+			dir = "logs/restoration/records"
+		}
+		return newFileStore(dir, maxIndexed)
+	default:
+		return nil, fmt.Errorf("unsupported restoration storage: %s", storage)
+	}
+}
+
+// storageWriter 在单独的协程中将日志和问题写入存储后端，不会阻塞日志的接收，队列已满或者已经关闭时丢弃并计数
+type storageWriter struct {
+	storage Storage
+	mtx     sync.RWMutex
+	closed  bool
+	batches chan storageBatch
+	stopped chan struct{}
+	dropped atomic.Uint64
+}
+
+// storageBatch 一次接收的日志和按照指纹聚合的结果
+type storageBatch struct {
+	records     []*Fields
+	occurrences []issueOccurrence
+}
+
+func newStorageWriter(storage Storage, size int) *storageWriter {
+	w := &storageWriter{
+		storage: storage,
+		batches: make(chan storageBatch, size),
+		stopped: make(chan struct{}),
+	}
+	go w.serve()
+	return w
+}
+
+// write 将日志放入写入队列
+//   - records: 需要保存的日志
+//   - occurrences: 按照指纹聚合的结果
+func (w *storageWriter) write(records []*Fields, occurrences []issueOccurrence) {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+
+	if !w.closed {
+		select {
+		case w.batches <- storageBatch{records: records, occurrences: occurrences}:
+			return
+		default:
+		}
+	}
+	w.dropped.Add(uint64(len(records)))
+	log.DefaultLogger().Log(log.DefaultField().WithLevel(log.Warn).WithCaller(log.Module).
+		WithMessage("restoration records not stored because storage queue is full").WithExtra(len(records)))
+}
+
+func (w *storageWriter) serve() {
+	defer close(w.stopped)
+	for batch := range w.batches {
+		ctx := context.Background()
+		if storeErr := w.storage.Store(ctx, batch.records); storeErr != nil {
+			log.DefaultLogger().Log(log.DefaultField().WithFields(log.Error, log.Module, "failed to store restoration records", ctx).
+				WithExtraField("error", storeErr.Error()).WithExtra(len(batch.records)))
+		}
+		if storeIssuesErr := w.storage.StoreIssues(ctx, batch.occurrences); storeIssuesErr != nil {
+			log.DefaultLogger().Log(log.DefaultField().WithFields(log.Error, log.Module, "failed to store restoration issues", ctx).
+				WithExtraField("error", storeIssuesErr.Error()).WithExtra(len(batch.occurrences)))
+		}
+	}
+}
+
+// close 停止接收新的日志，等待队列中的日志写入完成或者 ctx 结束
+func (w *storageWriter) close(ctx context.Context) error {
+	w.mtx.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.batches)
+	}
+	w.mtx.Unlock()
+
+	select {
+	case <-w.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// QueryFilter 日志查询的过滤条件，为零值的字段不参与过滤
+type QueryFilter struct {
+	Service     string
+	Level       string
+	TraceID     string
+	Fingerprint string
+	Keyword     string
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+	Cursor      uint64
+}
+
+// match 检查日志是否满足除关键字以外的过滤条件
+func (f QueryFilter) match(service, level, traceID, fingerprint string, calledAt time.Time) bool {
+	switch {
+	case f.Fingerprint != "" && f.Fingerprint != fingerprint:
+		return false
+	case f.Service != "" && f.Service != service:
+		return false
+	case f.Level != "" && f.Level != level:
+		return false
+	case f.TraceID != "" && f.TraceID != traceID:
+		return false
+	case !f.Since.IsZero() && calledAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !calledAt.Before(f.Until):
+		return false
+	default:
+		return true
+	}
+}
+
+// matchKeyword 检查日志消息是否包含关键字，不区分大小写
+func (f QueryFilter) matchKeyword(message string) bool {
+	return f.Keyword == "" || strings.Contains(strings.ToLower(message), strings.ToLower(f.Keyword))
+}
+
+// nextCursor 根据当前页的日志生成下一页的游标，不满一页时说明没有更多的日志
+func (f QueryFilter) nextCursor(records []model.RestorationRecordDTO) string {
+	if len(records) < f.Limit || len(records) == 0 {
+		return ""
+	}
+	return strconv.FormatUint(records[len(records)-1].ID, 10)
+}
+
+func newQueryFilter(request *alioth.RestorationQueryRequest) (filter QueryFilter, err error) {
+	filter = QueryFilter{
+		Service:     request.GetService(),
+		Level:       request.GetLevel(),
+		TraceID:     request.GetTraceId(),
+		Fingerprint: request.GetFingerprint(),
+		Keyword:     request.GetKeyword(),
+		Limit:       int(request.GetLimit()),
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultQueryLimit
+	} else if filter.Limit > maxQueryLimit {
+		filter.Limit = maxQueryLimit
+	}
+
+	if request.GetSince() != "" {
+		if filter.Since, err = parseQueryTime(request.GetSince()); err != nil {
+			return QueryFilter{}, errors.NewInvalidRestorationQueryError("since", request.GetSince())
+		}
+	}
+	if request.GetUntil() != "" {
+		if filter.Until, err = parseQueryTime(request.GetUntil()); err != nil {
+			return QueryFilter{}, errors.NewInvalidRestorationQueryError("until", request.GetUntil())
+		}
+	}
+	if request.GetCursor() != "" {
+		if filter.Cursor, err = strconv.ParseUint(request.GetCursor(), 10, 64); err != nil {
+			return QueryFilter{}, errors.NewInvalidRestorationQueryError("cursor", request.GetCursor())
+		}
+	}
+
+	return filter, nil
+}
+
+// parseQueryTime 解析查询条件中的时间，支持 alioth 时间格式和 RFC3339
+func parseQueryTime(value string) (t time.Time, err error) {
+	if t, err = time.Parse(global.AliothTimeFormat, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func exportRecord(record model.RestorationRecordDTO) *alioth.RestorationRecord {
+	return &alioth.RestorationRecord{
+		Id:             record.ID,
+		RecordId:       record.RecordID,
+		CallerService:  record.Service,
+		Level:          record.Level,
+		TraceId:        record.TraceID,
+		Message:        record.Message,
+		CallerIp:       record.CallerIP,
+		CallerType:     record.CallerType,
+		CodePath:       record.CodePath,
+		CalledFunction: record.CalledFunction,
+		CalledAt:       record.CalledAt.Format(global.AliothTimeFormat),
+		InputFields:    record.InputFields,
+		PayloadFields:  record.PayloadFields,
+		ExtraFields:    record.ExtraFields,
+		CollectedAt:    record.CreatedAt.Format(global.AliothTimeFormat),
+		Fields:         record.Fields,
+		Error:          record.Error,
+		DurationNs:     record.DurationNs,
+		User:           record.User,
+		Fingerprint:    record.Fingerprint,
+	}
+}
@@ -0,0 +1,497 @@
+package restoration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+const (
+	defaultSyslogMessageSize = 65536
+	defaultSyslogConnections = 1024
+	syslogNilValue           = "-"
+)
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// syslogMessage 解析后的 syslog 消息
+type syslogMessage struct {
+	protocol       string
+	facility       int
+	severity       int
+	timestamp      time.Time
+	hostname       string
+	appName        string
+	procID         string
+	msgID          string
+	structuredData map[string]map[string]string
+	message        string
+}
+
+// parseSyslog 解析 RFC 5424 或者 RFC 3164 格式的 syslog 消息，无法识别的消息头会作为消息内容保留
+//   - data: 一条完整的 syslog 消息，不包含传输层的分隔符
+//   - now: 接收消息的时间，消息中没有时间戳或者时间戳没有年份时使用
+func parseSyslog(data []byte, now time.Time) syslogMessage {
+	// 没有 PRI 的消息按照 RFC 3164 视为 user.notice
+	message := syslogMessage{protocol: "rfc3164", facility: 1, severity: 5, timestamp: now}
+	content := strings.TrimRight(string(data), "\r\n\x00")
+
+	if priority, rest, ok := parseSyslogPriority(content); !ok {
+		message.message = content
+		return message
+	} else {
+		message.facility, message.severity = priority/8, priority%8
+		content = rest
+	}
+
+	if strings.HasPrefix(content, "1 ") {
+		parseRfc5424(&message, content[2:])
+	} else {
+		parseRfc3164(&message, content, now)
+	}
+	return message
+}
+
+// parseSyslogPriority 解析消息开头的 <PRI>，PRI 的取值范围为 [0, 191]
+func parseSyslogPriority(content string) (priority int, rest string, ok bool) {
+	end := strings.IndexByte(content, '>')
+	if !strings.HasPrefix(content, "<") || end < 2 || end > 4 {
+		return 0, content, false
+	}
+	if value, parseErr := strconv.Atoi(content[1:end]); parseErr != nil || value < 0 || value > 191 {
+		return 0, content, false
+	} else {
+		return value, content[end+1:], true
+	}
+}
+
+// parseRfc5424 解析 RFC 5424 消息中版本号之后的部分
+//
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseRfc5424(message *syslogMessage, content string) {
+	message.protocol = "rfc5424"
+
+	headers := make([]string, 5)
+	for i := range headers {
+		headers[i], content, _ = strings.Cut(content, " ")
+		if headers[i] == syslogNilValue {
+			headers[i] = ""
+		}
+	}
+	if headers[0] != "" {
+		if timestamp, parseErr := time.Parse(time.RFC3339Nano, headers[0]); parseErr == nil {
+			message.timestamp = timestamp
+		}
+	}
+	message.hostname, message.appName, message.procID, message.msgID = headers[1], headers[2], headers[3], headers[4]
+
+	if strings.HasPrefix(content, syslogNilValue) {
+		content = content[len(syslogNilValue):]
+	} else {
+		message.structuredData, content = parseStructuredData(content)
+	}
+	content = strings.TrimPrefix(content, " ")
+	message.message = strings.TrimPrefix(content, "\ufeff")
+}
+
+// parseStructuredData 解析 RFC 5424 的 STRUCTURED-DATA，如 [id key="value"][id2 key="value"]
+//
+// 参数值中的 \" \\ \] 会被反转义，格式错误时停止解析并将剩余部分作为消息内容
+func parseStructuredData(content string) (data map[string]map[string]string, rest string) {
+	data = map[string]map[string]string{}
+	for strings.HasPrefix(content, "[") {
+		end, params := 1, map[string]string{}
+		for end < len(content) && content[end] != ' ' && content[end] != ']' {
+			end++
+		}
+		id := content[1:end]
+
+		for end < len(content) && content[end] == ' ' {
+			nameEnd := strings.IndexByte(content[end+1:], '=')
+			if nameEnd < 0 || end+nameEnd+2 >= len(content) || content[end+nameEnd+2] != '"' {
+				return data, content
+			}
+			name := content[end+1 : end+1+nameEnd]
+
+			var value strings.Builder
+			i := end + nameEnd + 3
+			for ; i < len(content) && content[i] != '"'; i++ {
+				if content[i] == '\\' && i+1 < len(content) && strings.IndexByte(`"\]`, content[i+1]) >= 0 {
+					i++
+				}
+				value.WriteByte(content[i])
+			}
+			if i >= len(content) {
+				return data, content
+			}
+			params[name] = value.String()
+			end = i + 1
+		}
+
+		if end >= len(content) || content[end] != ']' {
+			return data, content
+		}
+		data[id] = params
+		content = content[end+1:]
+	}
+	return data, content
+}
+
+// parseRfc3164 解析 RFC 3164 消息中 PRI 之后的部分，时间戳没有年份时使用接收时的年份
+//
+// Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+func parseRfc3164(message *syslogMessage, content string, now time.Time) {
+	const stampLayout = "Jan _2 15:04:05"
+	if len(content) < len(stampLayout)+1 {
+		message.message = content
+		return
+	} else if timestamp, parseErr := time.ParseInLocation(stampLayout, content[:len(stampLayout)], now.Location()); parseErr != nil {
+		message.message = content
+		return
+	} else {
+		timestamp = timestamp.AddDate(now.Year(), 0, 0)
+		// 跨年时接收到的去年的日志
+		if timestamp.After(now.AddDate(0, 0, 1)) {
+			timestamp = timestamp.AddDate(-1, 0, 0)
+		}
+		message.timestamp = timestamp
+		content = strings.TrimLeft(content[len(stampLayout):], " ")
+	}
+
+	// 本地转发的消息可能没有 HOSTNAME，第一个字段以 : 或者 ] 结尾时视为 TAG
+	if first, rest, _ := strings.Cut(content, " "); !strings.HasSuffix(first, ":") && !strings.HasSuffix(first, "]") {
+		message.hostname, content = first, rest
+	}
+
+	tag, rest, found := strings.Cut(content, " ")
+	if !found || !(strings.HasSuffix(tag, ":") || strings.HasSuffix(tag, "]")) {
+		message.message = content
+		return
+	}
+	tag = strings.TrimSuffix(tag, ":")
+	if start := strings.IndexByte(tag, '['); start > 0 && strings.HasSuffix(tag, "]") {
+		message.procID = tag[start+1 : len(tag)-1]
+		tag = tag[:start]
+	}
+	message.appName, message.message = tag, rest
+}
+
+// level 将 syslog 的 severity 转换为 restoration 的日志级别，emerg, alert 和 crit 视为 panic，notice 视为 info
+func (m syslogMessage) level() string {
+	switch {
+	case m.severity <= 2:
+		return string(log.Panic)
+	case m.severity == 3:
+		return string(log.Error)
+	case m.severity == 4:
+		return string(log.Warn)
+	case m.severity == 7:
+		return string(log.Debug)
+	default:
+		return string(log.Info)
+	}
+}
+
+// service 根据配置获取 caller_service，首选字段为空时使用另一个字段
+//   - from: app_name, hostname 或者 hostname/app_name
+func (m syslogMessage) service(from string) string {
+	switch {
+	case from == "hostname" && m.hostname != "":
+		return m.hostname
+	case from == "hostname/app_name" && m.hostname != "" && m.appName != "":
+		return m.hostname + "/" + m.appName
+	case m.appName != "":
+		return m.appName
+	default:
+		return m.hostname
+	}
+}
+
+// newFieldsFromSyslog 转换一条 syslog 消息，facility, 主机名等 syslog 的消息头作为 extra_fields
+//   - message: 解析后的 syslog 消息
+//   - ip: 发送消息的地址
+//   - serviceFrom: caller_service 的来源
+func newFieldsFromSyslog(message syslogMessage, ip, serviceFrom string) *Fields {
+	extra := map[string]any{
+		"protocol": message.protocol,
+		"facility": syslogFacilities[message.facility],
+		"severity": syslogSeverities[message.severity],
+	}
+	for key, value := range map[string]string{
+		"hostname": message.hostname,
+		"app_name": message.appName,
+		"proc_id":  message.procID,
+		"msg_id":   message.msgID,
+	} {
+		if value != "" {
+			extra[key] = value
+		}
+	}
+	if len(message.structuredData) > 0 {
+		extra["structured_data"] = message.structuredData
+	}
+
+	return &Fields{
+		callerIP:    ip,
+		service:     message.service(serviceFrom),
+		level:       message.level(),
+		caller:      string(log.External),
+		message:     message.message,
+		calledAt:    message.timestamp.Format(global.AliothTimeFormat),
+		extraFields: utils.JsonMarshal(extra),
+	}
+}
+
+// CollectLogSyslog 接收一条 syslog 消息，转换后与原生日志使用相同的处理流程
+//   - ip: 发送消息的地址
+//   - data: 一条完整的 RFC 5424 或者 RFC 3164 消息
+func (s *Service) CollectLogSyslog(ctx context.Context, ip string, data []byte) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	return s.collect(ctx, newFieldsFromSyslog(parseSyslog(data, time.Now()), ip, s.syslogServiceFrom))
+}
+
+// SyslogServer 接收 syslog 日志的 UDP 和 TCP 监听器
+type SyslogServer struct {
+	service        *Service
+	maxMessageSize int
+	maxConnections int
+	udp            net.PacketConn
+	tcp            net.Listener
+
+	mtx    sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// ListenSyslog 根据配置启动 syslog 监听器，地址为空的协议不会监听，监听地址的端口为 0 时使用随机端口
+//   - conf: syslog 配置
+func ListenSyslog(conf config.RestorationSyslogConfig) (*SyslogServer, error) {
+	server := &SyslogServer{
+		service:        defaultService,
+		maxMessageSize: conf.MaxMessageSize,
+		maxConnections: conf.MaxConnections,
+		conns:          map[net.Conn]struct{}{},
+	}
+	if server.maxMessageSize <= 0 {
+		server.maxMessageSize = defaultSyslogMessageSize
+	}
+	if server.maxConnections <= 0 {
+		server.maxConnections = defaultSyslogConnections
+	}
+
+	if conf.UDP != "" {
+		if conn, listenErr := net.ListenPacket("udp", conf.UDP); listenErr != nil {
+			return nil, fmt.Errorf("failed to listen syslog udp %s: %w", conf.UDP, listenErr)
+		} else {
+			server.udp = conn
+		}
+	}
+	if conf.TCP != "" {
+		if listener, listenErr := net.Listen("tcp", conf.TCP); listenErr != nil {
+			if server.udp != nil {
+				_ = server.udp.Close()
+			}
+			return nil, fmt.Errorf("failed to listen syslog tcp %s: %w", conf.TCP, listenErr)
+		} else {
+			server.tcp = listener
+		}
+	}
+
+	if server.udp != nil {
+		server.wg.Add(1)
+		go server.serveUDP()
+	}
+	if server.tcp != nil {
+		server.wg.Add(1)
+		go server.serveTCP()
+	}
+	return server, nil
+}
+
+// UDPAddr UDP 监听的地址，没有监听时返回 nil
+func (s *SyslogServer) UDPAddr() net.Addr {
+	if s.udp == nil {
+		return nil
+	}
+	return s.udp.LocalAddr()
+}
+
+// TCPAddr TCP 监听的地址，没有监听时返回 nil
+func (s *SyslogServer) TCPAddr() net.Addr {
+	if s.tcp == nil {
+		return nil
+	}
+	return s.tcp.Addr()
+}
+
+// Close 关闭监听器和所有的 TCP 连接，等待正在处理的消息完成
+func (s *SyslogServer) Close() error {
+	s.mtx.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mtx.Unlock()
+
+	var closeErr error
+	if s.udp != nil {
+		closeErr = errors.Join(closeErr, s.udp.Close())
+	}
+	if s.tcp != nil {
+		closeErr = errors.Join(closeErr, s.tcp.Close())
+	}
+	s.wg.Wait()
+	return closeErr
+}
+
+func (s *SyslogServer) isClosed() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.closed
+}
+
+// serveUDP 每个数据报是一条消息
+func (s *SyslogServer) serveUDP() {
+	defer s.wg.Done()
+
+	buffer := make([]byte, s.maxMessageSize)
+	for {
+		n, addr, readErr := s.udp.ReadFrom(buffer)
+		if readErr != nil {
+			if !s.isClosed() {
+				s.logError("failed to read syslog udp message", readErr)
+			}
+			return
+		}
+		ip := ""
+		if udpAddr, isUDP := addr.(*net.UDPAddr); isUDP {
+			ip = udpAddr.IP.String()
+		}
+		s.handle(ip, buffer[:n])
+	}
+}
+
+func (s *SyslogServer) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, acceptErr := s.tcp.Accept()
+		if acceptErr != nil {
+			if !s.isClosed() {
+				s.logError("failed to accept syslog tcp connection", acceptErr)
+			}
+			return
+		}
+
+		s.mtx.Lock()
+		if s.closed {
+			s.mtx.Unlock()
+			_ = conn.Close()
+			return
+		} else if len(s.conns) >= s.maxConnections {
+			// 连接数达到上限时直接关闭新的连接，避免大量空闲连接占用协程和缓冲区
+			s.mtx.Unlock()
+			_ = conn.Close()
+			s.logError("syslog tcp connection rejected", fmt.Errorf("too many connections from %s, limit %d", conn.RemoteAddr(), s.maxConnections))
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mtx.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn 按照 RFC 6587 读取 TCP 连接中的消息，以数字开头时按照长度分隔，否则按照换行分隔
+func (s *SyslogServer) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mtx.Lock()
+		delete(s.conns, conn)
+		s.mtx.Unlock()
+		_ = conn.Close()
+	}()
+
+	ip := ""
+	if tcpAddr, isTCP := conn.RemoteAddr().(*net.TCPAddr); isTCP {
+		ip = tcpAddr.IP.String()
+	}
+
+	reader := bufio.NewReaderSize(conn, s.maxMessageSize)
+	for {
+		message, readErr := s.readFrame(reader)
+		if readErr != nil {
+			if readErr != io.EOF && !s.isClosed() {
+				s.logError("failed to read syslog tcp message", readErr)
+			}
+			return
+		}
+		s.handle(ip, message)
+	}
+}
+
+// readFrame 读取一条 TCP 消息，超过最大长度时返回错误并关闭连接
+func (s *SyslogServer) readFrame(reader *bufio.Reader) ([]byte, error) {
+	first, peekErr := reader.Peek(1)
+	if peekErr != nil {
+		return nil, peekErr
+	}
+
+	if first[0] >= '0' && first[0] <= '9' {
+		prefix, readErr := reader.ReadString(' ')
+		if readErr != nil {
+			return nil, readErr
+		}
+		length, parseErr := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+		if parseErr != nil || length <= 0 || length > s.maxMessageSize {
+			return nil, fmt.Errorf("invalid syslog message length %q", strings.TrimSuffix(prefix, " "))
+		}
+		message := make([]byte, length)
+		if _, readErr = io.ReadFull(reader, message); readErr != nil {
+			return nil, readErr
+		}
+		return message, nil
+	}
+
+	line, readErr := reader.ReadSlice('\n')
+	if errors.Is(readErr, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("syslog message exceeds %d bytes", s.maxMessageSize)
+	} else if readErr != nil && (readErr != io.EOF || len(line) == 0) {
+		return nil, readErr
+	}
+	return append([]byte(nil), line...), nil
+}
+
+func (s *SyslogServer) handle(ip string, data []byte) {
+	if collectErr := s.service.CollectLogSyslog(context.Background(), ip, data); collectErr != nil && !isRateLimited(collectErr) {
+		s.logError("failed to collect syslog message", collectErr)
+	}
+}
+
+func (s *SyslogServer) logError(message string, err error) {
+	log.DefaultLogger().Log(log.DefaultField().WithLevel(log.Warn).WithCaller(log.Module).
+		WithMessage(message).WithExtra(err.Error()))
+}
@@ -0,0 +1,278 @@
+package restoration
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+func TestParseSyslog(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		data  string
+		want  syslogMessage
+		level string
+	}{
+		{
+			name: "rfc5424 with structured data",
+			data: `<165>1 2024-01-02T03:04:05.123Z host app 42 ID47 [meta a="1" b="x\"y"][origin ip="10.0.0.1"] ` + "\ufeffhello world",
+			want: syslogMessage{
+				protocol: "rfc5424", facility: 20, severity: 5, timestamp: time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC),
+				hostname: "host", appName: "app", procID: "42", msgID: "ID47",
+				structuredData: map[string]map[string]string{"meta": {"a": "1", "b": `x"y`}, "origin": {"ip": "10.0.0.1"}},
+				message:        "hello world",
+			},
+			level: string(log.Info),
+		},
+		{
+			name:  "rfc5424 with nil values",
+			data:  "<11>1 - - - - - - failed\n",
+			want:  syslogMessage{protocol: "rfc5424", facility: 1, severity: 3, timestamp: now, message: "failed"},
+			level: string(log.Error),
+		},
+		{
+			name: "rfc3164 with hostname",
+			data: "<34>Jan  2 03:00:00 host sshd[123]: login failed",
+			want: syslogMessage{
+				protocol: "rfc3164", facility: 4, severity: 2, timestamp: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC),
+				hostname: "host", appName: "sshd", procID: "123", message: "login failed",
+			},
+			level: string(log.Panic),
+		},
+		{
+			name: "rfc3164 without hostname",
+			data: "<12>Jan  2 03:00:00 cron: job started",
+			want: syslogMessage{
+				protocol: "rfc3164", facility: 1, severity: 4, timestamp: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC),
+				appName: "cron", message: "job started",
+			},
+			level: string(log.Warn),
+		},
+		{
+			name: "rfc3164 from last year",
+			data: "<15>Dec 31 23:59:59 host app: late",
+			want: syslogMessage{
+				protocol: "rfc3164", facility: 1, severity: 7, timestamp: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				hostname: "host", appName: "app", message: "late",
+			},
+			level: string(log.Debug),
+		},
+		{
+			name:  "no priority",
+			data:  "plain message",
+			want:  syslogMessage{protocol: "rfc3164", facility: 1, severity: 5, timestamp: now, message: "plain message"},
+			level: string(log.Info),
+		},
+		{
+			name:  "invalid priority",
+			data:  "<999>1 - - - - - - message",
+			want:  syslogMessage{protocol: "rfc3164", facility: 1, severity: 5, timestamp: now, message: "<999>1 - - - - - - message"},
+			level: string(log.Info),
+		},
+		{
+			name:  "malformed structured data kept as message",
+			data:  `<14>1 - host app - - [meta a=1] message`,
+			want:  syslogMessage{protocol: "rfc5424", facility: 1, severity: 6, timestamp: now, hostname: "host", appName: "app", structuredData: map[string]map[string]string{}, message: "[meta a=1] message"},
+			level: string(log.Info),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			message := parseSyslog([]byte(c.data), now)
+			if !message.timestamp.Equal(c.want.timestamp) {
+				t.Errorf("timestamp %v, want %v", message.timestamp, c.want.timestamp)
+			}
+			message.timestamp, c.want.timestamp = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(message, c.want) {
+				t.Errorf("parseSyslog(%q) = %+v, want %+v", c.data, message, c.want)
+			}
+			if level := message.level(); level != c.level {
+				t.Errorf("level %s, want %s", level, c.level)
+			}
+		})
+	}
+}
+
+func TestSyslogMessageService(t *testing.T) {
+	cases := []struct {
+		from    string
+		message syslogMessage
+		want    string
+	}{
+		{from: "", message: syslogMessage{hostname: "host", appName: "app"}, want: "app"},
+		{from: "", message: syslogMessage{hostname: "host"}, want: "host"},
+		{from: "hostname", message: syslogMessage{hostname: "host", appName: "app"}, want: "host"},
+		{from: "hostname", message: syslogMessage{appName: "app"}, want: "app"},
+		{from: "hostname/app_name", message: syslogMessage{hostname: "host", appName: "app"}, want: "host/app"},
+		{from: "hostname/app_name", message: syslogMessage{appName: "app"}, want: "app"},
+	}
+
+	for _, c := range cases {
+		if service := c.message.service(c.from); service != c.want {
+			t.Errorf("service(%q) of %+v = %q, want %q", c.from, c.message, service, c.want)
+		}
+	}
+}
+
+func TestSyslogReadFrame(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		messages []string
+		failed   bool
+	}{
+		{name: "octet counting", input: "5 hello11 hello world", messages: []string{"hello", "hello world"}},
+		{name: "non transparent framing", input: "<14>first\n<14>second", messages: []string{"<14>first\n", "<14>second"}},
+		{name: "invalid length", input: "0 ", failed: true},
+		{name: "length exceeds limit", input: "65 hello", failed: true},
+		{name: "line exceeds limit", input: "<14>" + strings.Repeat("a", 64) + "\n", failed: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := &SyslogServer{maxMessageSize: 64}
+			reader := bufio.NewReaderSize(strings.NewReader(c.input), server.maxMessageSize)
+			var messages []string
+			for {
+				message, readErr := server.readFrame(reader)
+				if readErr != nil {
+					if failed := readErr != io.EOF; failed != c.failed {
+						t.Errorf("failed %v, want %v: %v", failed, c.failed, readErr)
+					}
+					break
+				}
+				messages = append(messages, string(message))
+			}
+			if !c.failed && !reflect.DeepEqual(messages, c.messages) {
+				t.Errorf("read %q, want %q", messages, c.messages)
+			}
+		})
+	}
+}
+
+// receiveSyslog 等待订阅者收到一条日志
+func receiveSyslog(t *testing.T, subscriber *tailSubscriber) *alioth.RestorationRecord {
+	t.Helper()
+	select {
+	case record := <-subscriber.records:
+		return record
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for syslog message")
+		return nil
+	}
+}
+
+func TestSyslogServerLoopback(t *testing.T) {
+	server, listenErr := ListenSyslog(config.RestorationSyslogConfig{UDP: "127.0.0.1:0", TCP: "127.0.0.1:0"})
+	if listenErr != nil {
+		t.Fatalf("listen syslog: %v", listenErr)
+	}
+	defer func() { _ = server.Close() }()
+
+	cases := []struct {
+		name    string
+		network string
+		frame   func(message string) string
+		data    string
+		service string
+		level   string
+		message string
+	}{
+		{
+			name: "udp rfc5424", network: "udp", frame: func(m string) string { return m },
+			data:    "<11>1 2024-01-02T03:04:05Z host syslog-udp-5424 - - - failed over udp",
+			service: "syslog-udp-5424", level: string(log.Error), message: "failed over udp",
+		},
+		{
+			name: "udp rfc3164", network: "udp", frame: func(m string) string { return m },
+			data:    "<12>Jan  2 03:04:05 host syslog-udp-3164[1]: warned over udp",
+			service: "syslog-udp-3164", level: string(log.Warn), message: "warned over udp",
+		},
+		{
+			name: "tcp rfc5424 octet counting", network: "tcp", frame: func(m string) string { return fmt.Sprintf("%d %s", len(m), m) },
+			data:    "<14>1 2024-01-02T03:04:05Z host syslog-tcp-5424 - - [meta a=\"1\"] info over tcp",
+			service: "syslog-tcp-5424", level: string(log.Info), message: "info over tcp",
+		},
+		{
+			name: "tcp rfc3164 non transparent framing", network: "tcp", frame: func(m string) string { return m + "\n" },
+			data:    "<15>Jan  2 03:04:05 host syslog-tcp-3164: debug over tcp",
+			service: "syslog-tcp-3164", level: string(log.Debug), message: "debug over tcp",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			subscriber := defaultService.tail.subscribe(QueryFilter{Service: c.service}, 4)
+			defer defaultService.tail.unsubscribe(subscriber)
+
+			address := server.UDPAddr().String()
+			if c.network == "tcp" {
+				address = server.TCPAddr().String()
+			}
+			conn, dialErr := net.Dial(c.network, address)
+			if dialErr != nil {
+				t.Fatalf("dial %s: %v", address, dialErr)
+			}
+			defer func() { _ = conn.Close() }()
+			if _, writeErr := conn.Write([]byte(c.frame(c.data))); writeErr != nil {
+				t.Fatalf("write: %v", writeErr)
+			}
+
+			record := receiveSyslog(t, subscriber)
+			if record.Level != c.level || record.Message != c.message || record.CallerIp != "127.0.0.1" {
+				t.Errorf("received level %s, message %q from %s, want level %s, message %q from 127.0.0.1",
+					record.Level, record.Message, record.CallerIp, c.level, c.message)
+			}
+		})
+	}
+}
+
+func TestSyslogServerConnectionLimit(t *testing.T) {
+	server, listenErr := ListenSyslog(config.RestorationSyslogConfig{TCP: "127.0.0.1:0", MaxConnections: 1})
+	if listenErr != nil {
+		t.Fatalf("listen syslog: %v", listenErr)
+	}
+	defer func() { _ = server.Close() }()
+
+	subscriber := defaultService.tail.subscribe(QueryFilter{Service: "syslog-limit"}, 4)
+	defer defaultService.tail.unsubscribe(subscriber)
+
+	// 第一个连接发送一条消息，确认连接已经被接受
+	first, dialErr := net.Dial("tcp", server.TCPAddr().String())
+	if dialErr != nil {
+		t.Fatalf("dial: %v", dialErr)
+	}
+	defer func() { _ = first.Close() }()
+	_, _ = first.Write([]byte("<14>1 - host syslog-limit - - - first\n"))
+	receiveSyslog(t, subscriber)
+
+	// 超过上限的连接被服务端关闭
+	second, dialErr := net.Dial("tcp", server.TCPAddr().String())
+	if dialErr != nil {
+		t.Fatalf("dial: %v", dialErr)
+	}
+	defer func() { _ = second.Close() }()
+	_ = second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, readErr := second.Read(make([]byte, 1)); readErr == nil {
+		t.Fatal("connection over the limit should be closed")
+	} else if netErr, isNet := readErr.(net.Error); isNet && netErr.Timeout() {
+		t.Fatal("connection over the limit was not closed")
+	}
+
+	// 第一个连接不受影响
+	_, _ = first.Write([]byte("<14>1 - host syslog-limit - - - still open\n"))
+	if record := receiveSyslog(t, subscriber); record.Message != "still open" {
+		t.Errorf("received %q, want %q", record.Message, "still open")
+	}
+}
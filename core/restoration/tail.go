@@ -0,0 +1,121 @@
+package restoration
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+const (
+	defaultTailBufferSize = 256
+	maxTailBufferSize     = 4096
+)
+
+// tailSubscriber 实时日志的订阅者，缓冲区满时丢弃日志，不会阻塞日志的接收
+type tailSubscriber struct {
+	filter  QueryFilter
+	records chan *alioth.RestorationRecord
+	dropped atomic.Uint64
+}
+
+// tailHub 将新接收到的日志分发给所有的订阅者
+type tailHub struct {
+	mtx         sync.RWMutex
+	subscribers map[*tailSubscriber]struct{}
+}
+
+func newTailHub() *tailHub {
+	return &tailHub{subscribers: map[*tailSubscriber]struct{}{}}
+}
+
+// subscribe 注册一个订阅者，使用完毕后需要调用 unsubscribe
+//   - filter: 订阅者的过滤条件，只使用 Service, Level, TraceID 和 Keyword
+//   - size: 订阅者的缓冲区大小
+func (h *tailHub) subscribe(filter QueryFilter, size int) *tailSubscriber {
+	subscriber := &tailSubscriber{filter: filter, records: make(chan *alioth.RestorationRecord, size)}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+func (h *tailHub) unsubscribe(subscriber *tailSubscriber) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	delete(h.subscribers, subscriber)
+}
+
+// publish 将日志分发给匹配的订阅者，订阅者的缓冲区满时记录丢弃的数量
+//   - records: 新接收到的日志
+func (h *tailHub) publish(records []*Fields) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	if len(h.subscribers) == 0 {
+		return
+	}
+
+	for _, fields := range records {
+		record := fields.record()
+		var exported *alioth.RestorationRecord
+		for subscriber := range h.subscribers {
+			if !subscriber.filter.match(record.Service, record.Level, record.TraceID, record.Fingerprint, record.CalledAt) || !subscriber.filter.matchKeyword(record.Message) {
+				continue
+			}
+
+			if exported == nil {
+				exported = exportRecord(record)
+			}
+			select {
+			case subscriber.records <- exported:
+			default:
+				subscriber.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// newTailFilter 从请求中解析订阅者的过滤条件和缓冲区大小
+//   - request: 订阅请求
+func newTailFilter(request *alioth.RestorationTailRequest) (filter QueryFilter, size int) {
+	filter = QueryFilter{
+		Service: request.GetService(),
+		Level:   request.GetLevel(),
+		TraceID: request.GetTraceId(),
+		Keyword: request.GetKeyword(),
+	}
+
+	size = int(request.GetBufferSize())
+	if size <= 0 {
+		size = defaultTailBufferSize
+	} else if size > maxTailBufferSize {
+		size = maxTailBufferSize
+	}
+	return filter, size
+}
+
+// TailLog 订阅新接收到的日志，直到 ctx 结束或者 send 返回错误
+//   - ctx: 订阅的上下文，结束时取消订阅
+//   - request: 订阅请求
+//   - send: 推送日志的方法
+func (s *Service) TailLog(ctx context.Context, request *alioth.RestorationTailRequest, send func(response *alioth.RestorationTailResponse) error) error {
+	subscriber := s.tail.subscribe(newTailFilter(request))
+	defer s.tail.unsubscribe(subscriber)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case record := <-subscriber.records:
+			if sendErr := send(&alioth.RestorationTailResponse{
+				Record:  record,
+				Dropped: subscriber.dropped.Swap(0),
+			}); sendErr != nil {
+				return sendErr
+			}
+		}
+	}
+}
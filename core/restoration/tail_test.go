@@ -0,0 +1,158 @@
+package restoration
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+// drainTail 读取订阅者缓冲区中的所有日志消息
+func drainTail(subscriber *tailSubscriber) (messages []string) {
+	for {
+		select {
+		case record := <-subscriber.records:
+			messages = append(messages, record.GetMessage())
+		default:
+			return messages
+		}
+	}
+}
+
+func TestTailFilter(t *testing.T) {
+	records := []*Fields{
+		{service: "order", level: "info", traceID: "t1", message: "order created"},
+		{service: "order", level: "error", traceID: "t1", message: "Payment FAILED"},
+		{service: "user", level: "error", traceID: "t2", message: "user not found"},
+	}
+	cases := []struct {
+		name    string
+		request *alioth.RestorationTailRequest
+		want    []string
+	}{
+		{name: "no filter", request: &alioth.RestorationTailRequest{}, want: []string{"order created", "Payment FAILED", "user not found"}},
+		{name: "service", request: &alioth.RestorationTailRequest{Service: "order"}, want: []string{"order created", "Payment FAILED"}},
+		{name: "level", request: &alioth.RestorationTailRequest{Level: "error"}, want: []string{"Payment FAILED", "user not found"}},
+		{name: "trace id", request: &alioth.RestorationTailRequest{TraceId: "t2"}, want: []string{"user not found"}},
+		{name: "keyword ignores case", request: &alioth.RestorationTailRequest{Keyword: "failed"}, want: []string{"Payment FAILED"}},
+		{name: "combined", request: &alioth.RestorationTailRequest{Service: "order", Level: "error", Keyword: "created"}},
+	}
+
+	hub := newTailHub()
+	subscribers := make([]*tailSubscriber, len(cases))
+	for i, c := range cases {
+		subscribers[i] = hub.subscribe(newTailFilter(c.request))
+	}
+	hub.publish(records)
+
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if messages := drainTail(subscribers[i]); !reflect.DeepEqual(messages, c.want) {
+				t.Errorf("received %v, want %v", messages, c.want)
+			}
+		})
+	}
+
+	// 取消订阅之后不会再收到日志
+	hub.unsubscribe(subscribers[0])
+	hub.publish(records)
+	if messages := drainTail(subscribers[0]); len(messages) != 0 {
+		t.Errorf("received %v after unsubscribe", messages)
+	}
+}
+
+func TestNewTailFilterBufferSize(t *testing.T) {
+	for request, want := range map[int32]int{0: defaultTailBufferSize, -1: defaultTailBufferSize, 16: 16, maxTailBufferSize + 1: maxTailBufferSize} {
+		if _, size := newTailFilter(&alioth.RestorationTailRequest{BufferSize: request}); size != want {
+			t.Errorf("buffer size %d resolved to %d, want %d", request, size, want)
+		}
+	}
+}
+
+func TestTailDropsForSlowSubscriber(t *testing.T) {
+	hub := newTailHub()
+	slow, fast := hub.subscribe(QueryFilter{}, 2), hub.subscribe(QueryFilter{}, 8)
+
+	// 缓冲区满的订阅者丢弃日志，不会阻塞分发，也不影响其他订阅者
+	records := make([]*Fields, 5)
+	for i := range records {
+		records[i] = &Fields{service: "order", level: "info", message: strconv.Itoa(i)}
+	}
+	hub.publish(records)
+
+	if messages := drainTail(slow); !reflect.DeepEqual(messages, []string{"0", "1"}) || slow.dropped.Load() != 3 {
+		t.Errorf("slow subscriber received %v and dropped %d, want [0 1] and 3", messages, slow.dropped.Load())
+	}
+	if messages := drainTail(fast); len(messages) != 5 || fast.dropped.Load() != 0 {
+		t.Errorf("fast subscriber received %v and dropped %d, want all 5 records", messages, fast.dropped.Load())
+	}
+}
+
+func TestTailLogReportsDropped(t *testing.T) {
+	s := &Service{tail: newTailHub()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	responses := make(chan *alioth.RestorationTailResponse, 8)
+	done := make(chan error, 1)
+	go func() {
+		first := true
+		done <- s.TailLog(ctx, &alioth.RestorationTailRequest{BufferSize: 2}, func(response *alioth.RestorationTailResponse) error {
+			if first {
+				first = false
+				close(entered)
+				<-release
+			}
+			responses <- response
+			return nil
+		})
+	}()
+
+	// 等待订阅完成
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		s.tail.mtx.RLock()
+		subscribed := len(s.tail.subscribers) == 1
+		s.tail.mtx.RUnlock()
+		if subscribed {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the subscription")
+		}
+	}
+
+	// 推送第一条日志时阻塞，期间超过缓冲区的日志被丢弃，丢弃的数量随下一条推送的日志返回
+	publish := func(message string) { s.tail.publish([]*Fields{{service: "order", level: "info", message: message}}) }
+	publish("0")
+	<-entered
+	for i := 1; i <= 4; i++ {
+		publish(strconv.Itoa(i))
+	}
+	close(release)
+
+	want := []struct {
+		message string
+		dropped uint64
+	}{{"0", 0}, {"1", 2}, {"2", 0}}
+	for _, w := range want {
+		select {
+		case response := <-responses:
+			if response.GetRecord().GetMessage() != w.message || response.GetDropped() != w.dropped {
+				t.Errorf("received %s with %d dropped, want %s with %d", response.GetRecord().GetMessage(), response.GetDropped(), w.message, w.dropped)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for record %s", w.message)
+		}
+	}
+
+	cancel()
+	if tailErr := <-done; tailErr != nil {
+		t.Errorf("TailLog returned %v after the context ended", tailErr)
+	}
+	if len(s.tail.subscribers) != 0 {
+		t.Error("TailLog should unsubscribe when it returns")
+	}
+}
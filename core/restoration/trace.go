@@ -0,0 +1,57 @@
+package restoration
+
+import (
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+// buildTraceTimeline 根据按照调用时间排序的日志，生成每个服务的时间线，服务按照首次出现的时间排序
+//   - records: 同一个 trace_id 下按照调用时间排序的日志
+func buildTraceTimeline(records []model.RestorationRecordDTO) (timeline []*alioth.RestorationTraceTimeline) {
+	type serviceTimeline struct {
+		first, last model.RestorationRecordDTO
+		count       int32
+		errors      int32
+		functions   []string
+		seen        map[string]bool
+	}
+
+	var order []string
+	services := map[string]*serviceTimeline{}
+	for _, record := range records {
+		current, exist := services[record.Service]
+		if !exist {
+			current = &serviceTimeline{first: record, seen: map[string]bool{}}
+			services[record.Service] = current
+			order = append(order, record.Service)
+		}
+
+		current.last = record
+		current.count++
+		if level := log.NewLevelFromString(record.Level); level == log.Error || level == log.Panic {
+			current.errors++
+		}
+		if record.CalledFunction != "" && !current.seen[record.CalledFunction] {
+			current.seen[record.CalledFunction] = true
+			current.functions = append(current.functions, record.CalledFunction)
+		}
+	}
+
+	timeline = make([]*alioth.RestorationTraceTimeline, len(order))
+	for i, service := range order {
+		current := services[service]
+		timeline[i] = &alioth.RestorationTraceTimeline{
+			CallerService:   service,
+			FirstCalledAt:   current.first.CalledAt.Format(global.AliothTimeFormat),
+			LastCalledAt:    current.last.CalledAt.Format(global.AliothTimeFormat),
+			DurationMs:      current.last.CalledAt.Sub(current.first.CalledAt).Milliseconds(),
+			RecordCount:     current.count,
+			ErrorCount:      current.errors,
+			CalledFunctions: current.functions,
+		}
+	}
+	return timeline
+}
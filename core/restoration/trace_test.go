@@ -0,0 +1,105 @@
+package restoration
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+)
+
+func TestBuildTraceTimeline(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	record := func(service, level, function string, ms int) model.RestorationRecordDTO {
+		return model.RestorationRecordDTO{Service: service, Level: level, CalledFunction: function, CalledAt: at(ms)}
+	}
+
+	type timeline struct {
+		service   string
+		first     int
+		last      int
+		records   int32
+		errors    int32
+		functions []string
+	}
+	cases := []struct {
+		name    string
+		records []model.RestorationRecordDTO
+		want    []timeline
+	}{
+		{
+			name: "empty trace",
+		},
+		{
+			name: "services ordered by first record",
+			records: []model.RestorationRecordDTO{
+				record("gateway", "info", "Handle", 0),
+				record("order", "info", "Create", 10),
+				record("gateway", "info", "Respond", 20),
+				record("user", "info", "Get", 20),
+			},
+			want: []timeline{
+				{service: "gateway", first: 0, last: 20, records: 2, functions: []string{"Handle", "Respond"}},
+				{service: "order", first: 10, last: 10, records: 1, functions: []string{"Create"}},
+				{service: "user", first: 20, last: 20, records: 1, functions: []string{"Get"}},
+			},
+		},
+		{
+			// gateway 调用 order，order 调用 user，内层服务的时间线包含在外层服务的时间线中
+			name: "nested calls",
+			records: []model.RestorationRecordDTO{
+				record("gateway", "info", "Handle", 0),
+				record("order", "info", "Create", 5),
+				record("user", "warn", "Get", 10),
+				record("user", "error", "Get", 15),
+				record("order", "panic", "Create", 30),
+				record("gateway", "error", "Handle", 40),
+			},
+			want: []timeline{
+				{service: "gateway", first: 0, last: 40, records: 2, errors: 1, functions: []string{"Handle"}},
+				{service: "order", first: 5, last: 30, records: 2, errors: 1, functions: []string{"Create"}},
+				{service: "user", first: 10, last: 15, records: 2, errors: 1, functions: []string{"Get"}},
+			},
+		},
+		{
+			// 入口服务的日志没有上报时，时间线从最早出现的下游服务开始，不会补充缺失的服务
+			name: "missing parent",
+			records: []model.RestorationRecordDTO{
+				record("user", "info", "", 10),
+				record("order", "info", "Create", 12),
+				record("user", "info", "Get", 20),
+			},
+			want: []timeline{
+				{service: "user", first: 10, last: 20, records: 2, functions: []string{"Get"}},
+				{service: "order", first: 12, last: 12, records: 1, functions: []string{"Create"}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := buildTraceTimeline(c.records)
+			if len(got) != len(c.want) {
+				t.Fatalf("got %d services, want %d", len(got), len(c.want))
+			}
+			for i, want := range c.want {
+				current := got[i]
+				if current.CallerService != want.service || current.RecordCount != want.records || current.ErrorCount != want.errors {
+					t.Errorf("timeline %d is %s with %d records and %d errors, want %s with %d and %d",
+						i, current.CallerService, current.RecordCount, current.ErrorCount, want.service, want.records, want.errors)
+				}
+				if current.FirstCalledAt != at(want.first).Format(global.AliothTimeFormat) || current.LastCalledAt != at(want.last).Format(global.AliothTimeFormat) {
+					t.Errorf("timeline %d spans %s to %s, want %dms to %dms", i, current.FirstCalledAt, current.LastCalledAt, want.first, want.last)
+				}
+				if current.DurationMs != int64(want.last-want.first) {
+					t.Errorf("timeline %d lasts %dms, want %dms", i, current.DurationMs, want.last-want.first)
+				}
+				if !reflect.DeepEqual(current.CalledFunctions, want.functions) {
+					t.Errorf("timeline %d called %v, want %v", i, current.CalledFunctions, want.functions)
+				}
+			}
+		})
+	}
+}
@@ -22,19 +22,29 @@ var redisCache *cache = nil
 
 func init() {
 	if initialize.GlobalConfig().Stellar.Storage == "redis" {
-		redisCache = &cache{
-			client: memcache.GetRedisCache(),
-		}
+		redisCache = newCache()
+	}
+}
 
-		if initialize.GlobalConfig().Stellar.Logger != "" {
-			defaultDao.logger = log.NewLogger(initialize.GlobalConfig().Stellar.Logger)
-		} else {
-			defaultDao.logger = log.DefaultLogger()
-		}
+func newCache() *cache {
+	c := &cache{
+		client: memcache.GetRedisCache(),
+	}
+
+	if initialize.GlobalConfig().Stellar.Logger != "" {
+		c.logger = log.NewLogger(initialize.GlobalConfig().Stellar.Logger)
+	} else {
+		c.logger = log.DefaultLogger()
 	}
+
+	return c
 }
 
+// defaultCache 获取默认的 cache，如果当前存储后端不是 redis，会在第一次调用时创建，用于迁移等场景
 func defaultCache() *cache {
+	if redisCache == nil {
+		redisCache = newCache()
+	}
 	return redisCache
 }
 
@@ -75,6 +85,7 @@ func (c *cache) AddInstance(ctx context.Context, instanceService string, instanc
 		instance.Name = instanceName.String()
 		marshalBytes := utils.JsonMarshal(instance)
 		c.client.SAdd(ctx, utils.BuildRedisKey(instanceService, instanceVersion.Export()), string(marshalBytes))
+		c.client.SAdd(ctx, utils.BuildRedisKey("services"), instanceService)
 		c.logger.Log(log.DefaultField().WithFields(log.Info, log.Module, "alioth-stellar insert instance success", ctx, instance))
 		return instance, nil
 	}
@@ -96,6 +107,7 @@ func (c *cache) AddInstance(ctx context.Context, instanceService string, instanc
 		instance.Name = instanceName.String()
 		marshalBytes := utils.JsonMarshal(instance)
 		c.client.SAdd(ctx, utils.BuildRedisKey(instanceService, instanceVersion.Export()), string(marshalBytes))
+		c.client.SAdd(ctx, utils.BuildRedisKey("services"), instanceService)
 		c.logger.Log(log.DefaultField().WithFields(log.Info, log.Module, "alioth-stellar insert instance success", ctx, instance))
 		return instance, nil
 	}
@@ -175,3 +187,141 @@ func (c *cache) FindInstance(ctx context.Context, service string, minVersion ver
 		return instances, nil
 	}
 }
+
+// ExportInstances 导出所有服务实例
+func (c *cache) ExportInstances(ctx context.Context) (instances []model.InstanceDTO, err errors.AliothError) {
+	if instances, err = c.listInstances(ctx); err == nil {
+		c.logger.Log(log.DefaultField().WithFields(log.Info, log.Module, "alioth-stellar export instance success", ctx, len(instances)))
+	}
+	return instances, err
+}
+
+// listInstances 获取所有服务实例，只记录错误日志，用于定时统计实例数量
+func (c *cache) listInstances(ctx context.Context) (instances []model.InstanceDTO, err errors.AliothError) {
+	services, getServicesErr := c.listServices(ctx)
+	if getServicesErr != nil {
+		return []model.InstanceDTO{}, getServicesErr
+	}
+
+	instances = []model.InstanceDTO{}
+	for _, service := range services {
+		versionStrings, getVersionsErr := c.client.SMembers(ctx, utils.BuildRedisKey(service, "versions")).Result()
+		if getVersionsErr != nil {
+			c.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar export instance error", ctx, getVersionsErr.Error()))
+			return []model.InstanceDTO{}, errors.NewExecuteSqlError("SMembers", getVersionsErr)
+		}
+
+		for _, versionString := range versionStrings {
+			instanceStrings, getInstanceErr := c.client.SMembers(ctx, utils.BuildRedisKey(service, versionString)).Result()
+			if getInstanceErr != nil {
+				c.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar export instance error", ctx, getInstanceErr.Error()))
+				return []model.InstanceDTO{}, errors.NewExecuteSqlError("SMembers", getInstanceErr)
+			}
+
+			for _, instanceString := range instanceStrings {
+				var instance model.InstanceDTO
+				if unmarshalErr := json.Unmarshal([]byte(instanceString), &instance); unmarshalErr != nil {
+					c.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar unmarshal instance error", ctx, unmarshalErr.Error()))
+					return []model.InstanceDTO{}, errors.NewExecuteSqlError("JsonUnmarshal", unmarshalErr)
+				}
+				instances = append(instances, instance)
+			}
+		}
+	}
+
+	return instances, nil
+}
+
+// listServices 获取所有服务名称，除了 services 集合中记录的服务，还会扫描服务版本的键，
+// 找到记录服务名称之前注册的服务，并回填到 services 集合中
+func (c *cache) listServices(ctx context.Context) (services []string, err errors.AliothError) {
+	servicesKey := utils.BuildRedisKey("services")
+	recorded, getServicesErr := c.client.SMembers(ctx, servicesKey).Result()
+	if getServicesErr != nil {
+		c.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar export instance error", ctx, getServicesErr.Error()))
+		return nil, errors.NewExecuteSqlError("SMembers", getServicesErr)
+	}
+
+	seen := make(map[string]bool, len(recorded))
+	for _, service := range recorded {
+		seen[service] = true
+	}
+	services = append(services, recorded...)
+
+	// 服务版本的键为 <服务名称>:versions，使用 SCAN 避免阻塞 redis
+	pattern := utils.BuildRedisKey("*", "versions")
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+	var missing []interface{}
+	iter := c.client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		service := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), prefix), suffix)
+		if service == "" || seen[service] {
+			continue
+		}
+		seen[service] = true
+		services = append(services, service)
+		missing = append(missing, service)
+	}
+	if scanErr := iter.Err(); scanErr != nil {
+		c.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar export instance error", ctx, scanErr.Error()))
+		return nil, errors.NewExecuteSqlError("Scan", scanErr)
+	}
+
+	if len(missing) > 0 {
+		if backfillErr := c.client.SAdd(ctx, servicesKey, missing...).Err(); backfillErr != nil {
+			c.logger.Log(log.DefaultField().WithFields(log.Warn, log.Module, "alioth-stellar backfill services failed", ctx, backfillErr.Error()))
+		} else {
+			c.logger.Log(log.DefaultField().WithFields(log.Info, log.Module, "alioth-stellar backfill services success", ctx, missing))
+		}
+	}
+
+	return services, nil
+}
+
+// ImportInstance 导入服务实例，保留实例名称和创建时间
+//   - instance: 需要导入的实例
+//   - overwrite: 如果存在同名实例，是否覆盖
+//
+// 如果存在同名实例且不覆盖，则跳过并返回 imported = false
+func (c *cache) ImportInstance(ctx context.Context, instance model.InstanceDTO, overwrite bool) (imported bool, err errors.AliothError) {
+	instanceVersion := version.Version(instance.Version)
+	instanceKey := utils.BuildRedisKey(instance.Service, instanceVersion.Export())
+
+	// 检查是否存在同名实例
+	instanceStrings, getInstanceErr := c.client.SMembers(ctx, instanceKey).Result()
+	if getInstanceErr != nil {
+		c.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar import instance error", ctx, getInstanceErr.Error()))
+		return false, errors.NewExecuteSqlError("SMembers", getInstanceErr)
+	}
+	for _, instanceString := range instanceStrings {
+		var exist model.InstanceDTO
+		if unmarshalErr := json.Unmarshal([]byte(instanceString), &exist); unmarshalErr != nil || exist.Name != instance.Name {
+			continue
+		} else if !overwrite {
+			c.logger.Log(log.DefaultField().WithFields(log.Info, log.Module, "alioth-stellar import instance skipped", ctx, instance))
+			return false, nil
+		} else if removeErr := c.client.SRem(ctx, instanceKey, instanceString).Err(); removeErr != nil {
+			c.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar import instance error", ctx, removeErr.Error()))
+			return false, errors.NewExecuteSqlError("SRem", removeErr)
+		}
+	}
+
+	// 写入服务名称、服务版本和实例
+	if instance.CreatedAt.IsZero() {
+		instance.CreatedAt = time.Now()
+	}
+	if instance.UpdatedAt.IsZero() {
+		instance.UpdatedAt = time.Now()
+	}
+	pipe := c.client.TxPipeline()
+	pipe.SAdd(ctx, utils.BuildRedisKey("services"), instance.Service)
+	pipe.SAdd(ctx, utils.BuildRedisKey(instance.Service, "versions"), instanceVersion.Export())
+	pipe.SAdd(ctx, instanceKey, string(utils.JsonMarshal(instance)))
+	if _, execErr := pipe.Exec(ctx); execErr != nil {
+		c.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar import instance error", ctx, execErr.Error()))
+		return false, errors.NewExecuteSqlError("SAdd", execErr)
+	}
+
+	c.logger.Log(log.DefaultField().WithFields(log.Info, log.Module, "alioth-stellar import instance success", ctx, instance))
+	return true, nil
+}
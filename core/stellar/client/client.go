@@ -29,10 +29,14 @@ type Client interface {
 	//   - service: 服务名称
 	//   - handler: 服务处理器名称
 	Unmount(service string, handler string) (err error)
+
+	// Close 关闭客户端的连接，关闭后不能再调用其他方法
+	Close() (err error)
 }
 
 // client stellar 客户端，使用 rpc 协议
 type client struct {
+	cc   *grpc.ClientConn
 	conn alioth.AliothStellarClient
 }
 
@@ -82,6 +86,10 @@ func (c *client) Unmount(service string, handler string) (err error) {
 	}
 }
 
+func (c *client) Close() (err error) {
+	return c.cc.Close()
+}
+
 // NewClient 创建一个使用 rpc 协议的 stellar 客户端
 //   - serverAddr: stellar 服务的地址，需要包含IP和端口，如
 //
@@ -91,6 +99,6 @@ func NewClient(serverAddr string) (c Client, err error) {
 		return nil, fmt.Errorf("failed to dial grpc client: %w", dialErr)
 	} else {
 		clt := alioth.NewAliothStellarClient(conn)
-		return &client{conn: clt}, nil
+		return &client{cc: conn, conn: clt}, nil
 	}
 }
@@ -22,25 +22,35 @@ var defaultDao *dao = nil
 
 func init() {
 	if initialize.GlobalConfig().Stellar.Storage == "postgres" || initialize.GlobalConfig().Stellar.Storage == "" {
-		defaultDao = &dao{
-			db:    database.GetGormAccessor(uint64(0), model.InstanceDTO{}, model.InstancePO{}),
-			locks: map[string]*sync.RWMutex{},
-		}
+		defaultDao = newDao()
+	}
+}
 
-		if initialize.GlobalConfig().Stellar.Logger != "" {
-			defaultDao.logger = log.NewLogger(initialize.GlobalConfig().Stellar.Logger)
-		} else {
-			defaultDao.logger = log.DefaultLogger()
-		}
+func newDao() *dao {
+	d := &dao{
+		db:    database.GetGormAccessor(uint64(0), model.InstanceDTO{}, model.InstancePO{}),
+		locks: map[string]*sync.RWMutex{},
+	}
 
-		if err := database.RegisterSyncModels(model.InstancePO{}); err != nil {
-			defaultDao.logger.Log(log.DefaultField().WithLevel(log.Panic).WithCaller(log.Module).
-				WithMessage("failed to register sync models").WithExtra(err.Error()))
-		}
+	if initialize.GlobalConfig().Stellar.Logger != "" {
+		d.logger = log.NewLogger(initialize.GlobalConfig().Stellar.Logger)
+	} else {
+		d.logger = log.DefaultLogger()
+	}
+
+	if err := database.RegisterSyncModels(model.InstancePO{}); err != nil {
+		d.logger.Log(log.DefaultField().WithLevel(log.Panic).WithCaller(log.Module).
+			WithMessage("failed to register sync models").WithExtra(err.Error()))
 	}
+
+	return d
 }
 
+// defaultDAO 获取默认的 dao，如果当前存储后端不是 postgres，会在第一次调用时创建，用于迁移等场景
 func defaultDAO() *dao {
+	if defaultDao == nil {
+		defaultDao = newDao()
+	}
 	return defaultDao
 }
 
@@ -198,3 +208,67 @@ func (d *dao) ListInstances(ctx context.Context, pageLimit, offset int) (instanc
 		return queryResult, nil
 	}
 }
+
+// ExportInstances 导出所有服务实例
+func (d *dao) ExportInstances(ctx context.Context) (instances []model.InstanceDTO, err errors.AliothError) {
+	if instances, err = d.listInstances(ctx); err == nil {
+		d.logger.Log(log.DefaultField().WithFields(log.Info, log.Module, "alioth-stellar export instance success", ctx, len(instances)))
+	}
+	return instances, err
+}
+
+// listInstances 获取所有服务实例，只记录错误日志，用于定时统计实例数量
+func (d *dao) listInstances(ctx context.Context) (instances []model.InstanceDTO, err errors.AliothError) {
+	if queryResult, queryErr := d.db.CustomQueryList("version >= ?", version.AlphaVersion.FormatDatabase()); queryErr != nil {
+		if queryErr.Derive(gorm.ErrRecordNotFound) {
+			// 如果出现ErrRecordNotFound错误，说明一条记录都没有，直接返回空切片
+			return []model.InstanceDTO{}, nil
+		} else {
+			d.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar export instance error", ctx).
+				WithExtraField("error", queryErr.Error()))
+			return []model.InstanceDTO{}, queryErr
+		}
+	} else {
+		return queryResult, nil
+	}
+}
+
+// ImportInstance 导入服务实例，保留实例名称和创建时间
+//   - instance: 需要导入的实例
+//   - overwrite: 如果存在同名实例，是否覆盖
+//
+// 如果存在同名实例且不覆盖，则跳过并返回 imported = false
+func (d *dao) ImportInstance(ctx context.Context, instance model.InstanceDTO, overwrite bool) (imported bool, err errors.AliothError) {
+	// 如果没有锁，就创建一个
+	if d.locks[instance.Service] == nil {
+		d.locks[instance.Service] = &sync.RWMutex{}
+	}
+
+	// 导入期间不允许其他并发操作，因为可能导致实例编号不一致
+	d.locks[instance.Service].Lock()
+	defer d.locks[instance.Service].Unlock()
+
+	if _, queryErr := d.db.CustomQueryOne("name = ?", instance.Name); queryErr == nil {
+		if !overwrite {
+			d.logger.Log(log.DefaultField().WithFields(log.Info, log.Module, "alioth-stellar import instance skipped", ctx, instance))
+			return false, nil
+		} else if deleteErr := d.db.DeleteOneByCondition(model.InstanceDTO{Name: instance.Name}); deleteErr != nil {
+			d.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar import instance error", ctx).
+				WithExtraField("error", deleteErr.Error()).WithExtra(instance))
+			return false, deleteErr
+		}
+	} else if !queryErr.Derive(gorm.ErrRecordNotFound) {
+		d.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar import instance error", ctx).
+			WithExtraField("error", queryErr.Error()).WithExtra(instance))
+		return false, queryErr
+	}
+
+	if insertErr := d.db.InsertOne(instance); insertErr != nil {
+		d.logger.Log(log.DefaultField().WithFields(log.Error, log.Module, "alioth-stellar import instance error", ctx).
+			WithExtraField("error", insertErr.Error()).WithExtra(instance))
+		return false, insertErr
+	} else {
+		d.logger.Log(log.DefaultField().WithFields(log.Info, log.Module, "alioth-stellar import instance success", ctx, instance))
+		return true, nil
+	}
+}
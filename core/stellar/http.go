@@ -109,3 +109,40 @@ func (h HttpServer) ServiceList(ctx *gin.Context) {
 		})
 	}
 }
+
+func (h HttpServer) ServiceExport(ctx *gin.Context) {
+	if response, exportErr := defaultService.ServiceExport(ctx, &alioth.ServiceExportRequest{}); exportErr != nil {
+		ctx.JSON(500, gin.H{
+			"message": "internal error",
+			"error":   exportErr.Error(),
+		})
+	} else {
+		ctx.Data(200, "application/json", response.GetSnapshot())
+	}
+}
+
+func (h HttpServer) ServiceImport(ctx *gin.Context) {
+	request := alioth.ServiceImportRequest{Overwrite: ctx.Query("overwrite") == "true"}
+	if snapshot, readBodyErr := ctx.GetRawData(); readBodyErr != nil || len(snapshot) == 0 {
+		ctx.JSON(400, gin.H{
+			"message": "invalid request",
+			"error":   "invalid snapshot",
+		})
+		return
+	} else {
+		request.Snapshot = snapshot
+	}
+
+	if response, importErr := defaultService.ServiceImport(ctx, &request); importErr != nil {
+		ctx.JSON(500, gin.H{
+			"message": "internal error",
+			"error":   importErr.Error(),
+			"data":    response,
+		})
+	} else {
+		ctx.JSON(200, gin.H{
+			"message": "success",
+			"data":    response,
+		})
+	}
+}
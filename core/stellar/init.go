@@ -18,3 +18,11 @@ func InitStellarHttpServer(group *gin.RouterGroup) {
 	group.DELETE("/stellar/unmount/:service/:handler", server.ServiceUnmount)
 	group.GET("/stellar/list", server.ServiceList)
 }
+
+// InitStellarAdminHttpServer 注册导出和导入服务实例的接口，这些接口可以读取和覆盖所有服务实例，只能注册在管理接口的路由组上
+//   - group: 管理接口的路由组，需要已经使用了管理接口的认证中间件
+func InitStellarAdminHttpServer(group *gin.RouterGroup) {
+	server := HttpServer{}
+	group.GET("/stellar/export", server.ServiceExport)
+	group.POST("/stellar/import", server.ServiceImport)
+}
@@ -0,0 +1,206 @@
+package stellar
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/lifecycle"
+	"studio.sunist.work/platform/alioth-center/infrastructure/metrics"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils/version"
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+const (
+	instanceCollectTimeout = time.Second * 5
+	instanceProbeTimeout   = time.Millisecond * 500
+	instanceProbeInterval  = time.Second * 30
+)
+
+var (
+	requestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "alioth",
+		Subsystem: "stellar",
+		Name:      "requests_total",
+		Help:      "Total number of stellar requests by operation, backend and result.",
+	}, []string{"operation", "backend", "result"})
+	requestLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "alioth",
+		Subsystem: "stellar",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of stellar requests by operation and backend.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "backend"})
+	discoveryMissCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "alioth",
+		Subsystem: "stellar",
+		Name:      "discovery_miss_total",
+		Help:      "Total number of discovery requests that found no available instance.",
+	}, []string{"backend"})
+	// stellar 没有心跳，实例异常退出后注册信息会一直保留，health 标签用于区分这些已经无法连通的实例，
+	// 它只有 healthy 和 unhealthy 两个取值，不会增加过多的时间序列
+	instanceDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("alioth", "stellar", "instances"),
+		"Number of registered instances by service, version and health, health is whether the instance accepted a tcp connection in the last probe.",
+		[]string{"service", "version", "health"}, nil,
+	)
+
+	defaultInstanceCollector = &instanceCollector{stop: make(chan struct{})}
+)
+
+func init() {
+	metrics.MustRegister(requestCounter, requestLatency, discoveryMissCounter, defaultInstanceCollector)
+	lifecycle.Append(lifecycle.Hook{Name: "stellar instance collector", OnStop: defaultInstanceCollector.close})
+}
+
+// instanceCollector 定时统计所有服务实例，并探测实例地址是否可以连通，采集时只返回最近一次统计的结果，
+// 避免每次采集都查询存储后端并连接所有的实例，第一次采集时开始定时统计
+type instanceCollector struct {
+	lister    func(ctx context.Context) ([]model.InstanceDTO, errors.AliothError)
+	mtx       sync.RWMutex
+	counts    map[[3]string]int
+	startOnce sync.Once
+	closeOnce sync.Once
+	stop      chan struct{}
+}
+
+func (c *instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- instanceDesc
+}
+
+func (c *instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.lister == nil {
+		return
+	}
+	c.startOnce.Do(func() { go c.serve(instanceProbeInterval) })
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	for labels, count := range c.counts {
+		ch <- prometheus.MustNewConstMetric(instanceDesc, prometheus.GaugeValue, float64(count), labels[0], labels[1], labels[2])
+	}
+}
+
+// close 停止定时统计，可以重复调用
+func (c *instanceCollector) close(_ context.Context) error {
+	c.closeOnce.Do(func() { close(c.stop) })
+	return nil
+}
+
+// serve 立即统计一次，之后按照间隔定时统计，直到调用 close
+//   - interval: 统计的间隔
+func (c *instanceCollector) serve(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.refresh()
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh 统计所有服务实例并探测健康状态，获取实例失败时保留上一次的结果
+func (c *instanceCollector) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), instanceCollectTimeout)
+	defer cancel()
+	instances, listErr := c.lister(ctx)
+	if listErr != nil {
+		return
+	}
+
+	// 并发探测实例的健康状态
+	healthy := make([]bool, len(instances))
+	wg := sync.WaitGroup{}
+	for i, instance := range instances {
+		wg.Add(1)
+		go func(index int, address string) {
+			defer wg.Done()
+			healthy[index] = probeInstance(address)
+		}(i, instance.Address)
+	}
+	wg.Wait()
+
+	// 按照服务、版本和健康状态统计实例数量
+	counts := map[[3]string]int{}
+	for i, instance := range instances {
+		health := "healthy"
+		if !healthy[i] {
+			health = "unhealthy"
+		}
+		counts[[3]string{instance.Service, version.Version(instance.Version).Export(), health}]++
+	}
+
+	c.mtx.Lock()
+	c.counts = counts
+	c.mtx.Unlock()
+}
+
+// probeInstance 探测实例地址是否可以建立 tcp 连接
+func probeInstance(address string) (healthy bool) {
+	if conn, dialErr := net.DialTimeout("tcp", address, instanceProbeTimeout); dialErr != nil {
+		return false
+	} else {
+		_ = conn.Close()
+		return true
+	}
+}
+
+// metricsService 记录请求数量和延迟的服务装饰器
+type metricsService struct {
+	next    Service
+	backend string
+}
+
+func newMetricsService(next Service, backend string) *metricsService {
+	if backend == "" {
+		backend = "postgres"
+	}
+	return &metricsService{next: next, backend: backend}
+}
+
+func (m *metricsService) observe(operation string, startAt time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	requestCounter.WithLabelValues(operation, m.backend, result).Inc()
+	requestLatency.WithLabelValues(operation, m.backend).Observe(time.Since(startAt).Seconds())
+}
+
+func (m *metricsService) ServiceRegistration(ctx context.Context, request *alioth.ServiceRegistrationRequest, ip string) (response *alioth.ServiceRegistrationResponse, err error) {
+	defer func(startAt time.Time) { m.observe("registration", startAt, err) }(time.Now())
+	return m.next.ServiceRegistration(ctx, request, ip)
+}
+
+func (m *metricsService) ServiceDiscovery(ctx context.Context, request *alioth.ServiceDiscoveryRequest) (response *alioth.ServiceDiscoveryResponse, err error) {
+	defer func(startAt time.Time) { m.observe("discovery", startAt, err) }(time.Now())
+	return m.next.ServiceDiscovery(ctx, request)
+}
+
+func (m *metricsService) ServiceUnmount(ctx context.Context, request *alioth.ServiceUnmountRequest) (response *alioth.ServiceUnmountResponse, err error) {
+	defer func(startAt time.Time) { m.observe("unmount", startAt, err) }(time.Now())
+	return m.next.ServiceUnmount(ctx, request)
+}
+
+func (m *metricsService) ServiceList(ctx context.Context, request *alioth.ServiceListRequest) (response *alioth.ServiceListResponse, err error) {
+	defer func(startAt time.Time) { m.observe("list", startAt, err) }(time.Now())
+	return m.next.ServiceList(ctx, request)
+}
+
+func (m *metricsService) ServiceExport(ctx context.Context, request *alioth.ServiceExportRequest) (response *alioth.ServiceExportResponse, err error) {
+	defer func(startAt time.Time) { m.observe("export", startAt, err) }(time.Now())
+	return m.next.ServiceExport(ctx, request)
+}
+
+func (m *metricsService) ServiceImport(ctx context.Context, request *alioth.ServiceImportRequest) (response *alioth.ServiceImportResponse, err error) {
+	defer func(startAt time.Time) { m.observe("import", startAt, err) }(time.Now())
+	return m.next.ServiceImport(ctx, request)
+}
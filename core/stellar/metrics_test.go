@@ -0,0 +1,82 @@
+package stellar
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils/version"
+)
+
+const instanceMetricHeader = `# HELP alioth_stellar_instances Number of registered instances by service, version and health, health is whether the instance accepted a tcp connection in the last probe.
+# TYPE alioth_stellar_instances gauge
+`
+
+// newTestCollector 创建不会启动定时统计的实例统计对象，测试中手动调用 refresh
+//   - lister: 获取所有服务实例的函数
+func newTestCollector(lister func(ctx context.Context) ([]model.InstanceDTO, errors.AliothError)) *instanceCollector {
+	c := &instanceCollector{lister: lister, stop: make(chan struct{})}
+	c.startOnce.Do(func() {})
+	return c
+}
+
+func TestInstanceCollector(t *testing.T) {
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("listen: %v", listenErr)
+	}
+	defer func() { _ = listener.Close() }()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	unreachable := closed.Addr().String()
+	_ = closed.Close()
+
+	v1, v2 := version.NewVersion(1, 0, 0, 0), version.NewVersion(2, 0, 0, 0)
+	instances := []model.InstanceDTO{
+		{Name: "order-1", Service: "order", Address: listener.Addr().String(), Version: v1.FormatDatabase()},
+		{Name: "order-2", Service: "order", Address: listener.Addr().String(), Version: v1.FormatDatabase()},
+		{Name: "order-3", Service: "order", Address: unreachable, Version: v1.FormatDatabase()},
+		{Name: "user-1", Service: "user", Address: unreachable, Version: v2.FormatDatabase()},
+	}
+	var listErr errors.AliothError
+	c := newTestCollector(func(ctx context.Context) ([]model.InstanceDTO, errors.AliothError) {
+		if listErr != nil {
+			return nil, listErr
+		}
+		return instances, nil
+	})
+
+	expected := instanceMetricHeader + fmt.Sprintf(`alioth_stellar_instances{health="healthy",service="order",version=%q} 2
+alioth_stellar_instances{health="unhealthy",service="order",version=%q} 1
+alioth_stellar_instances{health="unhealthy",service="user",version=%q} 1
+`, v1.Export(), v1.Export(), v2.Export())
+	c.refresh()
+	if compareErr := testutil.CollectAndCompare(c, strings.NewReader(expected), "alioth_stellar_instances"); compareErr != nil {
+		t.Error(compareErr)
+	}
+
+	// 获取实例失败时保留上一次的统计结果
+	listErr = errors.NewExecuteSqlError("Find", fmt.Errorf("connection refused"))
+	c.refresh()
+	if compareErr := testutil.CollectAndCompare(c, strings.NewReader(expected), "alioth_stellar_instances"); compareErr != nil {
+		t.Errorf("counts changed after a failed refresh: %v", compareErr)
+	}
+}
+
+func TestInstanceCollectorWithoutLister(t *testing.T) {
+	c := &instanceCollector{stop: make(chan struct{})}
+	if count := testutil.CollectAndCount(c, "alioth_stellar_instances"); count != 0 {
+		t.Errorf("collected %d metrics without a lister, want 0", count)
+	}
+	if closeErr := c.close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+	if closeErr := c.close(context.Background()); closeErr != nil {
+		t.Errorf("closing twice returned %v", closeErr)
+	}
+}
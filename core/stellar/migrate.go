@@ -0,0 +1,68 @@
+package stellar
+
+import (
+	"context"
+	"fmt"
+
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+// Export 从指定的存储后端导出 json 格式的注册表快照
+//   - storage: 存储后端，支持 postgres 和 redis
+func Export(ctx context.Context, storage string) (snapshot []byte, err error) {
+	service, newServiceErr := newService(storage)
+	if newServiceErr != nil {
+		return nil, newServiceErr
+	}
+
+	if response, exportErr := service.ServiceExport(ctx, &alioth.ServiceExportRequest{}); exportErr != nil {
+		return nil, exportErr
+	} else {
+		return response.GetSnapshot(), nil
+	}
+}
+
+// Import 将 json 格式的注册表快照导入到指定的存储后端
+//   - storage: 存储后端，支持 postgres 和 redis
+//   - snapshot: json 格式的注册表快照
+//   - overwrite: 如果存在同名实例，是否覆盖
+func Import(ctx context.Context, storage string, snapshot []byte, overwrite bool) (result *alioth.ServiceImportResponse, err error) {
+	service, newServiceErr := newService(storage)
+	if newServiceErr != nil {
+		return nil, newServiceErr
+	}
+
+	return service.ServiceImport(ctx, &alioth.ServiceImportRequest{
+		Snapshot:  snapshot,
+		Overwrite: overwrite,
+	})
+}
+
+// Migrate 将注册表从一个存储后端迁移到另一个存储后端，不会删除源存储后端中的数据
+//   - from: 源存储后端
+//   - to: 目标存储后端
+//   - overwrite: 如果目标存储后端存在同名实例，是否覆盖
+func Migrate(ctx context.Context, from, to string, overwrite bool) (result *alioth.ServiceImportResponse, err error) {
+	if from == to {
+		return nil, fmt.Errorf("source and target stellar storage are the same: %s", from)
+	}
+
+	if snapshot, exportErr := Export(ctx, from); exportErr != nil {
+		return nil, fmt.Errorf("failed to export from %s: %w", from, exportErr)
+	} else if result, importErr := Import(ctx, to, snapshot, overwrite); importErr != nil {
+		return result, fmt.Errorf("failed to import to %s: %w", to, importErr)
+	} else {
+		return result, nil
+	}
+}
+
+// PrepareStorage 提前初始化存储后端，postgres 需要在同步数据库前注册数据模型
+//   - storages: 需要初始化的存储后端
+func PrepareStorage(storages ...string) (err error) {
+	for _, storage := range storages {
+		if _, newServiceErr := newService(storage); newServiceErr != nil {
+			return newServiceErr
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package stellar
 import (
 	"context"
 
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize"
 	"studio.sunist.work/platform/alioth-center/infrastructure/utils"
 	"studio.sunist.work/platform/alioth-center/proto/alioth"
 )
@@ -30,3 +31,19 @@ func (r RpcServer) ServiceUnmount(ctx context.Context, request *alioth.ServiceUn
 func (r RpcServer) ServiceList(ctx context.Context, request *alioth.ServiceListRequest) (*alioth.ServiceListResponse, error) {
 	return defaultService.ServiceList(ctx, request)
 }
+
+// ServiceExport 导出所有服务实例，与 http 的导出接口一样只允许携带管理接口令牌的请求调用
+func (r RpcServer) ServiceExport(ctx context.Context, request *alioth.ServiceExportRequest) (*alioth.ServiceExportResponse, error) {
+	if authErr := utils.CheckAdminToken(ctx, initialize.GlobalConfig().Http.AdminToken); authErr != nil {
+		return nil, authErr
+	}
+	return defaultService.ServiceExport(ctx, request)
+}
+
+// ServiceImport 导入服务实例，可以覆盖已有的实例，与 http 的导入接口一样只允许携带管理接口令牌的请求调用
+func (r RpcServer) ServiceImport(ctx context.Context, request *alioth.ServiceImportRequest) (*alioth.ServiceImportResponse, error) {
+	if authErr := utils.CheckAdminToken(ctx, initialize.GlobalConfig().Http.AdminToken); authErr != nil {
+		return nil, authErr
+	}
+	return defaultService.ServiceImport(ctx, request)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 
+	"studio.sunist.work/platform/alioth-center/core/model"
 	"studio.sunist.work/platform/alioth-center/infrastructure/global"
 	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
 	"studio.sunist.work/platform/alioth-center/infrastructure/initialize"
@@ -15,14 +16,39 @@ import (
 var defaultService Service
 
 func init() {
-	if initialize.GlobalConfig().Stellar.Storage == "redis" {
-		defaultService = &redisBasedService{
-			redis: defaultCache(),
-		}
+	// 只有明确配置为 redis 时使用 redis，其他取值与之前一样回退到 postgres，避免配置错误导致无法启动
+	storage := initialize.GlobalConfig().Stellar.Storage
+	if storage != "redis" {
+		storage = "postgres"
+	}
+	if service, newServiceErr := newService(storage); newServiceErr != nil {
+		panic(newServiceErr)
 	} else {
-		defaultService = &postgresBasedService{
+		defaultService = newMetricsService(service, storage)
+	}
+
+	// 注册实例数量指标的数据来源
+	if storage == "redis" {
+		defaultInstanceCollector.lister = defaultCache().listInstances
+	} else {
+		defaultInstanceCollector.lister = defaultDAO().listInstances
+	}
+}
+
+// newService 根据存储后端创建服务
+//   - storage: 存储后端，支持 postgres 和 redis，为空时使用 postgres
+func newService(storage string) (service Service, err error) {
+	switch storage {
+	case "postgres", "":
+		return &postgresBasedService{
 			dao: defaultDAO(),
-		}
+		}, nil
+	case "redis":
+		return &redisBasedService{
+			redis: defaultCache(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported stellar storage: %s", storage)
 	}
 }
 
@@ -31,6 +57,35 @@ type Service interface {
 	ServiceDiscovery(ctx context.Context, request *alioth.ServiceDiscoveryRequest) (*alioth.ServiceDiscoveryResponse, error)
 	ServiceUnmount(ctx context.Context, request *alioth.ServiceUnmountRequest) (*alioth.ServiceUnmountResponse, error)
 	ServiceList(ctx context.Context, request *alioth.ServiceListRequest) (*alioth.ServiceListResponse, error)
+	ServiceExport(ctx context.Context, request *alioth.ServiceExportRequest) (*alioth.ServiceExportResponse, error)
+	ServiceImport(ctx context.Context, request *alioth.ServiceImportRequest) (*alioth.ServiceImportResponse, error)
+}
+
+// instanceImporter 导入服务实例的存储后端
+type instanceImporter interface {
+	ImportInstance(ctx context.Context, instance model.InstanceDTO, overwrite bool) (imported bool, err errors.AliothError)
+}
+
+// importSnapshot 解码快照并逐个导入服务实例，存在同名实例且不覆盖时跳过，导入失败时返回已经统计的结果
+//   - importer: 导入服务实例的存储后端
+//   - request: 导入请求
+func importSnapshot(ctx context.Context, importer instanceImporter, request *alioth.ServiceImportRequest) (*alioth.ServiceImportResponse, error) {
+	instances, decodeErr := decodeSnapshot(request.GetSnapshot())
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	response := &alioth.ServiceImportResponse{Total: int32(len(instances))}
+	for _, instance := range instances {
+		if imported, importErr := importer.ImportInstance(ctx, instance, request.GetOverwrite()); importErr != nil {
+			return response, fmt.Errorf("failed to import instance %s: %w", instance.Name, importErr)
+		} else if imported {
+			response.Imported++
+		} else {
+			response.Skipped++
+		}
+	}
+	return response, nil
 }
 
 type postgresBasedService struct {
@@ -65,6 +120,7 @@ func (s *postgresBasedService) ServiceDiscovery(ctx context.Context, request *al
 		return nil, fmt.Errorf("failed to find instance: %w", getInstancesErr)
 	} else if len(instances) == 0 {
 		// 如果没有找到实例，返回空
+		discoveryMissCounter.WithLabelValues("postgres").Inc()
 		return nil, errors.NewNoAvailableInstanceError(request.GetService(), request.GetMinVersion())
 	} else {
 		// 使用随机负载均衡
@@ -115,6 +171,23 @@ func (s *postgresBasedService) ServiceList(ctx context.Context, request *alioth.
 	}
 }
 
+func (s *postgresBasedService) ServiceExport(ctx context.Context, _ *alioth.ServiceExportRequest) (*alioth.ServiceExportResponse, error) {
+	if instances, exportErr := s.dao.ExportInstances(ctx); exportErr != nil {
+		return nil, fmt.Errorf("failed to export instance: %w", exportErr)
+	} else if snapshot, encodeErr := encodeSnapshot("postgres", instances); encodeErr != nil {
+		return nil, encodeErr
+	} else {
+		return &alioth.ServiceExportResponse{
+			Total:    int32(len(instances)),
+			Snapshot: snapshot,
+		}, nil
+	}
+}
+
+func (s *postgresBasedService) ServiceImport(ctx context.Context, request *alioth.ServiceImportRequest) (*alioth.ServiceImportResponse, error) {
+	return importSnapshot(ctx, s.dao, request)
+}
+
 type redisBasedService struct {
 	redis *cache
 }
@@ -138,3 +211,20 @@ func (r *redisBasedService) ServiceList(ctx context.Context, request *alioth.Ser
 	// TODO implement me
 	panic("implement me")
 }
+
+func (r *redisBasedService) ServiceExport(ctx context.Context, _ *alioth.ServiceExportRequest) (*alioth.ServiceExportResponse, error) {
+	if instances, exportErr := r.redis.ExportInstances(ctx); exportErr != nil {
+		return nil, fmt.Errorf("failed to export instance: %w", exportErr)
+	} else if snapshot, encodeErr := encodeSnapshot("redis", instances); encodeErr != nil {
+		return nil, encodeErr
+	} else {
+		return &alioth.ServiceExportResponse{
+			Total:    int32(len(instances)),
+			Snapshot: snapshot,
+		}, nil
+	}
+}
+
+func (r *redisBasedService) ServiceImport(ctx context.Context, request *alioth.ServiceImportRequest) (*alioth.ServiceImportResponse, error) {
+	return importSnapshot(ctx, r.redis, request)
+}
@@ -0,0 +1,93 @@
+package stellar
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils/version"
+)
+
+// snapshotVersion 当前快照格式的版本，格式发生不兼容变化时需要递增
+const snapshotVersion = 1
+
+// Snapshot 服务注册表快照，用于导出、导入以及在不同存储后端之间迁移
+type Snapshot struct {
+	Version    int                `json:"version"`
+	Storage    string             `json:"storage"`
+	ExportedAt string             `json:"exported_at"`
+	Instances  []SnapshotInstance `json:"instances"`
+}
+
+// SnapshotInstance 快照中的服务实例
+type SnapshotInstance struct {
+	Name      string `json:"name"`
+	Service   string `json:"service"`
+	Address   string `json:"address"`
+	Version   string `json:"version"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// encodeSnapshot 将服务实例编码为 json 格式的快照
+//   - storage: 导出快照的存储后端
+//   - instances: 服务实例
+func encodeSnapshot(storage string, instances []model.InstanceDTO) (snapshot []byte, err error) {
+	content := Snapshot{
+		Version:    snapshotVersion,
+		Storage:    storage,
+		ExportedAt: time.Now().Format(global.AliothTimeFormat),
+		Instances:  make([]SnapshotInstance, len(instances)),
+	}
+	for i, instance := range instances {
+		content.Instances[i] = SnapshotInstance{
+			Name:      instance.Name,
+			Service:   instance.Service,
+			Address:   instance.Address,
+			Version:   version.Version(instance.Version).Export(),
+			CreatedAt: instance.CreatedAt.Format(global.AliothTimeFormat),
+			UpdatedAt: instance.UpdatedAt.Format(global.AliothTimeFormat),
+		}
+	}
+
+	if snapshot, err = json.Marshal(content); err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// decodeSnapshot 将 json 格式的快照解码为服务实例，不支持比当前版本更新的快照
+//   - snapshot: json 格式的快照
+func decodeSnapshot(snapshot []byte) (instances []model.InstanceDTO, err error) {
+	var content Snapshot
+	if unmarshalErr := json.Unmarshal(snapshot, &content); unmarshalErr != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot: %w", unmarshalErr)
+	} else if content.Version <= 0 || content.Version > snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %d", content.Version)
+	}
+
+	instances = make([]model.InstanceDTO, len(content.Instances))
+	for i, instance := range content.Instances {
+		instanceVersion, getVersionErr := version.NewVersionFromExport(instance.Version)
+		if getVersionErr != nil {
+			return nil, fmt.Errorf("failed to get version of instance %s: %w", instance.Name, getVersionErr)
+		}
+
+		instances[i] = model.InstanceDTO{
+			Name:    instance.Name,
+			Service: instance.Service,
+			Address: instance.Address,
+			Version: instanceVersion.FormatDatabase(),
+		}
+		if createdAt, parseErr := time.Parse(global.AliothTimeFormat, instance.CreatedAt); parseErr == nil {
+			instances[i].CreatedAt = createdAt
+		}
+		if updatedAt, parseErr := time.Parse(global.AliothTimeFormat, instance.UpdatedAt); parseErr == nil {
+			instances[i].UpdatedAt = updatedAt
+		}
+	}
+
+	return instances, nil
+}
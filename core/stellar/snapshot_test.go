@@ -0,0 +1,149 @@
+package stellar
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/core/model"
+	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
+	"studio.sunist.work/platform/alioth-center/infrastructure/utils/version"
+	"studio.sunist.work/platform/alioth-center/proto/alioth"
+)
+
+// testInstances 导出和导入测试使用的服务实例
+func testInstances() []model.InstanceDTO {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []model.InstanceDTO{
+		{
+			Name:      "order-1",
+			Service:   "order",
+			Address:   "10.0.0.1:8080",
+			Version:   version.NewVersion(1, 2, 3, 0).FormatDatabase(),
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt.Add(time.Hour),
+		},
+		{
+			Name:      "user-1",
+			Service:   "user",
+			Address:   "10.0.0.2:8080",
+			Version:   version.NewVersion(2, 0, 0, 0).FormatDatabase(),
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		},
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	instances := testInstances()
+	snapshot, encodeErr := encodeSnapshot("postgres", instances)
+	if encodeErr != nil {
+		t.Fatalf("encode: %v", encodeErr)
+	}
+
+	var content Snapshot
+	if unmarshalErr := json.Unmarshal(snapshot, &content); unmarshalErr != nil {
+		t.Fatalf("unmarshal: %v", unmarshalErr)
+	} else if content.Version != snapshotVersion || content.Storage != "postgres" || len(content.Instances) != len(instances) {
+		t.Fatalf("snapshot has version %d, storage %s and %d instances", content.Version, content.Storage, len(content.Instances))
+	}
+
+	decoded, decodeErr := decodeSnapshot(snapshot)
+	if decodeErr != nil {
+		t.Fatalf("decode: %v", decodeErr)
+	}
+	if len(decoded) != len(instances) {
+		t.Fatalf("decoded %d instances, want %d", len(decoded), len(instances))
+	}
+	for i, instance := range instances {
+		got := decoded[i]
+		if got.Name != instance.Name || got.Service != instance.Service || got.Address != instance.Address || got.Version != instance.Version {
+			t.Errorf("instance %d decoded as %+v, want %+v", i, got, instance)
+		}
+		if !got.CreatedAt.Equal(instance.CreatedAt) || !got.UpdatedAt.Equal(instance.UpdatedAt) {
+			t.Errorf("instance %d decoded with times %v and %v, want %v and %v", i, got.CreatedAt, got.UpdatedAt, instance.CreatedAt, instance.UpdatedAt)
+		}
+	}
+}
+
+func TestDecodeSnapshotRejects(t *testing.T) {
+	cases := []struct {
+		name     string
+		snapshot string
+	}{
+		{name: "invalid json", snapshot: "{"},
+		{name: "missing version", snapshot: `{"instances":[]}`},
+		{name: "newer version", snapshot: `{"version":2,"instances":[]}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, decodeErr := decodeSnapshot([]byte(c.snapshot)); decodeErr == nil {
+				t.Errorf("decodeSnapshot(%s) should fail", c.snapshot)
+			}
+		})
+	}
+}
+
+// memoryImporter 按照实例名称保存导入的实例，行为与存储后端的 ImportInstance 相同
+type memoryImporter struct {
+	instances map[string]model.InstanceDTO
+}
+
+func (m *memoryImporter) ImportInstance(_ context.Context, instance model.InstanceDTO, overwrite bool) (bool, errors.AliothError) {
+	if _, exist := m.instances[instance.Name]; exist && !overwrite {
+		return false, nil
+	}
+	m.instances[instance.Name] = instance
+	return true, nil
+}
+
+func TestImportSnapshotOverwrite(t *testing.T) {
+	instances := testInstances()
+	snapshot, encodeErr := encodeSnapshot("redis", instances)
+	if encodeErr != nil {
+		t.Fatalf("encode: %v", encodeErr)
+	}
+
+	cases := []struct {
+		name      string
+		overwrite bool
+		imported  int32
+		skipped   int32
+		address   string
+	}{
+		{name: "existing instance skipped", overwrite: false, imported: 1, skipped: 1, address: "10.0.0.9:8080"},
+		{name: "existing instance overwritten", overwrite: true, imported: 2, skipped: 0, address: instances[0].Address},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			importer := &memoryImporter{instances: map[string]model.InstanceDTO{
+				"order-1": {Name: "order-1", Service: "order", Address: "10.0.0.9:8080"},
+			}}
+			response, importErr := importSnapshot(context.Background(), importer, &alioth.ServiceImportRequest{Snapshot: snapshot, Overwrite: c.overwrite})
+			if importErr != nil {
+				t.Fatalf("import: %v", importErr)
+			}
+			if response.Total != 2 || response.Imported != c.imported || response.Skipped != c.skipped {
+				t.Errorf("imported %d and skipped %d of %d instances, want %d and %d of 2", response.Imported, response.Skipped, response.Total, c.imported, c.skipped)
+			}
+			if address := importer.instances["order-1"].Address; address != c.address {
+				t.Errorf("existing instance has address %s, want %s", address, c.address)
+			}
+			if _, exist := importer.instances["user-1"]; !exist {
+				t.Error("the new instance should be imported")
+			}
+		})
+	}
+}
+
+func TestImportSnapshotInvalid(t *testing.T) {
+	importer := &memoryImporter{instances: map[string]model.InstanceDTO{}}
+	if _, importErr := importSnapshot(context.Background(), importer, &alioth.ServiceImportRequest{Snapshot: []byte("{")}); importErr == nil {
+		t.Error("importing an invalid snapshot should fail")
+	} else if len(importer.instances) != 0 {
+		t.Errorf("imported %d instances from an invalid snapshot", len(importer.instances))
+	}
+}
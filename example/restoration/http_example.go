@@ -17,8 +17,10 @@ type HttpExampleStruct struct {
 }
 
 func main() {
-	// 添加一个外部收集器
-	collector, err := restoration.NewExternalCollector("http-example", "http://127.0.0.1:50050/external")
+	// 添加一个外部收集器，使用配置文件中 restoration.auth.tokens 的令牌认证，服务端会使用令牌对应的服务名称
+	options := restoration.DefaultCollectorOptions()
+	options.Credentials = restoration.Credentials{Token: "your_ingestion_token"}
+	collector, err := restoration.NewExternalCollectorWithOptions("http-example", "http://127.0.0.1:50050/external", options)
 	if err != nil {
 		panic(err)
 	}
@@ -44,7 +46,12 @@ func main() {
 	collector.Warn(restoration.NewCollection(ctx, "hello, world").WithProcessing(exampleStructure))
 	collector.Error(restoration.NewCollection(ctx, "hello, world").WithExtra(exampleStructure))
 
-	time.Sleep(time.Second)
+	// 退出前发送缓冲区中剩余的日志
+	closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if closeErr := collector.Close(closeCtx); closeErr != nil {
+		panic(closeErr)
+	}
 }
 
 // 打印结果：
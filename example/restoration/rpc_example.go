@@ -62,8 +62,15 @@ func main() {
 	collector.Info(restoration.NewCollection(ctx, "hello, world").WithParams(exampleStructure))
 	collector.Warn(restoration.NewCollection(ctx, "hello, world").WithProcessing(exampleStructure))
 	collector.Error(restoration.NewCollection(ctx, "hello, world").WithExtra(exampleStructure))
+	collector.Error(restoration.NewCollection(ctx, "request failed").WithField("order_id", 42).
+		WithError(fmt.Errorf("upstream timeout")).WithDuration(1500*time.Millisecond).WithUser("example-user"))
 
-	time.Sleep(time.Second)
+	// 退出前发送缓冲区中剩余的日志
+	closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if closeErr := collector.Close(closeCtx); closeErr != nil {
+		panic(closeErr)
+	}
 }
 
 // 打印结果：
@@ -1,9 +1,11 @@
 package stellar
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	stellar "studio.sunist.work/platform/alioth-center/core/stellar/client"
-	"studio.sunist.work/platform/alioth-center/infrastructure/utils/exit"
+	"studio.sunist.work/platform/alioth-center/infrastructure/lifecycle"
 	"studio.sunist.work/platform/alioth-center/infrastructure/utils/version"
 )
 
@@ -15,6 +17,7 @@ func main() {
 
 	_, handlerName, registerErr := client.Register("alioth-example", version.AlphaVersion, 50052)
 	if registerErr != nil {
+		_ = client.Close()
 		panic(registerErr)
 	}
 
@@ -24,13 +27,12 @@ func main() {
 	// removeInstance("alioth-example", handlerName, client)
 }
 
-// 退出时卸载服务
+// 退出时卸载服务，需要在服务依赖的 grpc 服务器之后添加，停止时会先于 grpc 服务器执行
 func removeInstance(serviceName, handlerName string, client stellar.Client) {
-	exit.AddExitFunctions(func() error {
-		err := client.Unmount(serviceName, handlerName)
-		if err != nil {
-			return err
-		}
-		return nil
+	lifecycle.Append(lifecycle.Hook{
+		Name: "stellar registration",
+		OnStop: func(ctx context.Context) error {
+			return errors.Join(client.Unmount(serviceName, handlerName), client.Close())
+		},
 	})
 }
@@ -16,3 +16,132 @@ func NewRestorationExternalResponseError(code int) AliothError {
 		code: code,
 	}
 }
+
+type RestorationStorageDisabledError struct {
+	basicAliothError
+}
+
+func (e *RestorationStorageDisabledError) Error() string {
+	return "restoration storage is disabled"
+}
+
+func NewRestorationStorageDisabledError() AliothError {
+	return &RestorationStorageDisabledError{}
+}
+
+type InvalidRestorationQueryError struct {
+	basicAliothError
+	field string
+	value string
+}
+
+func (e *InvalidRestorationQueryError) Error() string {
+	return fmt.Sprintf("invalid restoration query %s: %s", e.field, e.value)
+}
+
+func NewInvalidRestorationQueryError(field, value string) AliothError {
+	return &InvalidRestorationQueryError{
+		field: field,
+		value: value,
+	}
+}
+
+type RestorationAlertDisabledError struct {
+	basicAliothError
+}
+
+func (e *RestorationAlertDisabledError) Error() string {
+	return "restoration alert is disabled"
+}
+
+func NewRestorationAlertDisabledError() AliothError {
+	return &RestorationAlertDisabledError{}
+}
+
+type RestorationAlertNotReloadableError struct {
+	basicAliothError
+}
+
+func (e *RestorationAlertNotReloadableError) Error() string {
+	return "restoration alert rules are not loaded from a rules file"
+}
+
+func NewRestorationAlertNotReloadableError() AliothError {
+	return &RestorationAlertNotReloadableError{}
+}
+
+type RestorationRateLimitedError struct {
+	basicAliothError
+	limit string
+	key   string
+}
+
+func (e *RestorationRateLimitedError) Error() string {
+	return fmt.Sprintf("restoration ingestion rate limited by %s: %s", e.limit, e.key)
+}
+
+func NewRestorationRateLimitedError(limit, key string) AliothError {
+	return &RestorationRateLimitedError{
+		limit: limit,
+		key:   key,
+	}
+}
+
+type RestorationUnauthenticatedError struct {
+	basicAliothError
+	reason string
+}
+
+func (e *RestorationUnauthenticatedError) Error() string {
+	return fmt.Sprintf("restoration unauthenticated: %s", e.reason)
+}
+
+func NewRestorationUnauthenticatedError(reason string) AliothError {
+	return &RestorationUnauthenticatedError{
+		reason: reason,
+	}
+}
+
+type InvalidRestorationSamplingError struct {
+	basicAliothError
+	field string
+	value string
+}
+
+func (e *InvalidRestorationSamplingError) Error() string {
+	return fmt.Sprintf("invalid restoration sampling %s: %s", e.field, e.value)
+}
+
+func NewInvalidRestorationSamplingError(field, value string) AliothError {
+	return &InvalidRestorationSamplingError{
+		field: field,
+		value: value,
+	}
+}
+
+type RestorationIssueNotFoundError struct {
+	basicAliothError
+	fingerprint string
+}
+
+func (e *RestorationIssueNotFoundError) Error() string {
+	return fmt.Sprintf("restoration issue not found: %s", e.fingerprint)
+}
+
+func NewRestorationIssueNotFoundError(fingerprint string) AliothError {
+	return &RestorationIssueNotFoundError{
+		fingerprint: fingerprint,
+	}
+}
+
+type RestorationMetricsDisabledError struct {
+	basicAliothError
+}
+
+func (e *RestorationMetricsDisabledError) Error() string {
+	return "restoration metrics is disabled"
+}
+
+func NewRestorationMetricsDisabledError() AliothError {
+	return &RestorationMetricsDisabledError{}
+}
@@ -0,0 +1,88 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const defaultBufferSize = 100
+
+// Buffer 日志对象的缓冲区，零值表示使用默认的大小和溢出策略
+type Buffer struct {
+	Size     int            // 缓冲区可以容纳的日志条数，不大于 0 时为 100
+	Overflow OverflowPolicy // 缓冲区已满时的策略，block 阻塞调用方直到有空间，drop 丢弃新的日志并计数，默认为 block
+}
+
+var (
+	bufferMtx     sync.RWMutex
+	defaultBuffer = Buffer{Size: defaultBufferSize, Overflow: OverflowBlock}
+)
+
+// withDefaults 为零值的字段填充默认值
+func (b Buffer) withDefaults() Buffer {
+	if b.Size <= 0 {
+		b.Size = defaultBufferSize
+	}
+	if b.Overflow == "" {
+		b.Overflow = OverflowBlock
+	}
+	return b
+}
+
+// SetBuffer 设置所有日志对象的缓冲区大小和溢出策略，会立即应用到已经创建的日志对象上，缩小缓冲区不会丢弃已经在缓冲区中的日志
+//   - buffer: 缓冲区大小和溢出策略
+func SetBuffer(buffer Buffer) error {
+	buffer = buffer.withDefaults()
+	if _, parseErr := ParseOverflow(string(buffer.Overflow)); parseErr != nil {
+		return parseErr
+	}
+
+	bufferMtx.Lock()
+	defaultBuffer = buffer
+	bufferMtx.Unlock()
+
+	for _, l := range loggersSnapshot() {
+		l.setBuffer(buffer)
+	}
+	return nil
+}
+
+// bufferFor 获取新创建的日志对象使用的缓冲区大小和溢出策略
+func bufferFor() Buffer {
+	bufferMtx.RLock()
+	defer bufferMtx.RUnlock()
+	return defaultBuffer
+}
+
+// setBuffer 更新日志对象的缓冲区大小和溢出策略，并唤醒阻塞的调用方重新检查
+//   - buffer: 新的缓冲区大小和溢出策略
+func (l *Logger) setBuffer(buffer Buffer) {
+	l.queueMtx.Lock()
+	l.buffer = buffer
+	l.notFull.Broadcast()
+	l.queueMtx.Unlock()
+}
+
+// CloseAll 关闭所有已经创建的日志对象，写入缓冲区中剩余的日志，通常在进程退出前调用
+//   - ctx: 等待写入完成的上下文，所有日志对象共用
+func CloseAll(ctx context.Context) error {
+	loggers := loggersSnapshot()
+	closeErrs := make([]error, len(loggers))
+
+	wg := sync.WaitGroup{}
+	for i, l := range loggers {
+		wg.Add(1)
+		go func(i int, l *Logger) {
+			defer wg.Done()
+			closeErrs[i] = l.Close(ctx)
+		}(i, l)
+	}
+	wg.Wait()
+
+	if closeErr := errors.Join(closeErrs...); closeErr != nil {
+		return fmt.Errorf("failed to close loggers: %w", closeErr)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package log
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingSink 在 release 关闭之前阻塞写入协程，用于填满日志对象的缓冲区
+type blockingSink struct {
+	mtx     sync.Mutex
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+	entries []Entry
+}
+
+func newBlockingSink() *blockingSink {
+	return &blockingSink{entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (s *blockingSink) Write(entry Entry) error {
+	s.once.Do(func() { close(s.entered) })
+	<-s.release
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+func (s *blockingSink) count() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.entries)
+}
+
+// newBlockedLogger 创建写入协程阻塞在第一条日志上的日志对象，之后的日志都留在缓冲区中
+func newBlockedLogger(t *testing.T, buffer Buffer) (*Logger, *blockingSink) {
+	t.Helper()
+	l := newTestLogger(t)
+	l.setBuffer(buffer)
+	sink := newBlockingSink()
+	l.AddSink(sink)
+
+	l.Log(DefaultField().WithLevel(Info).WithMessage("first"))
+	select {
+	case <-sink.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the writer to block")
+	}
+	return l, sink
+}
+
+func TestLoggerOverflowDrop(t *testing.T) {
+	l, sink := newBlockedLogger(t, Buffer{Size: 2, Overflow: OverflowDrop})
+
+	for i := 0; i < 5; i++ {
+		l.Log(DefaultField().WithLevel(Info).WithMessage("queued"))
+	}
+	if dropped := l.Dropped(); dropped != 3 {
+		t.Errorf("dropped %d records with a full buffer, want 3", dropped)
+	}
+
+	close(sink.release)
+	if closeErr := l.Close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+	if written := sink.count(); written != 3 {
+		t.Errorf("wrote %d records, want 3", written)
+	}
+}
+
+func TestLoggerOverflowBlock(t *testing.T) {
+	l, sink := newBlockedLogger(t, Buffer{Size: 1, Overflow: OverflowBlock})
+	l.Log(DefaultField().WithLevel(Info).WithMessage("queued"))
+
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		l.Log(DefaultField().WithLevel(Info).WithMessage("blocked"))
+	}()
+	select {
+	case <-returned:
+		t.Fatal("Log should block while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(sink.release)
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Log should return after the buffer has space")
+	}
+	if closeErr := l.Close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+	if written, dropped := sink.count(), l.Dropped(); written != 3 || dropped != 0 {
+		t.Errorf("wrote %d and dropped %d records, want 3 and 0", written, dropped)
+	}
+}
+
+func TestLoggerGrowBufferWakesBlocked(t *testing.T) {
+	l, sink := newBlockedLogger(t, Buffer{Size: 1, Overflow: OverflowBlock})
+	defer close(sink.release)
+	l.Log(DefaultField().WithLevel(Info).WithMessage("queued"))
+
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		l.Log(DefaultField().WithLevel(Info).WithMessage("blocked"))
+	}()
+
+	// 扩大缓冲区后阻塞的调用方立即返回，不需要等待写入协程
+	time.Sleep(20 * time.Millisecond)
+	l.setBuffer(Buffer{Size: 2, Overflow: OverflowBlock})
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Log should return after the buffer grows")
+	}
+}
+
+func TestLoggerDropsAfterClose(t *testing.T) {
+	l := newTestLogger(t)
+	if closeErr := l.Close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+	l.Log(DefaultField().WithLevel(Info).WithMessage("late"))
+	if dropped := l.Dropped(); dropped != 1 {
+		t.Errorf("dropped %d records after close, want 1", dropped)
+	}
+}
+
+func TestBufferDefaults(t *testing.T) {
+	cases := []struct {
+		buffer Buffer
+		want   Buffer
+	}{
+		{buffer: Buffer{}, want: Buffer{Size: defaultBufferSize, Overflow: OverflowBlock}},
+		{buffer: Buffer{Size: -1, Overflow: OverflowDrop}, want: Buffer{Size: defaultBufferSize, Overflow: OverflowDrop}},
+		{buffer: Buffer{Size: 10}, want: Buffer{Size: 10, Overflow: OverflowBlock}},
+	}
+	for _, c := range cases {
+		if buffer := c.buffer.withDefaults(); buffer != c.want {
+			t.Errorf("%+v.withDefaults() = %+v, want %+v", c.buffer, buffer, c.want)
+		}
+	}
+
+	before := bufferFor()
+	if setErr := SetBuffer(Buffer{Overflow: "unknown"}); setErr == nil {
+		t.Error("SetBuffer should reject an unknown overflow policy")
+	} else if after := bufferFor(); after != before {
+		t.Errorf("buffer changed to %+v after a rejected SetBuffer", after)
+	}
+}
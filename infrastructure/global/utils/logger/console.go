@@ -0,0 +1,45 @@
+package log
+
+import (
+	"io"
+	"os"
+)
+
+// ConsoleSink 将日志输出到控制台，默认使用便于阅读的文本格式，用于开发调试
+type ConsoleSink struct {
+	output io.Writer
+	color  bool
+	format LoggerFormat
+}
+
+// NewConsoleSink 创建输出到控制台的输出目标
+//   - output: 输出到 stdout 或者 stderr，为空时为 stdout
+//   - color: 是否使用颜色区分日志级别
+func NewConsoleSink(output string, color bool) *ConsoleSink {
+	if output == "stderr" {
+		return &ConsoleSink{output: os.Stderr, color: color, format: Text}
+	}
+	return &ConsoleSink{output: os.Stdout, color: color, format: Text}
+}
+
+// setFormat 设置输出格式，为空时使用文本格式
+func (s *ConsoleSink) setFormat(format LoggerFormat) {
+	if format == "" {
+		format = Text
+	}
+	s.format = format
+}
+
+func (s *ConsoleSink) Write(entry Entry) error {
+	line, formatErr := formatEntry(entry, s.format, s.color)
+	if formatErr != nil {
+		return formatErr
+	}
+	_, writeErr := s.output.Write(line)
+	return writeErr
+}
+
+// Close 控制台不需要关闭
+func (s *ConsoleSink) Close() error {
+	return nil
+}
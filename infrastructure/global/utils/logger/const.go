@@ -1,6 +1,9 @@
 package log
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 type LoggerLevel string
 
@@ -21,17 +24,80 @@ const (
 	External LoggerCaller = "external"
 )
 
+// LevelRank 获取日志级别的高低，从 debug 的 0 到 panic 的 4，不区分大小写，支持 warning 作为 warn 的别名，
+// 服务端校验配置和客户端过滤日志使用同一个级别顺序
+//   - level: 日志级别，无法识别时 known 为 false
+func LevelRank(level string) (rank int, known bool) {
+	if parsed, parseErr := ParseLevel(level); parseErr != nil {
+		return 0, false
+	} else {
+		return levelRanks[parsed], true
+	}
+}
+
+// NewLevelFromString 将字符串转换为日志级别，不区分大小写，无法识别时视为 info
 func NewLevelFromString(level string) LoggerLevel {
+	if parsed, parseErr := ParseLevel(level); parseErr == nil {
+		return parsed
+	}
+	return Info
+}
+
+// ParseLevel 将字符串转换为日志级别，不区分大小写，支持 warning 作为 warn 的别名，无法识别时返回错误
+func ParseLevel(level string) (LoggerLevel, error) {
 	switch strings.ToLower(level) {
 	case "debug":
-		return Debug
+		return Debug, nil
 	case "info":
-		return Info
-	case "warn":
-		return Warn
+		return Info, nil
+	case "warn", "warning":
+		return Warn, nil
 	case "error":
-		return Error
+		return Error, nil
+	case "panic":
+		return Panic, nil
+	default:
+		return "", fmt.Errorf("invalid logger level: %s", level)
+	}
+}
+
+type LoggerFormat string
+
+const (
+	JSON   LoggerFormat = "json"
+	Logfmt LoggerFormat = "logfmt"
+	Text   LoggerFormat = "text"
+)
+
+// ParseFormat 将字符串转换为输出格式，不区分大小写，无法识别时返回错误
+func ParseFormat(format string) (LoggerFormat, error) {
+	switch strings.ToLower(format) {
+	case "json":
+		return JSON, nil
+	case "logfmt":
+		return Logfmt, nil
+	case "text":
+		return Text, nil
+	default:
+		return "", fmt.Errorf("invalid logger format: %s", format)
+	}
+}
+
+type OverflowPolicy string
+
+const (
+	OverflowBlock OverflowPolicy = "block"
+	OverflowDrop  OverflowPolicy = "drop"
+)
+
+// ParseOverflow 将字符串转换为缓冲区的溢出策略，不区分大小写，无法识别时返回错误
+func ParseOverflow(overflow string) (OverflowPolicy, error) {
+	switch strings.ToLower(overflow) {
+	case "block":
+		return OverflowBlock, nil
+	case "drop":
+		return OverflowDrop, nil
 	default:
-		return Info
+		return "", fmt.Errorf("invalid logger overflow policy: %s", overflow)
 	}
 }
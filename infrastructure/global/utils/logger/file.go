@@ -0,0 +1,214 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileSink 将日志追加到一个文件，默认使用 json lines 格式，不切分文件
+type FileSink struct {
+	file   *os.File
+	format LoggerFormat
+}
+
+// NewFileSink 创建写入文件的输出目标，文件所在的目录不存在时会创建
+//   - path: 文件路径
+func NewFileSink(path string) (*FileSink, error) {
+	if mkdirErr := os.MkdirAll(filepath.Dir(path), 0o755); mkdirErr != nil {
+		return nil, mkdirErr
+	}
+
+	file, openErr := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if openErr != nil {
+		return nil, openErr
+	}
+	return &FileSink{file: file, format: JSON}, nil
+}
+
+// setFormat 设置输出格式，为空时使用 json 格式
+func (s *FileSink) setFormat(format LoggerFormat) {
+	if format == "" {
+		format = JSON
+	}
+	s.format = format
+}
+
+func (s *FileSink) Write(entry Entry) error {
+	line, formatErr := formatEntry(entry, s.format, false)
+	if formatErr != nil {
+		return formatErr
+	}
+	_, writeErr := s.file.Write(line)
+	return writeErr
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// countingWriter 记录已经写入文件的字节数，用于按照大小切分日志文件
+type countingWriter struct {
+	file *os.File
+	size int64
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// RotatingFileSink 将日志写入按天切分的文件，默认使用 json lines 格式，文件名为 <prefix>_<日期>.log，
+// 超出保留策略的单个文件大小时在当天内切分，已经切分的文件按照保留策略压缩和清理
+type RotatingFileSink struct {
+	rwMtx       sync.RWMutex
+	maintainMtx sync.Mutex
+	dir         string
+	prefix      string
+	retention   Retention
+	format      LoggerFormat
+	writer      *countingWriter
+	timestamp   time.Time
+}
+
+// NewRotatingFileSink 创建按天切分文件的输出目标，目录不存在时会创建
+//   - dir: 日志文件所在的目录
+//   - prefix: 日志文件名的前缀，为空时为 stdout
+//   - retention: 日志文件的切分和保留策略
+func NewRotatingFileSink(dir, prefix string, retention Retention) (*RotatingFileSink, error) {
+	if prefix == "" {
+		prefix = "stdout"
+	}
+	if mkdirErr := os.MkdirAll(dir, 0o755); mkdirErr != nil {
+		return nil, mkdirErr
+	}
+
+	s := &RotatingFileSink{dir: dir, prefix: prefix, retention: retention, format: JSON}
+	now := time.Now()
+	if writer, openErr := s.open(now); openErr != nil {
+		return nil, openErr
+	} else {
+		s.writer, s.timestamp = writer, now
+	}
+	go s.maintain()
+	return s, nil
+}
+
+// filePath 获取日志文件的路径，sequence 为 0 时是当天正在写入的文件，否则是当天按照大小切分出的第 sequence 个文件
+//   - date: 日志文件的日期
+//   - sequence: 切分的序号
+func (s *RotatingFileSink) filePath(date time.Time, sequence int) string {
+	if sequence == 0 {
+		return filepath.Join(s.dir, fmt.Sprintf("%s_%s.log", s.prefix, date.Format("2006-01-02")))
+	}
+	return filepath.Join(s.dir, fmt.Sprintf("%s_%s.%d.log", s.prefix, date.Format("2006-01-02"), sequence))
+}
+
+// open 打开日期对应的日志文件，不会修改正在写入的文件
+//   - now: 当前时间
+func (s *RotatingFileSink) open(now time.Time) (*countingWriter, error) {
+	file, openFileErr := os.OpenFile(s.filePath(now, 0), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if openFileErr != nil {
+		return nil, openFileErr
+	}
+
+	writer := &countingWriter{file: file}
+	if info, statErr := file.Stat(); statErr == nil {
+		writer.size = info.Size()
+	}
+	return writer, nil
+}
+
+// rotate 打开新的日志文件并关闭当前的日志文件，按照大小切分时会先将当前的文件重命名为带序号的文件，
+// 重命名或者打开新的文件失败时继续写入当前的文件并返回错误，下一次写入时会重新尝试切分
+//   - now: 当前时间
+//   - bySize: 是否是按照大小切分
+func (s *RotatingFileSink) rotate(now time.Time, bySize bool) error {
+	s.rwMtx.Lock()
+	defer s.rwMtx.Unlock()
+
+	current, renamed := s.filePath(s.timestamp, 0), ""
+	if bySize && s.writer.size > 0 {
+		sequence := 1
+		for ; ; sequence++ {
+			path := s.filePath(s.timestamp, sequence)
+			if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+				continue
+			} else if _, statErr = os.Stat(path + ".gz"); !os.IsNotExist(statErr) {
+				continue
+			}
+			break
+		}
+		// 重命名不影响已经打开的文件，失败时仍然可以继续写入
+		renamed = s.filePath(s.timestamp, sequence)
+		if renameErr := os.Rename(current, renamed); renameErr != nil {
+			return fmt.Errorf("failed to rotate log file: %w", renameErr)
+		}
+	}
+
+	writer, openErr := s.open(now)
+	if openErr != nil {
+		// 恢复原来的文件名，避免当前的文件被当作已经切分的文件压缩和清理
+		if renamed != "" {
+			_ = os.Rename(renamed, current)
+		}
+		return fmt.Errorf("failed to rotate log file: %w", openErr)
+	}
+
+	_ = s.writer.file.Close()
+	s.writer, s.timestamp = writer, now
+	go s.maintain()
+	return nil
+}
+
+func (s *RotatingFileSink) setRetention(retention Retention) {
+	s.rwMtx.Lock()
+	s.retention = retention
+	s.rwMtx.Unlock()
+
+	go s.maintain()
+}
+
+// setFormat 设置输出格式，为空时使用 json 格式
+func (s *RotatingFileSink) setFormat(format LoggerFormat) {
+	if format == "" {
+		format = JSON
+	}
+	s.rwMtx.Lock()
+	s.format = format
+	s.rwMtx.Unlock()
+}
+
+func (s *RotatingFileSink) Write(entry Entry) error {
+	s.rwMtx.RLock()
+	dateChanged := time.Now().Format("2006-01-02") != s.timestamp.Format("2006-01-02")
+	sizeExceeded := s.retention.MaxFileSize > 0 && s.writer.size >= s.retention.MaxFileSize
+	format := s.format
+	s.rwMtx.RUnlock()
+
+	// 切分失败时仍然写入当前的文件，并返回切分的错误
+	var rotateErr error
+	if dateChanged || sizeExceeded {
+		rotateErr = s.rotate(time.Now(), !dateChanged)
+	}
+
+	line, formatErr := formatEntry(entry, format, false)
+	if formatErr != nil {
+		return errors.Join(rotateErr, formatErr)
+	}
+
+	s.rwMtx.Lock()
+	defer s.rwMtx.Unlock()
+	_, writeErr := s.writer.Write(line)
+	return errors.Join(rotateErr, writeErr)
+}
+
+func (s *RotatingFileSink) Close() error {
+	s.rwMtx.Lock()
+	defer s.rwMtx.Unlock()
+	return s.writer.file.Close()
+}
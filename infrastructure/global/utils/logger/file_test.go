@@ -0,0 +1,75 @@
+package log
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeLine 直接写入当前的文件，持有写锁，避免和后台的清理任务产生数据竞争
+func writeLine(s *RotatingFileSink, line string) error {
+	s.rwMtx.Lock()
+	defer s.rwMtx.Unlock()
+	_, writeErr := s.writer.Write([]byte(line))
+	return writeErr
+}
+
+func TestRotatingFileSinkRotateFailure(t *testing.T) {
+	dir := t.TempDir()
+	s, newErr := NewRotatingFileSink(dir, "test", Retention{})
+	if newErr != nil {
+		t.Fatalf("new sink: %v", newErr)
+	}
+	defer func() { _ = s.Close() }()
+
+	// 第二天的日志文件路径被目录占用，切分时无法打开新的文件
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	if mkdirErr := os.Mkdir(s.filePath(tomorrow, 0), 0o755); mkdirErr != nil {
+		t.Fatalf("occupy next file: %v", mkdirErr)
+	}
+	if rotateErr := s.rotate(tomorrow, false); rotateErr == nil {
+		t.Fatal("rotate should fail when the new file cannot be opened")
+	}
+
+	// 切分失败后继续写入原来的文件
+	if writeErr := writeLine(s, "after failure\n"); writeErr != nil {
+		t.Fatalf("write after failed rotation: %v", writeErr)
+	}
+	if content, readErr := os.ReadFile(s.filePath(time.Now(), 0)); readErr != nil {
+		t.Fatalf("read current file: %v", readErr)
+	} else if !strings.Contains(string(content), "after failure") {
+		t.Errorf("current file %q should contain the entry written after the failed rotation", content)
+	}
+}
+
+func TestRotatingFileSinkRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	s, newErr := NewRotatingFileSink(dir, "test", Retention{})
+	if newErr != nil {
+		t.Fatalf("new sink: %v", newErr)
+	}
+	defer func() { _ = s.Close() }()
+
+	now := time.Now()
+	_ = writeLine(s, "first\n")
+	if rotateErr := s.rotate(now, true); rotateErr != nil {
+		t.Fatalf("rotate: %v", rotateErr)
+	}
+	_ = writeLine(s, "second\n")
+
+	cases := []struct {
+		path    string
+		content string
+	}{
+		{path: s.filePath(now, 1), content: "first\n"},
+		{path: s.filePath(now, 0), content: "second\n"},
+	}
+	for _, c := range cases {
+		if content, readErr := os.ReadFile(c.path); readErr != nil {
+			t.Errorf("read %s: %v", c.path, readErr)
+		} else if string(content) != c.content {
+			t.Errorf("%s contains %q, want %q", c.path, content, c.content)
+		}
+	}
+}
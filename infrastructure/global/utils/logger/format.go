@@ -0,0 +1,138 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	jsonFormatter   = &logrus.JSONFormatter{}
+	logfmtFormatter = &logrus.TextFormatter{DisableColors: true, FullTimestamp: true, TimestampFormat: time.RFC3339}
+)
+
+// logrusLevel 将日志级别转换为 logrus 的级别，用于格式化日志
+func logrusLevel(level LoggerLevel) logrus.Level {
+	switch level {
+	case Debug:
+		return logrus.DebugLevel
+	case Warn:
+		return logrus.WarnLevel
+	case Error:
+		return logrus.ErrorLevel
+	case Panic:
+		return logrus.PanicLevel
+	default:
+		return logrus.InfoLevel
+	}
+}
+
+// formatJSON 将日志格式化为一行 json，格式和 logrus.JSONFormatter 相同
+func formatJSON(entry Entry) ([]byte, error) {
+	return jsonFormatter.Format(&logrus.Entry{
+		Data:    entry.Fields,
+		Time:    entry.Time,
+		Level:   logrusLevel(entry.Level),
+		Message: entry.Message,
+	})
+}
+
+// formatLogfmt 将日志格式化为一行 logfmt，格式和关闭颜色的 logrus.TextFormatter 相同
+func formatLogfmt(entry Entry) ([]byte, error) {
+	return logfmtFormatter.Format(&logrus.Entry{
+		Data:    entry.Fields,
+		Time:    entry.Time,
+		Level:   logrusLevel(entry.Level),
+		Message: entry.Message,
+	})
+}
+
+// formatEntry 按照输出格式格式化日志
+//   - entry: 日志
+//   - format: 输出格式，无法识别时使用 json
+//   - color: 使用 text 格式时是否使用颜色区分日志级别
+func formatEntry(entry Entry, format LoggerFormat, color bool) ([]byte, error) {
+	switch format {
+	case Text:
+		return formatText(entry, color), nil
+	case Logfmt:
+		return formatLogfmt(entry)
+	default:
+		return formatJSON(entry)
+	}
+}
+
+// levelColors 控制台输出时各个级别使用的 ANSI 颜色
+var levelColors = map[LoggerLevel]string{
+	Debug: "\x1b[90m",
+	Info:  "\x1b[36m",
+	Warn:  "\x1b[33m",
+	Error: "\x1b[31m",
+	Panic: "\x1b[35m",
+}
+
+// formatText 将日志格式化为一行文本，字段按照键排序，格式为 时间 级别 消息 key=value
+//   - entry: 日志
+//   - color: 是否使用颜色区分日志级别
+func formatText(entry Entry, color bool) []byte {
+	buffer := bytes.Buffer{}
+	buffer.WriteString(entry.Time.Format("2006-01-02 15:04:05.000"))
+	buffer.WriteByte(' ')
+
+	level := fmt.Sprintf("%-5s", strings.ToUpper(string(entry.Level)))
+	if color {
+		buffer.WriteString(levelColors[entry.Level] + level + "\x1b[0m")
+	} else {
+		buffer.WriteString(level)
+	}
+	buffer.WriteByte(' ')
+	buffer.WriteString(entry.Message)
+
+	keys := make([]string, 0, len(entry.Fields))
+	for key := range entry.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		buffer.WriteByte(' ')
+		buffer.WriteString(key)
+		buffer.WriteByte('=')
+		buffer.WriteString(formatValue(entry.Fields[key]))
+	}
+	buffer.WriteByte('\n')
+	return buffer.Bytes()
+}
+
+// formatValue 将字段值格式化为文本，包含空白或者引号的字符串会加上引号，结构化的值使用 json
+func formatValue(value any) string {
+	var text string
+	switch typed := value.(type) {
+	case string:
+		text = typed
+	case error:
+		text = typed.Error()
+	case fmt.Stringer:
+		text = typed.String()
+	case nil:
+		return "<nil>"
+	default:
+		if reflected := reflect.ValueOf(typed); reflected.Kind() == reflect.String {
+			text = reflected.String()
+		} else if encoded, marshalErr := json.Marshal(typed); marshalErr == nil {
+			return string(encoded)
+		} else {
+			text = fmt.Sprint(typed)
+		}
+	}
+
+	if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+		return fmt.Sprintf("%q", text)
+	}
+	return text
+}
@@ -0,0 +1,76 @@
+package log
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFormatEntry(t *testing.T) {
+	entry := newTestEntry(Warn, "disk full")
+	entry.Fields["path"] = "/var/log app"
+	entry.Fields["usage"] = map[string]int{"percent": 95}
+
+	cases := []struct {
+		format LoggerFormat
+		want   string
+	}{
+		{format: Text, want: `2024-01-02 03:04:05.006 WARN  disk full function=main.handle path="/var/log app" trace_id=trace usage={"percent":95}` + "\n"},
+		{format: Logfmt, want: `time="2024-01-02T03:04:05Z" level=warning msg="disk full" function=main.handle path="/var/log app" trace_id=trace usage="map[percent:95]"` + "\n"},
+	}
+	for _, c := range cases {
+		t.Run(string(c.format), func(t *testing.T) {
+			line, formatErr := formatEntry(entry, c.format, false)
+			if formatErr != nil {
+				t.Fatalf("format: %v", formatErr)
+			}
+			if string(line) != c.want {
+				t.Errorf("formatted %q, want %q", line, c.want)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	cases := []struct {
+		value any
+		want  string
+	}{
+		{value: "plain", want: "plain"},
+		{value: "", want: `""`},
+		{value: `say "hi"`, want: `"say \"hi\""`},
+		{value: "a=b", want: `"a=b"`},
+		{value: errors.New("not found"), want: `"not found"`},
+		{value: Internal, want: "internal"},
+		{value: nil, want: "<nil>"},
+		{value: 42, want: "42"},
+		{value: []string{"a", "b"}, want: `["a","b"]`},
+	}
+	for _, c := range cases {
+		if text := formatValue(c.value); text != c.want {
+			t.Errorf("formatValue(%#v) = %s, want %s", c.value, text, c.want)
+		}
+	}
+}
+
+func TestPanicLevelRoundTrip(t *testing.T) {
+	for _, text := range []string{"panic", "PANIC", "Panic"} {
+		if level, parseErr := ParseLevel(text); parseErr != nil || level != Panic {
+			t.Errorf("ParseLevel(%q) = %q, %v, want panic", text, level, parseErr)
+		}
+		if level := NewLevelFromString(text); level != Panic {
+			t.Errorf("NewLevelFromString(%q) = %q, want panic", text, level)
+		}
+	}
+	if level := NewLevelFromString(string(Panic)); level != Panic {
+		t.Errorf("panic level parsed back as %q", level)
+	}
+
+	// 格式化之后仍然是 panic 级别，不会被当作 info
+	entry := newTestEntry(Panic, "boom")
+	for format, want := range map[LoggerFormat]string{JSON: `"level":"panic"`, Logfmt: "level=panic", Text: "PANIC"} {
+		if line, _ := formatEntry(entry, format, false); !strings.Contains(string(line), want) {
+			t.Errorf("%s line %q does not contain %s", format, line, want)
+		}
+	}
+}
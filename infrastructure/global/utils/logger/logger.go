@@ -1,23 +1,18 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/signal"
-	"path/filepath"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
-
-	"github.com/sirupsen/logrus"
 )
 
 var logger *Logger
 
 func init() {
 	logger = NewLogger("logs")
-	exitFunctions = []func() error{}
-	go logger.listenOsSignal()
 }
 
 func DefaultLogger() *Logger {
@@ -31,142 +26,332 @@ func NewLogger(outputPath string) *Logger {
 }
 
 type Logger struct {
-	buffer     chan LoggerField
-	exit       chan struct{}
+	queueMtx   sync.Mutex
+	notEmpty   *sync.Cond
+	notFull    *sync.Cond
+	written    *sync.Cond
+	queue      []LoggerField
+	enqueued   uint64
+	flushed    uint64
+	buffer     Buffer
+	closed     bool
+	done       chan struct{}
+	dropped    atomic.Uint64
 	rwMtx      sync.RWMutex
 	outputDir  string
-	stdLogger  *logrus.Logger
-	errLogger  *logrus.Logger
-	stdoutFile *os.File
-	stderrFile *os.File
-	timestamp  time.Time
+	retention  Retention
+	options    Options
+	minRank    atomic.Int32
+	specs      []SinkSpec
+	configured []Sink
+	added      []Sink
 }
 
 func (l *Logger) init(outputPath string) {
-	if l.buffer == nil {
-		l.buffer = make(chan LoggerField, 100)
-		l.exit = make(chan struct{})
+	if l.done == nil {
+		l.notEmpty = sync.NewCond(&l.queueMtx)
+		l.notFull = sync.NewCond(&l.queueMtx)
+		l.written = sync.NewCond(&l.queueMtx)
+		l.buffer = bufferFor()
+		l.done = make(chan struct{})
 
 		go l.serve()
 	}
 
-	l.rwMtx = sync.RWMutex{}
+	if outputPath == "" {
+		outputPath = "logs"
+	}
 	l.rwMtx.Lock()
 	l.outputDir = outputPath
-	if l.outputDir == "" {
-		l.outputDir = "logs"
-	}
+	l.retention = retentionFor(outputPath)
+	l.rwMtx.Unlock()
 
 	// 检查日志输出目录是否存在，不存在则创建
-	if _, checkDirExistErr := os.Stat(l.outputDir); os.IsNotExist(checkDirExistErr) {
-		if mkdirErr := os.Mkdir(l.outputDir, 0o755); mkdirErr != nil {
+	if _, checkDirExistErr := os.Stat(outputPath); os.IsNotExist(checkDirExistErr) {
+		if mkdirErr := os.Mkdir(outputPath, 0o755); mkdirErr != nil {
 			panic(mkdirErr)
 		}
 	}
 
-	// 创建/打开/追加日志文件
-	l.timestamp = time.Now()
-	stdoutFilePath := filepath.Join(l.outputDir, fmt.Sprintf("stdout_%s.log", l.timestamp.Format("2006-01-02")))
-	stderrFilePath := filepath.Join(l.outputDir, fmt.Sprintf("stderr_%s.log", l.timestamp.Format("2006-01-02")))
-	if stdoutFile, openStdoutFileErr := os.OpenFile(stdoutFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o755); openStdoutFileErr != nil {
-		panic(openStdoutFileErr)
-	} else {
-		l.stdoutFile = stdoutFile
+	// 创建通过配置指定的输出目标
+	if configureErr := l.configureSinks(); configureErr != nil {
+		panic(configureErr)
 	}
-	if stderrFile, openStderrFileErr := os.OpenFile(stderrFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o755); openStderrFileErr != nil {
-		panic(openStderrFileErr)
-	} else {
-		l.stderrFile = stderrFile
-	}
-
-	// 初始化日志对象
-	l.stdLogger = logrus.New()
-	l.errLogger = logrus.New()
-	l.stdLogger.SetOutput(l.stdoutFile)
-	l.errLogger.SetOutput(l.stderrFile)
-	l.stdLogger.SetLevel(logrus.DebugLevel)
-	l.errLogger.SetLevel(logrus.ErrorLevel)
-	l.stdLogger.SetFormatter(&logrus.JSONFormatter{})
-	l.errLogger.SetFormatter(&logrus.JSONFormatter{})
+	l.setOptions(optionsFor(outputPath))
+
+	registerLogger(l)
+}
+
+// configureSinks 按照输出目录对应的配置重新创建输出目标，替换并关闭原有的通过配置创建的输出目标
+func (l *Logger) configureSinks() error {
+	specs := sinkSpecsFor(l.dir())
+	sinks, createErr := l.createSinks(specs)
+	if createErr != nil {
+		return createErr
+	}
+	l.replaceSinks(specs, sinks)
+	return nil
+}
+
+// createSinks 根据配置为日志对象创建输出目标，不会修改日志对象，任意一个输出目标创建失败时关闭已经创建的输出目标
+//   - specs: 输出目标的配置
+func (l *Logger) createSinks(specs []SinkSpec) ([]Sink, error) {
+	dir, sinks := l.dir(), make([]Sink, 0, len(specs))
+	for _, spec := range specs {
+		sink, newSinkErr := newSinkFromSpec(dir, spec)
+		if newSinkErr != nil {
+			closeSinks(sinks)
+			return nil, fmt.Errorf("failed to create %s sink for logger %s: %w", spec.Type, dir, newSinkErr)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// replaceSinks 替换并关闭原有的通过配置创建的输出目标
+//   - specs: 输出目标的配置
+//   - sinks: 根据 specs 创建的输出目标
+func (l *Logger) replaceSinks(specs []SinkSpec, sinks []Sink) {
+	l.rwMtx.Lock()
+	replaced := l.configured
+	l.specs, l.configured = specs, sinks
+	l.applyFormat()
 	l.rwMtx.Unlock()
+
+	closeSinks(replaced)
 }
 
-func (l *Logger) checkDateChange() {
-	if time.Now().Day() != l.timestamp.Day() {
-		l.rwMtx.Lock()
-		_ = l.stdoutFile.Close()
-		_ = l.stderrFile.Close()
-		l.rwMtx.Unlock()
-		l.init(l.outputDir)
+func closeSinks(sinks []Sink) {
+	for _, sink := range sinks {
+		_ = sink.Close()
 	}
 }
 
-func (l *Logger) serve() {
-	defer os.Exit(0)
-
-	logFunction := func(fields LoggerField) {
-		l.checkDateChange()
-		l.rwMtx.RLock()
-		switch fields.Level() {
-		case Debug:
-			l.stdLogger.WithFields(fields.EncodePayload()).Debugln(fields.Message())
-		case Info:
-			l.stdLogger.WithFields(fields.EncodePayload()).Infoln(fields.Message())
-		case Warn:
-			l.stdLogger.WithFields(fields.EncodePayload()).Warnln(fields.Message())
-		case Error:
-			l.stdLogger.WithFields(fields.EncodePayload()).Errorln(fields.Message())
-			l.errLogger.WithFields(fields.EncodePayload()).Errorln(fields.Message())
-		case Panic:
-			l.stdLogger.WithFields(fields.EncodePayload()).Errorln(fields.Message())
-			l.errLogger.WithFields(fields.EncodePayload()).Panicln(fields.Message())
-		default:
-			l.stdLogger.WithFields(fields.EncodePayload()).Infoln(fields.Message())
+// AddSink 添加输出目标，添加的输出目标不会被 SetSinks 替换
+//   - sink: 输出目标
+func (l *Logger) AddSink(sink Sink) {
+	l.rwMtx.Lock()
+	l.added = append(l.added, sink)
+	if fs, isFormatSink := sink.(formatSink); isFormatSink {
+		fs.setFormat(l.options.Format)
+	}
+	l.rwMtx.Unlock()
+}
+
+// Sinks 获取日志对象当前的所有输出目标，包括通过配置创建的和通过 AddSink 添加的
+func (l *Logger) Sinks() []Sink {
+	l.rwMtx.RLock()
+	defer l.rwMtx.RUnlock()
+	return append(append(make([]Sink, 0, len(l.configured)+len(l.added)), l.configured...), l.added...)
+}
+
+// setRetention 更新日志对象的保留策略，并应用到按天切分文件的输出目标上
+//   - retention: 新的保留策略
+func (l *Logger) setRetention(retention Retention) {
+	l.rwMtx.Lock()
+	l.retention = retention
+	sinks := append([]Sink{}, l.configured...)
+	l.rwMtx.Unlock()
+
+	for _, sink := range sinks {
+		if rs, isRetentionSink := sink.(retentionSink); isRetentionSink {
+			rs.setRetention(retention)
+		}
+	}
+}
+
+// dir 获取日志对象的输出目录，输出目录在 init 中持有写锁修改，其他地方需要通过这个方法读取
+func (l *Logger) dir() string {
+	l.rwMtx.RLock()
+	defer l.rwMtx.RUnlock()
+	return l.outputDir
+}
+
+// Options 获取日志对象当前使用的最低级别和输出格式
+func (l *Logger) Options() Options {
+	l.rwMtx.RLock()
+	defer l.rwMtx.RUnlock()
+	return l.options
+}
+
+// setOptions 更新日志对象的最低级别和输出格式，最低级别立即对之后的 Log 调用生效
+//   - options: 新的最低级别和输出格式
+func (l *Logger) setOptions(options Options) {
+	l.rwMtx.Lock()
+	l.options = options
+	l.applyFormat()
+	l.rwMtx.Unlock()
+
+	if options.MinLevel == "" {
+		l.minRank.Store(int32(levelRanks[Debug]))
+	} else {
+		l.minRank.Store(int32(levelRank(options.MinLevel)))
+	}
+}
+
+// applyFormat 将输出格式应用到输出目标上，日志对象没有设置输出格式时，通过配置创建的输出目标使用配置中的格式，调用前需要持有写锁
+func (l *Logger) applyFormat() {
+	for i, sink := range l.configured {
+		if fs, isFormatSink := sink.(formatSink); isFormatSink {
+			format := l.options.Format
+			if format == "" && i < len(l.specs) {
+				format = l.specs[i].Format
+			}
+			fs.setFormat(format)
+		}
+	}
+	for _, sink := range l.added {
+		if fs, isFormatSink := sink.(formatSink); isFormatSink {
+			fs.setFormat(l.options.Format)
 		}
-		l.rwMtx.RUnlock()
 	}
+}
+
+func (l *Logger) serve() {
+	defer close(l.done)
 
 	for {
-		select {
-		case fields := <-l.buffer:
-			logFunction(fields)
-		case <-l.exit:
-			for {
-				select {
-				case fields := <-l.buffer:
-					logFunction(fields)
-				default:
-					// 执行额外的退出函数
-					for _, function := range exitFunctions {
-						if e := function(); e != nil {
-							logFunction(DefaultField().WithLevel(Error).WithCaller(Internal).
-								WithMessage("exit function error").WithExtra(e))
-						}
-					}
-					return
-				}
+		// 每次取出缓冲区中的所有日志，写入时不持有缓冲区的锁，避免阻塞 Log 的调用方
+		l.queueMtx.Lock()
+		for len(l.queue) == 0 && !l.closed {
+			l.notEmpty.Wait()
+		}
+		batch, closed := l.queue, l.closed
+		l.queue = nil
+		l.notFull.Broadcast()
+		l.queueMtx.Unlock()
+
+		for _, fields := range batch {
+			l.write(fields)
+		}
+		if len(batch) > 0 {
+			l.queueMtx.Lock()
+			l.flushed += uint64(len(batch))
+			l.written.Broadcast()
+			l.queueMtx.Unlock()
+		}
+		if closed && len(batch) == 0 {
+			l.closeSinks()
+			return
+		}
+	}
+}
+
+// write 将一条日志写入所有的输出目标
+//   - fields: 日志字段
+func (l *Logger) write(fields LoggerField) {
+	entry := Entry{
+		Time:    time.Now(),
+		Level:   fields.Level(),
+		Message: fields.Message(),
+		Fields:  fields.EncodePayload(),
+	}
+	if _, known := levelRanks[entry.Level]; !known {
+		entry.Level = Info
+	}
+
+	// 输出目标之间共用同一个 entry，输出目标不能修改 entry.Fields
+	l.rwMtx.RLock()
+	for _, sinks := range [][]Sink{l.configured, l.added} {
+		for _, sink := range sinks {
+			if writeErr := sink.Write(entry); writeErr != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "failed to write log to %T: %v\n", sink, writeErr)
 			}
 		}
 	}
+	l.rwMtx.RUnlock()
 }
 
-func (l *Logger) listenOsSignal() {
-	sgChan := make(chan os.Signal, 1)
-	signal.Notify(sgChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
-	sig := <-sgChan
-	signalString := ""
-	switch sig {
-	case syscall.SIGTERM:
-		signalString = "SIGTERM"
-	case syscall.SIGINT:
-		signalString = "SIGINT"
-	case syscall.SIGQUIT:
-		signalString = "SIGQUIT"
+// closeSinks 关闭所有的输出目标，关闭后日志对象不再写入
+func (l *Logger) closeSinks() {
+	l.rwMtx.Lock()
+	defer l.rwMtx.Unlock()
+
+	for _, sinks := range [][]Sink{l.configured, l.added} {
+		for _, sink := range sinks {
+			if closeErr := sink.Close(); closeErr != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "failed to close %T: %v\n", sink, closeErr)
+			}
+		}
 	}
-	l.Log(DefaultField().WithLevel(Info).WithCaller(Internal).WithMessage("os signal received").WithExtra(signalString))
-	l.exit <- struct{}{}
+	l.configured, l.added, l.specs = nil, nil, nil
 }
 
+// Log 写入一条日志，低于日志对象最低级别的日志会被直接丢弃，缓冲区已满时按照缓冲区的溢出策略阻塞或者丢弃，
+// 日志对象关闭后写入的日志会被丢弃
+//
+// 本地产生的 panic 级别日志会等待写入所有的输出目标后在调用方的协程中触发 panic，调用方可以 recover，
+// 转发的日志记录（例如日志收集服务接收的记录）只写入不触发
+//   - fields: 日志字段
 func (l *Logger) Log(fields LoggerField) {
-	l.buffer <- fields
+	if int32(levelRank(fields.Level())) < l.minRank.Load() {
+		return
+	}
+
+	sequence, queued := l.enqueue(fields)
+	if _, isLocal := fields.(*AliothLoggerField); isLocal && fields.Level() == Panic {
+		if queued {
+			l.waitWritten(sequence)
+		}
+		panic(fields.Message())
+	}
+}
+
+// enqueue 将日志加入缓冲区，返回日志在缓冲区中的序号，日志被丢弃时 queued 为 false
+//   - fields: 日志字段
+func (l *Logger) enqueue(fields LoggerField) (sequence uint64, queued bool) {
+	l.queueMtx.Lock()
+	defer l.queueMtx.Unlock()
+
+	for !l.closed && len(l.queue) >= l.buffer.Size {
+		if l.buffer.Overflow == OverflowDrop {
+			l.dropped.Add(1)
+			return 0, false
+		}
+		l.notFull.Wait()
+	}
+	if l.closed {
+		l.dropped.Add(1)
+		return 0, false
+	}
+	l.queue = append(l.queue, fields)
+	l.enqueued++
+	l.notEmpty.Signal()
+	return l.enqueued, true
+}
+
+// waitWritten 等待序号不大于 sequence 的日志全部写入输出目标，日志对象关闭时缓冲区中的日志仍然会被写入
+//   - sequence: enqueue 返回的序号
+func (l *Logger) waitWritten(sequence uint64) {
+	l.queueMtx.Lock()
+	defer l.queueMtx.Unlock()
+
+	for l.flushed < sequence {
+		l.written.Wait()
+	}
+}
+
+// Dropped 获取因为缓冲区已满或者日志对象已经关闭而被丢弃的日志条数
+func (l *Logger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Close 关闭日志对象，写入缓冲区中剩余的日志后关闭所有的输出目标，重复调用会等待第一次关闭完成
+//   - ctx: 等待写入完成的上下文，超时后返回错误，剩余的日志仍然会在后台继续写入
+func (l *Logger) Close(ctx context.Context) error {
+	l.queueMtx.Lock()
+	if !l.closed {
+		l.closed = true
+		l.notEmpty.Broadcast()
+		l.notFull.Broadcast()
+	}
+	l.queueMtx.Unlock()
+	unregisterLogger(l)
+
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush logger %s: %w", l.dir(), ctx.Err())
+	}
 }
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestLogger 创建输出到临时目录的日志对象，测试结束时关闭
+func newTestLogger(t *testing.T) *Logger {
+	t.Helper()
+	l := NewLogger(t.TempDir())
+	t.Cleanup(func() { _ = l.Close(context.Background()) })
+	return l
+}
+
+func TestLoggerPanicsInCaller(t *testing.T) {
+	l := newTestLogger(t)
+	ring := NewRingBufferSink(10)
+	l.AddSink(ring)
+
+	recovered := func() (recovered any) {
+		defer func() { recovered = recover() }()
+		l.Log(DefaultField().WithLevel(Panic).WithMessage("boom"))
+		return nil
+	}()
+	if recovered != "boom" {
+		t.Fatalf("recovered %v, want boom", recovered)
+	}
+
+	// panic 之前日志已经写入输出目标，写入协程仍然可以继续写入
+	if entries := ring.Entries(); len(entries) != 1 || entries[0].Level != Panic {
+		t.Fatalf("ring contains %v before the panic, want the panic entry", entries)
+	}
+	l.Log(DefaultField().WithLevel(Info).WithMessage("after"))
+	if closeErr := l.Close(context.Background()); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+}
+
+func TestLoggerFileModes(t *testing.T) {
+	dir := t.TempDir()
+	sink, newErr := NewRotatingFileSink(dir, "mode", Retention{})
+	if newErr != nil {
+		t.Fatalf("new sink: %v", newErr)
+	}
+	defer func() { _ = sink.Close() }()
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "mode_*.log"))
+	if len(matches) != 1 {
+		t.Fatalf("found %v, want a single log file", matches)
+	}
+	if info, statErr := os.Stat(matches[0]); statErr != nil {
+		t.Fatalf("stat: %v", statErr)
+	} else if info.Mode().Perm()&0o111 != 0 {
+		t.Errorf("log file mode %v should not be executable", info.Mode().Perm())
+	}
+}
+
+func TestSetSinksKeepsSinksOnError(t *testing.T) {
+	valid, invalid := newTestLogger(t), newTestLogger(t)
+	before := valid.Sinks()
+
+	setErr := SetSinks(nil, map[string][]SinkSpec{
+		valid.outputDir:   {{Type: "ring"}},
+		invalid.outputDir: {{Type: "ring"}, {Type: "unknown"}},
+	})
+	if setErr == nil {
+		t.Fatal("SetSinks should fail with an unknown sink type")
+	}
+
+	// 创建失败时所有的日志对象都保持原来的输出目标，配置也恢复为原来的配置
+	after := valid.Sinks()
+	if len(after) != len(before) {
+		t.Fatalf("valid logger has %d sinks after a failed SetSinks, want %d", len(after), len(before))
+	}
+	for i := range before {
+		if after[i] != before[i] {
+			t.Errorf("sink %d was replaced by a failed SetSinks", i)
+		}
+	}
+	if specs := sinkSpecsFor(valid.outputDir); len(specs) != len(defaultSinkSpecs) {
+		t.Errorf("specs %v were not restored after a failed SetSinks", specs)
+	}
+}
@@ -0,0 +1,127 @@
+package log
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Options 日志对象的最低级别和输出格式，零值表示写入所有级别并使用输出目标自身的格式
+type Options struct {
+	MinLevel LoggerLevel  // 最低级别，低于最低级别的日志在进入缓冲区前被丢弃
+	Format   LoggerFormat // 输出格式，应用到支持切换格式的所有输出目标上
+}
+
+// LoggerOptions 日志对象当前使用的最低级别和输出格式
+type LoggerOptions struct {
+	Dir     string
+	Options Options
+	Dropped uint64 // 这个目录的日志对象因为缓冲区已满或者已经关闭而丢弃的日志条数
+}
+
+var (
+	optionsMtx     sync.RWMutex
+	defaultOptions Options
+	loggerOptions  = map[string]Options{}
+)
+
+// validate 检查最低级别和输出格式是否可以识别
+func (o Options) validate() error {
+	if o.MinLevel != "" {
+		if _, known := levelRanks[o.MinLevel]; !known {
+			return fmt.Errorf("invalid logger level: %s", o.MinLevel)
+		}
+	}
+	if o.Format != "" {
+		if _, parseErr := ParseFormat(string(o.Format)); parseErr != nil {
+			return parseErr
+		}
+	}
+	return nil
+}
+
+// SetOptions 设置日志对象的最低级别和输出格式，会立即应用到已经创建的日志对象上
+//   - options: 默认的最低级别和输出格式
+//   - overrides: 按照日志输出目录覆盖的最低级别和输出格式，例如 logs/restoration
+func SetOptions(options Options, overrides map[string]Options) error {
+	if validateErr := options.validate(); validateErr != nil {
+		return validateErr
+	}
+	for dir, override := range overrides {
+		if validateErr := override.validate(); validateErr != nil {
+			return fmt.Errorf("logger %s: %w", dir, validateErr)
+		}
+	}
+
+	optionsMtx.Lock()
+	defaultOptions = options
+	loggerOptions = make(map[string]Options, len(overrides))
+	for dir, override := range overrides {
+		loggerOptions[filepath.Clean(dir)] = override
+	}
+	optionsMtx.Unlock()
+
+	for _, l := range loggersSnapshot() {
+		l.setOptions(optionsFor(l.dir()))
+	}
+	return nil
+}
+
+// SetLoggerOptions 在运行时修改指定日志输出目录的最低级别和输出格式，之后在这个目录创建的日志对象也会使用新的配置
+//   - dir: 日志输出目录，例如 logs/restoration
+//   - options: 新的最低级别和输出格式
+func SetLoggerOptions(dir string, options Options) error {
+	if validateErr := options.validate(); validateErr != nil {
+		return validateErr
+	}
+
+	dir = filepath.Clean(dir)
+	var matched []*Logger
+	for _, l := range loggersSnapshot() {
+		if filepath.Clean(l.dir()) == dir {
+			matched = append(matched, l)
+		}
+	}
+	if len(matched) == 0 {
+		return fmt.Errorf("logger not found: %s", dir)
+	}
+
+	optionsMtx.Lock()
+	loggerOptions[dir] = options
+	optionsMtx.Unlock()
+
+	for _, l := range matched {
+		l.setOptions(options)
+	}
+	return nil
+}
+
+// GetLoggerOptions 获取所有已经创建的日志对象当前使用的最低级别和输出格式，按照日志输出目录排序
+func GetLoggerOptions() []LoggerOptions {
+	result := make([]LoggerOptions, 0)
+	seen := map[string]int{}
+	for _, l := range loggersSnapshot() {
+		dir := filepath.Clean(l.dir())
+		if index, exist := seen[dir]; exist {
+			result[index].Dropped += l.Dropped()
+			continue
+		}
+		seen[dir] = len(result)
+		result = append(result, LoggerOptions{Dir: dir, Options: l.Options(), Dropped: l.Dropped()})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Dir < result[j].Dir })
+	return result
+}
+
+// optionsFor 获取日志输出目录对应的最低级别和输出格式
+//   - dir: 日志输出目录
+func optionsFor(dir string) Options {
+	optionsMtx.RLock()
+	defer optionsMtx.RUnlock()
+
+	if options, exist := loggerOptions[filepath.Clean(dir)]; exist {
+		return options
+	}
+	return defaultOptions
+}
@@ -0,0 +1,186 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention 日志文件的切分和保留策略，零值表示不限制
+type Retention struct {
+	MaxAge       time.Duration // 已经切分的日志文件的最长保留时间
+	MaxTotalSize int64         // 同一个前缀的所有日志文件的最大总字节数，超出时从最旧的文件开始删除
+	MaxFileSize  int64         // 单个日志文件的最大字节数，超出时在当天内切分新的文件
+	Compress     bool          // 是否使用 gzip 压缩已经切分的日志文件
+}
+
+var (
+	retentionMtx      sync.RWMutex
+	defaultRetention  Retention
+	loggerRetentions  = map[string]Retention{}
+	registeredLoggers []*Logger
+)
+
+// SetRetention 设置日志文件的保留策略，会立即应用到已经创建的日志对象上
+//   - retention: 默认的保留策略
+//   - overrides: 按照日志输出目录覆盖的保留策略，例如 logs/restoration
+func SetRetention(retention Retention, overrides map[string]Retention) {
+	retentionMtx.Lock()
+	defaultRetention = retention
+	loggerRetentions = make(map[string]Retention, len(overrides))
+	for dir, override := range overrides {
+		loggerRetentions[filepath.Clean(dir)] = override
+	}
+	retentionMtx.Unlock()
+
+	for _, l := range loggersSnapshot() {
+		l.setRetention(retentionFor(l.dir()))
+	}
+}
+
+// retentionFor 获取日志输出目录对应的保留策略
+//   - dir: 日志输出目录
+func retentionFor(dir string) Retention {
+	retentionMtx.RLock()
+	defer retentionMtx.RUnlock()
+
+	if retention, exist := loggerRetentions[filepath.Clean(dir)]; exist {
+		return retention
+	}
+	return defaultRetention
+}
+
+func registerLogger(l *Logger) {
+	retentionMtx.Lock()
+	defer retentionMtx.Unlock()
+	registeredLoggers = append(registeredLoggers, l)
+}
+
+// unregisterLogger 移除已经关闭的日志对象，之后的配置变更不再应用到这个日志对象上
+func unregisterLogger(l *Logger) {
+	retentionMtx.Lock()
+	defer retentionMtx.Unlock()
+	for i, registered := range registeredLoggers {
+		if registered == l {
+			registeredLoggers = append(registeredLoggers[:i], registeredLoggers[i+1:]...)
+			return
+		}
+	}
+}
+
+// loggersSnapshot 获取已经创建的日志对象的副本，用于在不持有锁的情况下更新日志对象
+func loggersSnapshot() []*Logger {
+	retentionMtx.RLock()
+	defer retentionMtx.RUnlock()
+	return append([]*Logger{}, registeredLoggers...)
+}
+
+// isLogFileName 判断文件是否是按天切分的输出目标写入的日志文件
+//   - prefix: 日志文件名的前缀
+//   - name: 文件名
+func isLogFileName(prefix, name string) bool {
+	return strings.HasPrefix(name, prefix+"_") && (strings.HasSuffix(name, ".log") || strings.HasSuffix(name, ".log.gz"))
+}
+
+// compressFile 使用 gzip 压缩日志文件并删除原文件，压缩后的文件保留原文件的修改时间
+//   - path: 需要压缩的日志文件
+func compressFile(path string) (compressed string, err error) {
+	info, statErr := os.Stat(path)
+	if statErr != nil {
+		return "", statErr
+	}
+
+	src, openErr := os.Open(path)
+	if openErr != nil {
+		return "", openErr
+	}
+	defer func() { _ = src.Close() }()
+
+	compressed = path + ".gz"
+	dst, createErr := os.OpenFile(compressed, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if createErr != nil {
+		return "", createErr
+	}
+
+	writer := gzip.NewWriter(dst)
+	if _, copyErr := io.Copy(writer, src); copyErr != nil {
+		_ = dst.Close()
+		_ = os.Remove(compressed)
+		return "", copyErr
+	} else if closeWriterErr := writer.Close(); closeWriterErr != nil {
+		_ = dst.Close()
+		_ = os.Remove(compressed)
+		return "", closeWriterErr
+	} else if closeFileErr := dst.Close(); closeFileErr != nil {
+		_ = os.Remove(compressed)
+		return "", closeFileErr
+	}
+
+	_ = os.Chtimes(compressed, info.ModTime(), info.ModTime())
+	return compressed, os.Remove(path)
+}
+
+// maintain 压缩已经切分的日志文件，并按照保留时间和总大小清理旧的日志文件，正在写入的文件不会被处理
+func (s *RotatingFileSink) maintain() {
+	s.maintainMtx.Lock()
+	defer s.maintainMtx.Unlock()
+
+	s.rwMtx.RLock()
+	retention := s.retention
+	active := s.writer.file.Name()
+	total := s.writer.size
+	s.rwMtx.RUnlock()
+
+	entries, readDirErr := os.ReadDir(s.dir)
+	if readDirErr != nil {
+		return
+	}
+
+	type logFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	files := make([]logFile, 0, len(entries))
+	for _, entry := range entries {
+		path := filepath.Join(s.dir, entry.Name())
+		if entry.IsDir() || !isLogFileName(s.prefix, entry.Name()) || path == active {
+			continue
+		}
+
+		if retention.Compress && strings.HasSuffix(path, ".log") {
+			if compressed, compressErr := compressFile(path); compressErr == nil {
+				path = compressed
+			}
+		}
+		if info, statErr := os.Stat(path); statErr == nil {
+			files = append(files, logFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	now := time.Now()
+	kept := files[:0]
+	for _, file := range files {
+		if retention.MaxAge > 0 && now.Sub(file.modTime) > retention.MaxAge {
+			_ = os.Remove(file.path)
+			continue
+		}
+		kept = append(kept, file)
+		total += file.size
+	}
+
+	if retention.MaxTotalSize <= 0 {
+		return
+	}
+	for i := 0; i < len(kept) && total > retention.MaxTotalSize; i++ {
+		if removeErr := os.Remove(kept[i].path); removeErr == nil {
+			total -= kept[i].size
+		}
+	}
+}
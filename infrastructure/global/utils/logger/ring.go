@@ -0,0 +1,55 @@
+package log
+
+import "sync"
+
+const defaultRingSize = 1000
+
+// RingBufferSink 在内存中保留最近的日志，超出容量时覆盖最旧的日志，用于调试和在管理接口中查看最近的日志
+type RingBufferSink struct {
+	mtx     sync.RWMutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+// NewRingBufferSink 创建在内存中保留最近日志的输出目标
+//   - size: 保留的日志条数，不大于 0 时为 1000
+func NewRingBufferSink(size int) *RingBufferSink {
+	if size <= 0 {
+		size = defaultRingSize
+	}
+	return &RingBufferSink{entries: make([]Entry, size)}
+}
+
+func (s *RingBufferSink) Write(entry Entry) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.entries[s.next] = entry
+	s.next = (s.next + 1) % len(s.entries)
+	if s.next == 0 {
+		s.full = true
+	}
+	return nil
+}
+
+// Entries 获取保留的日志，按照写入的顺序从旧到新排列
+func (s *RingBufferSink) Entries() []Entry {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.full {
+		return append([]Entry{}, s.entries[:s.next]...)
+	}
+	return append(append(make([]Entry, 0, len(s.entries)), s.entries[s.next:]...), s.entries[:s.next]...)
+}
+
+// Close 清空保留的日志
+func (s *RingBufferSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.entries = make([]Entry, len(s.entries))
+	s.next, s.full = 0, false
+	return nil
+}
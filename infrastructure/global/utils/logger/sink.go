@@ -0,0 +1,198 @@
+package log
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry 写入输出目标的一条日志
+type Entry struct {
+	Time    time.Time
+	Level   LoggerLevel
+	Message string
+	Fields  map[string]any // 日志字段，包含 caller_type, function, filepath, extra 和 trace_id
+}
+
+// Sink 日志的输出目标，同一个日志对象的输出目标只会在写入协程中被调用，不需要处理并发写入
+type Sink interface {
+	// Write 写入一条日志
+	//   - entry: 日志
+	Write(entry Entry) error
+
+	// Close 关闭输出目标，关闭后不会再被调用
+	Close() error
+}
+
+// retentionSink 需要应用日志保留策略的输出目标
+type retentionSink interface {
+	setRetention(retention Retention)
+}
+
+// formatSink 可以切换输出格式的输出目标，调用时持有日志对象的写锁，不会和 Write 同时调用
+type formatSink interface {
+	setFormat(format LoggerFormat)
+}
+
+// levelRanks 日志级别的高低，无法识别的级别视为 info
+var levelRanks = map[LoggerLevel]int{Debug: 0, Info: 1, Warn: 2, Error: 3, Panic: 4}
+
+func levelRank(level LoggerLevel) int {
+	if rank, exist := levelRanks[level]; exist {
+		return rank
+	}
+	return levelRanks[Info]
+}
+
+// leveledSink 只写入不低于最低级别的日志
+type leveledSink struct {
+	Sink
+	minLevel LoggerLevel
+}
+
+// WithMinLevel 为输出目标设置最低级别，低于最低级别的日志不会写入
+//   - sink: 输出目标
+//   - minLevel: 最低级别
+func WithMinLevel(sink Sink, minLevel LoggerLevel) Sink {
+	return &leveledSink{Sink: sink, minLevel: minLevel}
+}
+
+func (s *leveledSink) Write(entry Entry) error {
+	if levelRank(entry.Level) < levelRank(s.minLevel) {
+		return nil
+	}
+	return s.Sink.Write(entry)
+}
+
+func (s *leveledSink) setRetention(retention Retention) {
+	if inner, isRetentionSink := s.Sink.(retentionSink); isRetentionSink {
+		inner.setRetention(retention)
+	}
+}
+
+func (s *leveledSink) setFormat(format LoggerFormat) {
+	if inner, isFormatSink := s.Sink.(formatSink); isFormatSink {
+		inner.setFormat(format)
+	}
+}
+
+// SinkSpec 通过配置创建输出目标的参数，为零值的字段使用默认值
+type SinkSpec struct {
+	Type     string       // 支持 console, file, rotating 和 ring
+	MinLevel LoggerLevel  // 最低级别，为空时写入所有级别
+	Format   LoggerFormat // 输出格式，日志对象设置了输出格式时以日志对象为准，为空时 console 使用 text，其他使用 json
+	Output   string       // console 的输出，支持 stdout 和 stderr，默认为 stdout
+	NoColor  bool         // console 不使用颜色
+	Path     string       // file 的文件路径，相对路径基于日志输出目录
+	Prefix   string       // rotating 的文件名前缀，文件写入日志输出目录，默认为 stdout
+	Size     int          // ring 保留的日志条数，默认为 1000
+}
+
+// newSinkFromSpec 根据配置为日志对象创建输出目标
+//   - dir: 日志对象的输出目录
+//   - spec: 输出目标的配置
+func newSinkFromSpec(dir string, spec SinkSpec) (sink Sink, err error) {
+	switch strings.ToLower(spec.Type) {
+	case "console":
+		sink = NewConsoleSink(spec.Output, !spec.NoColor)
+	case "file":
+		path := spec.Path
+		if path == "" {
+			return nil, fmt.Errorf("file sink has no path")
+		} else if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if sink, err = NewFileSink(path); err != nil {
+			return nil, err
+		}
+	case "rotating":
+		if sink, err = NewRotatingFileSink(dir, spec.Prefix, retentionFor(dir)); err != nil {
+			return nil, err
+		}
+	case "ring":
+		sink = NewRingBufferSink(spec.Size)
+	default:
+		return nil, fmt.Errorf("unsupported sink type: %s", spec.Type)
+	}
+
+	if spec.Format != "" {
+		if _, parseErr := ParseFormat(string(spec.Format)); parseErr != nil {
+			_ = sink.Close()
+			return nil, parseErr
+		}
+	}
+	if spec.MinLevel != "" {
+		if _, known := levelRanks[spec.MinLevel]; !known {
+			_ = sink.Close()
+			return nil, fmt.Errorf("invalid sink level: %s", spec.MinLevel)
+		}
+		sink = WithMinLevel(sink, spec.MinLevel)
+	}
+	return sink, nil
+}
+
+// defaultSinkSpecs 没有配置输出目标时使用的输出目标，所有日志写入 stdout 文件，error 和 panic 级别同时写入 stderr 文件
+var defaultSinkSpecs = []SinkSpec{
+	{Type: "rotating", Prefix: "stdout"},
+	{Type: "rotating", Prefix: "stderr", MinLevel: Error},
+}
+
+var (
+	sinkMtx      sync.RWMutex
+	defaultSinks []SinkSpec
+	loggerSinks  = map[string][]SinkSpec{}
+)
+
+// SetSinks 设置通过配置创建的输出目标，会立即替换已经创建的日志对象上通过配置创建的输出目标，通过 AddSink 添加的输出目标不受影响
+//
+// 先为所有的日志对象创建新的输出目标，任意一个创建失败时恢复原来的配置并返回错误，所有的日志对象都保持原来的输出目标
+//   - defaults: 默认的输出目标，为空时使用日志输出目录下的 stdout 和 stderr 文件
+//   - overrides: 按照日志输出目录覆盖的输出目标，例如 logs/restoration
+func SetSinks(defaults []SinkSpec, overrides map[string][]SinkSpec) error {
+	sinkMtx.Lock()
+	previousDefaults, previousOverrides := defaultSinks, loggerSinks
+	defaultSinks = defaults
+	loggerSinks = make(map[string][]SinkSpec, len(overrides))
+	for dir, specs := range overrides {
+		loggerSinks[filepath.Clean(dir)] = specs
+	}
+	sinkMtx.Unlock()
+
+	loggers := loggersSnapshot()
+	specs, created := make([][]SinkSpec, len(loggers)), make([][]Sink, len(loggers))
+	for i, l := range loggers {
+		specs[i] = sinkSpecsFor(l.dir())
+		if sinks, createErr := l.createSinks(specs[i]); createErr != nil {
+			for _, sinks := range created[:i] {
+				closeSinks(sinks)
+			}
+			sinkMtx.Lock()
+			defaultSinks, loggerSinks = previousDefaults, previousOverrides
+			sinkMtx.Unlock()
+			return createErr
+		} else {
+			created[i] = sinks
+		}
+	}
+
+	for i, l := range loggers {
+		l.replaceSinks(specs[i], created[i])
+	}
+	return nil
+}
+
+// sinkSpecsFor 获取日志输出目录对应的输出目标配置
+//   - dir: 日志输出目录
+func sinkSpecsFor(dir string) []SinkSpec {
+	sinkMtx.RLock()
+	defer sinkMtx.RUnlock()
+
+	if specs, exist := loggerSinks[filepath.Clean(dir)]; exist {
+		return specs
+	} else if len(defaultSinks) > 0 {
+		return defaultSinks
+	}
+	return defaultSinkSpecs
+}
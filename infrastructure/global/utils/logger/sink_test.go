@@ -0,0 +1,145 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestEntry(level LoggerLevel, message string) Entry {
+	return Entry{
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC),
+		Level:   level,
+		Message: message,
+		Fields:  map[string]any{"trace_id": "trace", "function": "main.handle"},
+	}
+}
+
+func TestConsoleSink(t *testing.T) {
+	cases := []struct {
+		name   string
+		color  bool
+		format LoggerFormat
+		want   string
+	}{
+		{name: "text", format: Text, want: "2024-01-02 03:04:05.006 WARN  disk full function=main.handle trace_id=trace\n"},
+		{name: "colored text", color: true, format: Text, want: "2024-01-02 03:04:05.006 \x1b[33mWARN \x1b[0m disk full function=main.handle trace_id=trace\n"},
+		{name: "default format", want: "2024-01-02 03:04:05.006 WARN  disk full function=main.handle trace_id=trace\n"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			sink := &ConsoleSink{output: output, color: c.color}
+			sink.setFormat(c.format)
+			if writeErr := sink.Write(newTestEntry(Warn, "disk full")); writeErr != nil {
+				t.Fatalf("write: %v", writeErr)
+			}
+			if output.String() != c.want {
+				t.Errorf("wrote %q, want %q", output.String(), c.want)
+			}
+		})
+	}
+
+	// 切换为 json 时不使用颜色
+	output := &bytes.Buffer{}
+	sink := &ConsoleSink{output: output, color: true}
+	sink.setFormat(JSON)
+	_ = sink.Write(newTestEntry(Error, "disk full"))
+	var decoded map[string]any
+	if decodeErr := json.Unmarshal(output.Bytes(), &decoded); decodeErr != nil {
+		t.Fatalf("json output %q: %v", output.String(), decodeErr)
+	} else if decoded["level"] != "error" || decoded["msg"] != "disk full" || decoded["trace_id"] != "trace" {
+		t.Errorf("json output %v", decoded)
+	}
+}
+
+func TestNewConsoleSink(t *testing.T) {
+	if sink := NewConsoleSink("stderr", false); sink.output == nil || sink.format != Text {
+		t.Errorf("stderr sink writes to %v in %s", sink.output, sink.format)
+	}
+	if stdout, stderr := NewConsoleSink("", true), NewConsoleSink("stderr", true); stdout.output == stderr.output {
+		t.Error("stdout and stderr sinks write to the same output")
+	}
+}
+
+func ringMessages(sink *RingBufferSink) (messages []string) {
+	for _, entry := range sink.Entries() {
+		messages = append(messages, entry.Message)
+	}
+	return messages
+}
+
+func TestRingBufferSink(t *testing.T) {
+	sink := NewRingBufferSink(3)
+	if messages := ringMessages(sink); len(messages) != 0 {
+		t.Errorf("empty ring contains %v", messages)
+	}
+
+	for i, want := range [][]string{{"0"}, {"0", "1"}, {"0", "1", "2"}, {"1", "2", "3"}, {"2", "3", "4"}} {
+		_ = sink.Write(newTestEntry(Info, strconv.Itoa(i)))
+		if messages := ringMessages(sink); !reflect.DeepEqual(messages, want) {
+			t.Errorf("after %d writes the ring contains %v, want %v", i+1, messages, want)
+		}
+	}
+
+	// 返回的日志是副本，不受之后写入的影响
+	entries := sink.Entries()
+	_ = sink.Write(newTestEntry(Info, "5"))
+	if entries[0].Message != "2" {
+		t.Errorf("entries changed to %v after a write", entries)
+	}
+
+	if closeErr := sink.Close(); closeErr != nil {
+		t.Fatalf("close: %v", closeErr)
+	}
+	if messages := ringMessages(sink); len(messages) != 0 {
+		t.Errorf("closed ring contains %v", messages)
+	}
+	if size := len(NewRingBufferSink(0).entries); size != defaultRingSize {
+		t.Errorf("default ring size %d, want %d", size, defaultRingSize)
+	}
+}
+
+func TestWithMinLevel(t *testing.T) {
+	ring := NewRingBufferSink(10)
+	sink := WithMinLevel(ring, Warn)
+	for _, level := range []LoggerLevel{Debug, Info, Warn, Error, Panic, "unknown"} {
+		_ = sink.Write(newTestEntry(level, string(level)))
+	}
+	if messages := ringMessages(ring); !reflect.DeepEqual(messages, []string{"warn", "error", "panic"}) {
+		t.Errorf("wrote %v, want the levels from warn", messages)
+	}
+}
+
+func TestNewSinkFromSpec(t *testing.T) {
+	cases := []struct {
+		name   string
+		spec   SinkSpec
+		failed bool
+	}{
+		{name: "console", spec: SinkSpec{Type: "Console", Output: "stderr"}},
+		{name: "ring with level", spec: SinkSpec{Type: "ring", Size: 5, MinLevel: Error}},
+		{name: "file", spec: SinkSpec{Type: "file", Path: "app.log", Format: Logfmt}},
+		{name: "rotating", spec: SinkSpec{Type: "rotating", Prefix: "app"}},
+		{name: "file without path", spec: SinkSpec{Type: "file"}, failed: true},
+		{name: "unknown type", spec: SinkSpec{Type: "kafka"}, failed: true},
+		{name: "unknown format", spec: SinkSpec{Type: "ring", Format: "xml"}, failed: true},
+		{name: "unknown level", spec: SinkSpec{Type: "ring", MinLevel: "fatal"}, failed: true},
+	}
+
+	dir := t.TempDir()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sink, newErr := newSinkFromSpec(dir, c.spec)
+			if failed := newErr != nil; failed != c.failed {
+				t.Fatalf("failed %v, want %v: %v", failed, c.failed, newErr)
+			} else if sink != nil {
+				_ = sink.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const DefaultMask = "******"
+
+// Rule 脱敏规则
+type Rule struct {
+	// Keys 需要脱敏的字段名，在任意层级匹配，不区分大小写，如 password
+	Keys []string
+	// Paths 需要脱敏的字段路径，使用 . 分隔，* 匹配一层任意字段，** 匹配任意多层字段，数组不占用层级，如 *.token
+	Paths []string
+	// Patterns 需要脱敏的字符串内容，使用正则表达式匹配，匹配到的部分会被替换为 Mask
+	Patterns []string
+	// Mask 替换敏感内容使用的字符串，默认为 DefaultMask
+	Mask string
+}
+
+// DefaultRule 默认的脱敏规则，覆盖密码、密钥、令牌、邮箱和手机号
+func DefaultRule() Rule {
+	return Rule{
+		Keys: []string{
+			"password", "passwd", "new_password", "old_password",
+			"app_secret", "secret", "access_token", "refresh_token", "authorization",
+		},
+		Paths: []string{"*.token"},
+		Patterns: []string{
+			`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`,
+			`\+86[\- ]?1[3-9]\d{9}\b`,
+			`\b1[3-9]\d{9}\b`,
+		},
+		Mask: DefaultMask,
+	}
+}
+
+// Merge 合并两个脱敏规则，other 的 Mask 不为空时覆盖当前的 Mask
+//   - other: 需要合并的规则
+func (r Rule) Merge(other Rule) Rule {
+	merged := Rule{
+		Keys:     append(append([]string{}, r.Keys...), other.Keys...),
+		Paths:    append(append([]string{}, r.Paths...), other.Paths...),
+		Patterns: append(append([]string{}, r.Patterns...), other.Patterns...),
+		Mask:     r.Mask,
+	}
+	if other.Mask != "" {
+		merged.Mask = other.Mask
+	}
+	return merged
+}
+
+// Redactor 脱敏引擎，创建后只读，可以并发使用
+type Redactor struct {
+	keys     map[string]bool
+	paths    [][]string
+	patterns []*regexp.Regexp
+	mask     string
+}
+
+// New 根据脱敏规则创建脱敏引擎
+//   - rule: 脱敏规则，正则表达式无法编译时返回错误
+func New(rule Rule) (r *Redactor, err error) {
+	r = &Redactor{keys: map[string]bool{}, mask: rule.Mask}
+	if r.mask == "" {
+		r.mask = DefaultMask
+	}
+
+	for _, key := range rule.Keys {
+		r.keys[strings.ToLower(key)] = true
+	}
+	for _, path := range rule.Paths {
+		if path != "" {
+			r.paths = append(r.paths, strings.Split(strings.ToLower(path), "."))
+		}
+	}
+	for _, pattern := range rule.Patterns {
+		if compiled, compileErr := regexp.Compile(pattern); compileErr != nil {
+			return nil, fmt.Errorf("compile redaction pattern %q error: %w", pattern, compileErr)
+		} else {
+			r.patterns = append(r.patterns, compiled)
+		}
+	}
+	return r, nil
+}
+
+// Default 使用默认脱敏规则创建的脱敏引擎
+func Default() *Redactor {
+	r, _ := New(DefaultRule())
+	return r
+}
+
+// Redact 对解析后的 json 数据脱敏，返回新的数据，不会修改原数据
+//   - value: 使用 encoding/json 解析得到的数据
+func (r *Redactor) Redact(value any) any {
+	if r == nil {
+		return value
+	}
+	return r.redact(value, nil)
+}
+
+// RedactJSON 对 json 数据脱敏，无法解析为 json 时按照字符串匹配正则表达式
+//   - data: json 数据
+func (r *Redactor) RedactJSON(data []byte) []byte {
+	if r == nil || len(data) == 0 {
+		return data
+	}
+
+	var value any
+	if unmarshalErr := json.Unmarshal(data, &value); unmarshalErr != nil {
+		return []byte(r.redactString(string(data)))
+	} else if redacted, marshalErr := json.Marshal(r.redact(value, nil)); marshalErr != nil {
+		return data
+	} else {
+		return redacted
+	}
+}
+
+// RedactString 按照正则表达式对字符串脱敏，如错误消息
+//   - value: 需要脱敏的字符串
+func (r *Redactor) RedactString(value string) string {
+	if r == nil {
+		return value
+	}
+	return r.redactString(value)
+}
+
+func (r *Redactor) redact(value any, path []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		redacted := make(map[string]any, len(v))
+		for key, field := range v {
+			fieldPath := append(path[:len(path):len(path)], strings.ToLower(key))
+			if r.matchKey(fieldPath) {
+				redacted[key] = r.mask
+			} else {
+				redacted[key] = r.redact(field, fieldPath)
+			}
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, item := range v {
+			redacted[i] = r.redact(item, path)
+		}
+		return redacted
+	case string:
+		return r.redactString(v)
+	default:
+		return value
+	}
+}
+
+// matchKey 判断字段是否命中字段名或者字段路径规则
+//   - path: 字段的完整路径，已经转换为小写
+func (r *Redactor) matchKey(path []string) bool {
+	if r.keys[path[len(path)-1]] {
+		return true
+	}
+	for _, pattern := range r.paths {
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) redactString(value string) string {
+	for _, pattern := range r.patterns {
+		value = pattern.ReplaceAllString(value, r.mask)
+	}
+	return value
+}
+
+// matchPath 判断字段路径是否匹配路径规则，* 匹配一层，** 匹配任意多层（包括零层）
+//   - pattern: 路径规则
+//   - path: 字段路径
+func matchPath(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPath(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 || (pattern[0] != "*" && pattern[0] != path[0]) {
+		return false
+	}
+	return matchPath(pattern[1:], path[1:])
+}
@@ -0,0 +1,102 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "token", path: "token", want: true},
+		{pattern: "token", path: "user.token", want: false},
+		{pattern: "*.token", path: "user.token", want: true},
+		{pattern: "*.token", path: "token", want: false},
+		{pattern: "*.token", path: "data.user.token", want: false},
+		{pattern: "user.*", path: "user.token", want: true},
+		{pattern: "user.*", path: "user", want: false},
+		{pattern: "**.token", path: "token", want: true},
+		{pattern: "**.token", path: "data.user.token", want: true},
+		{pattern: "data.**.token", path: "data.token", want: true},
+		{pattern: "data.**.token", path: "data.a.b.token", want: true},
+		{pattern: "data.**.token", path: "other.a.token", want: false},
+		{pattern: "**", path: "any.path", want: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.pattern+" "+c.path, func(t *testing.T) {
+			if matched := matchPath(strings.Split(c.pattern, "."), strings.Split(c.path, ".")); matched != c.want {
+				t.Errorf("matchPath(%s, %s) = %v, want %v", c.pattern, c.path, matched, c.want)
+			}
+		})
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  Rule
+		input string
+		want  string
+	}{
+		{
+			name:  "key in any level",
+			rule:  Rule{Keys: []string{"password"}},
+			input: `{"user":{"name":"alice","PassWord":"123"}}`,
+			want:  `{"user":{"PassWord":"******","name":"alice"}}`,
+		},
+		{
+			name:  "path one level deep",
+			rule:  Rule{Paths: []string{"*.token"}},
+			input: `{"token":"a","session":{"token":"b"},"data":{"user":{"token":"c"}}}`,
+			want:  `{"data":{"user":{"token":"c"}},"session":{"token":"******"},"token":"a"}`,
+		},
+		{
+			name:  "arrays do not count as a level",
+			rule:  Rule{Paths: []string{"*.token"}},
+			input: `{"sessions":[{"token":"a"},{"token":"b"}]}`,
+			want:  `{"sessions":[{"token":"******"},{"token":"******"}]}`,
+		},
+		{
+			name:  "pattern in string values",
+			rule:  Rule{Patterns: []string{`\b1[3-9]\d{9}\b`}, Mask: "#"},
+			input: `{"message":"call 13800138000 now","count":1}`,
+			want:  `{"count":1,"message":"call # now"}`,
+		},
+		{
+			name:  "not json",
+			rule:  Rule{Patterns: []string{`\b1[3-9]\d{9}\b`}},
+			input: `phone=13800138000`,
+			want:  `phone=******`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, newErr := New(c.rule)
+			if newErr != nil {
+				t.Fatalf("new redactor: %v", newErr)
+			}
+			if redacted := string(r.RedactJSON([]byte(c.input))); redacted != c.want {
+				t.Errorf("RedactJSON(%s) = %s, want %s", c.input, redacted, c.want)
+			}
+		})
+	}
+}
+
+func TestDefaultRule(t *testing.T) {
+	input := `{"username":"alice","password":"123","app_secret":"s","auth":{"token":"t"},"email":"alice@example.com","phone":"+86 13800138000"}`
+	want := `{"app_secret":"******","auth":{"token":"******"},"email":"******","password":"******","phone":"******","username":"alice"}`
+	if redacted := string(Default().RedactJSON([]byte(input))); redacted != want {
+		t.Errorf("default redaction = %s, want %s", redacted, want)
+	}
+}
+
+func TestInvalidPattern(t *testing.T) {
+	if _, newErr := New(Rule{Patterns: []string{"("}}); newErr == nil {
+		t.Error("invalid pattern should return an error")
+	}
+}
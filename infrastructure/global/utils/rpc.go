@@ -2,11 +2,15 @@ package utils
 
 import (
 	"context"
+	"crypto/subtle"
 	"net"
 	"strings"
 
 	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 
 	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
 )
@@ -35,14 +39,16 @@ func GetContextClientIP(ctx context.Context) (ip string, err error) {
 	}
 }
 
-// GetTraceID 获取上下文中的trace_id
+// GetTraceID 获取上下文中的trace_id，兼容使用字符串作为键的上下文，如 gin.Context
 func GetTraceID(ctx context.Context) (traceID string, err error) {
 	if ctx == nil {
 		return "", errors.NewInvalidTraceIDError()
-	} else if id, convertTraceIDSuccess := ctx.Value("trace_id").(string); !convertTraceIDSuccess {
-		return "", errors.NewInvalidTraceIDError()
-	} else {
+	} else if id, convertTraceIDSuccess := ctx.Value(traceIDKey).(string); convertTraceIDSuccess && id != "" {
 		return id, nil
+	} else if id, convertTraceIDSuccess = ctx.Value(string(traceIDKey)).(string); convertTraceIDSuccess && id != "" {
+		return id, nil
+	} else {
+		return "", errors.NewInvalidTraceIDError()
 	}
 }
 
@@ -56,3 +62,32 @@ func AddTraceID(ctx context.Context) (newCtx context.Context) {
 		return ctx
 	}
 }
+
+// SetTraceID 使用指定的trace_id覆盖上下文中的trace_id，用于传递上游的trace_id，traceID为空时不修改
+func SetTraceID(ctx context.Context, traceID string) (newCtx context.Context) {
+	if traceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceIDKey, traceID)
+}
+
+// CheckAdminToken 校验 grpc 请求 metadata 中的管理接口令牌，与 http 管理接口一样使用 authorization: Bearer <token> 传递，
+// 没有配置令牌时返回 PermissionDenied 拒绝所有请求，令牌不正确时返回 Unauthenticated
+//   - ctx: grpc 请求的上下文
+//   - token: 管理接口的令牌
+func CheckAdminToken(ctx context.Context, token string) (err error) {
+	if token == "" {
+		return status.Error(codes.PermissionDenied, "admin token is not configured")
+	}
+
+	provided := ""
+	if md, exist := metadata.FromIncomingContext(ctx); exist {
+		if values := md.Get("authorization"); len(values) > 0 && strings.HasPrefix(values[0], "Bearer ") {
+			provided = strings.TrimSpace(strings.TrimPrefix(values[0], "Bearer "))
+		}
+	}
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid admin token")
+	}
+	return nil
+}
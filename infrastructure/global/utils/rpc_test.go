@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckAdminToken(t *testing.T) {
+	withAuthorization := func(authorization string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", authorization))
+	}
+	cases := []struct {
+		name  string
+		ctx   context.Context
+		token string
+		code  codes.Code
+	}{
+		{name: "valid token", ctx: withAuthorization("Bearer secret"), token: "secret", code: codes.OK},
+		{name: "token not configured", ctx: withAuthorization("Bearer "), token: "", code: codes.PermissionDenied},
+		{name: "wrong token", ctx: withAuthorization("Bearer wrong"), token: "secret", code: codes.Unauthenticated},
+		{name: "missing bearer prefix", ctx: withAuthorization("secret"), token: "secret", code: codes.Unauthenticated},
+		{name: "missing metadata", ctx: context.Background(), token: "secret", code: codes.Unauthenticated},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if code := status.Code(CheckAdminToken(c.ctx, c.token)); code != c.code {
+				t.Errorf("CheckAdminToken returned %v, want %v", code, c.code)
+			}
+		})
+	}
+}
@@ -1,7 +1,12 @@
 package config
 
 type GlobalConfig struct {
-	Database DatabaseConfig `json:"database" yaml:"database"`
-	Grpc     GrpcConfig     `json:"grpc" yaml:"grpc"`
-	Http     HttpConfig     `json:"http" yaml:"http"`
+	Database    DatabaseConfig    `json:"database" yaml:"database"`
+	Grpc        GrpcConfig        `json:"grpc" yaml:"grpc"`
+	Http        HttpConfig        `json:"http" yaml:"http"`
+	Stellar     StellarConfig     `json:"stellar" yaml:"stellar"`
+	Restoration RestorationConfig `json:"restoration" yaml:"restoration"`
+	Logger      LoggerConfig      `json:"logger" yaml:"logger"`
+	Smtp        SmtpConfig        `json:"smtp" yaml:"smtp"`
+	Lifecycle   LifecycleConfig   `json:"lifecycle" yaml:"lifecycle"`
 }
@@ -1,7 +1,9 @@
 package config
 
 type HttpConfig struct {
-	ListenIP       string `json:"listen_ip" yaml:"listen_ip"`
-	ListenPort     int    `json:"listen_port" yaml:"listen_port"`
-	TimeoutSeconds int    `json:"timeout" yaml:"timeout_seconds"`
+	ListenIP       string   `json:"listen_ip" yaml:"listen_ip"`
+	ListenPort     int      `json:"listen_port" yaml:"listen_port"`
+	TimeoutSeconds int      `json:"timeout" yaml:"timeout_seconds"`
+	AdminToken     string   `json:"admin_token" yaml:"admin_token"`         // 管理接口的令牌，请求需要携带 Authorization: Bearer <admin_token>，为空时所有的管理接口都返回 403
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"` // 信任的反向代理地址或者网段，只有来自这些地址的请求才会使用 X-Forwarded-For 获取调用方 IP，为空时不信任任何代理
 }
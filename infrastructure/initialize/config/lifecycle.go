@@ -0,0 +1,5 @@
+package config
+
+type LifecycleConfig struct {
+	HookTimeoutSeconds int `json:"hook_timeout_seconds" yaml:"hook_timeout_seconds"` // 单个组件启动或者停止的最长时间，默认为 10
+}
@@ -0,0 +1,36 @@
+package config
+
+type LoggerConfig struct {
+	Level       string                           `json:"level" yaml:"level"`             // 最低级别，支持 debug, info, warn, error 和 panic，为空时写入所有级别
+	Format      string                           `json:"format" yaml:"format"`           // 输出格式，支持 json, logfmt 和 text，为空时使用输出目标自身的格式
+	Outputs     map[string]LoggerOutputConfig    `json:"outputs" yaml:"outputs"`         // 按照日志输出目录覆盖的最低级别和输出格式
+	BufferSize  int                              `json:"buffer_size" yaml:"buffer_size"` // 每个日志对象缓冲区可以容纳的日志条数，默认为 100
+	Overflow    string                           `json:"overflow" yaml:"overflow"`       // 缓冲区已满时的策略，支持 block 和 drop，默认为 block
+	Retention   LoggerRetentionConfig            `json:"retention" yaml:"retention"`
+	Loggers     map[string]LoggerRetentionConfig `json:"loggers" yaml:"loggers"`           // 按照日志输出目录覆盖的保留策略
+	Sinks       []LoggerSinkConfig               `json:"sinks" yaml:"sinks"`               // 默认的输出目标，为空时输出到日志目录下的 stdout 和 stderr 文件
+	LoggerSinks map[string][]LoggerSinkConfig    `json:"logger_sinks" yaml:"logger_sinks"` // 按照日志输出目录覆盖的输出目标
+}
+
+type LoggerOutputConfig struct {
+	Level  string `json:"level" yaml:"level"`   // 最低级别，为空时写入所有级别
+	Format string `json:"format" yaml:"format"` // 输出格式，为空时使用输出目标自身的格式
+}
+
+type LoggerRetentionConfig struct {
+	MaxAgeDays     int  `json:"max_age_days" yaml:"max_age_days"`
+	MaxTotalSizeMB int  `json:"max_total_size_mb" yaml:"max_total_size_mb"`
+	MaxFileSizeMB  int  `json:"max_file_size_mb" yaml:"max_file_size_mb"`
+	Compress       bool `json:"compress" yaml:"compress"`
+}
+
+type LoggerSinkConfig struct {
+	Type     string `json:"type" yaml:"type"`           // 支持 console, file, rotating 和 ring
+	MinLevel string `json:"min_level" yaml:"min_level"` // 最低级别，为空时写入所有级别
+	Format   string `json:"format" yaml:"format"`       // 输出格式，支持 json, logfmt 和 text，为空时 console 使用 text，其他使用 json
+	Output   string `json:"output" yaml:"output"`       // console 的输出，支持 stdout 和 stderr，默认为 stdout
+	NoColor  bool   `json:"no_color" yaml:"no_color"`   // console 不使用颜色
+	Path     string `json:"path" yaml:"path"`           // file 的文件路径，相对路径基于日志输出目录
+	Prefix   string `json:"prefix" yaml:"prefix"`       // rotating 的文件名前缀，默认为 stdout
+	Size     int    `json:"size" yaml:"size"`           // ring 保留的日志条数，默认为 1000
+}
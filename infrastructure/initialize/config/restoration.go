@@ -0,0 +1,106 @@
+package config
+
+type RestorationConfig struct {
+	Logger     string                               `json:"logger" yaml:"logger"`
+	Storage    string                               `json:"storage" yaml:"storage"`
+	StorageDir string                               `json:"storage_dir" yaml:"storage_dir"`
+	MaxIndexed int                                  `json:"max_indexed" yaml:"max_indexed"` // file 存储后端在内存中索引的最大日志条数，超过时最早的日志不再能被查询，默认为 1000000
+	DedupFile  string                               `json:"dedup_file" yaml:"dedup_file"`   // 停止时保存最近接收过的日志 ID，启动时读取，为空时只保存在内存中
+	Redaction  RestorationRedactionConfig           `json:"redaction" yaml:"redaction"`
+	Alert      RestorationAlertConfig               `json:"alert" yaml:"alert"`
+	RateLimit  RestorationRateLimitConfig           `json:"rate_limit" yaml:"rate_limit"`
+	Auth       RestorationAuthConfig                `json:"auth" yaml:"auth"`
+	Sampling   map[string]RestorationSamplingConfig `json:"sampling" yaml:"sampling"` // 按照 caller_service 下发给日志收集器的级别和采样配置
+	Syslog     RestorationSyslogConfig              `json:"syslog" yaml:"syslog"`
+	Metrics    RestorationMetricsConfig             `json:"metrics" yaml:"metrics"`
+}
+
+type RestorationRedactionConfig struct {
+	Disable  bool     `json:"disable" yaml:"disable"`
+	Keys     []string `json:"keys" yaml:"keys"`         // 在默认规则之外需要脱敏的字段名
+	Paths    []string `json:"paths" yaml:"paths"`       // 在默认规则之外需要脱敏的字段路径
+	Patterns []string `json:"patterns" yaml:"patterns"` // 在默认规则之外需要脱敏的正则表达式
+	Mask     string   `json:"mask" yaml:"mask"`
+}
+
+type RestorationAlertConfig struct {
+	RulesFile             string                           `json:"rules_file" yaml:"rules_file"`                           // 不为空时从文件中加载 rules 和 notifiers，文件变化时自动重新加载
+	ReloadIntervalSeconds int                              `json:"reload_interval_seconds" yaml:"reload_interval_seconds"` // 检查规则文件变化的间隔，默认为 30
+	Rules                 []RestorationAlertRuleConfig     `json:"rules" yaml:"rules"`
+	Notifiers             []RestorationAlertNotifierConfig `json:"notifiers" yaml:"notifiers"`
+}
+
+type RestorationAlertRuleConfig struct {
+	Name            string   `json:"name" yaml:"name"`
+	Service         string   `json:"service" yaml:"service"`                   // 为空时匹配所有服务，每个服务单独计数
+	Level           string   `json:"level" yaml:"level"`                       // 匹配不低于该级别的日志，为空时匹配所有级别
+	MessagePattern  string   `json:"message_pattern" yaml:"message_pattern"`   // 匹配日志消息的正则表达式，为空时匹配所有消息
+	Threshold       int      `json:"threshold" yaml:"threshold"`               // 时间窗口内匹配的日志数量达到该值时触发，默认为 1
+	WindowSeconds   int      `json:"window_seconds" yaml:"window_seconds"`     // 统计的时间窗口，默认为 60
+	CooldownSeconds int      `json:"cooldown_seconds" yaml:"cooldown_seconds"` // 触发后的冷却时间，冷却期间不会重复通知，默认为 300
+	Notifiers       []string `json:"notifiers" yaml:"notifiers"`               // 使用的通知渠道名称
+}
+
+type RestorationAlertNotifierConfig struct {
+	Name    string            `json:"name" yaml:"name"`
+	Type    string            `json:"type" yaml:"type"`       // 支持 webhook, smtp 和 log
+	URL     string            `json:"url" yaml:"url"`         // webhook 的地址
+	Headers map[string]string `json:"headers" yaml:"headers"` // webhook 请求附带的请求头
+	To      []string          `json:"to" yaml:"to"`           // smtp 的收件人，使用全局的 smtp 配置发送
+	Logger  string            `json:"logger" yaml:"logger"`   // log 的输出目录，默认为 logs/alert
+}
+
+type RestorationRateLimitConfig struct {
+	Service  RestorationQuotaConfig            `json:"service" yaml:"service"`   // 每个 caller_service 的默认限额
+	IP       RestorationQuotaConfig            `json:"ip" yaml:"ip"`             // 每个调用方 IP 的限额
+	Services map[string]RestorationQuotaConfig `json:"services" yaml:"services"` // 按照 caller_service 覆盖的限额
+}
+
+type RestorationQuotaConfig struct {
+	Rate  float64 `json:"rate" yaml:"rate"`   // 每秒允许接收的日志条数，为 0 时不限制
+	Burst int     `json:"burst" yaml:"burst"` // 允许的突发日志条数，默认与 rate 相同
+}
+
+type RestorationAuthConfig struct {
+	AllowAnonymous  bool                     `json:"allow_anonymous" yaml:"allow_anonymous"`   // 允许没有凭据的外部请求，此时使用客户端声明的 caller_service
+	ApplicationKeys bool                     `json:"application_keys" yaml:"application_keys"` // 允许使用 starward 管理的应用密钥，身份为应用名称
+	Tokens          []RestorationTokenConfig `json:"tokens" yaml:"tokens"`
+}
+
+type RestorationTokenConfig struct {
+	Token   string `json:"token" yaml:"token"`
+	Service string `json:"service" yaml:"service"` // 使用该令牌的日志的 caller_service，不能为空，为空时忽略这个令牌
+}
+
+type RestorationSamplingConfig struct {
+	MinLevel        string             `json:"min_level" yaml:"min_level"`
+	Rates           map[string]float64 `json:"rates" yaml:"rates"` // 按照级别的采样率，取值范围为 [0, 1]
+	TraceConsistent bool               `json:"trace_consistent" yaml:"trace_consistent"`
+}
+
+type RestorationSyslogConfig struct {
+	UDP            string `json:"udp" yaml:"udp"`                           // UDP 监听地址，如 0.0.0.0:514，为空时不监听
+	TCP            string `json:"tcp" yaml:"tcp"`                           // TCP 监听地址，支持按照长度和按照换行分隔的消息，为空时不监听
+	ServiceFrom    string `json:"service_from" yaml:"service_from"`         // caller_service 的来源，支持 app_name, hostname 和 hostname/app_name，默认为 app_name
+	MaxMessageSize int    `json:"max_message_size" yaml:"max_message_size"` // 单条消息的最大字节数，默认为 65536
+	MaxConnections int    `json:"max_connections" yaml:"max_connections"`   // TCP 的最大连接数，达到上限时关闭新的连接，默认为 1024
+}
+
+type RestorationMetricsConfig struct {
+	Disable           bool                          `json:"disable" yaml:"disable"`                       // 不统计日志产生的指标，也不提供 RestorationStats
+	ResolutionSeconds int                           `json:"resolution_seconds" yaml:"resolution_seconds"` // RestorationStats 统计的最小时间粒度，默认为 60
+	RetentionHours    int                           `json:"retention_hours" yaml:"retention_hours"`       // RestorationStats 保留的时长，默认为 24
+	Rules             []RestorationMetricRuleConfig `json:"rules" yaml:"rules"`
+}
+
+type RestorationMetricRuleConfig struct {
+	Name           string    `json:"name" yaml:"name"`                       // 指标名称，只能包含字母、数字和下划线，导出为 alioth_restoration_<name>
+	Type           string    `json:"type" yaml:"type"`                       // 支持 counter 和 histogram
+	Help           string    `json:"help" yaml:"help"`                       // 指标的说明
+	Service        string    `json:"service" yaml:"service"`                 // 为空时匹配所有服务
+	Level          string    `json:"level" yaml:"level"`                     // 匹配不低于该级别的日志，为空时匹配所有级别
+	MessagePattern string    `json:"message_pattern" yaml:"message_pattern"` // 匹配日志消息的正则表达式，为空时匹配所有消息
+	Field          string    `json:"field" yaml:"field"`                     // histogram 统计的 payload_fields 中的数值字段，使用 . 分隔嵌套的字段，如 result.cost_ms
+	Labels         []string  `json:"labels" yaml:"labels"`                   // 指标的标签，支持 service 和 level，默认为 service，called_function 由调用方决定，不能作为标签
+	Buckets        []float64 `json:"buckets" yaml:"buckets"`                 // histogram 的分桶，默认为 prometheus 的默认分桶
+}
@@ -0,0 +1,10 @@
+package config
+
+type SmtpConfig struct {
+	Host        string `json:"host" yaml:"host"`
+	Port        int    `json:"port" yaml:"port"`
+	Username    string `json:"username" yaml:"username"`
+	Password    string `json:"password" yaml:"password"`
+	From        string `json:"from" yaml:"from"`
+	ImplicitTLS bool   `json:"implicit_tls" yaml:"implicit_tls"` // 使用 465 端口的隐式 TLS，否则在服务器支持时使用 STARTTLS
+}
@@ -0,0 +1,6 @@
+package config
+
+type StellarConfig struct {
+	Storage string `json:"storage" yaml:"storage"`
+	Logger  string `json:"logger" yaml:"logger"`
+}
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"studio.sunist.work/platform/alioth-center/infrastructure/global/errors"
 	"studio.sunist.work/platform/alioth-center/infrastructure/global/utils/logger"
@@ -39,5 +41,81 @@ func init() {
 		panicErr := errors.NewReadConfigFileInitializeError(configFile, unmarshalConfigErr)
 		logger.Log(log.DefaultField().WithCaller(log.Internal).WithLevel(log.Panic).
 			WithMessage("failed to unmarshal config file").WithExtra(panicErr))
+	} else {
+		applyLoggerConfig(globalConf.Logger)
+	}
+}
+
+// applyLoggerConfig 将配置文件中的日志保留策略、输出目标、最低级别、输出格式和缓冲区应用到所有的日志对象上
+//   - conf: 日志配置
+func applyLoggerConfig(conf config.LoggerConfig) {
+	toRetention := func(c config.LoggerRetentionConfig) log.Retention {
+		return log.Retention{
+			MaxAge:       time.Duration(c.MaxAgeDays) * 24 * time.Hour,
+			MaxTotalSize: int64(c.MaxTotalSizeMB) << 20,
+			MaxFileSize:  int64(c.MaxFileSizeMB) << 20,
+			Compress:     c.Compress,
+		}
+	}
+
+	overrides := make(map[string]log.Retention, len(conf.Loggers))
+	for dir, retention := range conf.Loggers {
+		overrides[dir] = toRetention(retention)
+	}
+	log.SetRetention(toRetention(conf.Retention), overrides)
+
+	// 无法识别的级别和格式原样保留，由日志包校验并报告错误
+	toLevel := func(level string) log.LoggerLevel {
+		if parsed, parseErr := log.ParseLevel(level); parseErr == nil {
+			return parsed
+		}
+		return log.LoggerLevel(level)
+	}
+	toFormat := func(format string) log.LoggerFormat {
+		if parsed, parseErr := log.ParseFormat(format); parseErr == nil {
+			return parsed
+		}
+		return log.LoggerFormat(format)
+	}
+
+	toSinkSpecs := func(c []config.LoggerSinkConfig) []log.SinkSpec {
+		specs := make([]log.SinkSpec, len(c))
+		for i, sink := range c {
+			specs[i] = log.SinkSpec{
+				Type:     sink.Type,
+				MinLevel: toLevel(sink.MinLevel),
+				Format:   toFormat(sink.Format),
+				Output:   sink.Output,
+				NoColor:  sink.NoColor,
+				Path:     sink.Path,
+				Prefix:   sink.Prefix,
+				Size:     sink.Size,
+			}
+		}
+		return specs
+	}
+
+	sinkOverrides := make(map[string][]log.SinkSpec, len(conf.LoggerSinks))
+	for dir, sinks := range conf.LoggerSinks {
+		sinkOverrides[dir] = toSinkSpecs(sinks)
+	}
+	if setSinksErr := log.SetSinks(toSinkSpecs(conf.Sinks), sinkOverrides); setSinksErr != nil {
+		logger.Log(log.DefaultField().WithCaller(log.Internal).WithLevel(log.Panic).
+			WithMessage("failed to apply logger sinks").WithExtra(setSinksErr.Error()))
+	}
+
+	optionOverrides := make(map[string]log.Options, len(conf.Outputs))
+	for dir, output := range conf.Outputs {
+		optionOverrides[dir] = log.Options{MinLevel: toLevel(output.Level), Format: toFormat(output.Format)}
+	}
+	defaultOptions := log.Options{MinLevel: toLevel(conf.Level), Format: toFormat(conf.Format)}
+	if setOptionsErr := log.SetOptions(defaultOptions, optionOverrides); setOptionsErr != nil {
+		logger.Log(log.DefaultField().WithCaller(log.Internal).WithLevel(log.Panic).
+			WithMessage("failed to apply logger options").WithExtra(setOptionsErr.Error()))
+	}
+
+	if setBufferErr := log.SetBuffer(log.Buffer{Size: conf.BufferSize, Overflow: log.OverflowPolicy(strings.ToLower(conf.Overflow))}); setBufferErr != nil {
+		logger.Log(log.DefaultField().WithCaller(log.Internal).WithLevel(log.Panic).
+			WithMessage("failed to apply logger buffer").WithExtra(setBufferErr.Error()))
 	}
 }
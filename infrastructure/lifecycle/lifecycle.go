@@ -0,0 +1,215 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultHookTimeout 钩子没有设置超时时间时，单个钩子启动或者停止的最长时间
+const DefaultHookTimeout = 10 * time.Second
+
+// Hook 生命周期钩子，启动时按照添加顺序执行 OnStart，停止时按照相反的顺序执行 OnStop，
+// 因此依赖其他组件的钩子需要在被依赖的组件之后添加，例如日志对象最先添加，最后停止
+type Hook struct {
+	Name    string                          // 钩子的名称，用于错误信息
+	OnStart func(ctx context.Context) error // 启动组件，为空时跳过，不能阻塞到组件退出
+	OnStop  func(ctx context.Context) error // 停止组件，为空时跳过，需要在 ctx 结束时尽快返回
+	Timeout time.Duration                   // 启动和停止的最长时间，为 0 时使用管理器的默认超时时间
+}
+
+// Manager 管理进程的启动和退出，按照顺序执行钩子，监听退出信号，并接收组件运行中出现的致命错误
+type Manager struct {
+	mtx        sync.Mutex
+	timeout    time.Duration
+	hooks      []Hook
+	started    int
+	running    bool
+	stopOnce   sync.Once
+	stopErr    error
+	failed     chan error
+	signalOnce sync.Once
+	signals    chan os.Signal
+}
+
+// NewManager 创建生命周期管理器
+func NewManager() *Manager {
+	return &Manager{timeout: DefaultHookTimeout, failed: make(chan error, 1)}
+}
+
+// SetDefaultTimeout 设置没有设置超时时间的钩子启动或者停止的最长时间
+//   - timeout: 默认的超时时间，不大于 0 时为 DefaultHookTimeout
+func (m *Manager) SetDefaultTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	m.mtx.Lock()
+	m.timeout = timeout
+	m.mtx.Unlock()
+}
+
+// hookTimeout 获取钩子的超时时间
+//   - hook: 钩子
+func (m *Manager) hookTimeout(hook Hook) time.Duration {
+	if hook.Timeout > 0 {
+		return hook.Timeout
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.timeout
+}
+
+// Append 添加钩子，启动之后添加的钩子视为已经启动，不会执行 OnStart，但是会在停止时执行 OnStop
+//   - hooks: 需要添加的钩子
+func (m *Manager) Append(hooks ...Hook) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.hooks = append(m.hooks, hooks...)
+	if m.running {
+		m.started = len(m.hooks)
+	}
+}
+
+// Prepend 在所有钩子之前添加钩子，添加的钩子最先启动、最后停止，用于日志对象这样被所有组件依赖的钩子，
+// 包初始化时通过 Append 添加的钩子也会在这些钩子之前停止，启动之后添加的钩子视为已经启动
+//   - hooks: 需要添加的钩子
+func (m *Manager) Prepend(hooks ...Hook) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.hooks = append(append(make([]Hook, 0, len(hooks)+len(m.hooks)), hooks...), m.hooks...)
+	if m.running {
+		m.started += len(hooks)
+	}
+}
+
+// Start 按照添加顺序启动所有的钩子，任意一个钩子启动失败时按照相反的顺序停止已经启动的钩子并返回错误，
+// 启动前开始监听退出信号，启动过程中收到的信号会在 Wait 时返回
+//   - ctx: 启动的上下文，同时受到每个钩子自身超时时间的限制
+func (m *Manager) Start(ctx context.Context) error {
+	m.mtx.Lock()
+	if m.running {
+		m.mtx.Unlock()
+		return fmt.Errorf("lifecycle already started")
+	}
+	m.running = true
+	m.mtx.Unlock()
+	m.notifySignals()
+
+	for {
+		m.mtx.Lock()
+		if m.started >= len(m.hooks) {
+			m.mtx.Unlock()
+			return nil
+		}
+		hook := m.hooks[m.started]
+		m.mtx.Unlock()
+
+		if startErr := run(ctx, m.hookTimeout(hook), hook.OnStart); startErr != nil {
+			return errors.Join(fmt.Errorf("failed to start %s: %w", hook.Name, startErr), m.Stop(context.Background()))
+		}
+
+		m.mtx.Lock()
+		m.started++
+		m.mtx.Unlock()
+	}
+}
+
+// Stop 按照添加顺序的相反顺序停止已经启动的钩子，一个钩子停止失败时继续停止剩余的钩子，重复调用会返回第一次停止的结果
+//   - ctx: 停止的上下文，每个钩子同时受到自身超时时间的限制，通常使用 context.Background()，ctx 结束后剩余的钩子会立即超时
+func (m *Manager) Stop(ctx context.Context) error {
+	m.stopOnce.Do(func() {
+		m.mtx.Lock()
+		hooks := append([]Hook{}, m.hooks[:m.started]...)
+		m.started = 0
+		m.mtx.Unlock()
+
+		var stopErrs []error
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if stopErr := run(ctx, m.hookTimeout(hooks[i]), hooks[i].OnStop); stopErr != nil {
+				stopErrs = append(stopErrs, fmt.Errorf("failed to stop %s: %w", hooks[i].Name, stopErr))
+			}
+		}
+		m.stopErr = errors.Join(stopErrs...)
+	})
+	return m.stopErr
+}
+
+// Fail 报告组件运行中出现的致命错误，例如服务器意外退出，Wait 会返回第一个错误
+//   - err: 致命错误
+func (m *Manager) Fail(err error) {
+	select {
+	case m.failed <- err:
+	default:
+	}
+}
+
+// notifySignals 开始监听 SIGTERM, SIGINT 和 SIGQUIT 信号，只在启动时监听，避免影响不启动服务器的子命令
+func (m *Manager) notifySignals() {
+	m.signalOnce.Do(func() {
+		m.signals = make(chan os.Signal, 1)
+		signal.Notify(m.signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	})
+}
+
+// Wait 阻塞直到收到 SIGTERM, SIGINT 或者 SIGQUIT 信号，或者有组件报告了致命错误
+func (m *Manager) Wait() (sig os.Signal, err error) {
+	m.notifySignals()
+
+	select {
+	case sig = <-m.signals:
+		return sig, nil
+	case err = <-m.failed:
+		return nil, err
+	}
+}
+
+// run 在钩子的超时时间内执行钩子函数，超时后不再等待钩子函数返回
+//   - ctx: 上下文
+//   - timeout: 钩子的超时时间
+//   - function: 钩子的 OnStart 或者 OnStop
+func run(ctx context.Context, timeout time.Duration, function func(ctx context.Context) error) error {
+	if function == nil {
+		return nil
+	}
+
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- function(hookCtx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-hookCtx.Done():
+		return hookCtx.Err()
+	}
+}
+
+var defaultManager = NewManager()
+
+// Default 获取进程默认的生命周期管理器，由 main 负责启动和停止
+func Default() *Manager {
+	return defaultManager
+}
+
+// Append 向默认的生命周期管理器添加钩子
+//   - hooks: 需要添加的钩子
+func Append(hooks ...Hook) {
+	defaultManager.Append(hooks...)
+}
+
+// Prepend 在默认的生命周期管理器的所有钩子之前添加钩子，添加的钩子最后停止
+//   - hooks: 需要添加的钩子
+func Prepend(hooks ...Hook) {
+	defaultManager.Prepend(hooks...)
+}
@@ -0,0 +1,246 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
+)
+
+// recorder 按照执行顺序记录钩子的启动和停止
+type recorder struct {
+	mtx   sync.Mutex
+	calls []string
+}
+
+func (r *recorder) hook(name string, startErr, stopErr error) Hook {
+	return Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			r.record("start " + name)
+			return startErr
+		},
+		OnStop: func(ctx context.Context) error {
+			r.record("stop " + name)
+			return stopErr
+		},
+	}
+}
+
+func (r *recorder) record(call string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) result() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]string{}, r.calls...)
+}
+
+func TestManagerOrder(t *testing.T) {
+	startErr, stopErr := errors.New("start failed"), errors.New("stop failed")
+	cases := []struct {
+		name     string
+		hooks    func(r *recorder) []Hook
+		startErr error
+		stopErr  error
+		calls    []string
+	}{
+		{
+			name: "start in order and stop in reverse order",
+			hooks: func(r *recorder) []Hook {
+				return []Hook{r.hook("a", nil, nil), r.hook("b", nil, nil), r.hook("c", nil, nil)}
+			},
+			calls: []string{"start a", "start b", "start c", "stop c", "stop b", "stop a"},
+		},
+		{
+			name: "failed start stops started hooks",
+			hooks: func(r *recorder) []Hook {
+				return []Hook{r.hook("a", nil, nil), r.hook("b", nil, nil), r.hook("c", startErr, nil), r.hook("d", nil, nil)}
+			},
+			startErr: startErr,
+			calls:    []string{"start a", "start b", "start c", "stop b", "stop a"},
+		},
+		{
+			name: "failed stop continues with remaining hooks",
+			hooks: func(r *recorder) []Hook {
+				return []Hook{r.hook("a", nil, nil), r.hook("b", nil, stopErr), r.hook("c", nil, nil)}
+			},
+			stopErr: stopErr,
+			calls:   []string{"start a", "start b", "start c", "stop c", "stop b", "stop a"},
+		},
+		{
+			name: "hooks without functions are skipped",
+			hooks: func(r *recorder) []Hook {
+				return []Hook{r.hook("a", nil, nil), {Name: "empty"}, r.hook("b", nil, nil)}
+			},
+			calls: []string{"start a", "start b", "stop b", "stop a"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &recorder{}
+			m := NewManager()
+			m.Append(c.hooks(r)...)
+
+			if err := m.Start(context.Background()); !errors.Is(err, c.startErr) || (err == nil) != (c.startErr == nil) {
+				t.Fatalf("start returned %v, want %v", err, c.startErr)
+			}
+			if c.startErr == nil {
+				if err := m.Stop(context.Background()); !errors.Is(err, c.stopErr) || (err == nil) != (c.stopErr == nil) {
+					t.Fatalf("stop returned %v, want %v", err, c.stopErr)
+				}
+			}
+			if calls := r.result(); !reflect.DeepEqual(calls, c.calls) {
+				t.Errorf("calls %v, want %v", calls, c.calls)
+			}
+		})
+	}
+}
+
+func TestManagerStopOnce(t *testing.T) {
+	r := &recorder{}
+	m := NewManager()
+	m.Append(r.hook("a", nil, errors.New("stop failed")))
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := m.Start(context.Background()); err == nil {
+		t.Error("starting twice should fail")
+	}
+
+	first, second := m.Stop(context.Background()), m.Stop(context.Background())
+	if first == nil || first != second {
+		t.Errorf("stop returned %v and %v, want the same error", first, second)
+	}
+	if calls := r.result(); !reflect.DeepEqual(calls, []string{"start a", "stop a"}) {
+		t.Errorf("calls %v, want each hook started and stopped once", calls)
+	}
+}
+
+func TestManagerAppendAfterStart(t *testing.T) {
+	r := &recorder{}
+	m := NewManager()
+	m.Append(r.hook("a", nil, nil))
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	// 启动之后添加的钩子视为已经启动，只会在停止时执行
+	m.Append(r.hook("b", nil, nil))
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if calls := r.result(); !reflect.DeepEqual(calls, []string{"start a", "stop b", "stop a"}) {
+		t.Errorf("calls %v, want the late hook stopped but not started", calls)
+	}
+}
+
+func TestManagerPrepend(t *testing.T) {
+	r := &recorder{}
+	m := NewManager()
+	m.Append(r.hook("a", nil, nil))
+	m.Prepend(r.hook("first", nil, nil))
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	// 启动之后在最前面添加的钩子同样视为已经启动，并且最后停止
+	m.Prepend(r.hook("late", nil, nil))
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	want := []string{"start first", "start a", "stop a", "stop first", "stop late"}
+	if calls := r.result(); !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls %v, want %v", calls, want)
+	}
+}
+
+// messageSink 记录写入的日志内容，关闭之后仍然保留
+type messageSink struct {
+	mtx      sync.Mutex
+	messages []string
+}
+
+func (s *messageSink) Write(entry log.Entry) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.messages = append(s.messages, entry.Message)
+	return nil
+}
+
+func (s *messageSink) Close() error { return nil }
+
+func (s *messageSink) result() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]string{}, s.messages...)
+}
+
+func TestManagerLoggerStopsLast(t *testing.T) {
+	logger, sink := log.NewLogger(t.TempDir()), &messageSink{}
+	logger.AddSink(sink)
+
+	// 组件的钩子在日志对象之前添加，和包初始化时添加钩子的顺序相同
+	m := NewManager()
+	m.Append(Hook{Name: "component", OnStop: func(ctx context.Context) error {
+		logger.Log(log.DefaultField().WithLevel(log.Info).WithMessage("component stopped"))
+		return nil
+	}})
+	m.Prepend(Hook{Name: "logger", OnStop: logger.Close})
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if messages := sink.result(); !reflect.DeepEqual(messages, []string{"component stopped"}) {
+		t.Errorf("wrote %v, want the log written while the component stopped", messages)
+	}
+	if dropped := logger.Dropped(); dropped != 0 {
+		t.Errorf("dropped %d records, want 0", dropped)
+	}
+}
+
+func TestManagerHookTimeout(t *testing.T) {
+	r := &recorder{}
+	m := NewManager()
+	m.Append(
+		r.hook("a", nil, nil),
+		Hook{Name: "slow", Timeout: 20 * time.Millisecond, OnStart: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(time.Second)
+			return nil
+		}},
+	)
+
+	startedAt := time.Now()
+	if err := m.Start(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("start returned %v, want a deadline exceeded error", err)
+	}
+	if elapsed := time.Since(startedAt); elapsed > 500*time.Millisecond {
+		t.Errorf("start waited %v for a hook that timed out", elapsed)
+	}
+	if calls := r.result(); !reflect.DeepEqual(calls, []string{"start a", "stop a"}) {
+		t.Errorf("calls %v, want the started hook stopped after the timeout", calls)
+	}
+}
+
+func TestManagerFail(t *testing.T) {
+	m := NewManager()
+	failure := errors.New("server exited")
+	m.Fail(failure)
+	m.Fail(errors.New("ignored"))
+
+	if sig, err := m.Wait(); sig != nil || err != failure {
+		t.Errorf("wait returned %v, %v, want the first failure", sig, err)
+	}
+}
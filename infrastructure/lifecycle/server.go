@@ -0,0 +1,77 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+)
+
+// GrpcServerHook 创建启动和优雅停止 grpc 服务器的钩子，启动时先监听地址，监听失败时启动失败，
+// 停止时等待正在处理的请求完成，超时后强制停止
+//   - m: 接收服务器意外退出错误的生命周期管理器
+//   - server: grpc 服务器
+//   - addr: 监听的地址，如 127.0.0.1:50051
+func GrpcServerHook(m *Manager, server *grpc.Server, addr string) Hook {
+	return Hook{
+		Name: "grpc server",
+		OnStart: func(ctx context.Context) error {
+			listener, listenErr := (&net.ListenConfig{}).Listen(ctx, "tcp", addr)
+			if listenErr != nil {
+				return listenErr
+			}
+			go func() {
+				if serveErr := server.Serve(listener); serveErr != nil {
+					m.Fail(serveErr)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			stopped := make(chan struct{})
+			go func() {
+				server.GracefulStop()
+				close(stopped)
+			}()
+
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				server.Stop()
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+// HttpServerHook 创建启动和优雅停止 http 服务器的钩子，启动时先监听 server.Addr，监听失败时启动失败，
+// 停止时等待正在处理的请求完成，超时后强制关闭所有连接
+//   - m: 接收服务器意外退出错误的生命周期管理器
+//   - server: http 服务器
+func HttpServerHook(m *Manager, server *http.Server) Hook {
+	return Hook{
+		Name: "http server",
+		OnStart: func(ctx context.Context) error {
+			listener, listenErr := (&net.ListenConfig{}).Listen(ctx, "tcp", server.Addr)
+			if listenErr != nil {
+				return listenErr
+			}
+			go func() {
+				if serveErr := server.Serve(listener); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+					m.Fail(serveErr)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			if shutdownErr := server.Shutdown(ctx); shutdownErr != nil {
+				_ = server.Close()
+				return shutdownErr
+			}
+			return nil
+		},
+	}
+}
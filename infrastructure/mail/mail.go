@@ -0,0 +1,131 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize"
+	"studio.sunist.work/platform/alioth-center/infrastructure/initialize/config"
+)
+
+var errSmtpNotConfigured = errors.New("smtp is not configured")
+
+// Sender 邮件发送器，各个模块共用全局配置中的 smtp 设置
+type Sender struct {
+	conf config.SmtpConfig
+}
+
+// NewSender 创建一个邮件发送器
+//   - conf: smtp 配置
+func NewSender(conf config.SmtpConfig) *Sender {
+	return &Sender{conf: conf}
+}
+
+// DefaultSender 使用全局配置创建的邮件发送器
+func DefaultSender() *Sender {
+	return NewSender(initialize.GlobalConfig().Smtp)
+}
+
+// Configured 判断是否配置了 smtp 服务器
+func (s *Sender) Configured() bool {
+	return s.conf.Host != "" && s.conf.From != ""
+}
+
+// Send 发送邮件
+//   - to: 收件人
+//   - subject: 邮件主题
+//   - contentType: 邮件正文类型，如 text/plain 或者 text/html
+//   - body: 邮件正文
+func (s *Sender) Send(to []string, subject, contentType, body string) error {
+	if !s.Configured() {
+		return errSmtpNotConfigured
+	} else if len(to) == 0 {
+		return errors.New("no mail recipient")
+	}
+
+	port := s.conf.Port
+	if port == 0 {
+		port = 25
+		if s.conf.ImplicitTLS {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(s.conf.Host, strconv.Itoa(port))
+
+	var conn net.Conn
+	var dialErr error
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if s.conf.ImplicitTLS {
+		conn, dialErr = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: s.conf.Host})
+	} else {
+		conn, dialErr = dialer.Dial("tcp", addr)
+	}
+	if dialErr != nil {
+		return fmt.Errorf("dial smtp server error: %w", dialErr)
+	}
+	_ = conn.SetDeadline(time.Now().Add(time.Minute))
+
+	client, newClientErr := smtp.NewClient(conn, s.conf.Host)
+	if newClientErr != nil {
+		_ = conn.Close()
+		return fmt.Errorf("create smtp client error: %w", newClientErr)
+	}
+	defer func() { _ = client.Close() }()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !s.conf.ImplicitTLS {
+		if startTLSErr := client.StartTLS(&tls.Config{ServerName: s.conf.Host}); startTLSErr != nil {
+			return fmt.Errorf("smtp starttls error: %w", startTLSErr)
+		}
+	}
+	if ok, _ := client.Extension("AUTH"); ok && s.conf.Username != "" {
+		if authErr := client.Auth(smtp.PlainAuth("", s.conf.Username, s.conf.Password, s.conf.Host)); authErr != nil {
+			return fmt.Errorf("smtp auth error: %w", authErr)
+		}
+	}
+
+	if mailErr := client.Mail(s.conf.From); mailErr != nil {
+		return fmt.Errorf("smtp mail from error: %w", mailErr)
+	}
+	for _, recipient := range to {
+		if rcptErr := client.Rcpt(recipient); rcptErr != nil {
+			return fmt.Errorf("smtp rcpt %s error: %w", recipient, rcptErr)
+		}
+	}
+
+	writer, dataErr := client.Data()
+	if dataErr != nil {
+		return fmt.Errorf("smtp data error: %w", dataErr)
+	}
+	if _, writeErr := writer.Write(buildMessage(s.conf.From, to, subject, contentType, body)); writeErr != nil {
+		_ = writer.Close()
+		return fmt.Errorf("write smtp message error: %w", writeErr)
+	} else if closeErr := writer.Close(); closeErr != nil {
+		return fmt.Errorf("smtp send message error: %w", closeErr)
+	}
+	return client.Quit()
+}
+
+func buildMessage(from string, to []string, subject, contentType, body string) []byte {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+
+	message := bytes.Buffer{}
+	message.WriteString("From: " + from + "\r\n")
+	message.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	message.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	message.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: " + contentType + "; charset=UTF-8\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return message.Bytes()
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registry *prometheus.Registry
+
+func init() {
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Registry 获取全局的 prometheus 注册表
+func Registry() *prometheus.Registry {
+	return registry
+}
+
+// MustRegister 向全局的 prometheus 注册表注册指标，重复注册会 panic
+//   - cs: 需要注册的指标
+func MustRegister(cs ...prometheus.Collector) {
+	registry.MustRegister(cs...)
+}
+
+// Handler 获取全局 prometheus 注册表的 http 处理器，用于暴露 /metrics 接口
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
@@ -1,73 +1,104 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"net"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
 
 	"studio.sunist.work/platform/alioth-center/core/restoration"
 	"studio.sunist.work/platform/alioth-center/core/stellar"
 	"studio.sunist.work/platform/alioth-center/infrastructure/database"
 	"studio.sunist.work/platform/alioth-center/infrastructure/initialize"
+	"studio.sunist.work/platform/alioth-center/infrastructure/lifecycle"
+	"studio.sunist.work/platform/alioth-center/infrastructure/metrics"
 	log "studio.sunist.work/platform/alioth-center/infrastructure/utils/logger"
 )
 
 func main() {
+	// 执行子命令，如 stellar migrate
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	// 初始化数据库
 	database.SyncDatabase()
 
 	// 初始化rpc和http服务器
 	logger := log.DefaultLogger()
-	lis, err := net.Listen("tcp",
-		fmt.Sprintf("%s:%d", initialize.GlobalConfig().Grpc.ListenIP, initialize.GlobalConfig().Grpc.ListenPort))
-	if err != nil {
-		panic(err)
-	}
+	manager := lifecycle.Default()
+	manager.SetDefaultTimeout(time.Duration(initialize.GlobalConfig().Lifecycle.HookTimeoutSeconds) * time.Second)
 	s := grpc.NewServer()
 	engine := gin.Default()
 	engine.Use(gin.Recovery())
+	// gin 默认信任所有代理，调用方可以通过 X-Forwarded-For 伪造 IP 绕过按照 IP 的限流
+	if err := engine.SetTrustedProxies(initialize.GlobalConfig().Http.TrustedProxies); err != nil {
+		panic(err)
+	}
+	engine.GET("/metrics", gin.WrapH(metrics.Handler()))
+	metrics.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "alioth_logger_dropped_total",
+		Help: "Number of log records dropped because the logger buffer was full or the logger was closed.",
+	}, func() float64 {
+		dropped := uint64(0)
+		for _, l := range log.GetLoggerOptions() {
+			dropped += l.Dropped
+		}
+		return float64(dropped)
+	}))
 	external := engine.Group("/external")
+	admin := engine.Group("/admin")
+	initAdminHttpServer(admin, initialize.GlobalConfig().Http.AdminToken)
+
+	// 停止时按照添加顺序的相反顺序执行：卸载 stellar 注册，关闭 http 和 grpc 服务器，关闭 syslog 监听器，
+	// 再停止包初始化时添加的组件，日志对象添加在最前面，在所有组件停止之后写入剩余的日志
+	manager.Prepend(lifecycle.Hook{Name: "loggers", OnStop: log.CloseAll})
 
 	// 注册rpc和http服务器
 	restoration.InitRestorationRpcServer(s)
 	restoration.InitRestorationHttpServer(external)
+	restoration.InitRestorationAdminHttpServer(admin)
 	stellar.InitStellarRpcServer(s)
 	stellar.InitStellarHttpServer(external)
+	stellar.InitStellarAdminHttpServer(admin)
+	restoration.InitRestorationSyslogServer()
 
-	// 启动rpc和http服务器
-	rpcExit := startRpcEngine(s, lis)
-	httpExit := startHttpEngine(engine,
-		fmt.Sprintf("%s:%d", initialize.GlobalConfig().Http.ListenIP, initialize.GlobalConfig().Http.ListenPort))
+	// 启动rpc和http服务器，并注册服务到stellar
+	grpcConf, httpConf := initialize.GlobalConfig().Grpc, initialize.GlobalConfig().Http
+	manager.Append(
+		lifecycle.GrpcServerHook(manager, s, fmt.Sprintf("%s:%d", grpcConf.ListenIP, grpcConf.ListenPort)),
+		lifecycle.HttpServerHook(manager, &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", httpConf.ListenIP, httpConf.ListenPort),
+			Handler: engine,
+		}),
+		restoration.StellarRegistrationHook(),
+	)
+	if startErr := manager.Start(context.Background()); startErr != nil {
+		_, _ = fmt.Fprintln(os.Stderr, startErr)
+		os.Exit(1)
+	}
 	logger.Log(log.DefaultField().WithCaller(log.Internal).WithLevel(log.Info).WithMessage("server(s) started"))
 
-	// 注册服务到stellar
-	restoration.RegisterToStellar()
-
-	// 等待rpc和http服务器退出
-	select {
-	case err := <-rpcExit:
-		logger.Log(log.DefaultField().WithCaller(log.Internal).WithLevel(log.Panic).
-			WithMessage("rpc server exit").WithExtra(err.Error()))
-	case err := <-httpExit:
-		logger.Log(log.DefaultField().WithCaller(log.Internal).WithLevel(log.Panic).
-			WithMessage("rpc server exit").WithExtra(err.Error()))
+	// 等待退出信号或者rpc和http服务器意外退出
+	exitCode := 0
+	if sig, serverErr := manager.Wait(); serverErr != nil {
+		exitCode = 1
+		logger.Log(log.DefaultField().WithCaller(log.Internal).WithLevel(log.Error).
+			WithMessage("server exit unexpectedly").WithExtra(serverErr.Error()))
+	} else {
+		logger.Log(log.DefaultField().WithCaller(log.Internal).WithLevel(log.Info).
+			WithMessage("os signal received").WithExtra(sig.String()))
 	}
-}
 
-func startHttpEngine(engine *gin.Engine, addr string) (exitChan chan error) {
-	exit := make(chan error)
-	go func() {
-		exit <- engine.Run(addr)
-	}()
-	return exit
-}
-
-func startRpcEngine(engine *grpc.Server, conn net.Listener) (exitChan chan error) {
-	exit := make(chan error)
-	go func() {
-		exit <- engine.Serve(conn)
-	}()
-	return exit
+	// 日志对象最后停止，停止过程中的错误只能输出到 stderr
+	if stopErr := manager.Stop(context.Background()); stopErr != nil {
+		exitCode = 1
+		_, _ = fmt.Fprintln(os.Stderr, stopErr)
+	}
+	os.Exit(exitCode)
 }